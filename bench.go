@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/devops-works/scan-exporter/scan"
+)
+
+// runBench measures the probe throughput and latency against a target for
+// several numbers of workers and timeouts, and recommends a limit for each
+// timeout.
+// Usage: scan-exporter bench [-target <ip>] [-range <range>] [-workers <n,...>] [-timeouts <d,...>]
+func runBench(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	var target, portRange, workerList, timeoutList string
+	fs.StringVar(&target, "target", "127.0.0.1", "IP address of the probed target")
+	fs.StringVar(&portRange, "range", "1-10000", "range of ports to probe")
+	fs.StringVar(&workerList, "workers", "64,256,1024,2048", "comma-separated numbers of workers")
+	fs.StringVar(&timeoutList, "timeouts", "1s", "comma-separated probe timeouts")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	ports, err := scan.ParsePorts(portRange)
+	if err != nil {
+		return fmt.Errorf("invalid range: %w", err)
+	}
+	if len(ports) == 0 {
+		return errors.New("no ports to probe")
+	}
+	workers, err := benchWorkers(workerList)
+	if err != nil {
+		return err
+	}
+	timeouts, err := benchTimeouts(timeoutList)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "probing %d ports of %s\n\n", len(ports), target)
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WORKERS\tTIMEOUT\tOPEN\tDURATION\tPROBES/S\tP50\tP99\tMAX")
+
+	var recommendations []scan.BenchResult
+	for _, timeout := range timeouts {
+		var results []scan.BenchResult
+		for _, n := range workers {
+			r := scan.Bench(target, ports, n, timeout)
+			results = append(results, r)
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%.0f\t%s\t%s\t%s\n", r.Workers, r.Timeout, r.Open,
+				r.Duration.Round(time.Millisecond), r.Throughput(), r.Percentile(50).Round(time.Microsecond), r.Percentile(99).Round(time.Microsecond),
+				r.Percentile(100).Round(time.Microsecond))
+		}
+		recommendations = append(recommendations, scan.Recommend(results))
+	}
+	w.Flush()
+
+	fmt.Fprintln(stdout)
+	for _, r := range recommendations {
+		fmt.Fprintf(stdout, "recommended limit with a %s timeout: %d (%.0f probes/s, p99 %s)\n",
+			r.Timeout, r.Workers, r.Throughput(), r.Percentile(99).Round(time.Microsecond))
+	}
+	return nil
+}
+
+// benchWorkers parses a comma-separated list of numbers of workers.
+func benchWorkers(list string) ([]int, error) {
+	var workers []int
+	for _, field := range strings.Split(list, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid number of workers %q", field)
+		}
+		workers = append(workers, n)
+	}
+	return workers, nil
+}
+
+// benchTimeouts parses a comma-separated list of timeouts.
+func benchTimeouts(list string) ([]time.Duration, error) {
+	var timeouts []time.Duration
+	for _, field := range strings.Split(list, ",") {
+		d, err := time.ParseDuration(strings.TrimSpace(field))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", field)
+		}
+		timeouts = append(timeouts, d)
+	}
+	return timeouts, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_runBench(t *testing.T) {
+	var out bytes.Buffer
+	args := []string{"-range", "1-50", "-workers", "1,8", "-timeouts", "200ms,1s"}
+	if err := runBench(args, &out); err != nil {
+		t.Fatalf("runBench() error = %v", err)
+	}
+	for _, want := range []string{
+		"probing 50 ports of 127.0.0.1",
+		"recommended limit with a 200ms timeout:",
+		"recommended limit with a 1s timeout:",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("runBench() output does not contain %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := runBench([]string{"-workers", "0"}, &bytes.Buffer{}); err == nil {
+		t.Error("runBench() with 0 workers should fail")
+	}
+}
+
+func Test_benchTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    []time.Duration
+		wantErr bool
+	}{
+		{name: "single", list: "1s", want: []time.Duration{time.Second}},
+		{name: "several", list: "500ms, 2s", want: []time.Duration{500 * time.Millisecond, 2 * time.Second}},
+		{name: "invalid", list: "1s,fast", wantErr: true},
+		{name: "zero", list: "0s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := benchTimeouts(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("benchTimeouts() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("benchTimeouts() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
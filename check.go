@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/devops-works/scan-exporter/scan"
+)
+
+// runCheck scans ports of a target immediately, using the same probes as the
+// scans, and prints the state and latency of each port.
+// Usage: scan-exporter check <ip> -p [tcp:]<range> [-timeout <duration>]
+func runCheck(args []string, stdout io.Writer) error {
+	const usage = "usage: scan-exporter check <ip> -p [tcp:]<range> [OPTIONS]"
+
+	// The target comes before the options
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return errors.New(usage)
+	}
+	ip := args[0]
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("invalid IP address %q", ip)
+	}
+
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	var portList string
+	var timeout time.Duration
+	var workers int
+	fs.StringVar(&portList, "p", "", "ports to check, optionally prefixed with their protocol (tcp:22,80,443)")
+	fs.DurationVar(&timeout, "timeout", 2*time.Second, "probe timeout")
+	fs.IntVar(&workers, "workers", 64, "number of ports probed at the same time")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if portList == "" || fs.NArg() != 0 {
+		return errors.New(usage)
+	}
+	if workers < 1 {
+		return errors.New("at least one worker is required")
+	}
+
+	proto, ranges, found := strings.Cut(portList, ":")
+	if !found {
+		proto, ranges = "tcp", portList
+	}
+	if proto != "tcp" {
+		return fmt.Errorf("unsupported protocol %q, only tcp ports can be checked", proto)
+	}
+	ports, err := scan.ParsePorts(ranges)
+	if err != nil {
+		return fmt.Errorf("invalid ports: %w", err)
+	}
+	if len(ports) == 0 {
+		return errors.New("no ports to check")
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PORT\tSTATE\tLATENCY")
+	for _, r := range scan.Probe(ip, ports, workers, timeout) {
+		state := "closed"
+		if r.Open {
+			state = "open"
+		}
+		fmt.Fprintf(w, "%d/%s\t%s\t%s\n", r.Port, proto, state, r.Latency.Round(time.Microsecond))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"testing"
+)
+
+func Test_runCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	open := ln.Addr().(*net.TCPAddr).Port
+	closed, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "tcp ports",
+			args: []string{"127.0.0.1", "-p", fmt.Sprintf("tcp:%d,%d", open, closed)},
+			want: []string{fmt.Sprintf(`(?m)^%d/tcp +open `, open), fmt.Sprintf(`(?m)^%d/tcp +closed `, closed)},
+		},
+		{
+			name: "default protocol",
+			args: []string{"127.0.0.1", "-p", fmt.Sprint(open)},
+			want: []string{fmt.Sprintf(`(?m)^%d/tcp +open `, open)},
+		},
+		{name: "no target", args: []string{"-p", "22"}, wantErr: true},
+		{name: "invalid target", args: []string{"localhost", "-p", "22"}, wantErr: true},
+		{name: "no ports", args: []string{"127.0.0.1"}, wantErr: true},
+		{name: "udp ports", args: []string{"127.0.0.1", "-p", "udp:53"}, wantErr: true},
+		{name: "invalid ports", args: []string{"127.0.0.1", "-p", "tcp:70000"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runCheck(tt.args, &out)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("runCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, want := range tt.want {
+				if !regexp.MustCompile(want).MatchString(out.String()) {
+					t.Errorf("runCheck() output does not match %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
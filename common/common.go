@@ -1,6 +1,7 @@
 package common
 
 import (
+	"fmt"
 	"sort"
 )
 
@@ -14,6 +15,15 @@ func StringInSlice(s string, sl []string) bool {
 	return false
 }
 
+// Summarize formats a slice, keeping only its first max items followed by the
+// number of omitted ones. A max of zero or less keeps all the items.
+func Summarize(sl []string, max int) string {
+	if max <= 0 || len(sl) <= max {
+		return fmt.Sprint(sl)
+	}
+	return fmt.Sprintf("%v and %d more", sl[:max], len(sl)-max)
+}
+
 // CompareStringSlices checks if two slices are equal.
 // It returns the number of different items.
 func CompareStringSlices(sl1, sl2 []string) int {
@@ -25,6 +25,27 @@ func Test_StringInSlice(t *testing.T) {
 	}
 }
 
+func TestSummarize(t *testing.T) {
+	tests := []struct {
+		name string
+		sl   []string
+		max  int
+		want string
+	}{
+		{name: "unlimited", sl: []string{"22", "80", "443"}, max: 0, want: "[22 80 443]"},
+		{name: "under the limit", sl: []string{"22", "80", "443"}, max: 3, want: "[22 80 443]"},
+		{name: "over the limit", sl: []string{"22", "80", "443", "8080"}, max: 2, want: "[22 80] and 2 more"},
+		{name: "empty slice", sl: nil, max: 2, want: "[]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Summarize(tt.sl, tt.max); got != tt.want {
+				t.Errorf("Summarize() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestCompareStringSlices(t *testing.T) {
 
 	tests := []struct {
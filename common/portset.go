@@ -0,0 +1,119 @@
+package common
+
+import (
+	"iter"
+	"math/bits"
+	"strconv"
+)
+
+// PortSet is a set of ports, stored as a bitmap of 8KB holding a bit for each
+// port, so that membership tests and set operations do not depend on the
+// number of ports. A nil set is empty.
+type PortSet struct {
+	words [65536 / 64]uint64
+}
+
+// NewPortSet creates a set holding the given ports. Ports out of the valid
+// range are ignored.
+func NewPortSet(ports ...int) *PortSet {
+	s := &PortSet{}
+	for _, p := range ports {
+		s.Add(p)
+	}
+	return s
+}
+
+// PortSetOf creates a set holding the ports written in the given strings.
+// Strings which are not valid ports are ignored.
+func PortSetOf(ports []string) *PortSet {
+	s := &PortSet{}
+	for _, p := range ports {
+		if port, err := strconv.Atoi(p); err == nil {
+			s.Add(port)
+		}
+	}
+	return s
+}
+
+// Add adds a port to the set. Ports out of the valid range are ignored.
+func (s *PortSet) Add(port int) {
+	if port < 0 || port > 65535 {
+		return
+	}
+	s.words[port/64] |= 1 << (port % 64)
+}
+
+// Has reports whether a port is in the set.
+func (s *PortSet) Has(port int) bool {
+	if s == nil || port < 0 || port > 65535 {
+		return false
+	}
+	return s.words[port/64]&(1<<(port%64)) != 0
+}
+
+// HasString reports whether the port written in p is in the set.
+func (s *PortSet) HasString(p string) bool {
+	port, err := strconv.Atoi(p)
+	return err == nil && s.Has(port)
+}
+
+// Len returns the number of ports in the set.
+func (s *PortSet) Len() int {
+	if s == nil {
+		return 0
+	}
+	n := 0
+	for _, w := range s.words {
+		n += bits.OnesCount64(w)
+	}
+	return n
+}
+
+// Diff returns the number of ports which are in only one of the sets.
+func (s *PortSet) Diff(o *PortSet) int {
+	var empty PortSet
+	if s == nil {
+		s = &empty
+	}
+	if o == nil {
+		o = &empty
+	}
+	n := 0
+	for i := range s.words {
+		n += bits.OnesCount64(s.words[i] ^ o.words[i])
+	}
+	return n
+}
+
+// Minus returns the set of the ports which are in s but not in o.
+func (s *PortSet) Minus(o *PortSet) *PortSet {
+	d := &PortSet{}
+	if s == nil {
+		return d
+	}
+	d.words = s.words
+	if o != nil {
+		for i := range d.words {
+			d.words[i] &^= o.words[i]
+		}
+	}
+	return d
+}
+
+// All yields the ports of the set in ascending order.
+func (s *PortSet) All() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		if s == nil {
+			return
+		}
+		for i, w := range s.words {
+			for w != 0 {
+				b := bits.TrailingZeros64(w)
+				if !yield(i*64 + b) {
+					return
+				}
+				w &^= 1 << b
+			}
+		}
+	}
+}
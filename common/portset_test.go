@@ -0,0 +1,90 @@
+package common
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestPortSetOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []string
+		want  []int
+	}{
+		{name: "empty", want: nil},
+		{name: "unsorted", ports: []string{"443", "22", "80", "22"}, want: []int{22, 80, 443}},
+		{name: "bounds", ports: []string{"0", "65535"}, want: []int{0, 65535}},
+		{name: "invalid", ports: []string{"http", "65536", "-1", "8080"}, want: []int{8080}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := PortSetOf(tt.ports)
+			if got := slices.Collect(s.All()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PortSetOf() holds %v, want %v", got, tt.want)
+			}
+			if got := s.Len(); got != len(tt.want) {
+				t.Errorf("Len() = %d, want %d", got, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestPortSet_Has(t *testing.T) {
+	s := NewPortSet(22, 443)
+	tests := []struct {
+		port string
+		want bool
+	}{
+		{port: "22", want: true},
+		{port: "443", want: true},
+		{port: "80"},
+		{port: "ssh"},
+		{port: "70000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.port, func(t *testing.T) {
+			if got := s.HasString(tt.port); got != tt.want {
+				t.Errorf("HasString(%s) = %v, want %v", tt.port, got, tt.want)
+			}
+		})
+	}
+	var empty *PortSet
+	if empty.Has(22) || empty.Len() != 0 {
+		t.Errorf("nil set is not empty")
+	}
+}
+
+func TestPortSet_Diff(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b *PortSet
+		want int
+	}{
+		{name: "same", a: NewPortSet(1, 2, 3), b: NewPortSet(3, 2, 1), want: 0},
+		{name: "added", a: NewPortSet(1, 2, 3), b: NewPortSet(1, 2, 3, 4), want: 1},
+		{name: "removed and added", a: NewPortSet(22, 80), b: NewPortSet(80, 443), want: 2},
+		{name: "from nothing", a: nil, b: NewPortSet(80, 443), want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Diff(tt.b); got != tt.want {
+				t.Errorf("Diff() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortSet_Minus(t *testing.T) {
+	open := NewPortSet(22, 80, 443, 8080)
+	expected := NewPortSet(80, 443, 5432)
+	if got, want := slices.Collect(open.Minus(expected).All()), []int{22, 8080}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Minus() = %v, want %v", got, want)
+	}
+	if got, want := slices.Collect(expected.Minus(open).All()), []int{5432}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Minus() = %v, want %v", got, want)
+	}
+	if open.Len() != 4 {
+		t.Errorf("Minus() modified the set")
+	}
+}
@@ -1,7 +1,8 @@
 package config
 
 import (
-	"io/ioutil"
+	"fmt"
+	"io"
 	"os"
 
 	"gopkg.in/yaml.v3"
@@ -10,48 +11,494 @@ import (
 // Target holds an IP and a range of ports to scan
 type Target struct {
 	IP               string            `yaml:"ip"`
+	Host             string            `yaml:"host"`
+	IPv6             string            `yaml:"ipv6"`
 	Name             string            `yaml:"name"`
 	Range            string            `yaml:"range"`
 	QueriesPerSecond int               `yaml:"queries_per_sec"`
+	Profile          string            `yaml:"profile"`
+	Timeout          string            `yaml:"timeout"`
+	Retries          int               `yaml:"retries"`
+	RetryDelay       string            `yaml:"retry_delay"`
+	Rate             string            `yaml:"rate"`
+	Proxy            string            `yaml:"proxy"`
 	TCP              protocol          `yaml:"tcp"`
 	ICMP             protocol          `yaml:"icmp"`
+	HTTP             *HTTPCheck        `yaml:"http_check"`
+	TLS              *TLSCheck         `yaml:"tls_check"`
+	Severities       map[string]string `yaml:"severities"`
+	Annotations      map[int]string    `yaml:"annotations"`
+	ChangeThreshold  int               `yaml:"change_threshold"`
+	Backoff          *Backoff          `yaml:"backoff"`
+	SourcePorts      string            `yaml:"source_ports"`
+	SourceAddresses  []string          `yaml:"source_addresses"`
+	TTL              int               `yaml:"ttl"`
+	Interface        string            `yaml:"interface"`
+	Paused           bool              `yaml:"paused"`
+	DependsOn        string            `yaml:"depends_on"`
+	HostDown         *HostDown         `yaml:"host_down"`
 	Labels           map[string]string `yaml:"labels"`
+	Owner            string            `yaml:"owner"`
+	Description      string            `yaml:"description"`
+	Mode             string            `yaml:"mode"`
 }
 
 type protocol struct {
-	Period   string `yaml:"period"`
-	Range    string `yaml:"range"`
-	Expected string `yaml:"expected"`
+	Period   string  `yaml:"period"`
+	Range    string  `yaml:"range"`
+	Expected string  `yaml:"expected"`
+	Timeout  string  `yaml:"timeout"`
+	Checks   []Check `yaml:"checks"`
+	// Banners holds the pattern that the banner sent by the server must
+	// match, indexed by port
+	Banners map[int]string `yaml:"banners"`
+}
+
+// Check describes a send/expect exchange realised on a port once the TCP
+// connection is established
+type Check struct {
+	Port   int    `yaml:"port"`
+	Send   string `yaml:"send"`
+	Expect string `yaml:"expect"`
+}
+
+// HTTPCheck describes the assertions realised with an HTTP request on open web
+// ports
+type HTTPCheck struct {
+	Ports              string            `yaml:"ports"`
+	TLSPorts           string            `yaml:"tls_ports"`
+	Path               string            `yaml:"path"`
+	Host               string            `yaml:"host"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify"`
+	Headers            map[string]string `yaml:"headers"`
+	Body               string            `yaml:"body"`
+}
+
+// TLSCheck describes the inspection of the certificates presented by open TLS
+// ports
+type TLSCheck struct {
+	Ports      string `yaml:"ports"`
+	ServerName string `yaml:"server_name"`
 }
 
 // Conf holds configuration
 type Conf struct {
-	Timeout          int      `yaml:"timeout"`
-	Limit            int      `yaml:"limit"`
-	LogLevel         string   `yaml:"log_level"`
-	QueriesPerSecond int      `yaml:"queries_per_sec"`
-	TcpPeriod        string   `yaml:"tcp_period"`
-	IcmpPeriod       string   `yaml:"icmp_period"`
-	Targets          []Target `yaml:"targets"`
+	Timeout            int               `yaml:"timeout"`
+	Limit              int               `yaml:"limit"`
+	ConcurrentScans    int               `yaml:"concurrent_scans"`
+	ICMPMode           string            `yaml:"icmp_mode"`
+	LogLevel           string            `yaml:"log_level"`
+	LogMaxPorts        int               `yaml:"log_max_ports"`
+	LogDedupWindow     string            `yaml:"log_dedup_window"`
+	AvailabilityWindow int               `yaml:"availability_window"`
+	QueriesPerSecond   int               `yaml:"queries_per_sec"`
+	Rate               string            `yaml:"rate"`
+	Profile            string            `yaml:"profile"`
+	Retries            int               `yaml:"retries"`
+	RetryDelay         string            `yaml:"retry_delay"`
+	TcpPeriod          string            `yaml:"tcp_period"`
+	IcmpPeriod         string            `yaml:"icmp_period"`
+	StartupSpread      string            `yaml:"startup_spread"`
+	ShutdownTimeout    string            `yaml:"shutdown_timeout"`
+	History            *History          `yaml:"history"`
+	Severities         map[string]string `yaml:"severities"`
+	HostDown           *HostDown         `yaml:"host_down"`
+	ChangeThreshold    int               `yaml:"change_threshold"`
+	Backoff            *Backoff          `yaml:"backoff"`
+	Flapping           *Flapping         `yaml:"flapping"`
+	SubnetLimit        *SubnetLimit      `yaml:"subnet_limit"`
+	Blackhole          *Blackhole        `yaml:"blackhole"`
+	SourcePorts        string            `yaml:"source_ports"`
+	SourceAddresses    []string          `yaml:"source_addresses"`
+	TTL                int               `yaml:"ttl"`
+	OUIFile            string            `yaml:"oui_file"`
+	GeoIP              *GeoIP            `yaml:"geoip"`
+	Whois              *Whois            `yaml:"whois"`
+	ServiceInfo        bool              `yaml:"service_info"`
+	Notifications      Notifications     `yaml:"notifications"`
+	NetBox             *NetBox           `yaml:"netbox"`
+	Discovery          Discovery         `yaml:"discovery"`
+	NmapOutput         string            `yaml:"nmap_output"`
+	Outputs            Outputs           `yaml:"outputs"`
+	Tracing            *Tracing          `yaml:"tracing"`
+	OTLPMetrics        *OTLPMetrics      `yaml:"otlp_metrics"`
+	Sentry             *Sentry           `yaml:"sentry"`
+	DNS                *DNS              `yaml:"dns"`
+	Web                *Web              `yaml:"web"`
+	Targets            []Target          `yaml:"targets"`
+	TargetTemplates    []TargetTemplate  `yaml:"target_templates"`
+}
+
+// HostDown holds how targets not responding to pings are reported
+type HostDown struct {
+	Severity string `yaml:"severity"`
+	Notify   bool   `yaml:"notify"`
+}
+
+// Flapping holds the detection of the ports and hosts changing state too often
+type Flapping struct {
+	Changes int    `yaml:"changes"`
+	Window  string `yaml:"window"`
+}
+
+// Backoff holds the adaptation of the probe rate of a target to dial errors
+type Backoff struct {
+	ErrorRate  float64 `yaml:"error_rate"`
+	Window     int     `yaml:"window"`
+	MaxDelay   string  `yaml:"max_delay"`
+	AbortRate  float64 `yaml:"abort_rate"`
+	RetryAfter string  `yaml:"retry_after"`
+}
+
+// SubnetLimit holds the maximum number of simultaneous probes per destination
+// subnet
+type SubnetLimit struct {
+	Probes     int `yaml:"probes"`
+	IPv4Prefix int `yaml:"ipv4_prefix"`
+	IPv6Prefix int `yaml:"ipv6_prefix"`
+}
+
+// Blackhole holds the detection of the probes being dropped before they leave
+// the host
+type Blackhole struct {
+	MinTargets int `yaml:"min_targets"`
+}
+
+// GeoIP holds the MaxMind databases locating the public targets
+type GeoIP struct {
+	CountryDB string `yaml:"country_db"`
+	ASNDB     string `yaml:"asn_db"`
+}
+
+// Whois holds the lookup of the owners of the public targets
+type Whois struct {
+	CacheFile string `yaml:"cache_file"`
+	TTL       string `yaml:"ttl"`
+}
+
+// DNS holds the configuration of the resolver of hostname targets
+type DNS struct {
+	Servers         []string `yaml:"servers"`
+	Search          []string `yaml:"search"`
+	Timeout         string   `yaml:"timeout"`
+	RefreshInterval string   `yaml:"refresh_interval"`
+}
+
+// Tracing holds the configuration of the OTLP traces exporter
+type Tracing struct {
+	Endpoint    string            `yaml:"endpoint"`
+	Insecure    bool              `yaml:"insecure"`
+	Headers     map[string]string `yaml:"headers"`
+	SampleRatio *float64          `yaml:"sample_ratio"`
+}
+
+// OTLPMetrics holds the configuration of the OTLP metrics exporter
+type OTLPMetrics struct {
+	Endpoint string            `yaml:"endpoint"`
+	Insecure bool              `yaml:"insecure"`
+	Headers  map[string]string `yaml:"headers"`
+	Interval string            `yaml:"interval"`
+}
+
+// Web holds the protection of the metrics server
+type Web struct {
+	TLS       *WebTLS    `yaml:"tls"`
+	BasicAuth *BasicAuth `yaml:"basic_auth"`
+}
+
+// WebTLS holds the certificate served by the metrics server
+type WebTLS struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// BasicAuth holds the credentials required by the metrics server
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Sentry holds the configuration of the Sentry error reporting
+type Sentry struct {
+	DSN         string `yaml:"dsn"`
+	Environment string `yaml:"environment"`
+	Threshold   int    `yaml:"threshold"`
+	Interval    string `yaml:"interval"`
+}
+
+// NetBox holds the configuration used to generate targets from NetBox services
+type NetBox struct {
+	URL             string            `yaml:"url"`
+	Token           string            `yaml:"token"`
+	RefreshInterval string            `yaml:"refresh_interval"`
+	Filters         string            `yaml:"filters"`
+	Range           string            `yaml:"range"`
+	Period          string            `yaml:"period"`
+	ICMPPeriod      string            `yaml:"icmp_period"`
+	Labels          map[string]string `yaml:"labels"`
+}
+
+// Discovery holds the sources of targets generated at runtime
+type Discovery struct {
+	Consul *Consul `yaml:"consul"`
+	FileSD *FileSD `yaml:"file_sd"`
+}
+
+// Consul holds the discovery of targets from the services registered in Consul
+type Consul struct {
+	URL             string            `yaml:"url"`
+	Token           string            `yaml:"token"`
+	Datacenter      string            `yaml:"datacenter"`
+	Services        []string          `yaml:"services"`
+	Tags            []string          `yaml:"tags"`
+	RefreshInterval string            `yaml:"refresh_interval"`
+	Range           string            `yaml:"range"`
+	Period          string            `yaml:"period"`
+	ICMPPeriod      string            `yaml:"icmp_period"`
+	Labels          map[string]string `yaml:"labels"`
+}
+
+// FileSD holds the discovery of targets from files in the format of
+// Prometheus' file_sd_configs
+type FileSD struct {
+	Files           []string          `yaml:"files"`
+	RefreshInterval string            `yaml:"refresh_interval"`
+	Range           string            `yaml:"range"`
+	Period          string            `yaml:"period"`
+	ICMPPeriod      string            `yaml:"icmp_period"`
+	Labels          map[string]string `yaml:"labels"`
+}
+
+// Outputs holds the sinks receiving scan results and findings
+type Outputs struct {
+	Elasticsearch *Elasticsearch `yaml:"elasticsearch"`
+	Loki          *Loki          `yaml:"loki"`
+	StatsD        *StatsD        `yaml:"statsd"`
+	Kafka         *Kafka         `yaml:"kafka"`
+	Redis         *Redis         `yaml:"redis"`
+	NATS          *NATS          `yaml:"nats"`
+}
+
+// Elasticsearch holds the configuration of the Elasticsearch/OpenSearch sink
+type Elasticsearch struct {
+	URLs               []string `yaml:"urls"`
+	Index              string   `yaml:"index"`
+	Username           string   `yaml:"username"`
+	Password           string   `yaml:"password"`
+	APIKey             string   `yaml:"api_key"`
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify"`
+}
+
+// Loki holds the configuration of the Loki sink
+type Loki struct {
+	URL      string            `yaml:"url"`
+	TenantID string            `yaml:"tenant_id"`
+	Username string            `yaml:"username"`
+	Password string            `yaml:"password"`
+	Labels   map[string]string `yaml:"labels"`
 }
 
-// New reads config from file and returns a config struct
+// StatsD holds the configuration of the StatsD/DogStatsD sink
+type StatsD struct {
+	Host   string            `yaml:"host"`
+	Port   int               `yaml:"port"`
+	Prefix string            `yaml:"prefix"`
+	Tags   map[string]string `yaml:"tags"`
+}
+
+// Kafka holds the configuration of the Kafka sink
+type Kafka struct {
+	Brokers            []string        `yaml:"brokers"`
+	Topic              string          `yaml:"topic"`
+	TLS                bool            `yaml:"tls"`
+	InsecureSkipVerify bool            `yaml:"insecure_skip_verify"`
+	SASL               *KafkaSASL      `yaml:"sasl"`
+	Format             string          `yaml:"format"`
+	SchemaRegistry     *SchemaRegistry `yaml:"schema_registry"`
+}
+
+// KafkaSASL holds the SASL authentication to the Kafka brokers
+type KafkaSASL struct {
+	Mechanism string `yaml:"mechanism"`
+	Username  string `yaml:"username"`
+	Password  string `yaml:"password"`
+}
+
+// SchemaRegistry holds the schema registry where the schema of Avro messages
+// is registered
+type SchemaRegistry struct {
+	URL      string `yaml:"url"`
+	Subject  string `yaml:"subject"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Redis holds the configuration of the Redis sink
+type Redis struct {
+	Address  string `yaml:"address"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	TLS      bool   `yaml:"tls"`
+	Prefix   string `yaml:"prefix"`
+	History  int    `yaml:"history"`
+	TTL      string `yaml:"ttl"`
+}
+
+// NATS holds the configuration of the NATS sink
+type NATS struct {
+	URL      string `yaml:"url"`
+	Subject  string `yaml:"subject"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Token    string `yaml:"token"`
+}
+
+// Notifications holds the notification routes
+type Notifications struct {
+	Routes           []Route    `yaml:"routes"`
+	SilencesFile     string     `yaml:"silences_file"`
+	SuppressFlapping bool       `yaml:"suppress_flapping"`
+	Heartbeat        *Heartbeat `yaml:"heartbeat"`
+	Delivery         *Delivery  `yaml:"delivery"`
+	Webhook          *Webhook   `yaml:"webhook"`
+}
+
+// History holds the configuration of the store of the results of the scans
+type History struct {
+	Path      string `yaml:"path"`
+	Retention string `yaml:"retention"`
+}
+
+// Delivery holds the retries of the notifications which cannot be delivered
+type Delivery struct {
+	QueueFile string `yaml:"queue_file"`
+	MaxDelay  string `yaml:"max_delay"`
+	MaxAge    string `yaml:"max_age"`
+}
+
+// Heartbeat holds the configuration of the heartbeat sent while the scanner is
+// healthy
+type Heartbeat struct {
+	URL      string `yaml:"url"`
+	Interval string `yaml:"interval"`
+	MaxAge   string `yaml:"max_age"`
+}
+
+// Route sends the findings with the given severities to a notifier
+type Route struct {
+	Name        string       `yaml:"name"`
+	Severities  []string     `yaml:"severities"`
+	Targets     []string     `yaml:"targets"`
+	Webhook     *Webhook     `yaml:"webhook"`
+	CloudEvents *CloudEvents `yaml:"cloudevents"`
+	Opsgenie    *Opsgenie    `yaml:"opsgenie"`
+	Slack       *Slack       `yaml:"slack"`
+	QuietHours  *QuietHours  `yaml:"quiet_hours"`
+}
+
+// QuietHours holds the daily window during which the non-critical findings of
+// a route are held
+type QuietHours struct {
+	Start    string `yaml:"start"`
+	End      string `yaml:"end"`
+	Timezone string `yaml:"timezone"`
+}
+
+// Webhook holds the configuration of a webhook notifier
+type Webhook struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret"`
+}
+
+// Slack holds the configuration of a Slack or Mattermost notifier
+type Slack struct {
+	URL     string `yaml:"url"`
+	Channel string `yaml:"channel"`
+}
+
+// Opsgenie holds the configuration of an Opsgenie notifier
+type Opsgenie struct {
+	APIKey string   `yaml:"api_key"`
+	APIURL string   `yaml:"api_url"`
+	Tags   []string `yaml:"tags"`
+}
+
+// CloudEvents holds the configuration of a CloudEvents notifier
+type CloudEvents struct {
+	URL    string `yaml:"url"`
+	Source string `yaml:"source"`
+	Mode   string `yaml:"mode"`
+}
+
+// Stdin is the path of the configuration file to read it from the standard
+// input instead.
+const Stdin = "-"
+
+// stdin is the standard input configurations are read from.
+var stdin io.Reader = os.Stdin
+
+// New reads config from file, decrypting it if needed and expanding the
+// environment variables it references, and returns a config struct. It is
+// written in YAML, JSON or TOML, depending on the extension of the file, and
+// read from the standard input, in YAML, if f is Stdin.
 func New(f string) (*Conf, error) {
-	conf, err := os.Open(f)
+	var y []byte
+	var err error
+	if f == Stdin {
+		y, err = io.ReadAll(stdin)
+	} else {
+		y, err = os.ReadFile(f)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	y, err := ioutil.ReadAll(conf)
+	if y, err = decrypt(f, y); err != nil {
+		return nil, err
+	}
+	node, err := parse(format(f), y)
 	if err != nil {
 		return nil, err
 	}
+	if err = expandEnv(node); err != nil {
+		return nil, err
+	}
 
 	c := Conf{}
 
-	if err = yaml.Unmarshal(y, &c); err != nil {
+	if node.Kind != 0 {
+		if err = node.Decode(&c); err != nil {
+			return nil, err
+		}
+	}
+
+	// Templates are expanded after the targets, to which they are added
+	for i := range c.TargetTemplates {
+		targets, err := c.TargetTemplates[i].Expand()
+		if err != nil {
+			return nil, fmt.Errorf("invalid target template %d: %w", i+1, err)
+		}
+		c.Targets = append(c.Targets, targets...)
+	}
+	if c.Targets, err = expandNetworks(c.Targets); err != nil {
 		return nil, err
 	}
 
 	return &c, nil
 }
+
+// ReadTargets reads a list of targets, written in YAML or JSON as the targets
+// of the configuration file, such as the ones generated by an inventory. Their
+// networks are expanded as in the configuration file.
+func ReadTargets(r io.Reader) ([]Target, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var targets []Target
+	if err := yaml.Unmarshal(data, &targets); err != nil {
+		return nil, fmt.Errorf("cannot read targets: %w", err)
+	}
+	return expandNetworks(targets)
+}
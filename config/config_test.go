@@ -0,0 +1,149 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNew_stdin(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{name: "plaintext", content: plaintext},
+		{name: "invalid", content: "targets: {", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old := stdin
+			stdin = strings.NewReader(tt.content)
+			t.Cleanup(func() { stdin = old })
+
+			c, err := New(Stdin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(c.Targets) != 1 || c.Targets[0].Name != "web" || c.Targets[0].IP != "10.0.0.1" {
+				t.Errorf("New() targets = %+v, want web", c.Targets)
+			}
+		})
+	}
+}
+
+func TestNew_formats(t *testing.T) {
+	const yamlConf = `timeout: 2
+limit: 1024
+targets:
+  - name: web
+    ip: 10.0.0.1
+    tcp:
+      period: 12h
+      range: reserved
+      expected: 22,80,443
+    labels:
+      owner: web-team
+`
+	want, err := New(writeConf(t, "config.yaml", yamlConf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr bool
+	}{
+		{name: "YAML without extension", file: "config", content: yamlConf},
+		{
+			name: "JSON",
+			file: "config.json",
+			content: `{"timeout": 2, "limit": 1024, "targets": [{"name": "web", "ip": "10.0.0.1",
+				"tcp": {"period": "12h", "range": "reserved", "expected": "22,80,443"},
+				"labels": {"owner": "web-team"}}]}`,
+		},
+		{
+			name: "TOML",
+			file: "config.TOML",
+			content: `timeout = 2
+limit = 1024
+
+[[targets]]
+name = "web"
+ip = "10.0.0.1"
+
+[targets.tcp]
+period = "12h"
+range = "reserved"
+expected = "22,80,443"
+
+[targets.labels]
+owner = "web-team"
+`,
+		},
+		{name: "invalid JSON", file: "config.json", content: `{"targets": [`, wantErr: true},
+		{name: "several JSON documents", file: "config.json", content: `{"timeout": 2} {"timeout": 3}`, wantErr: true},
+		{name: "invalid TOML", file: "config.toml", content: "targets = [", wantErr: true},
+		{name: "invalid type", file: "config.json", content: `{"timeout": "2s"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(writeConf(t, tt.file, tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, want) {
+				t.Errorf("New() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+// writeConf writes a configuration file named name in a temporary directory,
+// and returns its path.
+func writeConf(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadTargets(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantNames []string
+		wantErr   bool
+	}{
+		{name: "YAML", input: "- name: web\n  ip: 10.0.0.1\n- name: db\n  ip: 10.0.0.2\n", wantNames: []string{"web", "db"}},
+		{name: "JSON", input: `[{"name": "web", "ip": "10.0.0.1", "tcp": {"range": "1-1024"}}]`, wantNames: []string{"web"}},
+		{name: "empty", input: ""},
+		{name: "not a list", input: "name: web\n", wantErr: true},
+		{name: "invalid", input: "[{", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadTargets(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadTargets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.wantNames) {
+				t.Fatalf("ReadTargets() = %+v, want %v", got, tt.wantNames)
+			}
+			for i, name := range tt.wantNames {
+				if got[i].Name != name {
+					t.Errorf("ReadTargets()[%d].Name = %q, want %q", i, got[i].Name, name)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables holding the age identities used to decrypt
+// age-encrypted configuration files, either directly or in a file.
+const (
+	AgeKeyEnv     = "SCAN_EXPORTER_AGE_KEY"
+	AgeKeyFileEnv = "SCAN_EXPORTER_AGE_KEY_FILE"
+)
+
+// sopsStdin is the path given to sops to decrypt its standard input.
+const sopsStdin = "/dev/stdin"
+
+// Headers of age-encrypted files, in binary and armored formats.
+var ageHeaders = [][]byte{
+	[]byte("age-encryption.org/v1\n"),
+	[]byte(armor.Header),
+}
+
+// decrypt returns the plaintext of the configuration file at path, whose
+// content is data, in the format of the file. SOPS-encrypted files are
+// decrypted with the sops command, which finds the keys itself, and
+// age-encrypted files with the identities found in the environment.
+// Other files are returned as they are. The plaintext is never written to
+// disk.
+func decrypt(path string, data []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case slices.ContainsFunc(ageHeaders, func(header []byte) bool { return bytes.HasPrefix(trimmed, header) }):
+		return ageDecrypt(path, trimmed)
+	case sopsEncrypted(data):
+		return sopsDecrypt(path, data)
+	}
+	return data, nil
+}
+
+// sopsEncrypted reports whether data is a YAML or JSON document encrypted by
+// SOPS, which adds its metadata under a top level sops key.
+func sopsEncrypted(data []byte) bool {
+	var doc struct {
+		Sops *struct {
+			Mac string `yaml:"mac"`
+		} `yaml:"sops"`
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return false
+	}
+	return doc.Sops != nil && doc.Sops.Mac != ""
+}
+
+// sopsDecrypt decrypts data, the content of the SOPS-encrypted file at path,
+// with the sops command. The document is given on its standard input, as the
+// file cannot be read again when it is the standard input, and is decrypted
+// in its own format. SOPS does not encrypt TOML files.
+func sopsDecrypt(path string, data []byte) ([]byte, error) {
+	f := format(path)
+	if path == Stdin && bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		f = formatJSON
+	}
+	if f != formatJSON {
+		f = formatYAML
+	}
+	return run(bytes.NewReader(data), "sops", "--decrypt", "--input-type", f, "--output-type", f, sopsStdin)
+}
+
+// ageDecrypt decrypts data, the content of the age-encrypted file at path,
+// with the identities found in the environment.
+func ageDecrypt(path string, data []byte) ([]byte, error) {
+	var keys io.Reader
+	switch {
+	case os.Getenv(AgeKeyEnv) != "":
+		keys = strings.NewReader(os.Getenv(AgeKeyEnv))
+	case os.Getenv(AgeKeyFileEnv) != "":
+		f, err := os.Open(os.Getenv(AgeKeyFileEnv))
+		if err != nil {
+			return nil, fmt.Errorf("cannot read age identities: %w", err)
+		}
+		defer f.Close()
+		keys = f
+	default:
+		return nil, fmt.Errorf("%s is age-encrypted, but neither %s nor %s is set", path, AgeKeyEnv, AgeKeyFileEnv)
+	}
+	identities, err := age.ParseIdentities(keys)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read age identities: %w", err)
+	}
+
+	var r io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(data, []byte(armor.Header)) {
+		r = armor.NewReader(r)
+	}
+	plain, err := age.Decrypt(r, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt configuration with age: %w", err)
+	}
+	return io.ReadAll(plain)
+}
+
+// run executes a command and returns its output. Its error output is included
+// in the returned error.
+func run(stdin io.Reader, name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = stdin
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, fmt.Errorf("cannot decrypt configuration: %s command not found, it must be installed to read encrypted configurations", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt configuration with %s: %w: %s", name, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
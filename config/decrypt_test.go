@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bytes"
+	"cmp"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const plaintext = "targets:\n  - name: web\n    ip: 10.0.0.1\n"
+
+const plaintextJSON = `{"targets": [{"name": "web", "ip": "10.0.0.1"}]}`
+
+const sopsEncryptedYAML = "targets: ENC[AES256_GCM,data:abc,type:str]\nsops:\n  mac: ENC[AES256_GCM,data:def,type:str]\n  version: 3.9.0\n"
+
+const sopsEncryptedJSON = `{"targets": "ENC[AES256_GCM,data:abc,type:str]", "sops": {"mac": "ENC[AES256_GCM,data:def,type:str]", "version": "3.9.0"}}`
+
+// fakeCommand installs a shell script named name in a directory added to the
+// PATH. The script prints the plaintext configuration, in JSON when asked to,
+// and its arguments and input to the args file of the directory.
+func fakeCommand(t *testing.T, dir, name string) {
+	t.Helper()
+	script := "#!/bin/sh\necho \"$@\" > " + filepath.Join(dir, "args") + "\ncat >> " + filepath.Join(dir, "args") + "\n" +
+		"case \"$*\" in\n*'--output-type json'*) printf '" + plaintextJSON + "' ;;\n*) printf '" + plaintext + "' ;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ageEncrypt encrypts plaintext for identity, armored or not.
+func ageEncrypt(t *testing.T, identity *age.X25519Identity, armored bool) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var out io.WriteCloser = nopCloser{&buf}
+	if armored {
+		out = armor.NewWriter(&buf)
+	}
+	w, err := age.Encrypt(out, identity.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, plaintext); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestNew_encrypted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake commands are shell scripts")
+	}
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := writeConf(t, "age.key", "# created for tests\n"+identity.String()+"\n")
+
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		stdin    bool
+		key      string
+		keyFile  string
+		wantArgs string
+		wantErr  bool
+	}{
+		{name: "plaintext", content: plaintext},
+		{
+			name:     "SOPS",
+			content:  sopsEncryptedYAML,
+			wantArgs: "--decrypt --input-type yaml --output-type yaml /dev/stdin",
+		},
+		{
+			name:     "SOPS from the standard input",
+			content:  sopsEncryptedYAML,
+			stdin:    true,
+			wantArgs: "--decrypt --input-type yaml --output-type yaml /dev/stdin",
+		},
+		{
+			name:     "SOPS in JSON",
+			file:     "config.json",
+			content:  sopsEncryptedJSON,
+			wantArgs: "--decrypt --input-type json --output-type json /dev/stdin",
+		},
+		{
+			name:     "SOPS in JSON from the standard input",
+			content:  sopsEncryptedJSON,
+			stdin:    true,
+			wantArgs: "--decrypt --input-type json --output-type json /dev/stdin",
+		},
+		{name: "SOPS without metadata", content: "sops: {}\n" + plaintext},
+		{name: "armored age with key", content: ageEncrypt(t, identity, true), key: identity.String()},
+		{name: "age with key file", content: ageEncrypt(t, identity, false), keyFile: keyFile},
+		{name: "age from the standard input", content: ageEncrypt(t, identity, true), stdin: true, key: identity.String()},
+		{name: "age with another key", content: ageEncrypt(t, identity, false), key: other.String(), wantErr: true},
+		{name: "age with an invalid key", content: ageEncrypt(t, identity, false), key: "AGE-SECRET-KEY-1TEST", wantErr: true},
+		{name: "age with a missing key file", content: ageEncrypt(t, identity, false), keyFile: "/nonexistent/age.key", wantErr: true},
+		{name: "age without key", content: ageEncrypt(t, identity, false), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bin := t.TempDir()
+			fakeCommand(t, bin, "sops")
+			t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+			t.Setenv(AgeKeyEnv, tt.key)
+			t.Setenv(AgeKeyFileEnv, tt.keyFile)
+
+			path := Stdin
+			if tt.stdin {
+				old := stdin
+				stdin = strings.NewReader(tt.content)
+				t.Cleanup(func() { stdin = old })
+			} else {
+				path = writeConf(t, cmp.Or(tt.file, "config.yaml"), tt.content)
+			}
+
+			c, err := New(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(c.Targets) != 1 || c.Targets[0].Name != "web" {
+				t.Errorf("New() targets = %+v, want web", c.Targets)
+			}
+
+			args, _ := os.ReadFile(filepath.Join(bin, "args"))
+			if tt.wantArgs == "" {
+				if len(args) != 0 {
+					t.Errorf("sops called with %q, want no call", args)
+				}
+				return
+			}
+			// The encrypted document is given on the standard input
+			if want := tt.wantArgs + "\n" + tt.content; string(args) != want {
+				t.Errorf("sops called with %q, want %q", args, want)
+			}
+		})
+	}
+}
+
+func TestNew_sopsMissing(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	_, err := New(writeConf(t, "config.yaml", sopsEncryptedYAML))
+	if err == nil || !strings.Contains(err.Error(), "sops command not found") {
+		t.Errorf("New() error = %v, want sops not found", err)
+	}
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envRef matches the references to environment variables in configuration
+// files: ${NAME}, or ${NAME:-default} to use a default value when the variable
+// is unset or empty. A reference preceded by another $ is escaped.
+var envRef = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\}`)
+
+// expandEnv replaces the references to environment variables in the string
+// values of a parsed configuration by their values. Keys and comments are left
+// as they are, and values cannot change the structure of the configuration. An
+// unquoted value made of a single reference is typed after its expansion, so
+// that numbers and booleans can be referenced. An error is returned if a
+// variable without default value is not set.
+func expandEnv(node *yaml.Node) error {
+	var missing []string
+	var walk func(n *yaml.Node, value bool)
+	walk = func(n *yaml.Node, value bool) {
+		switch n.Kind {
+		case yaml.DocumentNode, yaml.SequenceNode:
+			for _, c := range n.Content {
+				walk(c, true)
+			}
+		case yaml.MappingNode:
+			for i, c := range n.Content {
+				walk(c, i%2 == 1)
+			}
+		case yaml.ScalarNode:
+			if !value || n.ShortTag() != "!!str" {
+				return
+			}
+			expanded, unset := expandString(n.Value)
+			missing = append(missing, unset...)
+			if expanded == n.Value {
+				return
+			}
+			if n.Style == 0 && envRef.FindString(n.Value) == n.Value && n.Value[1] != '$' {
+				n.Tag = ""
+			}
+			n.Value = expanded
+		}
+	}
+	walk(node, true)
+
+	if len(missing) > 0 {
+		return fmt.Errorf("environment variables not set: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// expandString replaces the references to environment variables in s by their
+// values, and returns the variables without default value which are not set.
+func expandString(s string) (string, []string) {
+	var missing []string
+	expanded := envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref[1] == '$' {
+			return ref[1:]
+		}
+		m := envRef.FindStringSubmatch(ref)
+		name, def := m[1], m[2]
+		if value, ok := os.LookupEnv(name); ok && (value != "" || def == "") {
+			return value
+		}
+		if def != "" {
+			return def[2:]
+		}
+		missing = append(missing, name)
+		return ref
+	})
+	return expanded, missing
+}
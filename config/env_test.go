@@ -0,0 +1,76 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_expandEnv(t *testing.T) {
+	t.Setenv("SCAN_EXPORTER_TEST_URL", "https://hooks.example.com/abc")
+	t.Setenv("SCAN_EXPORTER_TEST_EMPTY", "")
+	t.Setenv("SCAN_EXPORTER_TEST_PORT", "8080")
+	t.Setenv("SCAN_EXPORTER_TEST_YAML", "x\nip: 10.0.0.9\ntags: {a: b}")
+
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]any
+		wantErr bool
+	}{
+		{name: "no reference", data: "ip: 10.0.0.1\npassword: pa$word\n", want: map[string]any{"ip": "10.0.0.1", "password": "pa$word"}},
+		{name: "set", data: "url: ${SCAN_EXPORTER_TEST_URL}/notify", want: map[string]any{"url": "https://hooks.example.com/abc/notify"}},
+		{name: "empty", data: "url: '${SCAN_EXPORTER_TEST_EMPTY}'", want: map[string]any{"url": ""}},
+		{name: "default", data: "range: ${SCAN_EXPORTER_TEST_UNSET:-1-1024}", want: map[string]any{"range": "1-1024"}},
+		{name: "default of empty", data: "ip: ${SCAN_EXPORTER_TEST_EMPTY:-10.0.0.1}", want: map[string]any{"ip": "10.0.0.1"}},
+		{name: "empty default", data: "ip: '${SCAN_EXPORTER_TEST_UNSET:-}'", want: map[string]any{"ip": ""}},
+		{name: "escaped", data: "password: $${SCAN_EXPORTER_TEST_URL}", want: map[string]any{"password": "${SCAN_EXPORTER_TEST_URL}"}},
+		{name: "typed", data: "port: ${SCAN_EXPORTER_TEST_PORT}", want: map[string]any{"port": 8080}},
+		{name: "quoted", data: "port: '${SCAN_EXPORTER_TEST_PORT}'", want: map[string]any{"port": "8080"}},
+		{name: "in a sequence", data: "ports:\n  - ${SCAN_EXPORTER_TEST_PORT}\n  - 22", want: map[string]any{"ports": []any{8080, 22}}},
+		{name: "YAML in value", data: "name: ${SCAN_EXPORTER_TEST_YAML}", want: map[string]any{"name": "x\nip: 10.0.0.9\ntags: {a: b}"}},
+		{name: "comment", data: "# ${SCAN_EXPORTER_TEST_UNSET}\nip: 10.0.0.1 # ${SCAN_EXPORTER_TEST_UNSET}", want: map[string]any{"ip": "10.0.0.1"}},
+		{name: "key", data: "${SCAN_EXPORTER_TEST_UNSET}: 10.0.0.1", want: map[string]any{"${SCAN_EXPORTER_TEST_UNSET}": "10.0.0.1"}},
+		{name: "unset", data: "url: ${SCAN_EXPORTER_TEST_UNSET}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node, err := parse(formatYAML, []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = expandEnv(node)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			var got map[string]any
+			if err := node.Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandEnv() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_expandEnv_json(t *testing.T) {
+	t.Setenv("SCAN_EXPORTER_TEST_NAME", `web", "ip": "10.0.0.9`)
+
+	node, err := parse(formatJSON, []byte(`{"targets": [{"name": "${SCAN_EXPORTER_TEST_NAME}", "ip": "10.0.0.1"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := expandEnv(node); err != nil {
+		t.Fatal(err)
+	}
+	var c Conf
+	if err := node.Decode(&c); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Targets) != 1 || c.Targets[0].Name != `web", "ip": "10.0.0.9` || c.Targets[0].IP != "10.0.0.1" {
+		t.Errorf("expandEnv() targets = %+v, want the value kept in the name", c.Targets)
+	}
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the configuration files.
+const (
+	formatYAML = "yaml"
+	formatJSON = "json"
+	formatTOML = "toml"
+)
+
+// format returns the format of the configuration file at path, given by its
+// extension, the one of the file it encrypts for age-encrypted files. Files
+// with another extension and the standard input are read as YAML.
+func format(path string) string {
+	switch strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".age"))) {
+	case ".json":
+		return formatJSON
+	case ".toml":
+		return formatTOML
+	}
+	return formatYAML
+}
+
+// parse parses data, written in the given format, into a YAML node. JSON and
+// TOML documents are converted to YAML first, so that the keys of the
+// configuration are the same in all formats. The node of an empty document
+// has no kind.
+func parse(f string, data []byte) (*yaml.Node, error) {
+	var doc any
+	switch f {
+	case formatJSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		if dec.More() {
+			return nil, fmt.Errorf("invalid JSON: several documents found")
+		}
+	case formatTOML:
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid TOML: %w", err)
+		}
+	}
+
+	if f == formatJSON || f == formatTOML {
+		var err error
+		if data, err = yaml.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
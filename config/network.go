@@ -0,0 +1,63 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// maxNetworkHosts is the maximum number of hosts of a target network, so that
+// a typo in a prefix length does not create millions of targets.
+const maxNetworkHosts = 1 << 16
+
+// expandNetworks replaces the targets whose IP is a network, written in CIDR
+// notation, by one target per host of the network. They keep the name of the
+// network, and their metrics are told apart by their IP.
+func expandNetworks(targets []Target) ([]Target, error) {
+	expanded := make([]Target, 0, len(targets))
+	for _, t := range targets {
+		if !strings.Contains(t.IP, "/") {
+			expanded = append(expanded, t)
+			continue
+		}
+		hosts, err := networkHosts(t.IP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network for %s: %w", t.Name, err)
+		}
+		if t.IPv6 != "" {
+			return nil, fmt.Errorf("invalid network for %s: networks cannot be dual-stack", t.Name)
+		}
+		for _, host := range hosts {
+			t.IP = host.String()
+			expanded = append(expanded, t)
+		}
+	}
+	return expanded, nil
+}
+
+// networkHosts returns the addresses of the hosts of an IPv4 network. The
+// network and broadcast addresses are left out, except for /31 and /32
+// networks which have none.
+func networkHosts(cidr string) ([]netip.Addr, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return nil, err
+	}
+	if !prefix.Addr().Is4() {
+		return nil, fmt.Errorf("%s is not an IPv4 network", cidr)
+	}
+	prefix = prefix.Masked()
+	size := 1 << (32 - prefix.Bits())
+	if size > maxNetworkHosts {
+		return nil, fmt.Errorf("%s holds more than %d addresses", cidr, maxNetworkHosts)
+	}
+
+	hosts := make([]netip.Addr, 0, size)
+	for addr := prefix.Addr(); prefix.Contains(addr); addr = addr.Next() {
+		hosts = append(hosts, addr)
+	}
+	if size > 2 {
+		hosts = hosts[1 : len(hosts)-1]
+	}
+	return hosts, nil
+}
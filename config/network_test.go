@@ -0,0 +1,61 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_expandNetworks(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []Target
+		want    []Target
+		wantErr bool
+	}{
+		{
+			name:    "single addresses",
+			targets: []Target{{Name: "web", IP: "10.0.0.1"}, {Name: "db", Host: "db.internal"}},
+			want:    []Target{{Name: "web", IP: "10.0.0.1"}, {Name: "db", Host: "db.internal"}},
+		},
+		{
+			name:    "network",
+			targets: []Target{{Name: "lan", IP: "10.0.0.0/30", Range: "22"}, {Name: "web", IP: "10.0.1.1"}},
+			want: []Target{
+				{Name: "lan", IP: "10.0.0.1", Range: "22"},
+				{Name: "lan", IP: "10.0.0.2", Range: "22"},
+				{Name: "web", IP: "10.0.1.1"},
+			},
+		},
+		{
+			name:    "unmasked network",
+			targets: []Target{{Name: "lan", IP: "10.0.0.5/31"}},
+			want:    []Target{{Name: "lan", IP: "10.0.0.4"}, {Name: "lan", IP: "10.0.0.5"}},
+		},
+		{name: "single host", targets: []Target{{Name: "web", IP: "10.0.0.1/32"}}, want: []Target{{Name: "web", IP: "10.0.0.1"}}},
+		{name: "too large", targets: []Target{{Name: "lan", IP: "10.0.0.0/15"}}, wantErr: true},
+		{name: "invalid", targets: []Target{{Name: "lan", IP: "10.0.0.0/33"}}, wantErr: true},
+		{name: "IPv6", targets: []Target{{Name: "lan", IP: "2001:db8::/120"}}, wantErr: true},
+		{name: "dual-stack", targets: []Target{{Name: "lan", IP: "10.0.0.0/30", IPv6: "2001:db8::1"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandNetworks(tt.targets)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandNetworks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandNetworks() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_networkHosts_size(t *testing.T) {
+	hosts, err := networkHosts("10.0.0.0/22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 1022 || hosts[0].String() != "10.0.0.1" || hosts[len(hosts)-1].String() != "10.0.3.254" {
+		t.Errorf("networkHosts(10.0.0.0/22) = %d hosts from %s to %s, want 1022 hosts from 10.0.0.1 to 10.0.3.254", len(hosts), hosts[0], hosts[len(hosts)-1])
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxTemplateTargets is the maximum number of targets a template can expand
+// into, so that a typo in a range does not exhaust the memory.
+const maxTemplateTargets = 100000
+
+// TargetTemplate describes many similar targets at once. The target is
+// created for each combination of the values of the loop variables, its
+// strings being Go templates which can use the variables, such as
+// "web-{{ .N }}".
+type TargetTemplate struct {
+	// Loop holds the values of each variable. Values such as 1-20 expand
+	// into the numbers they cover.
+	Loop map[string][]string `yaml:"loop"`
+	// Vars holds variables which have the same value for all the targets.
+	Vars   map[string]string `yaml:"vars"`
+	Target yaml.Node         `yaml:"target"`
+}
+
+// templateFuncs are the functions the templates can use on top of the
+// standard ones.
+var templateFuncs = template.FuncMap{
+	"add": func(a, b int) int { return a + b },
+	"sub": func(a, b int) int { return a - b },
+	"mul": func(a, b int) int { return a * b },
+}
+
+// Expand creates the targets described by the template.
+func (tt *TargetTemplate) Expand() ([]Target, error) {
+	if tt.Target.Kind == 0 {
+		return nil, fmt.Errorf("no target provided")
+	}
+
+	// Variables are iterated in the order of their names, so that the
+	// targets are created in the same order every time
+	names := slices.Sorted(maps.Keys(tt.Loop))
+	values := make([][]any, len(names))
+	count := 1
+	for i, name := range names {
+		v, err := loopValues(tt.Loop[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid values of %s: %w", name, err)
+		}
+		if len(v) == 0 {
+			return nil, fmt.Errorf("no values provided for %s", name)
+		}
+		values[i] = v
+		count *= len(v)
+		if count > maxTemplateTargets {
+			return nil, fmt.Errorf("template expands into more than %d targets", maxTemplateTargets)
+		}
+	}
+
+	targets := make([]Target, 0, count)
+	indexes := make([]int, len(names))
+	for {
+		data := make(map[string]any, len(tt.Vars)+len(names))
+		for k, v := range tt.Vars {
+			data[k] = v
+		}
+		for i, name := range names {
+			data[name] = values[i][indexes[i]]
+		}
+
+		node, err := renderNode(&tt.Target, data)
+		if err != nil {
+			return nil, err
+		}
+		var t Target
+		if err := node.Decode(&t); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+
+		// Move to the next combination, the last variable changing first
+		i := len(names) - 1
+		for ; i >= 0; i-- {
+			indexes[i]++
+			if indexes[i] < len(values[i]) {
+				break
+			}
+			indexes[i] = 0
+		}
+		if i < 0 {
+			return targets, nil
+		}
+	}
+}
+
+// loopValues expands the values of a loop variable. Ranges of numbers become
+// the numbers they cover, and other values are kept as they are.
+func loopValues(specs []string) ([]any, error) {
+	var values []any
+	for _, spec := range specs {
+		first, last, ok := strings.Cut(spec, "-")
+		from, errFrom := strconv.Atoi(first)
+		to, errTo := strconv.Atoi(last)
+		if !ok || errFrom != nil || errTo != nil {
+			if n, err := strconv.Atoi(spec); err == nil {
+				values = append(values, n)
+			} else {
+				values = append(values, spec)
+			}
+			continue
+		}
+		if from > to {
+			return nil, fmt.Errorf("range %s is reversed", spec)
+		}
+		if to-from >= maxTemplateTargets {
+			return nil, fmt.Errorf("range %s is too large", spec)
+		}
+		for n := from; n <= to; n++ {
+			values = append(values, n)
+		}
+	}
+	return values, nil
+}
+
+// renderNode returns a copy of the node whose strings are executed as
+// templates with data.
+func renderNode(n *yaml.Node, data map[string]any) (*yaml.Node, error) {
+	c := *n
+	if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "{{") {
+		tmpl, err := template.New("target").Funcs(templateFuncs).Option("missingkey=error").Parse(n.Value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n.Line, err)
+		}
+		c.Value = b.String()
+		// The rendered value is typed again, so that templates can fill
+		// numbers and booleans
+		c.Tag = ""
+		c.Style = 0
+	}
+	if len(n.Content) > 0 {
+		c.Content = make([]*yaml.Node, len(n.Content))
+		for i, child := range n.Content {
+			var err error
+			if c.Content[i], err = renderNode(child, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &c, nil
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNew_targetTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Target
+		wantErr bool
+	}{
+		{
+			name: "loop over numbers and names",
+			content: `targets:
+  - name: db
+    ip: 10.0.0.1
+target_templates:
+  - loop:
+      DC: [par, ams]
+      N: ["1-2"]
+    vars:
+      Domain: example.com
+    target:
+      name: "web-{{ .DC }}-{{ .N }}.{{ .Domain }}"
+      ip: "10.{{ if eq .DC \"par\" }}1{{ else }}2{{ end }}.0.{{ add .N 10 }}"
+      queries_per_sec: "{{ mul .N 100 }}"
+      labels:
+        host: "{{ printf \"%02d\" .N }}"
+`,
+			want: []Target{
+				{Name: "db", IP: "10.0.0.1"},
+				{Name: "web-par-1.example.com", IP: "10.1.0.11", QueriesPerSecond: 100, Labels: map[string]string{"host": "01"}},
+				{Name: "web-par-2.example.com", IP: "10.1.0.12", QueriesPerSecond: 200, Labels: map[string]string{"host": "02"}},
+				{Name: "web-ams-1.example.com", IP: "10.2.0.11", QueriesPerSecond: 100, Labels: map[string]string{"host": "01"}},
+				{Name: "web-ams-2.example.com", IP: "10.2.0.12", QueriesPerSecond: 200, Labels: map[string]string{"host": "02"}},
+			},
+		},
+		{
+			name: "no loop",
+			content: `target_templates:
+  - vars:
+      N: "7"
+    target:
+      name: "web-{{ .N }}"
+      ip: 10.0.0.7
+`,
+			want: []Target{{Name: "web-7", IP: "10.0.0.7"}},
+		},
+		{
+			name:    "unknown variable",
+			content: "target_templates:\n  - target:\n      name: \"web-{{ .N }}\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "reversed range",
+			content: "target_templates:\n  - loop:\n      N: [\"5-1\"]\n    target:\n      name: \"web-{{ .N }}\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "too many targets",
+			content: "target_templates:\n  - loop:\n      A: [\"1-1000\"]\n      B: [\"1-1000\"]\n    target:\n      name: \"web-{{ .A }}-{{ .B }}\"\n",
+			wantErr: true,
+		},
+		{
+			name:    "no target",
+			content: "target_templates:\n  - loop:\n      N: [\"1-2\"]\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			c, err := New(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(c.Targets, tt.want) {
+				t.Errorf("New() targets = %+v, want %+v", c.Targets, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Package consul generates targets from the services registered in Consul.
+package consul
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+const (
+	// defaultURL is the address of the local Consul agent.
+	defaultURL = "http://localhost:8500"
+	// defaultRange is the range of ports scanned on generated targets when
+	// none is configured. Expected ports are always added to it.
+	defaultRange = "reserved"
+)
+
+// Client fetches services from the Consul catalog.
+type Client struct {
+	conf   *config.Consul
+	url    string
+	client *http.Client
+}
+
+// instance is an instance of a service in the catalog.
+type instance struct {
+	Node           string   `json:"Node"`
+	Address        string   `json:"Address"`
+	ServiceName    string   `json:"ServiceName"`
+	ServiceAddress string   `json:"ServiceAddress"`
+	ServicePort    int      `json:"ServicePort"`
+	ServiceTags    []string `json:"ServiceTags"`
+}
+
+// New creates a Consul client.
+func New(conf *config.Consul) (*Client, error) {
+	u := conf.URL
+	if u == "" {
+		u = defaultURL
+	}
+	if _, err := url.Parse(u); err != nil {
+		return nil, fmt.Errorf("invalid Consul URL: %w", err)
+	}
+	return &Client{
+		conf:   conf,
+		url:    strings.TrimSuffix(u, "/"),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Targets generates one target per address of the instances of the services
+// carrying all the configured tags. The ports of the instances are the
+// expected ports of the target, which is named after the node of the first of
+// them. Instances registered with a hostname rather than an IP address are
+// skipped.
+func (c *Client) Targets() ([]config.Target, error) {
+	services := c.conf.Services
+	if len(services) == 0 {
+		var catalog map[string][]string
+		if err := c.get("/v1/catalog/services", &catalog); err != nil {
+			return nil, err
+		}
+		for name, tags := range catalog {
+			if c.tagged(tags) {
+				services = append(services, name)
+			}
+		}
+		sort.Strings(services)
+	}
+
+	names := make(map[string]string)
+	expected := make(map[string]map[int]bool)
+	for _, svc := range services {
+		var instances []instance
+		if err := c.get("/v1/catalog/service/"+url.PathEscape(svc), &instances); err != nil {
+			return nil, err
+		}
+		for _, inst := range instances {
+			if !c.tagged(inst.ServiceTags) || inst.ServicePort <= 0 {
+				continue
+			}
+			ip := inst.ServiceAddress
+			if ip == "" {
+				ip = inst.Address
+			}
+			if net.ParseIP(ip) == nil {
+				continue
+			}
+			if expected[ip] == nil {
+				names[ip] = inst.Node
+				expected[ip] = make(map[int]bool)
+			}
+			expected[ip][inst.ServicePort] = true
+		}
+	}
+
+	scanRange := c.conf.Range
+	if scanRange == "" {
+		scanRange = defaultRange
+	}
+
+	var targets []config.Target
+	for ip, ports := range expected {
+		var sorted []int
+		for p := range ports {
+			sorted = append(sorted, p)
+		}
+		sort.Ints(sorted)
+		var exp []string
+		for _, p := range sorted {
+			exp = append(exp, strconv.Itoa(p))
+		}
+
+		labels := make(map[string]string)
+		for k, v := range c.conf.Labels {
+			labels[k] = v
+		}
+
+		t := config.Target{
+			Name:   names[ip],
+			IP:     ip,
+			Labels: labels,
+		}
+		t.TCP.Period = c.conf.Period
+		t.ICMP.Period = c.conf.ICMPPeriod
+		t.TCP.Expected = strings.Join(exp, ",")
+		// Expected ports must be scanned to be seen open
+		t.TCP.Range = scanRange + "," + t.TCP.Expected
+		targets = append(targets, t)
+	}
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].IP < targets[j].IP })
+	return targets, nil
+}
+
+// tagged reports whether tags hold all the configured tags.
+func (c *Client) tagged(tags []string) bool {
+	for _, t := range c.conf.Tags {
+		if !slices.Contains(tags, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// get fetches an API endpoint and decodes its response in v.
+func (c *Client) get(path string, v any) error {
+	u := c.url + path
+	if c.conf.Datacenter != "" {
+		u += "?dc=" + url.QueryEscape(c.conf.Datacenter)
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.conf.Token != "" {
+		req.Header.Set("X-Consul-Token", c.conf.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Consul returned status %s for %s", resp.Status, path)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("cannot decode Consul response: %w", err)
+	}
+	return nil
+}
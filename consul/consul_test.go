@@ -0,0 +1,120 @@
+package consul
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+func TestClient_Targets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Consul-Token") != "secret" || r.URL.Query().Get("dc") != "paris" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/catalog/services":
+			fmt.Fprint(w, `{"consul": [], "web": ["scanned", "public"], "db": ["scanned"], "cache": []}`)
+		case "/v1/catalog/service/consul":
+			fmt.Fprint(w, `[{"Node": "server1", "Address": "10.0.0.9", "ServiceName": "consul", "ServicePort": 8300, "ServiceTags": []}]`)
+		case "/v1/catalog/service/web":
+			fmt.Fprint(w, `[
+				{"Node": "node1", "Address": "10.0.0.1", "ServiceName": "web", "ServiceAddress": "", "ServicePort": 443, "ServiceTags": ["scanned", "public"]},
+				{"Node": "node1", "Address": "10.0.0.1", "ServiceName": "web", "ServiceAddress": "", "ServicePort": 80, "ServiceTags": ["scanned"]},
+				{"Node": "node2", "Address": "10.0.0.2", "ServiceName": "web", "ServiceAddress": "web.internal", "ServicePort": 80, "ServiceTags": ["scanned"]}
+			]`)
+		case "/v1/catalog/service/db":
+			fmt.Fprint(w, `[
+				{"Node": "node1", "Address": "10.0.0.1", "ServiceName": "db", "ServiceAddress": "", "ServicePort": 5432, "ServiceTags": ["scanned"]},
+				{"Node": "node3", "Address": "10.0.0.3", "ServiceName": "db", "ServiceAddress": "172.16.0.3", "ServicePort": 5432, "ServiceTags": ["scanned"]}
+			]`)
+		case "/v1/catalog/service/cache":
+			fmt.Fprint(w, `[{"Node": "node4", "Address": "10.0.0.4", "ServiceName": "cache", "ServicePort": 6379, "ServiceTags": []}]`)
+		default:
+			// Consul knows no instance of unknown services
+			fmt.Fprint(w, `[]`)
+		}
+	}))
+	defer srv.Close()
+
+	target := func(name, ip, expected, scanRange string) config.Target {
+		t := config.Target{Name: name, IP: ip, Labels: map[string]string{"source": "consul"}}
+		t.TCP.Expected, t.TCP.Range, t.TCP.Period = expected, scanRange, "6h"
+		return t
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		services []string
+		tags     []string
+		want     []config.Target
+		wantErr  bool
+	}{
+		{
+			name: "all services",
+			want: []config.Target{
+				target("node1", "10.0.0.1", "80,443,5432", "1-100,80,443,5432"),
+				target("node4", "10.0.0.4", "6379", "1-100,6379"),
+				target("server1", "10.0.0.9", "8300", "1-100,8300"),
+				target("node3", "172.16.0.3", "5432", "1-100,5432"),
+			},
+		},
+		{
+			name: "tags",
+			tags: []string{"scanned"},
+			want: []config.Target{
+				target("node1", "10.0.0.1", "80,443,5432", "1-100,80,443,5432"),
+				target("node3", "172.16.0.3", "5432", "1-100,5432"),
+			},
+		},
+		{
+			name:     "services and tags",
+			services: []string{"web"},
+			tags:     []string{"public"},
+			want:     []config.Target{target("node1", "10.0.0.1", "443", "1-100,443")},
+		},
+		{
+			name:     "unknown service",
+			services: []string{"mail"},
+		},
+		{
+			name:    "invalid token",
+			token:   "guessed",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := tt.token
+			if token == "" {
+				token = "secret"
+			}
+			c, err := New(&config.Consul{
+				URL:        srv.URL,
+				Token:      token,
+				Datacenter: "paris",
+				Services:   tt.services,
+				Tags:       tt.tags,
+				Range:      "1-100",
+				Period:     "6h",
+				Labels:     map[string]string{"source": "consul"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := c.Targets()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Targets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Targets() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/devops-works/scan-exporter/results"
+)
+
+// Exit codes of the diff subcommand, as for diff(1).
+const (
+	diffSame    = 0
+	diffChanged = 1
+	diffFailed  = 2
+)
+
+// targetDiff holds the ports of a target whose state changed between two
+// result sets.
+type targetDiff struct {
+	Name, IP       string
+	Added, Removed bool
+	Opened, Closed []string
+}
+
+// runDiff compares two exported result sets and prints the ports that were
+// opened or closed on each target. It exits with 1 if ports changed, and 2 if
+// the comparison failed.
+// Usage: scan-exporter diff <old.json> <new.json>
+func runDiff(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return &exitError{code: diffFailed, err: err}
+	}
+	if fs.NArg() != 2 {
+		return &exitError{code: diffFailed, err: errors.New("usage: scan-exporter diff <old.json> <new.json>")}
+	}
+
+	var sets [2][]results.Scan
+	for i, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return &exitError{code: diffFailed, err: err}
+		}
+		sets[i], err = readRecordedScans(f)
+		f.Close()
+		if err != nil {
+			return &exitError{code: diffFailed, err: fmt.Errorf("cannot read %s: %w", path, err)}
+		}
+	}
+
+	diffs := diffScans(sets[0], sets[1])
+	for _, d := range diffs {
+		var changes []string
+		switch {
+		case d.Added:
+			changes = append(changes, "new target")
+		case d.Removed:
+			changes = append(changes, "removed target")
+		}
+		if len(d.Opened) > 0 {
+			changes = append(changes, "opened "+strings.Join(d.Opened, ","))
+		}
+		if len(d.Closed) > 0 {
+			changes = append(changes, "closed "+strings.Join(d.Closed, ","))
+		}
+		fmt.Fprintf(stdout, "%s (%s): %s\n", d.Name, d.IP, strings.Join(changes, ", "))
+	}
+
+	if len(diffs) > 0 {
+		return &exitError{code: diffChanged}
+	}
+	return nil
+}
+
+// diffScans compares the latest scan of each target in two result sets. Only
+// targets whose open ports changed are returned, sorted by name and IP.
+func diffScans(old, current []results.Scan) []targetDiff {
+	before, after := latestScans(old), latestScans(current)
+
+	var diffs []targetDiff
+	for ip, scan := range after {
+		prev, ok := before[ip]
+		d := targetDiff{
+			Name:   scan.Name,
+			IP:     ip,
+			Added:  !ok,
+			Opened: portsDiff(scan.Open, prev.Open),
+			Closed: portsDiff(prev.Open, scan.Open),
+		}
+		if d.Added || len(d.Opened) > 0 || len(d.Closed) > 0 {
+			diffs = append(diffs, d)
+		}
+	}
+	for ip, scan := range before {
+		if _, ok := after[ip]; !ok {
+			diffs = append(diffs, targetDiff{Name: scan.Name, IP: ip, Removed: true, Closed: portsDiff(scan.Open, nil)})
+		}
+	}
+
+	sort.Slice(diffs, func(i, j int) bool {
+		if diffs[i].Name != diffs[j].Name {
+			return diffs[i].Name < diffs[j].Name
+		}
+		return diffs[i].IP < diffs[j].IP
+	})
+	return diffs
+}
+
+// latestScans returns the latest scan of each target, indexed by IP.
+func latestScans(scans []results.Scan) map[string]results.Scan {
+	latest := make(map[string]results.Scan)
+	for _, scan := range scans {
+		if prev, ok := latest[scan.IP]; !ok || !scan.End.Before(prev.End) {
+			latest[scan.IP] = scan
+		}
+	}
+	return latest
+}
+
+// portsDiff returns the ports of a that are not in b, sorted numerically.
+func portsDiff(a, b []string) []string {
+	var diff []string
+	for _, port := range a {
+		if !slices.Contains(b, port) && !slices.Contains(diff, port) {
+			diff = append(diff, port)
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool {
+		pi, _ := strconv.Atoi(diff[i])
+		pj, _ := strconv.Atoi(diff[j])
+		return pi < pj
+	})
+	return diff
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func Test_diffScans(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	web := results.Scan{Name: "web", IP: "10.0.0.1", End: start, Open: []string{"80", "443"}}
+	db := results.Scan{Name: "db", IP: "10.0.0.2", End: start, Open: []string{"5432"}}
+	tests := []struct {
+		name    string
+		old     []results.Scan
+		current []results.Scan
+		want    []targetDiff
+	}{
+		{name: "same", old: []results.Scan{web, db}, current: []results.Scan{db, web}, want: nil},
+		{
+			name:    "opened and closed",
+			old:     []results.Scan{web},
+			current: []results.Scan{{Name: "web", IP: "10.0.0.1", Open: []string{"8080", "22", "80"}}},
+			want:    []targetDiff{{Name: "web", IP: "10.0.0.1", Opened: []string{"22", "8080"}, Closed: []string{"443"}}},
+		},
+		{
+			name:    "added and removed targets",
+			old:     []results.Scan{web},
+			current: []results.Scan{db},
+			want: []targetDiff{
+				{Name: "db", IP: "10.0.0.2", Added: true, Opened: []string{"5432"}},
+				{Name: "web", IP: "10.0.0.1", Removed: true, Closed: []string{"80", "443"}},
+			},
+		},
+		{
+			name:    "latest scan of each target",
+			old:     []results.Scan{web, {Name: "web", IP: "10.0.0.1", End: start.Add(-time.Hour), Open: []string{"22"}}},
+			current: []results.Scan{web, {Name: "web", IP: "10.0.0.1", End: start.Add(-time.Hour), Open: []string{"22"}}},
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diffScans(tt.old, tt.current); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffScans() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_runDiff(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	old := write("old.json", `[{"name":"web","ip":"10.0.0.1","open":["80","443"]}]`)
+	same := write("same.json", `[{"name":"web","ip":"10.0.0.1","open":["443","80"]}]`)
+	changed := write("changed.json", `[{"name":"web","ip":"10.0.0.1","open":["22","80"]}]`)
+	invalid := write("invalid.json", `[{"name":`)
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     string
+		wantCode int
+	}{
+		{name: "same", args: []string{old, same}, want: "", wantCode: diffSame},
+		{name: "changed", args: []string{old, changed}, want: "web (10.0.0.1): opened 22, closed 443\n", wantCode: diffChanged},
+		{name: "invalid file", args: []string{old, invalid}, wantCode: diffFailed},
+		{name: "missing file", args: []string{old, filepath.Join(dir, "missing.json")}, wantCode: diffFailed},
+		{name: "missing argument", args: []string{old}, wantCode: diffFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runDiff(tt.args, &out)
+
+			code := 0
+			var exit *exitError
+			if errors.As(err, &exit) {
+				code = exit.code
+			} else if err != nil {
+				t.Fatalf("runDiff() error = %v, want an exit error", err)
+			}
+			if code != tt.wantCode {
+				t.Errorf("runDiff() exit code = %d, want %d", code, tt.wantCode)
+			}
+			if out.String() != tt.want {
+				t.Errorf("runDiff() output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+// Package filesd generates targets from files in the format of Prometheus'
+// file_sd_configs, so that the files written for Prometheus by configuration
+// management can be reused.
+package filesd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultRange is the range of ports scanned on generated targets when none is
+// configured. Expected ports are always added to it.
+const defaultRange = "reserved"
+
+// nameLabel is the label of a group naming its targets.
+const nameLabel = "name"
+
+// group is a group of targets sharing labels, as written in a file.
+type group struct {
+	Targets []string          `json:"targets" yaml:"targets"`
+	Labels  map[string]string `json:"labels" yaml:"labels"`
+}
+
+// host gathers the ports of an address found in the files.
+type host struct {
+	name   string
+	labels map[string]string
+	ports  map[int]bool
+}
+
+// Client reads targets from files.
+type Client struct {
+	conf *config.FileSD
+}
+
+// New creates a client reading the files matching the patterns of conf. Like
+// in Prometheus, the patterns must end in .json, .yml or .yaml, and only their
+// last element may hold wildcards.
+func New(conf *config.FileSD) (*Client, error) {
+	if len(conf.Files) == 0 {
+		return nil, errors.New("no files provided for file_sd")
+	}
+	for _, p := range conf.Files {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("invalid file_sd pattern %q: %w", p, err)
+		}
+		if strings.ContainsAny(filepath.Dir(p), "*?[") {
+			return nil, fmt.Errorf("invalid file_sd pattern %q: only the file name may hold wildcards", p)
+		}
+		switch filepath.Ext(p) {
+		case ".json", ".yml", ".yaml":
+		default:
+			return nil, fmt.Errorf("invalid file_sd pattern %q: files must end in .json, .yml or .yaml", p)
+		}
+	}
+	return &Client{conf: conf}, nil
+}
+
+// Targets generates one target per IP address of the files. The ports of its
+// entries are the expected ports of the target, which is named after the name
+// label of its first group, or its address. The other labels of the group are
+// added to the ones of the target. Entries holding a hostname rather than an
+// IP address are skipped.
+//
+// Reading stops at the first invalid file, so that a file being written does
+// not remove its targets.
+func (c *Client) Targets() ([]config.Target, error) {
+	var files []string
+	for _, p := range c.conf.Files {
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	slices.Sort(files)
+	files = slices.Compact(files)
+
+	hosts := make(map[string]*host)
+	for _, f := range files {
+		groups, err := readFile(f)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Removed since listed
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot read %s: %w", f, err)
+		}
+		for _, g := range groups {
+			for _, entry := range g.Targets {
+				ip, port, err := splitTarget(entry)
+				if err != nil {
+					return nil, fmt.Errorf("invalid target %q in %s: %w", entry, f, err)
+				}
+				if net.ParseIP(ip) == nil {
+					continue
+				}
+				h, ok := hosts[ip]
+				if !ok {
+					h = c.newHost(ip, g.Labels)
+					hosts[ip] = h
+				}
+				if port > 0 {
+					h.ports[port] = true
+				}
+			}
+		}
+	}
+
+	scanRange := c.conf.Range
+	if scanRange == "" {
+		scanRange = defaultRange
+	}
+
+	var targets []config.Target
+	for ip, h := range hosts {
+		var sorted []int
+		for p := range h.ports {
+			sorted = append(sorted, p)
+		}
+		sort.Ints(sorted)
+		var exp []string
+		for _, p := range sorted {
+			exp = append(exp, strconv.Itoa(p))
+		}
+
+		t := config.Target{
+			Name:   h.name,
+			IP:     ip,
+			Labels: h.labels,
+		}
+		t.TCP.Period = c.conf.Period
+		t.ICMP.Period = c.conf.ICMPPeriod
+		t.TCP.Expected = strings.Join(exp, ",")
+		t.TCP.Range = scanRange
+		if t.TCP.Expected != "" {
+			// Expected ports must be scanned to be seen open
+			t.TCP.Range += "," + t.TCP.Expected
+		}
+		targets = append(targets, t)
+	}
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].IP < targets[j].IP })
+	return targets, nil
+}
+
+// newHost creates the host of an address, from the labels of its first group.
+// Labels starting with __ are internal to Prometheus and ignored.
+func (c *Client) newHost(ip string, groupLabels map[string]string) *host {
+	h := &host{
+		name:   ip,
+		labels: make(map[string]string),
+		ports:  make(map[int]bool),
+	}
+	for k, v := range c.conf.Labels {
+		h.labels[k] = v
+	}
+	for k, v := range groupLabels {
+		switch {
+		case k == nameLabel:
+			h.name = v
+		case strings.HasPrefix(k, "__"):
+		default:
+			h.labels[k] = v
+		}
+	}
+	return h
+}
+
+// Watch reports on the returned channel the changes in the directories of the
+// files, until done is closed. Changes happening before the previous one is
+// received are reported once. Errors of the watcher are reported as changes,
+// as events may have been lost.
+func (c *Client) Watch(done <-chan struct{}) (<-chan struct{}, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	watched := make(map[string]bool)
+	for _, p := range c.conf.Files {
+		dir := filepath.Dir(p)
+		if watched[dir] {
+			continue
+		}
+		if err := w.Add(dir); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("cannot watch %s: %w", dir, err)
+		}
+		watched[dir] = true
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer w.Close()
+		for {
+			select {
+			case <-done:
+				return
+			case _, ok := <-w.Events:
+				if !ok {
+					return
+				}
+			case _, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+			}
+			select {
+			case changes <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// readFile decodes the groups of a file, according to its extension.
+func readFile(path string) ([]group, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var groups []group
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, &groups)
+	} else {
+		err = yaml.Unmarshal(data, &groups)
+	}
+	return groups, err
+}
+
+// splitTarget splits an entry into its address and its port, which is 0 when
+// the entry has none.
+func splitTarget(entry string) (string, int, error) {
+	h, p, err := net.SplitHostPort(entry)
+	if err != nil {
+		// Entries may hold no port, including bare IPv6 addresses
+		return strings.Trim(entry, "[]"), 0, nil
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port %q", p)
+	}
+	return h, port, nil
+}
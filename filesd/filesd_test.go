@@ -0,0 +1,147 @@
+package filesd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		wantErr bool
+	}{
+		{name: "valid", files: []string{"/etc/targets/*.yml", "/etc/targets/db.json"}},
+		{name: "no files", wantErr: true},
+		{name: "invalid pattern", files: []string{"/etc/targets/[.yml"}, wantErr: true},
+		{name: "wildcard in directory", files: []string{"/etc/*/targets.yml"}, wantErr: true},
+		{name: "invalid extension", files: []string{"/etc/targets/*"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(&config.FileSD{Files: tt.files}); (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClient_Targets(t *testing.T) {
+	dir := t.TempDir()
+	write(t, filepath.Join(dir, "web.yml"), `
+- targets: ["10.0.0.1:443", "10.0.0.1:80", "web.internal:80", "[fd00::1]:22"]
+  labels:
+    name: web
+    owner: web-team
+    __meta_source: cmdb
+`)
+	write(t, filepath.Join(dir, "db.json"), `[
+		{"targets": ["10.0.0.7:5432", "10.0.0.1:5432"], "labels": {"name": "db"}},
+		{"targets": ["10.0.0.9"]}
+	]`)
+	write(t, filepath.Join(dir, "ignored.txt"), `not targets`)
+
+	target := func(name, ip, expected, scanRange string, labels map[string]string) config.Target {
+		t := config.Target{Name: name, IP: ip, Labels: labels}
+		t.TCP.Expected, t.TCP.Range, t.TCP.Period = expected, scanRange, "6h"
+		return t
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []config.Target
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			want: []config.Target{
+				// Files are read in lexical order
+				target("db", "10.0.0.1", "80,443,5432", "1-100,80,443,5432", map[string]string{"env": "prod"}),
+				target("db", "10.0.0.7", "5432", "1-100,5432", map[string]string{"env": "prod"}),
+				target("10.0.0.9", "10.0.0.9", "", "1-100", map[string]string{"env": "prod"}),
+				target("web", "fd00::1", "22", "1-100,22", map[string]string{"env": "prod", "owner": "web-team"}),
+			},
+		},
+		{name: "invalid file", content: `- targets: [`, wantErr: true},
+		{name: "invalid port", content: `[{"targets": ["10.0.0.3:ssh"]}]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := []string{filepath.Join(dir, "*.yml"), filepath.Join(dir, "*.json"), filepath.Join(dir, "web.yml")}
+			if tt.content != "" {
+				path := filepath.Join(t.TempDir(), "invalid.yaml")
+				write(t, path, tt.content)
+				files = append(files, path)
+			}
+			c, err := New(&config.FileSD{
+				Files:  files,
+				Range:  "1-100",
+				Period: "6h",
+				Labels: map[string]string{"env": "prod"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := c.Targets()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Targets() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Targets() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_Watch(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(&config.FileSD{Files: []string{filepath.Join(dir, "*.yml")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+
+	changes, err := c.Watch(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Fatal("change reported before any file was written")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	write(t, filepath.Join(dir, "web.yml"), `[{"targets": ["10.0.0.1:80"]}]`)
+	select {
+	case <-changes:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change reported after a file was written")
+	}
+	targets, err := c.Targets()
+	if err != nil || len(targets) != 1 {
+		t.Errorf("Targets() = %+v, %v, want the written target", targets, err)
+	}
+
+	missing, err := New(&config.FileSD{Files: []string{filepath.Join(dir, "missing", "*.yml")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := missing.Watch(done); err == nil {
+		t.Errorf("Watch() of a missing directory succeeded")
+	}
+}
+
+func write(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func TestBasicAuth(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		user, pass string
+		noAuth     bool
+		wantStatus int
+	}{
+		{name: "authenticated", url: "/api/v1/results", user: "prometheus", pass: "s3cret", wantStatus: http.StatusOK},
+		{name: "wrong password", url: "/api/v1/results", user: "prometheus", pass: "secret", wantStatus: http.StatusUnauthorized},
+		{name: "wrong username", url: "/api/v1/results", user: "admin", pass: "s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "no credentials", url: "/metrics", noAuth: true, wantStatus: http.StatusUnauthorized},
+		{name: "health check", url: "/health", noAuth: true, wantStatus: http.StatusOK},
+	}
+	h := BasicAuth(HandleFunc(results.New(), nil, nil, nil, nil, nil, "1.2.3"), "prometheus", "s3cret")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if !tt.noAuth {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Errorf("GET %s returned status %d, want %d", tt.url, rr.Code, tt.wantStatus)
+			}
+			if rr.Code == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("GET %s did not ask for credentials", tt.url)
+			}
+		})
+	}
+}
@@ -1,25 +1,325 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"math/rand"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/devops-works/scan-exporter/history"
+	"github.com/devops-works/scan-exporter/nmap"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
 	"github.com/gorilla/mux"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
 )
 
-// HandleFunc fills the router.
-func HandleFunc() *mux.Router {
+// Targets controls the scans of the targets.
+type Targets interface {
+	// Pause suspends the scans of the targets with the given name for a
+	// duration, or until they are resumed when d is 0. It reports whether
+	// such a target exists.
+	Pause(name string, d time.Duration) bool
+	// Resume ends the pause of the targets with the given name. It reports
+	// whether such a target exists.
+	Resume(name string) bool
+}
+
+// Lifecycle controls scan-exporter itself.
+type Lifecycle interface {
+	// Reload reads the configuration again and applies its changes.
+	Reload() error
+	// Quit stops scan-exporter gracefully, once the request is answered.
+	Quit()
+}
+
+// HandleFunc fills the router. The dashboard and the API handlers serve the
+// results held in res, produced by the given version of scan-exporter. They
+// manage the silences of the notifications, the targets and scan-exporter
+// itself when silences, targets and lifecycle are not nil, and probe ports on
+// demand when prober is not nil. They serve the history of the scans when
+// hist is not nil.
+func HandleFunc(res *results.Store, silences *notify.Silences, targets Targets, lifecycle Lifecycle, prober Prober, hist *history.Store, version string) *mux.Router {
 	r := mux.NewRouter()
 	r.Handle("/metrics", promhttp.Handler())
 	r.Handle("/health", http.HandlerFunc(healthCheckPage))
+	r.Handle("/", http.RedirectHandler("/ui/", http.StatusFound)).Methods(http.MethodGet)
+	r.Handle("/ui/", dashboardPage(res)).Methods(http.MethodGet)
+	r.Handle("/ui/targets/{name}", targetPage(res)).Methods(http.MethodGet)
+	r.Handle("/ui/style.css", http.FileServerFS(uiFS)).Methods(http.MethodGet)
+	r.Handle("/api/v1/results", resultsPage(res)).Methods(http.MethodGet)
+	r.Handle("/api/v1/results/nmap", nmapResultsPage(res, version)).Methods(http.MethodGet)
+	r.Handle("/api/v1/targets/{name}/scans", scansPage(res)).Methods(http.MethodGet)
+	if hist != nil {
+		r.Handle("/api/v1/targets/{name}/history", historyPage(hist)).Methods(http.MethodGet)
+	}
+	if silences != nil {
+		r.Handle("/api/v1/silences", silencesPage(silences)).Methods(http.MethodGet)
+		r.Handle("/api/v1/silences", createSilencePage(silences)).Methods(http.MethodPost)
+		r.Handle("/api/v1/silences/{id}", deleteSilencePage(silences)).Methods(http.MethodDelete)
+	}
+	if targets != nil {
+		r.Handle("/api/v1/targets/{name}/pause", pausePage(targets)).Methods(http.MethodPost)
+		r.Handle("/api/v1/targets/{name}/resume", resumePage(targets)).Methods(http.MethodPost)
+	}
+	if lifecycle != nil {
+		// Same endpoints as Prometheus, so that the automation reloading
+		// it works with scan-exporter as well
+		r.Handle("/-/reload", reloadPage(lifecycle)).Methods(http.MethodPost, http.MethodPut)
+		r.Handle("/-/quit", quitPage(lifecycle)).Methods(http.MethodPost, http.MethodPut)
+	}
+	if prober != nil {
+		r.Handle("/probe", probePage(prober)).Methods(http.MethodGet)
+	}
 	r.NotFoundHandler = http.HandlerFunc(notFoundPage)
 
 	return r
 }
 
+// resultsPage renders the latest results of all targets in JSON.
+func resultsPage(res *results.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(res.All()); err != nil {
+			log.Error().Err(err).Msg("cannot render results")
+		}
+	}
+}
+
+// nmapResultsPage renders the latest results of all targets in nmap XML.
+func nmapResultsPage(res *results.Store, version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		if err := nmap.FromResults(res.All(), version).Write(w); err != nil {
+			log.Error().Err(err).Msg("cannot render nmap results")
+		}
+	}
+}
+
+// defaultScansLimit is the number of scan summaries rendered when no limit is
+// given.
+const defaultScansLimit = 20
+
+// scansPage renders in JSON the summaries of the latest scans of a target,
+// whose number is given by the limit parameter.
+func scansPage(res *results.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := defaultScansLimit
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+				http.Error(w, "invalid limit: a positive number is expected", http.StatusBadRequest)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		sums := res.Summaries(mux.Vars(r)["name"], limit)
+		if sums == nil {
+			sums = []results.Summary{}
+		}
+		if err := json.NewEncoder(w).Encode(sums); err != nil {
+			log.Error().Err(err).Msg("cannot render scan summaries")
+		}
+	}
+}
+
+// defaultHistoryLimit is the number of history records rendered when no limit
+// is given.
+const defaultHistoryLimit = 100
+
+// historyPage renders in JSON the records of the scans of a target, the most
+// recent first. The port parameter only keeps the scans in which the port
+// changed state, the since parameter, a duration, the scans of this last
+// period, and the limit parameter gives their maximum number.
+func historyPage(hist *history.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit := defaultHistoryLimit
+		if l := q.Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit <= 0 {
+				http.Error(w, "invalid limit: a positive number is expected", http.StatusBadRequest)
+				return
+			}
+		}
+		var since time.Time
+		if s := q.Get("since"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				http.Error(w, "invalid since: a positive duration is expected", http.StatusBadRequest)
+				return
+			}
+			since = time.Now().Add(-d)
+		}
+		port := q.Get("port")
+		if port != "" {
+			if p, err := strconv.Atoi(port); err != nil || p < 0 || p > 65535 {
+				http.Error(w, "invalid port", http.StatusBadRequest)
+				return
+			}
+		}
+
+		records, err := hist.Records(mux.Vars(r)["name"], notify.ProtoTCP, port, since, limit)
+		if err != nil {
+			log.Error().Err(err).Msg("cannot read history")
+			http.Error(w, "cannot read history", http.StatusInternalServerError)
+			return
+		}
+		if records == nil {
+			records = []history.Record{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(records); err != nil {
+			log.Error().Err(err).Msg("cannot render history")
+		}
+	}
+}
+
+// silenceRequest is the body of a silence creation request. The silence lasts
+// for the duration, starting now.
+type silenceRequest struct {
+	Target    string `json:"target"`
+	Port      string `json:"port"`
+	Proto     string `json:"proto"`
+	Duration  string `json:"duration"`
+	Comment   string `json:"comment"`
+	CreatedBy string `json:"created_by"`
+}
+
+// silencesPage renders the active and pending silences in JSON.
+func silencesPage(silences *notify.Silences) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(silences.List()); err != nil {
+			log.Error().Err(err).Msg("cannot render silences")
+		}
+	}
+}
+
+// createSilencePage creates a silence and renders it in JSON.
+func createSilencePage(silences *notify.Silences) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req silenceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("invalid silence: %v", err), http.StatusBadRequest)
+			return
+		}
+		if req.Comment == "" || req.CreatedBy == "" {
+			http.Error(w, "invalid silence: comment and creator are required", http.StatusBadRequest)
+			return
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid silence duration: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		silence, err := silences.Add(notify.Silence{
+			Target:    req.Target,
+			Port:      req.Port,
+			Proto:     req.Proto,
+			Comment:   req.Comment,
+			CreatedBy: req.CreatedBy,
+			StartsAt:  now,
+			EndsAt:    now.Add(d),
+		})
+		if errors.Is(err, notify.ErrInvalidSilence) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("cannot create silence")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		log.Info().Str("target", silence.Target).Str("port", silence.Port).Str("created_by", silence.CreatedBy).Msgf("findings silenced until %s: %s", silence.EndsAt.Format(time.RFC3339), silence.Comment)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(silence); err != nil {
+			log.Error().Err(err).Msg("cannot render silence")
+		}
+	}
+}
+
+// deleteSilencePage ends a silence.
+func deleteSilencePage(silences *notify.Silences) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		err := silences.Delete(mux.Vars(r)["id"])
+		switch {
+		case errors.Is(err, notify.ErrSilenceNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			log.Error().Err(err).Msg("cannot delete silence")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// pausePage pauses the scans of a target for the duration given by the for
+// parameter, or until they are resumed without it.
+func pausePage(targets Targets) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var d time.Duration
+		if param := r.URL.Query().Get("for"); param != "" {
+			var err error
+			if d, err = time.ParseDuration(param); err != nil || d <= 0 {
+				http.Error(w, "invalid pause duration: a positive duration is expected in the for parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		name := mux.Vars(r)["name"]
+		if !targets.Pause(name, d) {
+			http.Error(w, fmt.Sprintf("target %s not found", name), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// resumePage ends the pause of the scans of a target.
+func resumePage(targets Targets) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		if !targets.Resume(name) {
+			http.Error(w, fmt.Sprintf("target %s not found", name), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// reloadPage reloads the configuration.
+func reloadPage(lifecycle Lifecycle) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := lifecycle.Reload(); err != nil {
+			http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// quitPage stops scan-exporter.
+func quitPage(lifecycle Lifecycle) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Requesting termination... Goodbye!")
+		// The response is sent before scan-exporter stops
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		lifecycle.Quit()
+	}
+}
+
 // notFoundPage set the response header to 404 status and prints an error message.
 func notFoundPage(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNotFound)
@@ -1,10 +1,22 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/history"
+	"github.com/devops-works/scan-exporter/nmap"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
 )
 
 func Test_notFoundPage(t *testing.T) {
@@ -52,3 +64,358 @@ func Test_healthCheckPage(t *testing.T) {
 			rr.Body.String(), healthStatus)
 	}
 }
+
+func Test_nmapResultsPage_empty(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/results/nmap", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	nmapResultsPage(results.New(), "1.2.3").ServeHTTP(rr, req)
+
+	run, err := nmap.Parse(rr.Body)
+	if err != nil {
+		t.Fatalf("handler returned unparsable XML: %v", err)
+	}
+	if run.Start <= 0 || run.Version != "1.2.3" {
+		t.Errorf("handler returned start %d and version %s, want a valid start and version 1.2.3", run.Start, run.Version)
+	}
+}
+
+func Test_resultsPage(t *testing.T) {
+	req, err := http.NewRequest("GET", "/api/v1/results", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res := results.New()
+	res.Set(results.Scan{Name: "web", IP: "10.0.0.1", Open: []string{"22", "80"}, Expected: []string{"80"}})
+
+	rr := httptest.NewRecorder()
+	resultsPage(res).ServeHTTP(rr, req)
+
+	var got []results.Scan
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("handler returned unparsable JSON: %v", err)
+	}
+	if len(got) != 1 || got[0].IP != "10.0.0.1" || !reflect.DeepEqual(got[0].Open, []string{"22", "80"}) {
+		t.Errorf("handler returned %+v, want the results of 10.0.0.1", got)
+	}
+}
+
+func Test_silencesPages(t *testing.T) {
+	silences, err := notify.NewSilences("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := HandleFunc(results.New(), silences, nil, nil, nil, nil, "1.2.3")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "valid", body: `{"target": "web", "port": "22", "duration": "2h", "comment": "upgrade", "created_by": "ops"}`, wantStatus: http.StatusCreated},
+		{name: "invalid JSON", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "no comment", body: `{"target": "web", "duration": "2h", "created_by": "ops"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid duration", body: `{"target": "web", "duration": "soon", "comment": "upgrade", "created_by": "ops"}`, wantStatus: http.StatusBadRequest},
+		{name: "no target", body: `{"duration": "2h", "comment": "upgrade", "created_by": "ops"}`, wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/silences", strings.NewReader(tt.body)))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("POST returned status %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/silences", nil))
+	var got []notify.Silence
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("handler returned unparsable JSON: %v", err)
+	}
+	if len(got) != 1 || got[0].Target != "web" || got[0].Port != "22" || got[0].EndsAt.Sub(got[0].StartsAt) != 2*time.Hour {
+		t.Fatalf("GET returned %+v, want the silence of web", got)
+	}
+
+	for _, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/silences/"+got[0].ID, nil))
+		if rr.Code != want {
+			t.Errorf("DELETE returned status %d, want %d", rr.Code, want)
+		}
+	}
+}
+
+// fakePause is the pause of a fake target.
+type fakePause struct {
+	paused bool
+	d      time.Duration
+}
+
+// fakeTargets records the pauses of the targets.
+type fakeTargets map[string]fakePause
+
+func (f fakeTargets) Pause(name string, d time.Duration) bool {
+	if _, ok := f[name]; !ok {
+		return false
+	}
+	f[name] = fakePause{paused: true, d: d}
+	return true
+}
+
+func (f fakeTargets) Resume(name string) bool {
+	if _, ok := f[name]; !ok {
+		return false
+	}
+	f[name] = fakePause{}
+	return true
+}
+
+func Test_pausePage(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		paused     bool
+		wantStatus int
+		wantPause  fakePause
+	}{
+		{name: "pause", url: "/api/v1/targets/web/pause?for=2h", wantStatus: http.StatusNoContent, wantPause: fakePause{paused: true, d: 2 * time.Hour}},
+		{name: "pause until resumed", url: "/api/v1/targets/web/pause", wantStatus: http.StatusNoContent, wantPause: fakePause{paused: true}},
+		{name: "invalid duration", url: "/api/v1/targets/web/pause?for=2", wantStatus: http.StatusBadRequest},
+		{name: "negative duration", url: "/api/v1/targets/web/pause?for=-1h", wantStatus: http.StatusBadRequest},
+		{name: "unknown target", url: "/api/v1/targets/db/pause?for=2h", wantStatus: http.StatusNotFound},
+		{name: "resume", url: "/api/v1/targets/web/resume", paused: true, wantStatus: http.StatusNoContent},
+		{name: "resume unknown target", url: "/api/v1/targets/db/resume", paused: true, wantStatus: http.StatusNotFound, wantPause: fakePause{paused: true}},
+		{name: "resume with GET", method: http.MethodGet, url: "/api/v1/targets/web/resume", paused: true, wantStatus: http.StatusMethodNotAllowed, wantPause: fakePause{paused: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets := fakeTargets{"web": fakePause{paused: tt.paused}}
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			rr := httptest.NewRecorder()
+			HandleFunc(results.New(), nil, targets, nil, nil, nil, "1.2.3").ServeHTTP(rr, httptest.NewRequest(method, tt.url, nil))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("%s returned status %d, want %d: %s", method, rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if targets["web"] != tt.wantPause {
+				t.Errorf("web pause = %+v, want %+v", targets["web"], tt.wantPause)
+			}
+		})
+	}
+}
+
+// fakeLifecycle records the reloads and the termination requests.
+type fakeLifecycle struct {
+	err            error
+	reloads, quits int
+}
+
+func (f *fakeLifecycle) Reload() error {
+	f.reloads++
+	return f.err
+}
+
+func (f *fakeLifecycle) Quit() {
+	f.quits++
+}
+
+func Test_lifecyclePages(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		err         error
+		wantStatus  int
+		wantReloads int
+		wantQuits   int
+	}{
+		{name: "reload", method: http.MethodPost, url: "/-/reload", wantStatus: http.StatusOK, wantReloads: 1},
+		{name: "reload with PUT", method: http.MethodPut, url: "/-/reload", wantStatus: http.StatusOK, wantReloads: 1},
+		{name: "failed reload", method: http.MethodPost, url: "/-/reload", err: errors.New("invalid range"), wantStatus: http.StatusInternalServerError, wantReloads: 1},
+		{name: "reload with GET", method: http.MethodGet, url: "/-/reload", wantStatus: http.StatusMethodNotAllowed},
+		{name: "quit", method: http.MethodPost, url: "/-/quit", wantStatus: http.StatusOK, wantQuits: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lc := &fakeLifecycle{err: tt.err}
+			rr := httptest.NewRecorder()
+			HandleFunc(results.New(), nil, nil, lc, nil, nil, "1.2.3").ServeHTTP(rr, httptest.NewRequest(tt.method, tt.url, nil))
+			if rr.Code != tt.wantStatus {
+				t.Errorf("%s %s returned status %d, want %d: %s", tt.method, tt.url, rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if lc.reloads != tt.wantReloads || lc.quits != tt.wantQuits {
+				t.Errorf("%s %s made %d reloads and %d quits, want %d and %d", tt.method, tt.url, lc.reloads, lc.quits, tt.wantReloads, tt.wantQuits)
+			}
+		})
+	}
+}
+
+func Test_scansPage(t *testing.T) {
+	res := results.New()
+	start := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	for i := range results.MaxSummaries + 5 {
+		res.AddSummary(results.Summary{ID: strconv.Itoa(i), Name: "web", IP: "10.0.0.1", Start: start.Add(time.Duration(i) * time.Minute)})
+	}
+	res.AddSummary(results.Summary{ID: "db", Name: "db", IP: "10.0.0.2", Start: start})
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantCount  int
+		// wantFirst holds the IDs of the first summaries
+		wantFirst []string
+	}{
+		{name: "default limit", url: "/api/v1/targets/web/scans", wantStatus: http.StatusOK, wantCount: defaultScansLimit, wantFirst: []string{"104", "103"}},
+		{name: "limit", url: "/api/v1/targets/web/scans?limit=2", wantStatus: http.StatusOK, wantCount: 2, wantFirst: []string{"104", "103"}},
+		{name: "other target", url: "/api/v1/targets/db/scans", wantStatus: http.StatusOK, wantCount: 1, wantFirst: []string{"db"}},
+		{name: "unknown target", url: "/api/v1/targets/dns/scans", wantStatus: http.StatusOK, wantFirst: []string{}},
+		{name: "invalid limit", url: "/api/v1/targets/web/scans?limit=0", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			HandleFunc(res, nil, nil, nil, nil, nil, "1.2.3").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("GET returned status %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var sums []results.Summary
+			if err := json.Unmarshal(rr.Body.Bytes(), &sums); err != nil {
+				t.Fatal(err)
+			}
+			if len(sums) != tt.wantCount {
+				t.Fatalf("GET returned %d summaries, want %d", len(sums), tt.wantCount)
+			}
+			ids := []string{}
+			for _, sum := range sums[:len(tt.wantFirst)] {
+				ids = append(ids, sum.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantFirst) {
+				t.Errorf("GET returned summaries %v first, want %v", ids, tt.wantFirst)
+			}
+		})
+	}
+
+	// Only the latest summaries are kept
+	if sums := res.Summaries("web", 1000); len(sums) != results.MaxSummaries || sums[len(sums)-1].ID != "5" {
+		t.Errorf("Summaries() kept %d summaries, the oldest being %s, want %d from 5", len(sums), sums[len(sums)-1].ID, results.MaxSummaries)
+	}
+}
+
+func Test_historyPage(t *testing.T) {
+	hist, err := history.Open(&config.History{Path: filepath.Join(t.TempDir(), "history.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hist.Close()
+	now := time.Now()
+	for i, r := range []history.Record{
+		{Open: []string{"22"}},
+		{Open: []string{"22", "3306"}, Opened: []string{"3306"}},
+		{Open: []string{"22"}, Closed: []string{"3306"}},
+	} {
+		r.Name, r.IP, r.Proto = "db", "10.0.0.1", "tcp"
+		r.Time = now.Add(time.Duration(i-3) * time.Hour)
+		if err := hist.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		wantCount  int
+	}{
+		{name: "all", url: "/api/v1/targets/db/history", wantStatus: http.StatusOK, wantCount: 3},
+		{name: "port", url: "/api/v1/targets/db/history?port=3306", wantStatus: http.StatusOK, wantCount: 2},
+		{name: "since", url: "/api/v1/targets/db/history?since=150m", wantStatus: http.StatusOK, wantCount: 2},
+		{name: "limit", url: "/api/v1/targets/db/history?limit=1", wantStatus: http.StatusOK, wantCount: 1},
+		{name: "unknown target", url: "/api/v1/targets/web/history", wantStatus: http.StatusOK},
+		{name: "invalid port", url: "/api/v1/targets/db/history?port=ssh", wantStatus: http.StatusBadRequest},
+		{name: "invalid since", url: "/api/v1/targets/db/history?since=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "invalid limit", url: "/api/v1/targets/db/history?limit=-1", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			HandleFunc(results.New(), nil, nil, nil, nil, hist, "1.2.3").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("GET returned status %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var records []history.Record
+			if err := json.Unmarshal(rr.Body.Bytes(), &records); err != nil {
+				t.Fatal(err)
+			}
+			if records == nil || len(records) != tt.wantCount {
+				t.Errorf("GET returned %v, want %d records", records, tt.wantCount)
+			}
+		})
+	}
+}
+
+func Test_dashboardPages(t *testing.T) {
+	res := results.New()
+	end := time.Now().Add(-time.Minute)
+	res.Set(results.Scan{Name: "web", IP: "10.0.0.1", Start: end.Add(-time.Second), End: end, Open: []string{"443", "22"}, Expected: []string{"443", "80"}, Services: map[string]string{"22": "ssh"}})
+	res.Set(results.Scan{Name: "web", IP: "10.0.0.2", End: end, Open: []string{"443"}, Expected: []string{"443"}})
+	res.Set(results.Scan{Name: "db", IP: "10.0.0.3", End: end, Open: []string{"5432"}, Expected: []string{"5432"}})
+	res.AddSummary(results.Summary{ID: "1", Name: "web", IP: "10.0.0.1", Start: end.Add(-time.Second), Findings: []notify.Finding{{Severity: notify.SeverityWarning, Message: "web (10.0.0.1) unexpected open port 22/tcp (ssh)"}}})
+
+	tests := []struct {
+		name       string
+		url        string
+		wantStatus int
+		// want holds fragments of the page, in order
+		want []string
+	}{
+		{name: "root", url: "/", wantStatus: http.StatusFound},
+		{name: "dashboard", url: "/ui/", wantStatus: http.StatusOK, want: []string{
+			`<a href="/ui/targets/db">db</a>`, "compliant",
+			`<a href="/ui/targets/web">web</a>`, "10.0.0.1<br>10.0.0.2", `<div class="unexpected">22</div>`, `<div class="closed">80</div>`, "deviating",
+		}},
+		{name: "target", url: "/ui/targets/web", wantStatus: http.StatusOK, want: []string{
+			"<h2>10.0.0.1", "in 1s",
+			`<td>22</td><td><span class="unexpected">unexpected</span></td><td>ssh</td>`,
+			`<td>80</td><td><span class="closed">closed</span></td>`,
+			`<td>443</td><td><span class="open">open</span></td>`,
+			"<h2>10.0.0.2",
+			"Latest scans", `<div class="warning">web (10.0.0.1) unexpected open port 22/tcp (ssh)</div>`,
+		}},
+		{name: "unknown target", url: "/ui/targets/dns", wantStatus: http.StatusNotFound},
+		{name: "stylesheet", url: "/ui/style.css", wantStatus: http.StatusOK, want: []string{".deviating"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			HandleFunc(res, nil, nil, nil, nil, nil, "1.2.3").ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.url, nil))
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("GET returned status %d, want %d: %s", rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			body := rr.Body.String()
+			for _, w := range tt.want {
+				i := strings.Index(body, w)
+				if i < 0 {
+					t.Fatalf("GET returned a page without %q after the previous fragments: %s", w, rr.Body.String())
+				}
+				body = body[i+len(w):]
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrInvalidProbe is returned by the probers when the ports to probe are
+// invalid.
+var ErrInvalidProbe = errors.New("invalid probe")
+
+// scrapeTimeoutOffset is subtracted from the scrape timeout of Prometheus, so
+// that the metrics of a probe are sent before Prometheus gives up.
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+// PortProbe is the result of probing a single port on demand.
+type PortProbe struct {
+	Port    int
+	Open    bool
+	Latency time.Duration
+}
+
+// Prober probes the ports of any address on demand.
+type Prober interface {
+	// ProbePorts probes the TCP ports of ip, given as ranges written as in
+	// the configuration, and returns their results in the order of the
+	// ports. It stops once ctx is done.
+	ProbePorts(ctx context.Context, ip, ports string) ([]PortProbe, error)
+}
+
+// probePage probes the ports of the target given by the query, like the probes
+// of blackbox_exporter, and renders the results as Prometheus metrics.
+func probePage(prober Prober) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		target := q.Get("target")
+		if net.ParseIP(target) == nil {
+			http.Error(w, "invalid target: an IP address is expected in the target parameter", http.StatusBadRequest)
+			return
+		}
+		proto := q.Get("proto")
+		if proto == "" {
+			proto = "tcp"
+		}
+		if proto != "tcp" {
+			http.Error(w, fmt.Sprintf("unsupported protocol %q, only tcp ports can be probed", proto), http.StatusBadRequest)
+			return
+		}
+		ports := q.Get("ports")
+		if ports == "" {
+			http.Error(w, "invalid probe: ports are expected in the ports parameter", http.StatusBadRequest)
+			return
+		}
+
+		// The probe ends before Prometheus stops waiting for it
+		ctx := r.Context()
+		if s, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64); err == nil && s > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(s*float64(time.Second))-scrapeTimeoutOffset)
+			defer cancel()
+		}
+
+		start := time.Now()
+		res, err := prober.ProbePorts(ctx, target, ports)
+		if errors.Is(err, ErrInvalidProbe) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		success := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_success",
+			Help: "1 when all the probed ports are open, 0 otherwise",
+		})
+		duration := prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "probe_duration_seconds",
+			Help: "Time taken by the probe",
+		})
+		open := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_probe_port_open",
+			Help: "1 when the probed port is open, 0 otherwise",
+		}, []string{"port", "proto"})
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(success, duration, open)
+
+		duration.Set(time.Since(start).Seconds())
+		if err != nil {
+			log.Warn().Str("target", target).Err(err).Msg("probe failed")
+		} else {
+			allOpen := 1.0
+			for _, p := range res {
+				state := 0.0
+				if p.Open {
+					state = 1
+				} else {
+					allOpen = 0
+				}
+				open.WithLabelValues(strconv.Itoa(p.Port), proto).Set(state)
+			}
+			success.Set(allOpen)
+		}
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/results"
+)
+
+// fakeProber reports the ports in open as open, and records the deadline of
+// its last probe.
+type fakeProber struct {
+	open     map[int]bool
+	deadline time.Time
+}
+
+func (f *fakeProber) ProbePorts(ctx context.Context, ip, ports string) ([]PortProbe, error) {
+	f.deadline, _ = ctx.Deadline()
+	if ports == "invalid" {
+		return nil, fmt.Errorf("%w: bad ports", ErrInvalidProbe)
+	}
+	var probes []PortProbe
+	for _, p := range strings.Split(ports, ",") {
+		var port int
+		fmt.Sscan(p, &port)
+		probes = append(probes, PortProbe{Port: port, Open: f.open[port]})
+	}
+	return probes, nil
+}
+
+func Test_probePage(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		timeout      string
+		wantStatus   int
+		want         []string
+		wantDeadline bool
+	}{
+		{
+			name:       "all open",
+			url:        "/probe?target=10.0.0.1&ports=22,443",
+			wantStatus: http.StatusOK,
+			want:       []string{"probe_success 1", `scanexporter_probe_port_open{port="22",proto="tcp"} 1`, `scanexporter_probe_port_open{port="443",proto="tcp"} 1`},
+		},
+		{
+			name:         "closed port",
+			url:          "/probe?target=10.0.0.1&ports=22,80&proto=tcp",
+			timeout:      "10",
+			wantStatus:   http.StatusOK,
+			want:         []string{"probe_success 0", `scanexporter_probe_port_open{port="80",proto="tcp"} 0`},
+			wantDeadline: true,
+		},
+		{name: "hostname", url: "/probe?target=example.com&ports=22", wantStatus: http.StatusBadRequest},
+		{name: "no ports", url: "/probe?target=10.0.0.1", wantStatus: http.StatusBadRequest},
+		{name: "invalid ports", url: "/probe?target=10.0.0.1&ports=invalid", wantStatus: http.StatusBadRequest},
+		{name: "udp", url: "/probe?target=10.0.0.1&ports=53&proto=udp", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prober := &fakeProber{open: map[int]bool{22: true, 443: true}}
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			if tt.timeout != "" {
+				req.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tt.timeout)
+			}
+			rr := httptest.NewRecorder()
+			HandleFunc(results.New(), nil, nil, nil, prober, nil, "1.2.3").ServeHTTP(rr, req)
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("GET %s returned status %d, want %d: %s", tt.url, rr.Code, tt.wantStatus, rr.Body.String())
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(rr.Body.String(), want) {
+					t.Errorf("GET %s body does not contain %q:\n%s", tt.url, want, rr.Body.String())
+				}
+			}
+			if got := !prober.deadline.IsZero(); got != tt.wantDeadline {
+				t.Errorf("probe has a deadline = %v, want %v", got, tt.wantDeadline)
+			}
+		})
+	}
+}
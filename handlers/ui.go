@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// uiScansLimit is the number of scan summaries rendered on the page of a
+// target.
+const uiScansLimit = 20
+
+//go:embed ui
+var uiFS embed.FS
+
+var uiTemplates = template.Must(template.New("ui").Funcs(template.FuncMap{
+	"ago":  ago,
+	"join": strings.Join,
+}).ParseFS(uiFS, "ui/*.html"))
+
+// Port states rendered by the dashboard.
+const (
+	portOpen       = "open"
+	portUnexpected = "unexpected"
+	portClosed     = "closed"
+)
+
+// uiPort is a port of an address which is either open or expected.
+type uiPort struct {
+	Port       string
+	State      string
+	Service    string
+	Annotation string
+}
+
+// uiAddress is the latest scan of one of the addresses of a target.
+type uiAddress struct {
+	results.Scan
+	Ports []uiPort
+	// Unexpected holds the open ports which are not expected, and Missing
+	// the expected ports which are closed.
+	Unexpected []string
+	Missing    []string
+}
+
+// Duration returns the duration of the scan.
+func (a uiAddress) Duration() time.Duration {
+	return a.End.Sub(a.Start).Round(time.Millisecond)
+}
+
+// uiTarget gathers the latest scans of the addresses of a target.
+type uiTarget struct {
+	Name      string
+	Addresses []uiAddress
+	LastScan  time.Time
+	// Open, Unexpected and Missing are the numbers of ports of all the
+	// addresses.
+	Open       int
+	Unexpected int
+	Missing    int
+}
+
+// Deviating reports whether a port of the target is unexpectedly open or
+// closed.
+func (t uiTarget) Deviating() bool {
+	return t.Unexpected > 0 || t.Missing > 0
+}
+
+// newUIAddress sorts the ports of a scan by state.
+func newUIAddress(scan results.Scan) uiAddress {
+	a := uiAddress{Scan: scan}
+	open, expected := common.PortSetOf(scan.Open), common.PortSetOf(scan.Expected)
+	for p := range open.All() {
+		port := strconv.Itoa(p)
+		state := portOpen
+		if !expected.Has(p) {
+			state = portUnexpected
+			a.Unexpected = append(a.Unexpected, port)
+		}
+		a.Ports = append(a.Ports, uiPort{Port: port, State: state})
+	}
+	for p := range expected.Minus(open).All() {
+		port := strconv.Itoa(p)
+		a.Missing = append(a.Missing, port)
+		a.Ports = append(a.Ports, uiPort{Port: port, State: portClosed})
+	}
+
+	slices.SortFunc(a.Ports, func(x, y uiPort) int {
+		px, _ := strconv.Atoi(x.Port)
+		py, _ := strconv.Atoi(y.Port)
+		return px - py
+	})
+	for i := range a.Ports {
+		a.Ports[i].Service = scan.Services[a.Ports[i].Port]
+		a.Ports[i].Annotation = scan.Annotations[a.Ports[i].Port]
+	}
+	return a
+}
+
+// uiTargets gathers the latest scans by target, sorted by name.
+func uiTargets(scans []results.Scan) []uiTarget {
+	byName := make(map[string]*uiTarget)
+	var targets []*uiTarget
+	for _, scan := range scans {
+		t, ok := byName[scan.Name]
+		if !ok {
+			t = &uiTarget{Name: scan.Name}
+			byName[scan.Name] = t
+			targets = append(targets, t)
+		}
+		a := newUIAddress(scan)
+		t.Addresses = append(t.Addresses, a)
+		t.Open += len(a.Open)
+		t.Unexpected += len(a.Unexpected)
+		t.Missing += len(a.Missing)
+		if a.End.After(t.LastScan) {
+			t.LastScan = a.End
+		}
+	}
+
+	sorted := make([]uiTarget, 0, len(targets))
+	for _, t := range targets {
+		sort.Slice(t.Addresses, func(i, j int) bool {
+			return t.Addresses[i].IP < t.Addresses[j].IP
+		})
+		sorted = append(sorted, *t)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	return sorted
+}
+
+// ago renders the time elapsed since t.
+func ago(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
+
+// renderUI renders a page of the dashboard. It is rendered in a buffer first,
+// so that errors are not sent after a partial page.
+func renderUI(w http.ResponseWriter, name string, data any) {
+	var buf bytes.Buffer
+	if err := uiTemplates.ExecuteTemplate(&buf, name, data); err != nil {
+		log.Error().Err(err).Str("page", name).Msg("cannot render dashboard")
+		http.Error(w, "cannot render page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+// dashboardPage renders the status of all targets: their last scan, their
+// open ports and their deviations from the expected ones.
+func dashboardPage(res *results.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		renderUI(w, "dashboard.html", uiTargets(res.All()))
+	}
+}
+
+// targetPage renders the ports of each address of a target, and the summaries
+// of its latest scans.
+func targetPage(res *results.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := mux.Vars(r)["name"]
+		var scans []results.Scan
+		for _, scan := range res.All() {
+			if scan.Name == name {
+				scans = append(scans, scan)
+			}
+		}
+		if len(scans) == 0 {
+			notFoundPage(w, r)
+			return
+		}
+
+		renderUI(w, "target.html", struct {
+			uiTarget
+			Summaries []results.Summary
+		}{
+			uiTarget:  uiTargets(scans)[0],
+			Summaries: res.Summaries(name, uiScansLimit),
+		})
+	}
+}
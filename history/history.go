@@ -0,0 +1,192 @@
+// Package history records the results of the scans in an embedded database,
+// so that they survive restarts.
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	bolt "go.etcd.io/bbolt"
+)
+
+// defaultRetention is the time during which the records are kept when none is
+// configured.
+const defaultRetention = 30 * 24 * time.Hour
+
+// Record is the result of a scan of one of the addresses of a target.
+type Record struct {
+	Name  string    `json:"name"`
+	IP    string    `json:"ip"`
+	Proto string    `json:"proto"`
+	Time  time.Time `json:"time"`
+	Open  []string  `json:"open"`
+	// Opened and Closed hold the ports which changed state since the
+	// previous scan
+	Opened []string `json:"opened,omitempty"`
+	Closed []string `json:"closed,omitempty"`
+}
+
+// changed reports whether port changed state in the scan.
+func (r Record) changed(port string) bool {
+	return slices.Contains(r.Opened, port) || slices.Contains(r.Closed, port)
+}
+
+// Store holds the records in a bolt database. Records are stored in a bucket
+// per target and protocol, ordered by time. A nil store records nothing.
+type Store struct {
+	db        *bolt.DB
+	retention time.Duration
+}
+
+// Open opens the store described in configuration, creating its file if
+// needed. It returns nil if no history is configured.
+func Open(c *config.History) (*Store, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.Path == "" {
+		return nil, errors.New("no path provided for the history")
+	}
+
+	s := &Store{retention: defaultRetention}
+	if c.Retention != "" {
+		var err error
+		if s.retention, err = time.ParseDuration(c.Retention); err != nil || s.retention <= 0 {
+			return nil, fmt.Errorf("invalid retention %q", c.Retention)
+		}
+	}
+
+	db, err := bolt.Open(c.Path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %s: %w", c.Path, err)
+	}
+	s.db = db
+	return s, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.db.Close()
+}
+
+// bucket returns the name of the bucket of the records of a target and
+// protocol.
+func bucket(name, proto string) []byte {
+	return []byte(proto + "/" + name)
+}
+
+// timeKey returns the prefix of the keys of the records of time t, which sorts
+// them by time. Times before 1970 are all sorted first.
+func timeKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(max(t.UnixNano(), 0)))
+}
+
+// key returns the key of a record.
+func key(r Record) []byte {
+	return append(timeKey(r.Time), r.IP...)
+}
+
+// Add records the result of a scan, and drops the records of the target which
+// are older than the retention.
+func (s *Store) Add(r Record) error {
+	if s == nil {
+		return nil
+	}
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(bucket(r.Name, r.Proto))
+		if err != nil {
+			return err
+		}
+		if err := b.Put(key(r), value); err != nil {
+			return err
+		}
+
+		// Keys are gathered first, as deleting through the cursor would
+		// skip some of them
+		oldest := timeKey(r.Time.Add(-s.retention))
+		var expired [][]byte
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil && string(k[:8]) < string(oldest); k, _ = c.Next() {
+			expired = append(expired, k)
+		}
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Last returns the latest record of an address of a target, and whether there
+// is one.
+func (s *Store) Last(name, ip, proto string) (Record, bool, error) {
+	var last Record
+	var found bool
+	if s == nil {
+		return last, false, nil
+	}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket(name, proto))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			if string(k[8:]) != ip {
+				continue
+			}
+			found = true
+			return json.Unmarshal(v, &last)
+		}
+		return nil
+	})
+	return last, found, err
+}
+
+// Records returns the records of a target since the given time, the most recent
+// first. When port is not empty, only the records of the scans in which it
+// changed state are returned. At most limit records are returned.
+func (s *Store) Records(name, proto, port string, since time.Time, limit int) ([]Record, error) {
+	var records []Record
+	if s == nil {
+		return records, nil
+	}
+
+	var first []byte
+	if !since.IsZero() {
+		first = timeKey(since)
+	}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucket(name, proto))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		for k, v := c.Last(); k != nil && string(k[:8]) >= string(first) && len(records) < limit; k, v = c.Prev() {
+			var r Record
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if port == "" || r.changed(port) {
+				records = append(records, r)
+			}
+		}
+		return nil
+	})
+	return records, err
+}
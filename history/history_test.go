@@ -0,0 +1,114 @@
+package history
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.History
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "disabled", wantNil: true},
+		{name: "no path", conf: &config.History{}, wantErr: true},
+		{name: "invalid retention", conf: &config.History{Path: "history.db", Retention: "30d"}, wantErr: true},
+		{name: "default retention", conf: &config.History{Path: "history.db"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.conf != nil && tt.conf.Path != "" {
+				tt.conf.Path = filepath.Join(t.TempDir(), tt.conf.Path)
+			}
+			s, err := Open(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			defer s.Close()
+			if !tt.wantErr && (s == nil) != tt.wantNil {
+				t.Errorf("Open() = %v, want nil %v", s, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	conf := &config.History{Path: filepath.Join(t.TempDir(), "history.db"), Retention: "24h"}
+	s, err := Open(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(-48 * time.Hour)
+	records := []Record{
+		{Name: "web", IP: "10.0.0.1", Proto: "tcp", Time: start, Open: []string{"22"}},
+		{Name: "web", IP: "10.0.0.1", Proto: "tcp", Time: start.Add(36 * time.Hour), Open: []string{"22", "80"}, Opened: []string{"80"}},
+		{Name: "web", IP: "fd00::1", Proto: "tcp", Time: start.Add(36 * time.Hour), Open: []string{"80"}},
+		{Name: "web", IP: "10.0.0.1", Proto: "tcp", Time: start.Add(40 * time.Hour), Open: []string{"80"}, Closed: []string{"22"}},
+		{Name: "web", IP: "10.0.0.1", Proto: "tcp", Time: start.Add(44 * time.Hour), Open: []string{"80"}},
+		{Name: "db", IP: "10.0.0.2", Proto: "tcp", Time: start.Add(44 * time.Hour), Open: []string{"5432"}},
+	}
+	for _, r := range records {
+		if err := s.Add(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The records survive restarts
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err = Open(conf); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	last, ok, err := s.Last("web", "10.0.0.1", "tcp")
+	if err != nil || !ok || !reflect.DeepEqual(last.Open, []string{"80"}) || !last.Time.Equal(records[4].Time) {
+		t.Errorf("Last() = %+v, %v, %v, want the last record of 10.0.0.1", last, ok, err)
+	}
+	if last, ok, _ := s.Last("web", "fd00::1", "tcp"); !ok || !reflect.DeepEqual(last.Open, []string{"80"}) {
+		t.Errorf("Last() = %+v, %v, want the record of fd00::1", last, ok)
+	}
+	if _, ok, _ := s.Last("mail", "10.0.0.1", "tcp"); ok {
+		t.Errorf("Last() found a record of another target")
+	}
+
+	tests := []struct {
+		name  string
+		port  string
+		since time.Time
+		limit int
+		// want holds the indexes of the expected records
+		want []int
+	}{
+		// The first record is older than the retention
+		{name: "all", limit: 10, want: []int{4, 3, 2, 1}},
+		{name: "limit", limit: 2, want: []int{4, 3}},
+		{name: "port", port: "22", limit: 10, want: []int{3}},
+		{name: "opened port", port: "80", limit: 10, want: []int{1}},
+		{name: "since", since: start.Add(39 * time.Hour), limit: 10, want: []int{4, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Records("web", "tcp", tt.port, tt.since, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Records() returned %d records, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, idx := range tt.want {
+				if w := records[idx]; got[i].IP != w.IP || !got[i].Time.Equal(w.Time) {
+					t.Errorf("Records()[%d] = %+v, want %+v", i, got[i], w)
+				}
+			}
+		})
+	}
+}
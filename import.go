@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/devops-works/scan-exporter/nmap"
+	"github.com/devops-works/scan-exporter/scan"
+	"gopkg.in/yaml.v3"
+)
+
+// importedTarget is a target definition generated by an import. Only the
+// fields that can be deduced from the imported results are written.
+type importedTarget struct {
+	Name string      `yaml:"name"`
+	IP   string      `yaml:"ip"`
+	TCP  importedTCP `yaml:"tcp"`
+}
+
+type importedTCP struct {
+	Period   string `yaml:"period,omitempty"`
+	Range    string `yaml:"range"`
+	Expected string `yaml:"expected"`
+}
+
+// runImport converts existing scan results into targets definitions, written
+// to stdout in YAML.
+// Usage: scan-exporter import nmap [-range <range>] [-period <period>] <file.xml>
+func runImport(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] != "nmap" {
+		return errors.New("usage: scan-exporter import nmap [OPTIONS] <results.xml>")
+	}
+
+	fs := flag.NewFlagSet("import nmap", flag.ContinueOnError)
+	var scanRange, period string
+	fs.StringVar(&scanRange, "range", "", "range of ports to scan. Defaults to the ports scanned by nmap")
+	fs.StringVar(&period, "period", "", "TCP period of the generated targets")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: scan-exporter import nmap [OPTIONS] <results.xml>")
+	}
+	if _, err := scan.ParsePorts(scanRange); err != nil {
+		return fmt.Errorf("invalid range: %w", err)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	run, err := nmap.Parse(f)
+	if err != nil {
+		return fmt.Errorf("cannot parse %s: %w", fs.Arg(0), err)
+	}
+
+	targets := nmapTargets(run, scanRange, period)
+
+	out := struct {
+		Targets []importedTarget `yaml:"targets"`
+	}{Targets: targets}
+
+	enc := yaml.NewEncoder(stdout)
+	enc.SetIndent(2)
+	defer enc.Close()
+	return enc.Encode(out)
+}
+
+// nmapTargets creates a target for each host that was up during the nmap scan.
+// Its open TCP ports become the expected ones. If scanRange is empty, the
+// ports scanned by nmap are used.
+func nmapTargets(run *nmap.Run, scanRange, period string) []importedTarget {
+	if scanRange == "" {
+		scanRange = "top1000"
+		for _, si := range run.ScanInfo {
+			if si.Protocol == "tcp" && si.Services != "" {
+				scanRange = si.Services
+			}
+		}
+	}
+
+	var targets []importedTarget
+	for _, h := range run.Hosts {
+		ip := h.IP()
+		if h.Status.State != "up" || ip == "" {
+			continue
+		}
+
+		name := ip
+		if len(h.Hostnames) > 0 {
+			name = h.Hostnames[0].Name
+		}
+
+		open := h.OpenPorts("tcp")
+		slices.Sort(open)
+		var expected []string
+		for _, p := range open {
+			expected = append(expected, strconv.Itoa(p))
+		}
+
+		targets = append(targets, importedTarget{
+			Name: name,
+			IP:   ip,
+			TCP: importedTCP{
+				Period:   period,
+				Range:    scanRange,
+				Expected: strings.Join(expected, ","),
+			},
+		})
+	}
+	return targets
+}
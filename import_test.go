@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/nmap"
+	"github.com/devops-works/scan-exporter/scan"
+)
+
+func Test_nmapTargets(t *testing.T) {
+	up := nmap.Status{State: "up"}
+	web := nmap.Host{
+		Status:    up,
+		Addresses: []nmap.Address{{Addr: "10.0.0.1", AddrType: "ipv4"}},
+		Hostnames: []nmap.Hostname{{Name: "web1"}},
+		Ports: []nmap.Port{
+			{Protocol: "tcp", PortID: 443, State: nmap.State{State: "open"}},
+			{Protocol: "tcp", PortID: 22, State: nmap.State{State: "open"}},
+			{Protocol: "tcp", PortID: 25, State: nmap.State{State: "closed"}},
+			{Protocol: "udp", PortID: 53, State: nmap.State{State: "open"}},
+		},
+	}
+	anonymous := nmap.Host{
+		Status:    up,
+		Addresses: []nmap.Address{{Addr: "10.0.0.2", AddrType: "ipv4"}},
+	}
+	down := nmap.Host{
+		Status:    nmap.Status{State: "down"},
+		Addresses: []nmap.Address{{Addr: "10.0.0.3", AddrType: "ipv4"}},
+	}
+	noIP := nmap.Host{
+		Status:    up,
+		Addresses: []nmap.Address{{Addr: "00:11:22:33:44:55", AddrType: "mac"}},
+	}
+
+	tests := []struct {
+		name      string
+		run       *nmap.Run
+		scanRange string
+		period    string
+		want      []importedTarget
+	}{
+		{
+			name: "range from scaninfo",
+			run:  &nmap.Run{ScanInfo: []nmap.ScanInfo{{Protocol: "tcp", Services: "1-1024"}}, Hosts: []nmap.Host{web}},
+			want: []importedTarget{{Name: "web1", IP: "10.0.0.1", TCP: importedTCP{Range: "1-1024", Expected: "22,443"}}},
+		},
+		{
+			name: "udp scaninfo ignored",
+			run:  &nmap.Run{ScanInfo: []nmap.ScanInfo{{Protocol: "udp", Services: "53"}}, Hosts: []nmap.Host{web}},
+			want: []importedTarget{{Name: "web1", IP: "10.0.0.1", TCP: importedTCP{Range: "top1000", Expected: "22,443"}}},
+		},
+		{
+			name:      "range and period given",
+			run:       &nmap.Run{ScanInfo: []nmap.ScanInfo{{Protocol: "tcp", Services: "1-1024"}}, Hosts: []nmap.Host{web}},
+			scanRange: "all",
+			period:    "6h",
+			want:      []importedTarget{{Name: "web1", IP: "10.0.0.1", TCP: importedTCP{Period: "6h", Range: "all", Expected: "22,443"}}},
+		},
+		{
+			name: "hosts down or without IP skipped",
+			run:  &nmap.Run{Hosts: []nmap.Host{down, noIP, anonymous}},
+			want: []importedTarget{{Name: "10.0.0.2", IP: "10.0.0.2", TCP: importedTCP{Range: "top1000"}}},
+		},
+		{
+			name: "no hosts",
+			run:  &nmap.Run{},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nmapTargets(tt.run, tt.scanRange, tt.period)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nmapTargets() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_runImport(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "results.xml")
+	err := os.WriteFile(input, []byte(`<?xml version="1.0"?>
+<nmaprun scanner="nmap" start="1700000000" version="7.94" xmloutputversion="1.05">
+  <scaninfo type="connect" protocol="tcp" numservices="1024" services="1-1024"/>
+  <host>
+    <status state="up" reason="syn-ack"/>
+    <address addr="10.0.0.1" addrtype="ipv4"/>
+    <hostnames><hostname name="web1" type="PTR"/></hostnames>
+    <ports>
+      <port protocol="tcp" portid="22"><state state="open" reason="syn-ack"/></port>
+      <port protocol="tcp" portid="443"><state state="open" reason="syn-ack"/></port>
+    </ports>
+  </host>
+</nmaprun>
+`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := runImport([]string{"nmap", "-period", "12h", input}, &out); err != nil {
+		t.Fatalf("runImport() error = %v", err)
+	}
+
+	// The output must be usable as a configuration file
+	output := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(output, out.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c, err := config.New(output)
+	if err != nil {
+		t.Fatalf("config.New() error = %v", err)
+	}
+	if len(c.Targets) != 1 {
+		t.Fatalf("got %d targets, want 1", len(c.Targets))
+	}
+
+	target := c.Targets[0]
+	if target.Name != "web1" || target.IP != "10.0.0.1" || target.TCP.Period != "12h" {
+		t.Errorf("got target %s (%s) with period %s, want web1 (10.0.0.1) with period 12h", target.Name, target.IP, target.TCP.Period)
+	}
+	if ports, err := scan.ParsePorts(target.TCP.Range); err != nil || len(ports) != 1024 {
+		t.Errorf("got range %q, want 1-1024", target.TCP.Range)
+	}
+	if ports, err := scan.ParsePorts(target.TCP.Expected); err != nil || !reflect.DeepEqual(ports, []int{22, 443}) {
+		t.Errorf("got expected ports %q, want 22,443", target.TCP.Expected)
+	}
+}
+
+func Test_runImport_invalidRange(t *testing.T) {
+	var out bytes.Buffer
+	if err := runImport([]string{"nmap", "-range", "100-20", "results.xml"}, &out); err == nil {
+		t.Errorf("runImport() accepted an invalid range")
+	}
+}
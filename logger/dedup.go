@@ -0,0 +1,115 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Dedup is a hook suppressing the warnings and errors identical to one logged
+// less than a window ago, so that recurring conditions do not produce the same
+// line on every scan. Once the window is over, the number of suppressed lines
+// is logged in a summary.
+type Dedup struct {
+	window time.Duration
+	// out is the logger the summaries are written to, which must not use
+	// the hook
+	out zerolog.Logger
+	now func() time.Time
+
+	mu   sync.Mutex
+	seen map[dedupKey]*dedupEntry
+}
+
+// dedupKey identifies identical lines.
+type dedupKey struct {
+	level zerolog.Level
+	msg   string
+}
+
+// dedupEntry counts the lines suppressed since the first one was logged.
+type dedupEntry struct {
+	first    time.Time
+	repeated int
+}
+
+// NewDedup creates a hook suppressing the lines repeated within window. The
+// summaries are written to out.
+func NewDedup(window time.Duration, out zerolog.Logger) *Dedup {
+	return &Dedup{
+		window: window,
+		out:    out,
+		now:    time.Now,
+		seen:   make(map[dedupKey]*dedupEntry),
+	}
+}
+
+// Run implements zerolog.Hook.
+func (d *Dedup) Run(e *zerolog.Event, level zerolog.Level, msg string) {
+	if level < zerolog.WarnLevel || level == zerolog.NoLevel || msg == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	k := dedupKey{level: level, msg: msg}
+	now := d.now()
+	if entry, ok := d.seen[k]; ok {
+		if now.Sub(entry.first) < d.window {
+			entry.repeated++
+			e.Discard()
+			return
+		}
+		d.summarize(k, entry)
+	}
+	d.seen[k] = &dedupEntry{first: now}
+}
+
+// Flush logs the summaries of the lines whose window is over.
+func (d *Dedup) Flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for k, entry := range d.seen {
+		if now.Sub(entry.first) >= d.window {
+			d.summarize(k, entry)
+			delete(d.seen, k)
+		}
+	}
+}
+
+// FlushEvery flushes the summaries periodically. It never returns.
+func (d *Dedup) FlushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		d.Flush()
+	}
+}
+
+// summarize logs the number of times a line has been suppressed, if any. It
+// must be called with the lock held.
+func (d *Dedup) summarize(k dedupKey, entry *dedupEntry) {
+	if entry.repeated == 0 {
+		return
+	}
+	d.out.WithLevel(k.level).Int("repeated", entry.repeated).
+		Msgf("%s (repeated %d times in the last %s)", k.msg, entry.repeated, shortDuration(d.window))
+}
+
+// shortDuration formats a duration without its trailing zero units, such as
+// 1h instead of 1h0m0s.
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
@@ -0,0 +1,84 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestDedup(t *testing.T) {
+	var buf bytes.Buffer
+	base := zerolog.New(&buf)
+	d := NewDedup(time.Hour, base)
+	now := time.Now()
+	d.now = func() time.Time { return now }
+	l := base.Hook(d)
+
+	lines := func() []map[string]any {
+		var got []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var m map[string]any
+			if err := json.Unmarshal([]byte(line), &m); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, m)
+		}
+		buf.Reset()
+		return got
+	}
+
+	for range 3 {
+		l.Warn().Msg("app (10.0.0.1) unexpected open ports: [8080]")
+	}
+	l.Info().Msg("app (10.0.0.1) open ports: [22 8080]")
+	l.Info().Msg("app (10.0.0.1) open ports: [22 8080]")
+	l.Error().Msg("app (10.0.0.1) unexpected open ports: [8080]")
+	if got := lines(); len(got) != 4 {
+		t.Errorf("logged %v, want the warning once, the info lines and the error", got)
+	}
+
+	// Nothing is summarized before the end of the window
+	now = now.Add(30 * time.Minute)
+	d.Flush()
+	if got := lines(); len(got) != 0 {
+		t.Errorf("Flush() logged %v before the end of the window", got)
+	}
+
+	now = now.Add(30 * time.Minute)
+	d.Flush()
+	got := lines()
+	if len(got) != 1 || got[0]["level"] != "warn" || got[0]["repeated"] != 2. ||
+		got[0]["message"] != "app (10.0.0.1) unexpected open ports: [8080] (repeated 2 times in the last 1h)" {
+		t.Errorf("Flush() logged %v, want a summary of the 2 repeated warnings", got)
+	}
+
+	// Once flushed, the line is logged again
+	l.Warn().Msg("app (10.0.0.1) unexpected open ports: [8080]")
+	if got := lines(); len(got) != 1 {
+		t.Errorf("logged %v after the window, want the warning", got)
+	}
+}
+
+func Test_shortDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{d: time.Hour, want: "1h"},
+		{d: 90 * time.Minute, want: "1h30m"},
+		{d: 10 * time.Minute, want: "10m"},
+		{d: 45 * time.Second, want: "45s"},
+	}
+	for _, tt := range tests {
+		if got := shortDuration(tt.d); got != tt.want {
+			t.Errorf("shortDuration(%s) = %s, want %s", tt.d, got, tt.want)
+		}
+	}
+}
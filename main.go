@@ -1,16 +1,29 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/history"
 	"github.com/devops-works/scan-exporter/logger"
 	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/output"
 	"github.com/devops-works/scan-exporter/pprof"
+	"github.com/devops-works/scan-exporter/reporting"
+	"github.com/devops-works/scan-exporter/results"
 	"github.com/devops-works/scan-exporter/scan"
+	"github.com/devops-works/scan-exporter/tracing"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog/log"
 )
 
@@ -21,22 +34,125 @@ var (
 	BuildDate string
 )
 
+// Output modes of the scanner.
+const (
+	// outputLogs only writes logs, to stderr
+	outputLogs = "logs"
+	// outputJSONEvents also writes scan results and findings to stdout, as
+	// JSON objects
+	outputJSONEvents = "json-events"
+)
+
+// shutdownFlushTimeout is the time given to the notifications, the outputs
+// and the traces to be sent once the scans are stopped.
+const shutdownFlushTimeout = 5 * time.Second
+
+// exitError makes scan-exporter exit with a specific code. The error, if
+// any, is logged first.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func (e *exitError) Unwrap() error {
+	return e.err
+}
+
 func main() {
 	if err := run(os.Args, os.Stdout); err != nil {
+		var exit *exitError
+		if errors.As(err, &exit) {
+			if exit.err != nil {
+				log.Error().Err(exit.err).Msgf("error running %s", os.Args[0])
+			}
+			os.Exit(exit.code)
+		}
 		log.Fatal().Err(err).Msgf("error running %s", os.Args[0])
 		os.Exit(1)
 	}
 }
 
+// lifecycle reloads the configuration of the scanner and stops scan-exporter
+// on request.
+type lifecycle struct {
+	confFile string
+	scanner  *scan.Scanner
+	// extraTargets are the targets read from the standard input, which are
+	// added to the ones of the configuration file
+	extraTargets []config.Target
+	// quit receives the requests to stop scan-exporter
+	quit chan struct{}
+}
+
+// Reload reads the configuration file again and applies it to the scanner.
+func (l *lifecycle) Reload() error {
+	if l.confFile == config.Stdin {
+		return errors.New("configuration read from the standard input cannot be reloaded")
+	}
+	c, err := config.New(l.confFile)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", l.confFile, err)
+	}
+	c.Targets = append(c.Targets, l.extraTargets...)
+	return l.scanner.Reload(c)
+}
+
+// Quit requests scan-exporter to stop.
+func (l *lifecycle) Quit() {
+	select {
+	case l.quit <- struct{}{}:
+	default:
+	}
+}
+
 func run(args []string, stdout io.Writer) error {
-	var confFile, pprofAddr, metricAddr, loglvl string
-	flag.StringVar(&confFile, "config", "config.yaml", "path to config file")
+	// Subcommands
+	if len(args) > 1 {
+		switch args[1] {
+		case "bench":
+			return runBench(args[2:], stdout)
+		case "check":
+			return runCheck(args[2:], stdout)
+		case "diff":
+			return runDiff(args[2:], stdout)
+		case "import":
+			return runImport(args[2:], stdout)
+		case "replay":
+			return runReplay(args[2:], stdout)
+		case "scan":
+			return runScan(args[2:], stdout)
+		case "selftest":
+			return runSelftest(args[2:], stdout)
+		}
+	}
+
+	var confFile, targetsFrom, pprofAddr, metricAddr, loglvl, outputMode string
+	flag.StringVar(&confFile, "config", "config.yaml", "path to config file, or - to read it from stdin")
+	flag.StringVar(&targetsFrom, "targets-from", "", "read additional targets from {stdin}, as a YAML or JSON list")
 	flag.StringVar(&pprofAddr, "pprof.addr", "", "pprof addr")
 	flag.StringVar(&metricAddr, "metric.addr", ":2112", "metric server addr")
 	flag.StringVar(&loglvl, "log.lvl", "debug", "log level. Can be {trace,debug,info,warn,error,fatal}")
+	flag.StringVar(&outputMode, "output", outputLogs, "output mode. Can be {logs,json-events}")
 	flag.Parse()
 
-	fmt.Printf("scan-exporter version %s (built %s)\n", Version, BuildDate)
+	// In json-events mode, stdout only holds the events, logs being written
+	// to stderr as usual
+	var extraOutputs []output.Sink
+	switch outputMode {
+	case outputLogs:
+		fmt.Fprintf(stdout, "scan-exporter version %s (built %s)\n", Version, BuildDate)
+	case outputJSONEvents:
+		extraOutputs = append(extraOutputs, output.NewJSONEvents(stdout))
+	default:
+		return fmt.Errorf("unknown output mode %q", outputMode)
+	}
 
 	// Start  pprof server is asked.
 	if pprofAddr != "" {
@@ -55,6 +171,22 @@ func run(args []string, stdout io.Writer) error {
 		log.Fatal().Msgf("error reading %s: %s", confFile, err)
 	}
 
+	// Targets can also be piped from an inventory
+	var extraTargets []config.Target
+	switch targetsFrom {
+	case "":
+	case "stdin":
+		if confFile == config.Stdin {
+			return errors.New("the configuration and the targets cannot both be read from stdin")
+		}
+		if extraTargets, err = config.ReadTargets(os.Stdin); err != nil {
+			return fmt.Errorf("cannot read targets from stdin: %w", err)
+		}
+		c.Targets = append(c.Targets, extraTargets...)
+	default:
+		return fmt.Errorf("unknown targets source %q", targetsFrom)
+	}
+
 	// Set global loglevel
 	// Overwrite the flag loglevel by the one given in configuration
 	if c.LogLevel != "" {
@@ -64,21 +196,152 @@ func run(args []string, stdout io.Writer) error {
 
 	// Create scanner
 	scanner := scan.Scanner{
-		Logger: logger.New(loglvl),
+		Logger:  logger.New(loglvl),
+		Results: results.New(),
+		Version: Version,
+	}
+
+	// Recurring warnings are summarized instead of being logged on every
+	// scan
+	if c.LogDedupWindow != "" {
+		window, err := time.ParseDuration(c.LogDedupWindow)
+		if err != nil {
+			return fmt.Errorf("invalid log deduplication window: %w", err)
+		}
+		dedup := logger.NewDedup(window, scanner.Logger)
+		go dedup.FlushEvery(min(window, time.Minute))
+		scanner.Logger = scanner.Logger.Hook(dedup)
+		log.Logger = log.Logger.Hook(dedup)
 	}
 
 	// Create metrics server
 	scanner.MetricsServ = *metrics.Init(metricAddr)
+	scanner.MetricsServ.Results = scanner.Results
+	scanner.MetricsServ.Version = Version
+	scanner.MetricsServ.Targets = &scanner
+	scanner.MetricsServ.Prober = &scanner
+	scanner.MetricsServ.LogMaxPorts = c.LogMaxPorts
+	scanner.MetricsServ.AvailabilityWindow = c.AvailabilityWindow
+	if err := scanner.MetricsServ.SetWeb(c.Web); err != nil {
+		return fmt.Errorf("cannot protect the metrics server: %w", err)
+	}
+
+	// Create notification routes
+	scanner.MetricsServ.Notifier, err = notify.New(c.Notifications, scanner.Logger)
+	if err != nil {
+		return fmt.Errorf("cannot configure notifications: %w", err)
+	}
+
+	// Create outputs, which receive scan results and findings
+	scanner.Outputs, err = output.New(c.Outputs, scanner.MetricsServ.DroppedEvents, scanner.Logger, extraOutputs...)
+	if err != nil {
+		return fmt.Errorf("cannot configure outputs: %w", err)
+	}
+	scanner.MetricsServ.Notifier.Subscribe(func(f notify.Finding) {
+		scanner.Outputs.Publish(output.FindingEvent(f))
+	})
+
+	// Record the results of the scans, so that they survive restarts
+	scanner.History, err = history.Open(c.History)
+	if err != nil {
+		return fmt.Errorf("cannot open the history: %w", err)
+	}
+	defer scanner.History.Close()
+	scanner.MetricsServ.History = scanner.History
+
+	// Ping the heartbeat URL while scans are running
+	heartbeat, err := notify.NewHeartbeat(c.Notifications.Heartbeat, scanner.Healthy, scanner.Logger)
+	if err != nil {
+		return fmt.Errorf("cannot configure heartbeat: %w", err)
+	}
+	if heartbeat != nil {
+		go heartbeat.Run()
+	}
+
+	// Report errors and panics to Sentry
+	flushReports, err := reporting.Init(c.Sentry, Version)
+	if err != nil {
+		return fmt.Errorf("cannot configure error reporting: %w", err)
+	}
+	defer flushReports()
+	defer reporting.Recover("", "")
+
+	// Export traces of the scans
+	shutdownTracing, err := tracing.Init(c.Tracing)
+	if err != nil {
+		return fmt.Errorf("cannot configure tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Push the metrics to an OpenTelemetry collector
+	shutdownOTLP, err := metrics.InitOTLP(c.OTLPMetrics, prometheus.DefaultGatherer)
+	if err != nil {
+		return fmt.Errorf("cannot configure OTLP metrics: %w", err)
+	}
+	defer shutdownOTLP(context.Background())
+
+	// The configuration is reloaded, and scan-exporter stopped, through the
+	// API as well as with signals
+	lc := &lifecycle{confFile: confFile, scanner: &scanner, extraTargets: extraTargets, quit: make(chan struct{}, 1)}
+	scanner.MetricsServ.Lifecycle = lc
+
+	// Scans run until scan-exporter is stopped, the running scan being then
+	// given the shutdown timeout to end
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		var reason string
+		for reason == "" {
+			select {
+			case sig := <-sigs:
+				if sig == syscall.SIGHUP {
+					if err := lc.Reload(); err != nil {
+						scanner.Logger.Error().Err(err).Msg("cannot reload configuration")
+					}
+					continue
+				}
+				reason = fmt.Sprintf("received %s", sig)
+			case <-lc.quit:
+				reason = "termination requested through the API"
+			}
+		}
+		scanner.Logger.Info().Msgf("%s, stopping the scans", reason)
+		stop()
+	}()
 
 	// Start metrics server
 	go func() {
-		if err := scanner.MetricsServ.Start(); err != nil {
+		if err := scanner.MetricsServ.Start(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			scanner.Logger.Fatal().Err(err).Msg("metrics server failed critically")
 		}
 	}()
 
-	if err := scanner.Start(c); err != nil {
+	if err := scanner.Start(ctx, c); err != nil {
 		return err
 	}
+
+	// The findings and events of the last scans are sent, then the metrics
+	// server, the traces and the OTLP metrics are shut down. Error reports
+	// are flushed on return
+	flushCtx, cancel := context.WithTimeout(context.Background(), shutdownFlushTimeout)
+	defer cancel()
+	if err := scanner.MetricsServ.Notifier.Close(flushCtx); err != nil {
+		scanner.Logger.Error().Err(err).Msg("cannot send the last notifications")
+	}
+	if err := scanner.Outputs.Close(flushCtx); err != nil {
+		scanner.Logger.Error().Err(err).Msg("cannot send the last events to the outputs")
+	}
+	if err := scanner.MetricsServ.Shutdown(flushCtx); err != nil {
+		scanner.Logger.Error().Err(err).Msg("cannot shut down the metrics server")
+	}
+	if err := shutdownTracing(flushCtx); err != nil {
+		scanner.Logger.Error().Err(err).Msg("cannot flush traces")
+	}
+	if err := shutdownOTLP(flushCtx); err != nil {
+		scanner.Logger.Error().Err(err).Msg("cannot push the last metrics")
+	}
+	scanner.Logger.Info().Msg("scan-exporter stopped")
 	return nil
 }
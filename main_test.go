@@ -0,0 +1,14 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+func Test_lifecycle_Reload_stdin(t *testing.T) {
+	l := &lifecycle{confFile: config.Stdin}
+	if err := l.Reload(); err == nil {
+		t.Error("Reload() error = nil, want an error for a configuration read from stdin")
+	}
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"github.com/devops-works/scan-exporter/common"
+)
+
+// defaultAvailabilityWindow is the default number of scans over which the
+// availability of the expected ports is computed.
+const defaultAvailabilityWindow = 100
+
+// availability records whether a port was open during the latest scans.
+type availability struct {
+	// samples is a ring buffer of the latest scans, next being the index
+	// of the oldest one once it is full
+	samples []bool
+	next    int
+	full    bool
+}
+
+// newAvailability creates the record of the latest window scans.
+func newAvailability(window int) *availability {
+	return &availability{samples: make([]bool, window)}
+}
+
+// add records the state of the port during a scan.
+func (a *availability) add(open bool) {
+	a.samples[a.next] = open
+	a.next = (a.next + 1) % len(a.samples)
+	if a.next == 0 {
+		a.full = true
+	}
+}
+
+// ratio returns the fraction of the recorded scans during which the port was
+// open.
+func (a *availability) ratio() float64 {
+	n := a.next
+	if a.full {
+		n = len(a.samples)
+	}
+	if n == 0 {
+		return 0
+	}
+	open := 0
+	for _, o := range a.samples[:n] {
+		if o {
+			open++
+		}
+	}
+	return float64(open) / float64(n)
+}
+
+// updateAvailability records the state of the expected ports of a target
+// address during its latest scan, and exports their availability. Ports that
+// are not expected anymore are forgotten.
+func (s *Server) updateAvailability(nm NewMetrics) {
+	window := s.AvailabilityWindow
+	if window <= 0 {
+		window = defaultAvailabilityWindow
+	}
+
+	ports := s.availabilities[nm.IP]
+	if ports == nil {
+		ports = make(map[string]*availability)
+		s.availabilities[nm.IP] = ports
+	}
+	open, expected := common.PortSetOf(nm.Open), nm.expectedPorts()
+	for port := range ports {
+		if !expected.HasString(port) {
+			delete(ports, port)
+			s.Availability.DeletePartialMatch(map[string]string{"name": nm.Name, "ip": nm.IP, "port": port})
+		}
+	}
+
+	for _, port := range nm.Expected {
+		a, ok := ports[port]
+		if !ok {
+			a = newAvailability(window)
+			ports[port] = a
+		}
+		a.add(open.HasString(port))
+		s.Availability.WithLabelValues(nm.Name, nm.IP, port, nm.Labels["owner"]).Set(a.ratio())
+	}
+}
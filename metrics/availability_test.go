@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_availability_ratio(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  int
+		samples []bool
+		want    float64
+	}{
+		{name: "no scan", window: 4, want: 0},
+		{name: "always open", window: 4, samples: []bool{true, true}, want: 1},
+		{name: "partial window", window: 4, samples: []bool{true, false, true}, want: 2. / 3},
+		{name: "oldest scans forgotten", window: 4, samples: []bool{false, false, true, true, true, false}, want: 0.75},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAvailability(tt.window)
+			for _, open := range tt.samples {
+				a.add(open)
+			}
+			if got := a.ratio(); got != tt.want {
+				t.Errorf("ratio() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_updateAvailability(t *testing.T) {
+	s := &Server{
+		Availability:       prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "availability"}, []string{"name", "ip", "port", "owner"}),
+		AvailabilityWindow: 2,
+		availabilities:     make(map[string]map[string]*availability),
+	}
+	nm := NewMetrics{Name: "app", IP: "10.0.0.1", Expected: []string{"22", "443"}, Open: []string{"22"}}
+	s.updateAvailability(nm)
+	nm.Open = []string{"22", "443"}
+	s.updateAvailability(nm)
+
+	if got := testutil.ToFloat64(s.Availability.WithLabelValues("app", "10.0.0.1", "22", "")); got != 1 {
+		t.Errorf("availability of port 22 = %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(s.Availability.WithLabelValues("app", "10.0.0.1", "443", "")); got != 0.5 {
+		t.Errorf("availability of port 443 = %v, want 0.5", got)
+	}
+
+	// Ports which are not expected anymore are forgotten
+	nm.Expected = []string{"22"}
+	s.updateAvailability(nm)
+	if n := testutil.CollectAndCount(s.Availability); n != 1 {
+		t.Errorf("%d availability series once port 443 is not expected, want 1", n)
+	}
+}
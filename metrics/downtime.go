@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Downtime exports how long conditions, such as an expected port being
+// closed, have persisted since they were first detected. The durations are
+// computed when the metrics are collected, so they keep increasing between
+// two scans. Its first labels must be the name and the IP of the target.
+type Downtime struct {
+	desc *prometheus.Desc
+	now  func() time.Time
+
+	mu sync.Mutex
+	// since holds the time at which each condition has been detected,
+	// indexed by its label values
+	since map[string]downtimeEntry
+}
+
+// downtimeEntry is a condition which persists.
+type downtimeEntry struct {
+	labels []string
+	since  time.Time
+}
+
+// NewDowntime creates a downtime metric.
+func NewDowntime(name, help string, labels []string) *Downtime {
+	return &Downtime{
+		desc:  prometheus.NewDesc(name, help, labels, nil),
+		now:   time.Now,
+		since: make(map[string]downtimeEntry),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (d *Downtime) Describe(ch chan<- *prometheus.Desc) {
+	ch <- d.desc
+}
+
+// Collect implements prometheus.Collector.
+func (d *Downtime) Collect(ch chan<- prometheus.Metric) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.now()
+	for _, e := range d.since {
+		ch <- prometheus.MustNewConstMetric(d.desc, prometheus.GaugeValue, now.Sub(e.since).Seconds(), e.labels...)
+	}
+}
+
+// Track records the conditions of a target address which currently hold,
+// given by their label values. Conditions detected earlier keep their
+// detection time, and the other conditions of the address are over.
+func (d *Downtime) Track(name, ip string, down [][]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current := make(map[string]bool, len(down))
+	for _, labels := range down {
+		key := strings.Join(labels, "\x00")
+		current[key] = true
+		if _, ok := d.since[key]; !ok {
+			d.since[key] = downtimeEntry{labels: slices.Clone(labels), since: d.now()}
+		}
+	}
+	for key, e := range d.since {
+		if e.labels[0] == name && e.labels[1] == ip && !current[key] {
+			delete(d.since, key)
+		}
+	}
+}
+
+// Delete forgets all the conditions of a target address.
+func (d *Downtime) Delete(name, ip string) {
+	d.Track(name, ip, nil)
+}
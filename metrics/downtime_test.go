@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestDowntime(t *testing.T) {
+	d := NewDowntime("port_down_seconds", "Downtime.", []string{"name", "ip", "port"})
+	now := time.Now()
+	d.now = func() time.Time { return now }
+
+	d.Track("app", "10.0.0.1", [][]string{{"app", "10.0.0.1", "22"}})
+	d.Track("db", "10.0.0.2", [][]string{{"db", "10.0.0.2", "5432"}})
+	now = now.Add(time.Minute)
+	d.Track("app", "10.0.0.1", [][]string{{"app", "10.0.0.1", "22"}, {"app", "10.0.0.1", "443"}})
+	now = now.Add(time.Minute)
+
+	want := `
+# HELP port_down_seconds Downtime.
+# TYPE port_down_seconds gauge
+port_down_seconds{ip="10.0.0.1",name="app",port="22"} 120
+port_down_seconds{ip="10.0.0.1",name="app",port="443"} 60
+port_down_seconds{ip="10.0.0.2",name="db",port="5432"} 120
+`
+	if err := testutil.CollectAndCompare(d, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+
+	// Conditions which are over are forgotten, and so are the ones of
+	// deleted targets
+	d.Track("app", "10.0.0.1", [][]string{{"app", "10.0.0.1", "443"}})
+	d.Delete("db", "10.0.0.2")
+	want = `
+# HELP port_down_seconds Downtime.
+# TYPE port_down_seconds gauge
+port_down_seconds{ip="10.0.0.1",name="app",port="443"} 60
+`
+	if err := testutil.CollectAndCompare(d, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
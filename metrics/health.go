@@ -0,0 +1,85 @@
+package metrics
+
+import "time"
+
+// Weights of the components of the health score, adding up to 100.
+const (
+	reachabilityWeight = 30
+	availabilityWeight = 40
+	latencyWeight      = 10
+	exposureWeight     = 20
+)
+
+// Latencies between which the latency component decreases linearly from its
+// full weight to zero.
+const (
+	goodLatency = 50 * time.Millisecond
+	badLatency  = time.Second
+)
+
+// exposurePenalty is the number of points of the exposure component lost for
+// each unexpected open port.
+const exposurePenalty = 5
+
+// health holds the latest state of a target address, from which its health
+// score is computed.
+type health struct {
+	// pinged is true once a ping result has been received, in which case
+	// responding and rtt hold its outcome
+	pinged     bool
+	responding bool
+	rtt        time.Duration
+	// scanned is true once a scan result has been received, in which case
+	// the ports fields hold its outcome
+	scanned        bool
+	expected       int
+	expectedOpen   int
+	unexpectedOpen int
+}
+
+// health returns the state of a target address, creating it if needed.
+func (s *Server) health(ip string) *health {
+	h, ok := s.healths[ip]
+	if !ok {
+		h = &health{}
+		s.healths[ip] = h
+	}
+	return h
+}
+
+// setHealthScore exports the health score of a target address, once it has
+// been scanned.
+func (s *Server) setHealthScore(name, ip, owner string) {
+	h := s.healths[ip]
+	if !h.scanned {
+		return
+	}
+	s.HealthScore.WithLabelValues(name, ip, owner).Set(h.score())
+}
+
+// score returns the health score, from 0 to 100. Unknown components, such as
+// the reachability of targets which are not pinged, get their full weight.
+func (h health) score() float64 {
+	var score float64
+
+	if !h.pinged || h.responding {
+		score += reachabilityWeight
+	}
+
+	if h.expected == 0 {
+		score += availabilityWeight
+	} else {
+		score += availabilityWeight * float64(h.expectedOpen) / float64(h.expected)
+	}
+
+	switch {
+	case !h.pinged || !h.responding || h.rtt <= goodLatency:
+		// Unreachable targets already lost the reachability points
+		score += latencyWeight
+	case h.rtt < badLatency:
+		score += latencyWeight * float64(badLatency-h.rtt) / float64(badLatency-goodLatency)
+	}
+
+	score += float64(max(exposureWeight-exposurePenalty*h.unexpectedOpen, 0))
+	return score
+}
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_health_score(t *testing.T) {
+	tests := []struct {
+		name   string
+		health health
+		want   float64
+	}{
+		{name: "unknown", health: health{}, want: 100},
+		{
+			name:   "healthy",
+			health: health{pinged: true, responding: true, rtt: 10 * time.Millisecond, scanned: true, expected: 3, expectedOpen: 3},
+			want:   100,
+		},
+		{
+			name:   "not responding",
+			health: health{pinged: true, scanned: true, expected: 2, expectedOpen: 2},
+			want:   70,
+		},
+		{
+			name:   "expected port closed",
+			health: health{scanned: true, expected: 4, expectedOpen: 3},
+			want:   90,
+		},
+		{
+			name:   "slow",
+			health: health{pinged: true, responding: true, rtt: 525 * time.Millisecond},
+			want:   95,
+		},
+		{
+			name:   "very slow",
+			health: health{pinged: true, responding: true, rtt: 2 * time.Second},
+			want:   90,
+		},
+		{
+			name:   "unexpected ports",
+			health: health{scanned: true, unexpectedOpen: 2},
+			want:   90,
+		},
+		{
+			name:   "widely exposed",
+			health: health{scanned: true, unexpectedOpen: 100},
+			want:   80,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.health.score(); got != tt.want {
+				t.Errorf("score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_setHealthScore(t *testing.T) {
+	s := &Server{
+		HealthScore: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "health"}, []string{"name", "ip", "owner"}),
+		healths:     make(map[string]*health),
+	}
+
+	// Pings alone do not tell whether the expected ports are open
+	h := s.health("10.0.0.1")
+	h.pinged = true
+	s.setHealthScore("app", "10.0.0.1", "team")
+	if n := testutil.CollectAndCount(s.HealthScore); n != 0 {
+		t.Errorf("setHealthScore() exported %d scores before the first scan, want 0", n)
+	}
+
+	h.scanned = true
+	h.expected = 2
+	h.expectedOpen = 1
+	s.setHealthScore("app", "10.0.0.1", "team")
+	if got := testutil.ToFloat64(s.HealthScore.WithLabelValues("app", "10.0.0.1", "team")); got != 50 {
+		t.Errorf("setHealthScore() exported %v, want 50", got)
+	}
+}
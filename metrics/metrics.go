@@ -1,12 +1,22 @@
 package metrics
 
 import (
+	"context"
+	"crypto/tls"
+	"fmt"
 	"net/http"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/devops-works/scan-exporter/common"
 	"github.com/devops-works/scan-exporter/handlers"
+	"github.com/devops-works/scan-exporter/history"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/devops-works/scan-exporter/services"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
@@ -15,19 +25,249 @@ type Server struct {
 	Addr                                                    string
 	NotRespondingList                                       map[string]bool
 	NumOfTargets, PendingScans, NumOfDownTargets, Uptime    prometheus.Gauge
+	EgressBlackhole, FDInUse, FDLimit                       prometheus.Gauge
+	FDThrottled                                             prometheus.Counter
 	UnexpectedPorts, OpenPorts, ClosedPorts, DiffPorts, Rtt *prometheus.GaugeVec
+	HTTPAssertionFailed, MisbehavingPorts, PortAnnotations  *prometheus.GaugeVec
+	Compliant, ChangeRateExceeded, FamilyMismatches         *prometheus.GaugeVec
+	TargetPaused, UnreachableViaDependency, TargetMAC       *prometheus.GaugeVec
+	PortService, TargetGeo, TargetInfo                      *prometheus.GaugeVec
+	TargetTimeout, TLSCertExpiry, TLSCertInfo               *prometheus.GaugeVec
+	HTTPStatusCode, HTTPResponseSize, HTTPLatency           *prometheus.GaugeVec
+	NeighborReachable, HealthScore, Availability            *prometheus.GaugeVec
+	PortFlapping, TargetFlapping, PortState                 *prometheus.GaugeVec
+	DroppedEvents, AbortedScans, PortChanges                *prometheus.CounterVec
+	MissedTicks                                             *prometheus.CounterVec
+	JobDuration, ScanDuration                               *prometheus.HistogramVec
+	PortDowntime, TargetDowntime                            *Downtime
+	BatchDuration, SchedulerLag                             prometheus.Histogram
+	Notifier                                                *notify.Dispatcher
+	Results                                                 *results.Store
+	// Targets controls the scans of the targets through the API
+	Targets handlers.Targets
+	// Lifecycle reloads and stops scan-exporter through the API
+	Lifecycle handlers.Lifecycle
+	// Prober probes ports on demand through the API
+	Prober handlers.Prober
+	// History serves the history of the scans through the API, if enabled
+	History *history.Store
+	// Version is the version of scan-exporter
+	Version string
+	// LogMaxPorts is the number of ports after which the lists of ports are
+	// truncated in the logs. Zero keeps the whole lists
+	LogMaxPorts int
+	// AvailabilityWindow is the number of scans over which the availability
+	// of the expected ports is computed. Zero uses the default
+	AvailabilityWindow int
+
+	// web holds the protection of the server
+	web web
+	// srv serves the metrics and the API. It is created by Init, so that it
+	// can be shut down before being started
+	srv *http.Server
+	// deletions holds the targets whose metrics must be deleted
+	deletions chan deletion
+	// healths holds the state of each target address from which its health
+	// score is computed. It is only accessed by the updater
+	healths map[string]*health
+	// availabilities holds the latest states of the expected ports of each
+	// target address. It is only accessed by the updater
+	availabilities map[string]map[string]*availability
+}
+
+// HTTPResponse describes the response to the HTTP check of a port.
+type HTTPResponse struct {
+	Status  int
+	Size    int
+	Latency time.Duration
+}
+
+// TLSCert describes the certificate presented by a TLS port.
+type TLSCert struct {
+	NotAfter        time.Time
+	Subject, Issuer string
+}
+
+// deletion identifies a target whose metrics must be deleted.
+type deletion struct {
+	name, ip string
 }
 
 // NewMetrics is the type that will transit between scan and metrics. It carries
 // informations that will be used for calculation, such as expected ports.
 type NewMetrics struct {
-	Name     string
-	IP       string
-	Diff     int
+	Name string
+	IP   string
+	Diff int
+	// Baseline is true for the first scan of the target, for which Diff is
+	// meaningless.
+	Baseline bool
 	Open     []string
 	Closed   []string
 	Expected []string
 	Labels   map[string]string
+
+	// ExpectedPorts holds the ports of Expected as a set, parsed once with
+	// the target. It is built from Expected when nil.
+	ExpectedPorts *common.PortSet
+
+	// Severities classifies ports. The other ports have the warning
+	// severity.
+	Severities notify.Severities
+
+	// Annotations describes what ports are used for.
+	Annotations map[string]string
+
+	// ChangeThreshold is the value of Diff above which the changes are
+	// flagged. Zero disables the detection.
+	ChangeThreshold int
+
+	// Misbehaving holds, for each open port whose banner does not match the
+	// expected one, the reason of the mismatch.
+	Misbehaving map[string]string
+
+	// HTTPMismatches holds, for each port checked using HTTP, the reason
+	// why the assertions failed. An empty reason means that they succeeded.
+	HTTPMismatches map[string]string
+
+	// HTTPResponses holds the responses to the HTTP checks, indexed by
+	// port.
+	HTTPResponses map[string]HTTPResponse
+
+	// Certificates holds the certificates presented by the inspected TLS
+	// ports, indexed by port.
+	Certificates map[string]TLSCert
+
+	// FamilyMismatches holds, for the IPv6 address of a dual-stack target,
+	// the ports that are only open on one of its addresses, with the family
+	// of that address.
+	FamilyMismatches map[string]string
+
+	// Job holds the timing of the scan, and is only set on the metrics of
+	// the first address of a target.
+	Job *JobTiming
+	// ScanID is the ID of the scan job, and Start and End the times at
+	// which its probes started and ended.
+	ScanID     string
+	Start, End time.Time
+
+	// Flapping holds the ports changing state too often.
+	Flapping []string
+
+	// Owner identifies the network of public addresses, when known.
+	Owner *notify.Owner
+
+	// Stop is closed when the target is removed. Metrics of removed targets
+	// are ignored.
+	Stop <-chan struct{}
+}
+
+// expectedPorts returns the set of the expected ports.
+func (nm NewMetrics) expectedPorts() *common.PortSet {
+	if nm.ExpectedPorts != nil {
+		return nm.ExpectedPorts
+	}
+	return common.PortSetOf(nm.Expected)
+}
+
+// severity returns the severity of a port.
+func (nm NewMetrics) severity(port string) string {
+	p, _ := strconv.Atoi(port)
+	if sev, ok := nm.Severities.Of(p); ok {
+		return sev
+	}
+	return notify.SeverityWarning
+}
+
+// attributed appends the owner of a target to the message of one of its
+// findings, so that the team responsible for it is known at once.
+func attributed(msg string, labels map[string]string) string {
+	if owner := labels["owner"]; owner != "" {
+		return msg + " [owner: " + owner + "]"
+	}
+	return msg
+}
+
+// finding creates a finding of the given kind for a port of the target. If the
+// port is annotated, the annotation is appended to the message, followed by the
+// owner of the target.
+func (nm NewMetrics) finding(kind, port, msg string) notify.Finding {
+	annotation := nm.Annotations[port]
+	if annotation != "" {
+		msg += " (" + annotation + ")"
+	}
+	msg = attributed(msg, nm.Labels)
+	return notify.Finding{
+		Kind:       kind,
+		Name:       nm.Name,
+		IP:         nm.IP,
+		Port:       port,
+		Service:    services.Name(notify.ProtoTCP, port),
+		Proto:      notify.ProtoTCP,
+		Severity:   nm.severity(port),
+		Message:    msg,
+		Annotation: annotation,
+		Labels:     nm.Labels,
+		Time:       time.Now(),
+		Owner:      nm.Owner,
+
+		Diff:         nm.Diff,
+		ScanDuration: nm.End.Sub(nm.Start).Seconds(),
+	}
+}
+
+// countPortChanges counts the ports that changed state since the previous scan
+// of a target address. The counter is created at zero by the first scan, whose
+// changes are meaningless.
+func (s *Server) countPortChanges(nm NewMetrics) {
+	changes := s.PortChanges.WithLabelValues(nm.Name, nm.IP, notify.ProtoTCP, nm.Labels["owner"])
+	if !nm.Baseline {
+		changes.Add(float64(nm.Diff))
+	}
+}
+
+// observeScan exports the duration of the scan of a target, during which its
+// ports were probed.
+func (s *Server) observeScan(nm NewMetrics) {
+	s.ScanDuration.WithLabelValues(nm.Name, nm.IP, notify.ProtoTCP, nm.Labels["owner"]).Observe(nm.End.Sub(nm.Start).Seconds())
+}
+
+// setPortStates exports the state of the open and expected ports of a target
+// address. The other ports have no series, so that the ports which closed and
+// are not expected disappear.
+func (s *Server) setPortStates(nm NewMetrics, open, expected *common.PortSet) {
+	s.PortState.DeletePartialMatch(prometheus.Labels{"name": nm.Name, "ip": nm.IP, "proto": notify.ProtoTCP})
+	owner := nm.Labels["owner"]
+	for p := range open.All() {
+		s.PortState.WithLabelValues(nm.Name, nm.IP, notify.ProtoTCP, strconv.Itoa(p), owner).Set(1)
+	}
+	for p := range expected.Minus(open).All() {
+		s.PortState.WithLabelValues(nm.Name, nm.IP, notify.ProtoTCP, strconv.Itoa(p), owner).Set(0)
+	}
+}
+
+// JobTiming holds the lifecycle of a scan job.
+type JobTiming struct {
+	// Queued, Started and Finished are the times at which the scan has been
+	// triggered, has started, and has probed all the ports.
+	Queued, Started, Finished time.Time
+	// Scheduled is the time at which the scan was planned by the scheduler.
+	// It is zero for the scans triggered otherwise, such as retries.
+	Scheduled time.Time
+	// Batches holds the duration of each probe batch.
+	Batches []time.Duration
+}
+
+// observeJob exports the timing of a job.
+func (s *Server) observeJob(job *JobTiming) {
+	s.JobDuration.WithLabelValues("queued").Observe(job.Started.Sub(job.Queued).Seconds())
+	s.JobDuration.WithLabelValues("probing").Observe(job.Finished.Sub(job.Started).Seconds())
+	if !job.Scheduled.IsZero() {
+		s.SchedulerLag.Observe(job.Started.Sub(job.Scheduled).Seconds())
+	}
+	for _, d := range job.Batches {
+		s.BatchDuration.Observe(d.Seconds())
+	}
 }
 
 // PingInfo holds the ping update of a specific target
@@ -37,6 +277,60 @@ type PingInfo struct {
 	IsResponding bool
 	RTT          time.Duration
 	Labels       map[string]string
+	// NeighborChecked is true when the reachability of an IPv6 address on
+	// the local segment has been checked using neighbor discovery, in which
+	// case NeighborReachable holds the result.
+	NeighborChecked, NeighborReachable bool
+	// Flapping is true when the target goes up and down too often.
+	Flapping bool
+	// DownSeverity is the severity of the target not responding, and
+	// NotifyDown is true when it is sent to the notification routes.
+	DownSeverity string
+	NotifyDown   bool
+	// Stop is closed when the target is removed.
+	Stop <-chan struct{}
+}
+
+// hostDownFinding creates the finding of the target not responding, whose
+// severity is warning by default.
+func (pm PingInfo) hostDownFinding() *notify.Finding {
+	severity := pm.DownSeverity
+	if severity == "" {
+		severity = notify.SeverityWarning
+	}
+	return &notify.Finding{
+		Kind:     notify.KindHostDown,
+		Name:     pm.Name,
+		IP:       pm.IP,
+		Proto:    notify.ProtoICMP,
+		Severity: severity,
+		Message:  attributed(fmt.Sprintf("%s (%s) does not respond to ICMP requests", pm.Name, pm.IP), pm.Labels),
+		Labels:   pm.Labels,
+		Time:     time.Now(),
+	}
+}
+
+// downLevel returns the level at which a target not responding is logged,
+// given the severity of its findings.
+func downLevel(severity string) zerolog.Level {
+	switch severity {
+	case notify.SeverityInfo:
+		return zerolog.InfoLevel
+	case notify.SeverityCritical:
+		return zerolog.ErrorLevel
+	default:
+		return zerolog.WarnLevel
+	}
+}
+
+// removed checks if the channel closed when a target is removed is closed.
+func removed(stop <-chan struct{}) bool {
+	select {
+	case <-stop:
+		return true
+	default:
+		return false
+	}
 }
 
 // Init initialize the metrics
@@ -61,10 +355,27 @@ func Init(addr string) *Server {
 			Name: "scanexporter_icmp_not_responding_total",
 			Help: "Number of targets that doesn't respond to pings.",
 		}),
+
+		EgressBlackhole: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "scanexporter_egress_blackhole",
+			Help: "Indicates that the probes are likely dropped before they leave the host.",
+		}),
+		FDInUse: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "scanexporter_fd_in_use",
+			Help: "Number of file descriptors held by the probes.",
+		}),
+		FDLimit: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "scanexporter_fd_limit",
+			Help: "Number of file descriptors available to the probes.",
+		}),
+		FDThrottled: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "scanexporter_fd_throttled_total",
+			Help: "Number of probes which waited for a file descriptor.",
+		}),
 		UnexpectedPorts: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scanexporter_unexpected_open_port",
 			Help: "Indicates the presence of an unexpected open port.",
-		}, []string{"name", "ip", "port", "owner"}),
+		}, []string{"name", "ip", "port", "severity", "owner"}),
 		OpenPorts: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 			Name: "scanexporter_open_ports_total",
 			Help: "Number of ports that are open.",
@@ -84,6 +395,179 @@ func Init(addr string) *Server {
 			Name: "scanexporter_rtt_total",
 			Help: "Response time of the target.",
 		}, []string{"name", "ip", "owner"}),
+
+		MisbehavingPorts: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_misbehaving_port",
+			Help: "Indicates that an open port does not send the expected banner.",
+		}, []string{"name", "ip", "port", "severity", "owner"}),
+
+		Compliant: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_target_compliant",
+			Help: "Indicates that the open ports of the target exactly match the expected ones.",
+		}, []string{"name", "ip"}),
+
+		ChangeRateExceeded: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_change_threshold_exceeded",
+			Help: "Indicates that more ports than the threshold changed state since previous scan.",
+		}, []string{"name", "ip", "owner"}),
+
+		PortAnnotations: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_port_annotation_info",
+			Help: "Describes what an annotated port is used for.",
+		}, []string{"name", "ip", "port", "annotation", "owner"}),
+
+		HTTPAssertionFailed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_http_assertion_failed",
+			Help: "Indicates that an open web port does not satisfy the HTTP assertions.",
+		}, []string{"name", "ip", "port", "owner"}),
+
+		HTTPStatusCode: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_http_status_code",
+			Help: "Status code of the response to the HTTP check of a port.",
+		}, []string{"name", "ip", "port", "owner"}),
+
+		HTTPResponseSize: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_http_response_size_bytes",
+			Help: "Size of the body of the response to the HTTP check of a port.",
+		}, []string{"name", "ip", "port", "owner"}),
+
+		HTTPLatency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_http_latency_seconds",
+			Help: "Time between the HTTP check of a port and the headers of the response.",
+		}, []string{"name", "ip", "port", "owner"}),
+
+		TLSCertExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_tls_cert_expiry_timestamp_seconds",
+			Help: "Expiry time of the certificate presented by a TLS port, as a Unix timestamp.",
+		}, []string{"name", "ip", "port", "owner"}),
+
+		TLSCertInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_tls_cert_info",
+			Help: "Describes the certificate presented by a TLS port.",
+		}, []string{"name", "ip", "port", "subject", "issuer", "owner"}),
+
+		FamilyMismatches: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_family_mismatch_port",
+			Help: "Indicates that a port of a dual-stack target is only open on one address family.",
+		}, []string{"name", "ip", "port", "open_on", "owner"}),
+
+		TargetPaused: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_target_paused",
+			Help: "Indicates that the scans of a target are paused.",
+		}, []string{"name", "ip", "owner"}),
+
+		UnreachableViaDependency: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_unreachable_via_dependency",
+			Help: "Indicates that a target is not scanned because a target it depends on is down.",
+		}, []string{"name", "ip", "owner", "dependency"}),
+
+		TargetMAC: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_target_mac_info",
+			Help: "MAC address of a target on the local segment, and its vendor.",
+		}, []string{"name", "ip", "mac", "vendor", "owner"}),
+
+		PortService: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_port_service_info",
+			Help: "Well-known service running on an open port.",
+		}, []string{"name", "ip", "port", "service", "owner"}),
+
+		TargetGeo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_target_geo_info",
+			Help: "Country and autonomous system of a public target.",
+		}, []string{"name", "ip", "country", "asn", "as_org", "owner"}),
+
+		TargetInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_target_info",
+			Help: "Owner and description of a target.",
+		}, []string{"name", "ip", "owner", "description"}),
+
+		TargetTimeout: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_target_timeout_seconds",
+			Help: "Effective timeout of the probes of a target, by protocol.",
+		}, []string{"name", "ip", "proto"}),
+
+		NeighborReachable: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_ndp_reachable",
+			Help: "Indicates whether an IPv6 target on the local segment answers neighbor solicitations.",
+		}, []string{"name", "ip", "owner"}),
+
+		HealthScore: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_target_health_score",
+			Help: "Health score of a target, from 0 to 100, combining reachability, expected ports availability, latency and unexpected exposure.",
+		}, []string{"name", "ip", "owner"}),
+
+		Availability: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_expected_port_availability_ratio",
+			Help: "Fraction of the latest scans during which an expected port was open.",
+		}, []string{"name", "ip", "port", "owner"}),
+
+		PortFlapping: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_port_flapping",
+			Help: "Indicates that a port changes state too often.",
+		}, []string{"name", "ip", "port", "owner"}),
+
+		TargetFlapping: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_target_flapping",
+			Help: "Indicates whether a target goes up and down too often.",
+		}, []string{"name", "ip", "owner"}),
+
+		PortState: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "scanexporter_port_state",
+			Help: "State of the open and expected ports of a target: 1 when open, 0 when closed.",
+		}, []string{"name", "ip", "proto", "port", "owner"}),
+
+		AbortedScans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scanexporter_aborted_scans_total",
+			Help: "Number of scans aborted because too many dials failed.",
+		}, []string{"name", "ip", "owner"}),
+
+		MissedTicks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scanexporter_scheduler_missed_ticks_total",
+			Help: "Number of scheduled scans dropped because the scan queue was full.",
+		}, []string{"name", "ip", "owner"}),
+
+		PortChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scanexporter_port_changes_total",
+			Help: "Number of ports that changed state between consecutive scans.",
+		}, []string{"name", "ip", "proto", "owner"}),
+
+		DroppedEvents: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "scanexporter_output_dropped_events_total",
+			Help: "Number of events that could not be sent to an output.",
+		}, []string{"sink", "reason"}),
+
+		PortDowntime: NewDowntime("scanexporter_expected_port_down_seconds",
+			"Time since an expected port has been detected closed.",
+			[]string{"name", "ip", "port", "owner"}),
+
+		TargetDowntime: NewDowntime("scanexporter_target_down_seconds",
+			"Time since a target has been detected not responding to pings.",
+			[]string{"name", "ip", "owner"}),
+
+		// Scans last from milliseconds to hours
+		JobDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scanexporter_job_duration_seconds",
+			Help:    "Time spent by scan jobs waiting in the queue and probing the ports.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 12),
+		}, []string{"phase"}),
+
+		ScanDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "scanexporter_scan_duration_seconds",
+			Help:    "Time spent probing the ports of each target.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 12),
+		}, []string{"name", "ip", "proto", "owner"}),
+
+		BatchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "scanexporter_job_batch_duration_seconds",
+			Help:    "Time spent probing each batch of ports of the scan jobs.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 12),
+		}),
+
+		SchedulerLag: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "scanexporter_scheduler_lag_seconds",
+			Help:    "Delay between the scheduled time of the scans and their start.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 12),
+		}),
 	}
 
 	prometheus.MustRegister(
@@ -91,11 +575,49 @@ func Init(addr string) *Server {
 		s.PendingScans,
 		s.Uptime,
 		s.NumOfDownTargets,
+		s.EgressBlackhole,
+		s.FDInUse,
+		s.FDLimit,
+		s.FDThrottled,
 		s.UnexpectedPorts,
 		s.OpenPorts,
 		s.ClosedPorts,
 		s.DiffPorts,
 		s.Rtt,
+		s.MisbehavingPorts,
+		s.HTTPAssertionFailed,
+		s.HTTPStatusCode,
+		s.HTTPResponseSize,
+		s.HTTPLatency,
+		s.TLSCertExpiry,
+		s.TLSCertInfo,
+		s.PortAnnotations,
+		s.Compliant,
+		s.ChangeRateExceeded,
+		s.FamilyMismatches,
+		s.TargetPaused,
+		s.UnreachableViaDependency,
+		s.TargetMAC,
+		s.PortService,
+		s.TargetGeo,
+		s.TargetInfo,
+		s.TargetTimeout,
+		s.NeighborReachable,
+		s.HealthScore,
+		s.Availability,
+		s.PortFlapping,
+		s.TargetFlapping,
+		s.PortState,
+		s.AbortedScans,
+		s.PortChanges,
+		s.DroppedEvents,
+		s.JobDuration,
+		s.ScanDuration,
+		s.BatchDuration,
+		s.SchedulerLag,
+		s.MissedTicks,
+		s.PortDowntime,
+		s.TargetDowntime,
 	)
 
 	s.Addr = addr
@@ -103,30 +625,64 @@ func Init(addr string) *Server {
 	// Initialize the map
 	s.NotRespondingList = make(map[string]bool)
 
+	s.deletions = make(chan deletion, 64)
+	s.srv = &http.Server{
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+	s.healths = make(map[string]*health)
+	s.availabilities = make(map[string]map[string]*availability)
+
 	// Start uptime counter
 	go s.uptimeCounter()
 
 	return &s
 }
 
-// Start starts the prometheus server
+// Start starts the prometheus server. Once the server is shut down, it
+// returns http.ErrServerClosed.
 func (s *Server) Start() error {
-	srv := &http.Server{
-		Addr:         s.Addr,
-		Handler:      handlers.HandleFunc(),
-		ReadTimeout:  5 * time.Second,
-		WriteTimeout: 10 * time.Second,
+	s.srv.Addr = s.Addr
+	s.srv.Handler = s.handler()
+	if s.web.cert != nil {
+		s.srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{*s.web.cert}, MinVersion: tls.VersionTLS12}
+		return s.srv.ListenAndServeTLS("", "")
 	}
-	return srv.ListenAndServe()
+	return s.srv.ListenAndServe()
+}
+
+// Shutdown stops the prometheus server, waiting for the active requests to be
+// served until ctx is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+// DeleteTarget removes all the metrics of a target. The deletion is realised
+// asynchronously by the updater.
+func (s *Server) DeleteTarget(name, ip string) {
+	s.deletions <- deletion{name: name, ip: ip}
 }
 
-// Updater updates metrics
+// Updater updates metrics. It returns once metChan is closed, all the metrics
+// sent before having been applied.
 func (s *Server) Updater(metChan chan NewMetrics, pingChan chan PingInfo, pending chan int) {
 	var unexpectedPorts, closedPorts []string
 	for {
 		select {
-		case nm := <-metChan:
+		case nm, ok := <-metChan:
+			if !ok {
+				return
+			}
 			// New metrics set has been receievd
+			if removed(nm.Stop) {
+				continue
+			}
+			var findings []notify.Finding
+
+			if nm.Job != nil {
+				s.observeJob(nm.Job)
+				s.observeScan(nm)
+			}
 
 			labels := make(map[string]string)
 			labels["name"] = nm.Name
@@ -134,60 +690,256 @@ func (s *Server) Updater(metChan chan NewMetrics, pingChan chan PingInfo, pendin
 			labels["owner"] = nm.Labels["owner"]
 
 			s.DiffPorts.With(labels).Set(float64(nm.Diff))
-			log.Info().Str("name", nm.Name).Str("ip", nm.IP).Msgf("%s (%s) open ports: %s", nm.Name, nm.IP, nm.Open)
+			s.countPortChanges(nm)
+
+			// Flag massive changes, which usually come from a firewall rule or a
+			// compromised host rather than from a single service change
+			if nm.ChangeThreshold > 0 {
+				exceeded := 0.
+				if !nm.Baseline && nm.Diff > nm.ChangeThreshold {
+					exceeded = 1
+					msg := fmt.Sprintf("%s (%s) %d ports changed state since previous scan (threshold: %d)", nm.Name, nm.IP, nm.Diff, nm.ChangeThreshold)
+					log.Warn().Str("name", nm.Name).Str("ip", nm.IP).Msg(msg)
+					findings = append(findings, notify.Finding{
+						Kind:     notify.KindChangeRate,
+						Name:     nm.Name,
+						IP:       nm.IP,
+						Proto:    notify.ProtoTCP,
+						Severity: notify.SeverityCritical,
+						Message:  attributed(msg, nm.Labels),
+						Labels:   nm.Labels,
+						Time:     time.Now(),
+						Owner:    nm.Owner,
+					})
+				}
+				s.ChangeRateExceeded.With(labels).Set(exceeded)
+			}
+			// The whole lists of ports are available through the API, so
+			// they can be truncated in the logs
+			log.Info().Str("name", nm.Name).Str("ip", nm.IP).Int("count", len(nm.Open)).Msgf("%s (%s) open ports: %s", nm.Name, nm.IP, common.Summarize(nm.Open, s.LogMaxPorts))
 
 			s.OpenPorts.With(labels).Set(float64(len(nm.Open)))
 
+			open, expected := common.PortSetOf(nm.Open), nm.expectedPorts()
+			s.setPortStates(nm, open, expected)
+
 			// If the port is open but not expected
 
 			// Delete all previous metrics for this target
 			s.UnexpectedPorts.DeletePartialMatch(labels)
 
 			// Add only current unexpected open ports
-			for _, port := range nm.Open {
-				if !common.StringInSlice(port, nm.Expected) {
-					labels["port"] = port
-					s.UnexpectedPorts.With(labels).Set(float64(1))
-
-					unexpectedPorts = append(unexpectedPorts, port)
-				}
+			for p := range open.Minus(expected).All() {
+				port := strconv.Itoa(p)
+				labels["port"] = port
+				labels["severity"] = nm.severity(port)
+				s.UnexpectedPorts.With(labels).Set(float64(1))
+
+				unexpectedPorts = append(unexpectedPorts, port)
+				findings = append(findings, nm.finding(notify.KindUnexpectedOpen, port,
+					fmt.Sprintf("%s (%s) unexpected open port %s", nm.Name, nm.IP, services.Describe(notify.ProtoTCP, port))))
 			}
 			if len(unexpectedPorts) > 0 {
-				log.Warn().Str("name", nm.Name).Str("ip", nm.IP).Msgf("%s (%s) unexpected open ports: %s", nm.Name, nm.IP, unexpectedPorts)
+				log.Warn().Str("name", nm.Name).Str("ip", nm.IP).Int("count", len(unexpectedPorts)).Msgf("%s (%s) unexpected open ports: %s", nm.Name, nm.IP, common.Summarize(unexpectedPorts, s.LogMaxPorts))
 			} else {
-				log.Info().Str("name", nm.Name).Str("ip", nm.IP).Msgf("%s (%s) unexpected open ports: %s", nm.Name, nm.IP, unexpectedPorts)
+				log.Info().Str("name", nm.Name).Str("ip", nm.IP).Int("count", 0).Msgf("%s (%s) unexpected open ports: %s", nm.Name, nm.IP, unexpectedPorts)
 			}
 
-			unexpectedPorts = nil
 			delete(labels, "port")
+			delete(labels, "severity")
 
 			// If the port is expected but not open
-			for _, port := range nm.Expected {
-				if !common.StringInSlice(port, nm.Open) {
-					closedPorts = append(closedPorts, port)
-				}
+			for p := range expected.Minus(open).All() {
+				port := strconv.Itoa(p)
+				closedPorts = append(closedPorts, port)
+				findings = append(findings, nm.finding(notify.KindUnexpectedClosed, port,
+					fmt.Sprintf("%s (%s) unexpected closed port %s", nm.Name, nm.IP, services.Describe(notify.ProtoTCP, port))))
 			}
 			s.ClosedPorts.With(labels).Set(float64(len(closedPorts)))
 			if len(closedPorts) > 0 {
-				log.Warn().Str("name", nm.Name).Str("ip", nm.IP).Msgf("%s (%s) unexpected closed ports: %s", nm.Name, nm.IP, closedPorts)
+				log.Warn().Str("name", nm.Name).Str("ip", nm.IP).Int("count", len(closedPorts)).Msgf("%s (%s) unexpected closed ports: %s", nm.Name, nm.IP, common.Summarize(closedPorts, s.LogMaxPorts))
 			} else {
-				log.Info().Str("name", nm.Name).Str("ip", nm.IP).Msgf("%s (%s) unexpected closed ports: %s", nm.Name, nm.IP, closedPorts)
+				log.Info().Str("name", nm.Name).Str("ip", nm.IP).Int("count", 0).Msgf("%s (%s) unexpected closed ports: %s", nm.Name, nm.IP, closedPorts)
+			}
+
+			// The target is compliant if no port is unexpectedly open or closed
+			compliant := 0.
+			if len(unexpectedPorts) == 0 && len(closedPorts) == 0 {
+				compliant = 1
+			}
+			s.Compliant.WithLabelValues(nm.Name, nm.IP).Set(compliant)
+			s.Notifier.ReportDeviation(notify.Deviation{
+				Target:     nm.Name,
+				IP:         nm.IP,
+				Proto:      notify.ProtoTCP,
+				Unexpected: unexpectedPorts,
+				Closed:     closedPorts,
+				Time:       time.Now(),
+			})
+
+			h := s.health(nm.IP)
+			h.scanned = true
+			h.expected = len(nm.Expected)
+			h.expectedOpen = len(nm.Expected) - len(closedPorts)
+			h.unexpectedOpen = len(unexpectedPorts)
+			s.setHealthScore(nm.Name, nm.IP, nm.Labels["owner"])
+
+			s.updateAvailability(nm)
+
+			var down [][]string
+			for _, port := range closedPorts {
+				down = append(down, []string{nm.Name, nm.IP, port, nm.Labels["owner"]})
 			}
+			s.PortDowntime.Track(nm.Name, nm.IP, down)
 
+			unexpectedPorts = nil
 			closedPorts = nil
+
+			// Replace previous misbehaving ports for this target
+			s.MisbehavingPorts.DeletePartialMatch(labels)
+			for port, reason := range nm.Misbehaving {
+				labels["port"] = port
+				labels["severity"] = nm.severity(port)
+				s.MisbehavingPorts.With(labels).Set(1)
+				log.Warn().Str("name", nm.Name).Str("ip", nm.IP).Str("port", port).Msgf("%s (%s) misbehaving port %s: %s", nm.Name, nm.IP, services.Describe(notify.ProtoTCP, port), reason)
+				findings = append(findings, nm.finding(notify.KindMisbehaving, port,
+					fmt.Sprintf("%s (%s) misbehaving port %s: %s", nm.Name, nm.IP, services.Describe(notify.ProtoTCP, port), reason)))
+			}
+			delete(labels, "port")
+			delete(labels, "severity")
+
+			// Replace previous HTTP assertions results for this target
+			s.HTTPAssertionFailed.DeletePartialMatch(labels)
+			for port, reason := range nm.HTTPMismatches {
+				labels["port"] = port
+				if reason != "" {
+					s.HTTPAssertionFailed.With(labels).Set(1)
+					log.Warn().Str("name", nm.Name).Str("ip", nm.IP).Str("port", port).Msgf("%s (%s) HTTP assertions failed on port %s: %s", nm.Name, nm.IP, services.Describe(notify.ProtoTCP, port), reason)
+					findings = append(findings, nm.finding(notify.KindHTTPAssertion, port,
+						fmt.Sprintf("%s (%s) HTTP assertions failed on port %s: %s", nm.Name, nm.IP, services.Describe(notify.ProtoTCP, port), reason)))
+				} else {
+					s.HTTPAssertionFailed.With(labels).Set(0)
+				}
+			}
+			delete(labels, "port")
+
+			// Replace previous HTTP responses for this target
+			for _, vec := range []*prometheus.GaugeVec{s.HTTPStatusCode, s.HTTPResponseSize, s.HTTPLatency} {
+				vec.DeletePartialMatch(labels)
+			}
+			for port, resp := range nm.HTTPResponses {
+				labels["port"] = port
+				s.HTTPStatusCode.With(labels).Set(float64(resp.Status))
+				s.HTTPResponseSize.With(labels).Set(float64(resp.Size))
+				s.HTTPLatency.With(labels).Set(resp.Latency.Seconds())
+			}
+			delete(labels, "port")
+
+			// Replace previous certificates for this target
+			s.TLSCertExpiry.DeletePartialMatch(labels)
+			s.TLSCertInfo.DeletePartialMatch(labels)
+			for port, cert := range nm.Certificates {
+				labels["port"] = port
+				s.TLSCertExpiry.With(labels).Set(float64(cert.NotAfter.Unix()))
+				labels["subject"] = cert.Subject
+				labels["issuer"] = cert.Issuer
+				s.TLSCertInfo.With(labels).Set(1)
+				delete(labels, "subject")
+				delete(labels, "issuer")
+			}
+			delete(labels, "port")
+
+			// Replace previous address family mismatches for this target
+			s.FamilyMismatches.DeletePartialMatch(labels)
+			for port, family := range nm.FamilyMismatches {
+				labels["port"] = port
+				labels["open_on"] = family
+				s.FamilyMismatches.With(labels).Set(1)
+				log.Warn().Str("name", nm.Name).Str("ip", nm.IP).Str("port", port).Msgf("%s (%s) port %s is only open on %s", nm.Name, nm.IP, services.Describe(notify.ProtoTCP, port), family)
+				findings = append(findings, nm.finding(notify.KindFamilyMismatch, port,
+					fmt.Sprintf("%s (%s) port %s is only open on %s", nm.Name, nm.IP, services.Describe(notify.ProtoTCP, port), family)))
+			}
+			delete(labels, "port")
+			delete(labels, "open_on")
+
+			// Replace previous flapping ports for this target, whose
+			// findings are flagged
+			s.PortFlapping.DeletePartialMatch(labels)
+			for _, port := range nm.Flapping {
+				labels["port"] = port
+				s.PortFlapping.With(labels).Set(1)
+			}
+			delete(labels, "port")
+			for i, f := range findings {
+				findings[i].Flapping = slices.Contains(nm.Flapping, f.Port)
+			}
+
+			// Send new and resolved findings to the notification routes
+			s.Notifier.Report(nm.IP, findings, nm.Flapping...)
+
+			if s.Results != nil {
+				s.Results.AddSummary(results.Summary{
+					ID:       nm.ScanID,
+					Name:     nm.Name,
+					IP:       nm.IP,
+					Start:    nm.Start,
+					End:      nm.End,
+					Duration: nm.End.Sub(nm.Start).Seconds(),
+					Open:     len(nm.Open),
+					Closed:   len(nm.Closed),
+					Expected: len(nm.Expected),
+					Findings: findings,
+				})
+			}
 		case pm := <-pingChan:
+			if removed(pm.Stop) {
+				continue
+			}
 			log.Debug().Str("name", pm.Name).Str("ip", pm.IP).Msg("received new ping result")
 
-			// New ping metric has been received
+			// New ping metric has been received. Targets not responding
+			// are logged, and notified if configured, with their severity
+			var hostDown *notify.Finding
 			if pm.IsResponding {
 				log.Debug().Str("name", pm.Name).Str("ip", pm.IP).Str("rtt", pm.RTT.String()).Msgf("%s (%s) responds to ICMP requests", pm.Name, pm.IP)
 			} else {
-				log.Warn().Str("name", pm.Name).Str("ip", pm.IP).Str("rtt", "nil").Msgf("%s (%s) does not respond to ICMP requests", pm.Name, pm.IP)
+				f := pm.hostDownFinding()
+				log.WithLevel(downLevel(f.Severity)).Str("name", pm.Name).Str("ip", pm.IP).Str("rtt", "nil").Str("severity", f.Severity).Msg(f.Message)
+				if pm.NotifyDown {
+					hostDown = f
+				}
 			}
+			s.Notifier.ReportHost(pm.IP, hostDown)
 
 			// Update target's RTT metric
 			s.Rtt.WithLabelValues(pm.Name, pm.IP, pm.Labels["owner"]).Set(float64(pm.RTT))
 
+			flapping := 0.
+			if pm.Flapping {
+				flapping = 1
+			}
+			s.TargetFlapping.WithLabelValues(pm.Name, pm.IP, pm.Labels["owner"]).Set(flapping)
+
+			if pm.NeighborChecked {
+				reachable := 0.
+				if pm.NeighborReachable {
+					reachable = 1
+				}
+				s.NeighborReachable.WithLabelValues(pm.Name, pm.IP, pm.Labels["owner"]).Set(reachable)
+			}
+
+			h := s.health(pm.IP)
+			h.pinged = true
+			h.responding = pm.IsResponding
+			h.rtt = pm.RTT
+			s.setHealthScore(pm.Name, pm.IP, pm.Labels["owner"])
+
+			var down [][]string
+			if !pm.IsResponding {
+				down = append(down, []string{pm.Name, pm.IP, pm.Labels["owner"]})
+			}
+			s.TargetDowntime.Track(pm.Name, pm.IP, down)
+
 			// Check if the IP is already in the map.
 			_, ok := s.NotRespondingList[pm.IP]
 			if !ok {
@@ -210,6 +962,38 @@ func (s *Server) Updater(metChan chan NewMetrics, pingChan chan PingInfo, pendin
 				s.NotRespondingList[pm.IP] = true
 			}
 			// Else, everything is good, do nothing or everything is as bad as it was, so do nothing too.
+		case d := <-s.deletions:
+			labels := prometheus.Labels{"name": d.name, "ip": d.ip}
+			for _, vec := range []*prometheus.GaugeVec{
+				s.UnexpectedPorts, s.OpenPorts, s.ClosedPorts, s.DiffPorts, s.Rtt,
+				s.HTTPAssertionFailed, s.MisbehavingPorts, s.PortAnnotations,
+				s.HTTPStatusCode, s.HTTPResponseSize, s.HTTPLatency,
+				s.TLSCertExpiry, s.TLSCertInfo, s.Compliant, s.ChangeRateExceeded, s.FamilyMismatches,
+				s.TargetPaused, s.UnreachableViaDependency, s.TargetMAC, s.PortService, s.TargetGeo, s.TargetInfo,
+				s.TargetTimeout, s.NeighborReachable, s.HealthScore, s.Availability,
+				s.PortFlapping, s.TargetFlapping, s.PortState,
+			} {
+				vec.DeletePartialMatch(labels)
+			}
+			s.AbortedScans.DeletePartialMatch(labels)
+			s.MissedTicks.DeletePartialMatch(labels)
+			s.PortChanges.DeletePartialMatch(labels)
+			s.ScanDuration.DeletePartialMatch(labels)
+			s.PortDowntime.Delete(d.name, d.ip)
+			s.TargetDowntime.Delete(d.name, d.ip)
+
+			if s.NotRespondingList[d.ip] {
+				s.NumOfDownTargets.Dec()
+			}
+			delete(s.NotRespondingList, d.ip)
+			delete(s.healths, d.ip)
+			delete(s.availabilities, d.ip)
+
+			// The findings of a removed target are resolved
+			s.Notifier.Report(d.ip, nil)
+			s.Notifier.ReportHost(d.ip, nil)
+			s.Notifier.ReportDeviation(notify.Deviation{Target: d.name, IP: d.ip, Proto: notify.ProtoTCP, Time: time.Now()})
+			log.Debug().Str("name", d.name).Str("ip", d.ip).Msg("metrics deleted")
 		case pending := <-pending:
 			// New pending metric has been received
 
@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+)
+
+func TestServer_countPortChanges(t *testing.T) {
+	s := &Server{
+		PortChanges: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "changes"}, []string{"name", "ip", "proto", "owner"}),
+	}
+	labels := map[string]string{"owner": "team"}
+	scans := []NewMetrics{
+		{Name: "app", IP: "10.0.0.1", Diff: 3, Baseline: true, Labels: labels},
+		{Name: "app", IP: "10.0.0.1", Diff: 2, Labels: labels},
+		{Name: "app", IP: "10.0.0.1", Diff: 0, Labels: labels},
+		{Name: "app", IP: "10.0.0.1", Diff: 5, Labels: labels},
+	}
+	for _, nm := range scans {
+		s.countPortChanges(nm)
+	}
+
+	if got := testutil.ToFloat64(s.PortChanges.WithLabelValues("app", "10.0.0.1", notify.ProtoTCP, "team")); got != 7 {
+		t.Errorf("countPortChanges() counted %v changes, want 7", got)
+	}
+}
+
+func TestServer_observeScan(t *testing.T) {
+	s := &Server{
+		ScanDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "duration", Buckets: []float64{1, 10}}, []string{"name", "ip", "proto", "owner"}),
+	}
+	start := time.Now()
+	for _, d := range []time.Duration{500 * time.Millisecond, 5 * time.Second} {
+		s.observeScan(NewMetrics{Name: "app", IP: "10.0.0.1", Start: start, End: start.Add(d), Labels: map[string]string{"owner": "team"}})
+	}
+
+	m := &dto.Metric{}
+	if err := s.ScanDuration.WithLabelValues("app", "10.0.0.1", notify.ProtoTCP, "team").(prometheus.Histogram).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	h := m.GetHistogram()
+	if h.GetSampleCount() != 2 || h.GetSampleSum() != 5.5 || h.GetBucket()[0].GetCumulativeCount() != 1 {
+		t.Errorf("scan durations = %d samples summing to %vs, %d under 1s, want 2 samples summing to 5.5s, 1 under 1s", h.GetSampleCount(), h.GetSampleSum(), h.GetBucket()[0].GetCumulativeCount())
+	}
+}
+
+func TestServer_setPortStates(t *testing.T) {
+	s := &Server{
+		PortState: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "state"}, []string{"name", "ip", "proto", "port", "owner"}),
+	}
+	scans := []struct {
+		open, expected []string
+		want           map[string]float64
+	}{
+		{open: []string{"22", "5432"}, expected: []string{"22", "443"}, want: map[string]float64{"22": 1, "443": 0, "5432": 1}},
+		// Ports which closed and are not expected disappear
+		{open: []string{"443"}, expected: []string{"22", "443"}, want: map[string]float64{"22": 0, "443": 1}},
+	}
+	for i, scan := range scans {
+		nm := NewMetrics{Name: "db", IP: "10.0.0.1", Open: scan.open, Expected: scan.expected, Labels: map[string]string{"owner": "team"}}
+		s.setPortStates(nm, common.PortSetOf(nm.Open), nm.expectedPorts())
+
+		if n := testutil.CollectAndCount(s.PortState); n != len(scan.want) {
+			t.Errorf("scan %d: %d port state series, want %d", i, n, len(scan.want))
+		}
+		for port, want := range scan.want {
+			if got := testutil.ToFloat64(s.PortState.WithLabelValues("db", "10.0.0.1", notify.ProtoTCP, port, "team")); got != want {
+				t.Errorf("scan %d: state of port %s = %v, want %v", i, port, got, want)
+			}
+		}
+	}
+}
+
+func TestPingInfo_hostDownFinding(t *testing.T) {
+	tests := []struct {
+		name         string
+		severity     string
+		wantSeverity string
+		wantLevel    zerolog.Level
+	}{
+		{name: "default", wantSeverity: notify.SeverityWarning, wantLevel: zerolog.WarnLevel},
+		{name: "lab target", severity: notify.SeverityInfo, wantSeverity: notify.SeverityInfo, wantLevel: zerolog.InfoLevel},
+		{name: "critical target", severity: notify.SeverityCritical, wantSeverity: notify.SeverityCritical, wantLevel: zerolog.ErrorLevel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pm := PingInfo{Name: "lab", IP: "10.0.0.1", DownSeverity: tt.severity}
+			f := pm.hostDownFinding()
+			if f.Kind != notify.KindHostDown || f.Proto != notify.ProtoICMP || f.Severity != tt.wantSeverity {
+				t.Errorf("hostDownFinding() = %+v, want a host down finding of severity %s", f, tt.wantSeverity)
+			}
+			if got := downLevel(f.Severity); got != tt.wantLevel {
+				t.Errorf("downLevel(%s) = %s, want %s", f.Severity, got, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestNewMetrics_finding_owner(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels map[string]string
+		want   string
+	}{
+		{name: "no owner", want: "app (10.0.0.1) unexpected open port 22 (bastion)"},
+		{name: "owner", labels: map[string]string{"owner": "team-infra", "description": "bastion host"}, want: "app (10.0.0.1) unexpected open port 22 (bastion) [owner: team-infra]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nm := NewMetrics{Name: "app", IP: "10.0.0.1", Labels: tt.labels, Annotations: map[string]string{"22": "bastion"}}
+			f := nm.finding(notify.KindUnexpectedOpen, "22", "app (10.0.0.1) unexpected open port 22")
+			if f.Message != tt.want {
+				t.Errorf("finding() message = %q, want %q", f.Message, tt.want)
+			}
+			if f.Labels["description"] != tt.labels["description"] {
+				t.Errorf("finding() description label = %q, want %q", f.Labels["description"], tt.labels["description"])
+			}
+		})
+	}
+}
+
+func TestServer_observeJob_schedulerLag(t *testing.T) {
+	s := &Server{
+		JobDuration:   prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "jobs"}, []string{"phase"}),
+		BatchDuration: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "batches"}),
+		SchedulerLag:  prometheus.NewHistogram(prometheus.HistogramOpts{Name: "lag"}),
+	}
+	now := time.Now()
+	s.observeJob(&JobTiming{Scheduled: now, Queued: now, Started: now.Add(3 * time.Second), Finished: now.Add(time.Minute)})
+	// Retries are not scheduled
+	s.observeJob(&JobTiming{Queued: now, Started: now.Add(time.Second), Finished: now.Add(time.Minute)})
+
+	m := &dto.Metric{}
+	if err := s.SchedulerLag.(prometheus.Metric).Write(m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetHistogram().GetSampleCount(); got != 1 {
+		t.Errorf("observeJob() observed %d lags, want 1", got)
+	}
+	if got := m.GetHistogram().GetSampleSum(); got != 3 {
+		t.Errorf("observeJob() observed a lag of %vs, want 3s", got)
+	}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	promBridge "go.opentelemetry.io/contrib/bridges/prometheus"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// otlpServiceName is the name under which metrics are pushed.
+const otlpServiceName = "scan-exporter"
+
+// defaultOTLPInterval is the interval between two pushes of the metrics when
+// none is configured.
+const defaultOTLPInterval = time.Minute
+
+// InitOTLP pushes the metrics gathered by gatherer to an OTLP/gRPC collector at
+// the configured interval, so that they reach it without being scraped. If conf
+// is nil, nothing is pushed. The returned function pushes the metrics a last
+// time and must be called before exiting.
+func InitOTLP(conf *config.OTLPMetrics, gatherer prometheus.Gatherer) (func(context.Context) error, error) {
+	if conf == nil {
+		return func(context.Context) error { return nil }, nil
+	}
+	if conf.Endpoint == "" {
+		return nil, fmt.Errorf("no endpoint provided for the OTLP metrics")
+	}
+
+	interval := defaultOTLPInterval
+	if conf.Interval != "" {
+		var err error
+		if interval, err = time.ParseDuration(conf.Interval); err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid OTLP metrics interval %q", conf.Interval)
+		}
+	}
+
+	opts := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(conf.Endpoint)}
+	if conf.Insecure {
+		opts = append(opts, otlpmetricgrpc.WithInsecure())
+	}
+	if len(conf.Headers) > 0 {
+		opts = append(opts, otlpmetricgrpc.WithHeaders(conf.Headers))
+	}
+	exporter, err := otlpmetricgrpc.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create OTLP metrics exporter: %w", err)
+	}
+
+	// The metrics are those of the Prometheus registry, converted when they
+	// are pushed, so that both backends always report the same values
+	reader := sdkmetric.NewPeriodicReader(exporter,
+		sdkmetric.WithInterval(interval),
+		sdkmetric.WithProducer(promBridge.NewMetricProducer(promBridge.WithGatherer(gatherer))),
+	)
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(resource.NewSchemaless(semconv.ServiceName(otlpServiceName))),
+	)
+
+	return mp.Shutdown, nil
+}
@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/prometheus/client_golang/prometheus"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/grpc"
+)
+
+// fakeCollector records the values of the gauges pushed to it, by name.
+type fakeCollector struct {
+	collectorpb.UnimplementedMetricsServiceServer
+	mu     sync.Mutex
+	gauges map[string]float64
+}
+
+func (c *fakeCollector) Export(_ context.Context, req *collectorpb.ExportMetricsServiceRequest) (*collectorpb.ExportMetricsServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				if g := m.GetGauge(); g != nil && len(g.DataPoints) > 0 {
+					c.gauges[m.Name] = g.DataPoints[0].GetAsDouble()
+				}
+			}
+		}
+	}
+	return &collectorpb.ExportMetricsServiceResponse{}, nil
+}
+
+func TestInitOTLP(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.OTLPMetrics
+		wantErr bool
+	}{
+		{name: "disabled"},
+		{name: "no endpoint", conf: &config.OTLPMetrics{}, wantErr: true},
+		{name: "invalid interval", conf: &config.OTLPMetrics{Endpoint: "localhost:4317", Interval: "1"}, wantErr: true},
+		{name: "negative interval", conf: &config.OTLPMetrics{Endpoint: "localhost:4317", Interval: "-1m"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := InitOTLP(tt.conf, prometheus.NewRegistry())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InitOTLP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				if err := shutdown(context.Background()); err != nil {
+					t.Errorf("shutdown() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestInitOTLP_push(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := &fakeCollector{gauges: make(map[string]float64)}
+	srv := grpc.NewServer()
+	collectorpb.RegisterMetricsServiceServer(srv, collector)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	reg := prometheus.NewRegistry()
+	targets := prometheus.NewGauge(prometheus.GaugeOpts{Name: "scanexporter_targets_number_total"})
+	reg.MustRegister(targets)
+	targets.Set(3)
+
+	// The metrics are pushed a last time on shutdown, long before the
+	// interval
+	shutdown, err := InitOTLP(&config.OTLPMetrics{Endpoint: ln.Addr().String(), Insecure: true, Interval: "1h"}, reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown() error = %v", err)
+	}
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if got, ok := collector.gauges["scanexporter_targets_number_total"]; !ok || got != 3 {
+		t.Errorf("collector received %v (found %v), want 3", got, ok)
+	}
+}
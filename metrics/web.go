@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/handlers"
+)
+
+// web holds the protection of the server.
+type web struct {
+	// cert is the certificate served over TLS. The server is served over
+	// plain HTTP when it is nil
+	cert *tls.Certificate
+	// auth holds the credentials required by the server, if any
+	auth *config.BasicAuth
+}
+
+// SetWeb protects the server with TLS and basic authentication, as set in c,
+// which can be nil. The certificate is read once, when it is set.
+func (s *Server) SetWeb(c *config.Web) error {
+	s.web = web{}
+	if c == nil {
+		return nil
+	}
+
+	if c.TLS != nil {
+		if c.TLS.CertFile == "" || c.TLS.KeyFile == "" {
+			return errors.New("both the certificate and the key files are required for TLS")
+		}
+		cert, err := tls.LoadX509KeyPair(c.TLS.CertFile, c.TLS.KeyFile)
+		if err != nil {
+			return fmt.Errorf("cannot read TLS certificate: %w", err)
+		}
+		s.web.cert = &cert
+	}
+	if c.BasicAuth != nil {
+		if c.BasicAuth.Username == "" || c.BasicAuth.Password == "" {
+			return errors.New("both the username and the password are required for basic authentication")
+		}
+		s.web.auth = c.BasicAuth
+	}
+	return nil
+}
+
+// handler returns the handler of the server, requiring the credentials of the
+// basic authentication if any.
+func (s *Server) handler() http.Handler {
+	var h http.Handler = handlers.HandleFunc(s.Results, s.Notifier.Silences(), s.Targets, s.Lifecycle, s.Prober, s.History, s.Version)
+	if s.web.auth != nil {
+		h = handlers.BasicAuth(h, s.web.auth.Username, s.web.auth.Password)
+	}
+	return h
+}
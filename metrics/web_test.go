@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+// writeCertificate writes a self-signed certificate and its key in dir, and
+// returns their paths.
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "scan-exporter"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestServer_SetWeb(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, t.TempDir())
+
+	tests := []struct {
+		name     string
+		web      *config.Web
+		wantTLS  bool
+		wantAuth bool
+		wantErr  bool
+	}{
+		{name: "none"},
+		{name: "TLS", web: &config.Web{TLS: &config.WebTLS{CertFile: certFile, KeyFile: keyFile}}, wantTLS: true},
+		{name: "basic auth", web: &config.Web{BasicAuth: &config.BasicAuth{Username: "prometheus", Password: "s3cret"}}, wantAuth: true},
+		{name: "missing key", web: &config.Web{TLS: &config.WebTLS{CertFile: certFile}}, wantErr: true},
+		{name: "key as certificate", web: &config.Web{TLS: &config.WebTLS{CertFile: keyFile, KeyFile: keyFile}}, wantErr: true},
+		{name: "missing password", web: &config.Web{BasicAuth: &config.BasicAuth{Username: "prometheus"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{}
+			err := s.SetWeb(tt.web)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetWeb() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := s.web.cert != nil; got != tt.wantTLS {
+				t.Errorf("SetWeb() TLS = %v, want %v", got, tt.wantTLS)
+			}
+			if got := s.web.auth != nil; got != tt.wantAuth {
+				t.Errorf("SetWeb() basic auth = %v, want %v", got, tt.wantAuth)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package netbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+// defaultRange is the range of ports scanned on generated targets when none is
+// configured. Expected ports are always added to it.
+const defaultRange = "reserved"
+
+// Client fetches services from the NetBox API.
+type Client struct {
+	conf   *config.NetBox
+	client *http.Client
+}
+
+// object is the nested representation of a device or a virtual machine.
+type object struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type ipAddress struct {
+	Address string `json:"address"`
+}
+
+type service struct {
+	Device         *object `json:"device"`
+	VirtualMachine *object `json:"virtual_machine"`
+	Protocol       struct {
+		Value string `json:"value"`
+	} `json:"protocol"`
+	Ports       []int       `json:"ports"`
+	IPAddresses []ipAddress `json:"ipaddresses"`
+}
+
+type host struct {
+	ID        int        `json:"id"`
+	Name      string     `json:"name"`
+	PrimaryIP *ipAddress `json:"primary_ip"`
+}
+
+// page is a page of results returned by the API.
+type page struct {
+	Next    string          `json:"next"`
+	Results json.RawMessage `json:"results"`
+}
+
+// New creates a NetBox client.
+func New(conf *config.NetBox) (*Client, error) {
+	if conf.URL == "" {
+		return nil, fmt.Errorf("no URL provided for NetBox")
+	}
+	return &Client{
+		conf:   conf,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Targets generates one target per IP address owning TCP services in NetBox.
+// The ports of the services are the expected ports of the target.
+func (c *Client) Targets() ([]config.Target, error) {
+	var services []service
+	if err := c.list("/api/ipam/services/", c.conf.Filters, &services); err != nil {
+		return nil, err
+	}
+
+	var devices, vms []host
+	if err := c.list("/api/dcim/devices/", "has_primary_ip=true", &devices); err != nil {
+		return nil, err
+	}
+	if err := c.list("/api/virtualization/virtual-machines/", "has_primary_ip=true", &vms); err != nil {
+		return nil, err
+	}
+
+	primaryIPs := make(map[string]string)
+	for _, d := range devices {
+		if d.PrimaryIP != nil {
+			primaryIPs["device/"+strconv.Itoa(d.ID)] = d.PrimaryIP.Address
+		}
+	}
+	for _, vm := range vms {
+		if vm.PrimaryIP != nil {
+			primaryIPs["vm/"+strconv.Itoa(vm.ID)] = vm.PrimaryIP.Address
+		}
+	}
+
+	names := make(map[string]string)
+	expected := make(map[string]map[int]bool)
+	for _, svc := range services {
+		if svc.Protocol.Value != "tcp" {
+			continue
+		}
+
+		var parent *object
+		var key string
+		switch {
+		case svc.Device != nil:
+			parent, key = svc.Device, "device/"+strconv.Itoa(svc.Device.ID)
+		case svc.VirtualMachine != nil:
+			parent, key = svc.VirtualMachine, "vm/"+strconv.Itoa(svc.VirtualMachine.ID)
+		default:
+			continue
+		}
+
+		var addresses []string
+		for _, a := range svc.IPAddresses {
+			addresses = append(addresses, a.Address)
+		}
+		if len(addresses) == 0 && primaryIPs[key] != "" {
+			addresses = append(addresses, primaryIPs[key])
+		}
+
+		for _, a := range addresses {
+			// Addresses are stored with their prefix length
+			ip := strings.Split(a, "/")[0]
+			names[ip] = parent.Name
+			if expected[ip] == nil {
+				expected[ip] = make(map[int]bool)
+			}
+			for _, p := range svc.Ports {
+				expected[ip][p] = true
+			}
+		}
+	}
+
+	scanRange := c.conf.Range
+	if scanRange == "" {
+		scanRange = defaultRange
+	}
+
+	var targets []config.Target
+	for ip, ports := range expected {
+		var sorted []int
+		for p := range ports {
+			sorted = append(sorted, p)
+		}
+		sort.Ints(sorted)
+		var exp []string
+		for _, p := range sorted {
+			exp = append(exp, strconv.Itoa(p))
+		}
+
+		labels := make(map[string]string)
+		for k, v := range c.conf.Labels {
+			labels[k] = v
+		}
+
+		t := config.Target{
+			Name:   names[ip],
+			IP:     ip,
+			Labels: labels,
+		}
+		t.TCP.Period = c.conf.Period
+		t.ICMP.Period = c.conf.ICMPPeriod
+		t.TCP.Expected = strings.Join(exp, ",")
+		// Expected ports must be scanned to be seen open
+		t.TCP.Range = scanRange + "," + t.TCP.Expected
+		targets = append(targets, t)
+	}
+
+	sort.Slice(targets, func(i, j int) bool { return targets[i].IP < targets[j].IP })
+	return targets, nil
+}
+
+// list fetches all the pages of an API endpoint and decodes the results in v,
+// which must be a pointer to a slice.
+func (c *Client) list(path, query string, v any) error {
+	u, err := url.Parse(strings.TrimSuffix(c.conf.URL, "/") + path)
+	if err != nil {
+		return err
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return fmt.Errorf("invalid NetBox filters: %w", err)
+	}
+	q.Set("limit", "1000")
+	u.RawQuery = q.Encode()
+
+	var all []json.RawMessage
+	next := u.String()
+	for next != "" {
+		p, err := c.get(next)
+		if err != nil {
+			return err
+		}
+
+		var results []json.RawMessage
+		if err := json.Unmarshal(p.Results, &results); err != nil {
+			return fmt.Errorf("cannot decode results of %s: %w", path, err)
+		}
+		all = append(all, results...)
+		next = p.Next
+	}
+
+	raw, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// get fetches a single page of results.
+func (c *Client) get(u string) (*page, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.conf.Token != "" {
+		req.Header.Set("Authorization", "Token "+c.conf.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("NetBox returned status %s for %s", resp.Status, u)
+	}
+
+	p := &page{}
+	if err := json.NewDecoder(resp.Body).Decode(p); err != nil {
+		return nil, fmt.Errorf("cannot decode NetBox response: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,62 @@
+package netbox
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+func TestClient_Targets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/ipam/services/":
+			if r.URL.Query().Get("offset") == "" {
+				fmt.Fprintf(w, `{"next": "http://%s/api/ipam/services/?offset=2", "results": [
+					{"device": {"id": 1, "name": "web1"}, "protocol": {"value": "tcp"}, "ports": [443, 80], "ipaddresses": []},
+					{"device": {"id": 1, "name": "web1"}, "protocol": {"value": "udp"}, "ports": [53], "ipaddresses": []}
+				]}`, r.Host)
+				return
+			}
+			fmt.Fprint(w, `{"next": null, "results": [
+				{"virtual_machine": {"id": 7, "name": "db1"}, "protocol": {"value": "tcp"}, "ports": [5432], "ipaddresses": [{"address": "10.0.0.7/24"}]}
+			]}`)
+		case "/api/dcim/devices/":
+			fmt.Fprint(w, `{"next": null, "results": [{"id": 1, "name": "web1", "primary_ip": {"address": "10.0.0.1/24"}}]}`)
+		case "/api/virtualization/virtual-machines/":
+			fmt.Fprint(w, `{"next": null, "results": []}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := New(&config.NetBox{URL: srv.URL, Token: "secret", Range: "1-100", Period: "6h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := c.Targets()
+	if err != nil {
+		t.Fatalf("Targets() error = %v", err)
+	}
+
+	want := []config.Target{
+		{Name: "web1", IP: "10.0.0.1", Labels: map[string]string{}},
+		{Name: "db1", IP: "10.0.0.7", Labels: map[string]string{}},
+	}
+	want[0].TCP.Expected, want[0].TCP.Range = "80,443", "1-100,80,443"
+	want[1].TCP.Expected, want[1].TCP.Range = "5432", "1-100,5432"
+	want[0].TCP.Period, want[1].TCP.Period = "6h", "6h"
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Targets() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,122 @@
+package nmap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devops-works/scan-exporter/results"
+)
+
+// FromResults renders the latest scans of the targets as an nmap run, so tools
+// parsing nmap XML outputs can consume them. version is the version of
+// scan-exporter.
+func FromResults(scans []results.Scan, version string) *Run {
+	run := &Run{
+		Scanner:          "scan-exporter",
+		Version:          version,
+		XMLOutputVersion: "1.05",
+		RunStats:         &RunStats{Finished: Finished{Exit: "success"}},
+	}
+
+	var start, end time.Time
+	for _, scan := range scans {
+		if start.IsZero() || scan.Start.Before(start) {
+			start = scan.Start
+		}
+		if scan.End.After(end) {
+			end = scan.End
+		}
+
+		addrType := "ipv4"
+		if ip := net.ParseIP(scan.IP); ip != nil && ip.To4() == nil {
+			addrType = "ipv6"
+		}
+
+		h := Host{
+			StartTime: scan.Start.Unix(),
+			EndTime:   scan.End.Unix(),
+			// Targets are scanned without host discovery
+			Status:    Status{State: "up", Reason: "user-set"},
+			Addresses: []Address{{Addr: scan.IP, AddrType: addrType}},
+			Hostnames: []Hostname{{Name: scan.Name, Type: "user"}},
+		}
+		if scan.MAC != "" {
+			h.Addresses = append(h.Addresses, Address{Addr: strings.ToUpper(scan.MAC), AddrType: "mac", Vendor: scan.Vendor})
+		}
+		if len(scan.Closed) > 0 {
+			h.ExtraPorts = []ExtraPorts{{State: "closed", Count: len(scan.Closed)}}
+		}
+		for _, p := range scan.Open {
+			id, err := strconv.Atoi(p)
+			if err != nil {
+				continue
+			}
+			port := Port{
+				Protocol: "tcp",
+				PortID:   id,
+				State:    State{State: "open", Reason: "syn-ack"},
+			}
+			// Annotations are the closest thing to a service description
+			if annotation := scan.Annotations[p]; annotation != "" {
+				port.Service = &Service{Name: "unknown", ExtraInfo: annotation, Method: "table", Conf: 3}
+			}
+			h.Ports = append(h.Ports, port)
+		}
+		run.Hosts = append(run.Hosts, h)
+	}
+
+	// Before the first scan, the run is empty and happens now
+	if len(scans) == 0 {
+		start = time.Now()
+		end = start
+	}
+
+	run.Start = start.Unix()
+	run.StartStr = start.Format(time.ANSIC)
+	run.RunStats.Finished.Time = end.Unix()
+	run.RunStats.Finished.TimeStr = end.Format(time.ANSIC)
+	run.RunStats.Finished.Elapsed = fmt.Sprintf("%.2f", end.Sub(start).Seconds())
+	run.RunStats.Hosts = HostStats{Up: len(run.Hosts), Total: len(run.Hosts)}
+
+	return run
+}
+
+// Write renders the run as XML.
+func (r *Run) Write(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteFile renders the run as XML in a file. The file is replaced atomically
+// so readers never see a partial output.
+func (r *Run) WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := r.Write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,137 @@
+package nmap
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// Run is the root element of an nmap XML output.
+type Run struct {
+	XMLName          xml.Name   `xml:"nmaprun"`
+	Scanner          string     `xml:"scanner,attr"`
+	Args             string     `xml:"args,attr,omitempty"`
+	Start            int64      `xml:"start,attr"`
+	StartStr         string     `xml:"startstr,attr,omitempty"`
+	Version          string     `xml:"version,attr"`
+	XMLOutputVersion string     `xml:"xmloutputversion,attr"`
+	ScanInfo         []ScanInfo `xml:"scaninfo"`
+	Hosts            []Host     `xml:"host"`
+	RunStats         *RunStats  `xml:"runstats"`
+}
+
+// ScanInfo describes the ports scanned for a protocol.
+type ScanInfo struct {
+	Type        string `xml:"type,attr"`
+	Protocol    string `xml:"protocol,attr"`
+	NumServices int    `xml:"numservices,attr"`
+	Services    string `xml:"services,attr"`
+}
+
+// Host holds the results of a scanned host.
+type Host struct {
+	StartTime  int64        `xml:"starttime,attr,omitempty"`
+	EndTime    int64        `xml:"endtime,attr,omitempty"`
+	Status     Status       `xml:"status"`
+	Addresses  []Address    `xml:"address"`
+	Hostnames  []Hostname   `xml:"hostnames>hostname"`
+	ExtraPorts []ExtraPorts `xml:"ports>extraports"`
+	Ports      []Port       `xml:"ports>port"`
+}
+
+// ExtraPorts holds the number of ports in the same state that are not listed.
+type ExtraPorts struct {
+	State string `xml:"state,attr"`
+	Count int    `xml:"count,attr"`
+}
+
+// Status is the state of a host.
+type Status struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+// Address is an address of a host.
+type Address struct {
+	Addr     string `xml:"addr,attr"`
+	AddrType string `xml:"addrtype,attr"`
+	Vendor   string `xml:"vendor,attr,omitempty"`
+}
+
+// Hostname is a name of a host.
+type Hostname struct {
+	Name string `xml:"name,attr"`
+	Type string `xml:"type,attr"`
+}
+
+// Port holds the result of a scanned port.
+type Port struct {
+	Protocol string   `xml:"protocol,attr"`
+	PortID   int      `xml:"portid,attr"`
+	State    State    `xml:"state"`
+	Service  *Service `xml:"service"`
+}
+
+// State is the state of a port.
+type State struct {
+	State  string `xml:"state,attr"`
+	Reason string `xml:"reason,attr"`
+}
+
+// Service is the service detected on a port.
+type Service struct {
+	Name      string `xml:"name,attr"`
+	ExtraInfo string `xml:"extrainfo,attr,omitempty"`
+	Method    string `xml:"method,attr"`
+	Conf      int    `xml:"conf,attr"`
+}
+
+// RunStats holds the statistics of the run.
+type RunStats struct {
+	Finished Finished  `xml:"finished"`
+	Hosts    HostStats `xml:"hosts"`
+}
+
+// Finished holds the end of the run.
+type Finished struct {
+	Time    int64  `xml:"time,attr"`
+	TimeStr string `xml:"timestr,attr,omitempty"`
+	Elapsed string `xml:"elapsed,attr"`
+	Exit    string `xml:"exit,attr"`
+}
+
+// HostStats holds the number of hosts by state.
+type HostStats struct {
+	Up    int `xml:"up,attr"`
+	Down  int `xml:"down,attr"`
+	Total int `xml:"total,attr"`
+}
+
+// Parse reads an nmap XML output.
+func Parse(r io.Reader) (*Run, error) {
+	run := &Run{}
+	if err := xml.NewDecoder(r).Decode(run); err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// IP returns the IPv4 or IPv6 address of the host.
+func (h Host) IP() string {
+	for _, a := range h.Addresses {
+		if a.AddrType == "ipv4" || a.AddrType == "ipv6" {
+			return a.Addr
+		}
+	}
+	return ""
+}
+
+// OpenPorts returns the open ports of the host for the given protocol.
+func (h Host) OpenPorts(protocol string) []int {
+	var ports []int
+	for _, p := range h.Ports {
+		if p.Protocol == protocol && p.State.State == "open" {
+			ports = append(ports, p.PortID)
+		}
+	}
+	return ports
+}
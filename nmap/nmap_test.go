@@ -0,0 +1,105 @@
+package nmap
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/results"
+)
+
+const sample = `<?xml version="1.0" encoding="UTF-8"?>
+<nmaprun scanner="nmap" args="nmap -sT -oX - 10.0.0.0/30" start="1700000000" version="7.94" xmloutputversion="1.05">
+<scaninfo type="connect" protocol="tcp" numservices="1000" services="1,3-4,6-7"/>
+<host starttime="1700000000" endtime="1700000010"><status state="up" reason="syn-ack"/>
+<address addr="10.0.0.1" addrtype="ipv4"/>
+<hostnames><hostname name="web1.example.com" type="PTR"/></hostnames>
+<ports>
+<port protocol="tcp" portid="22"><state state="open" reason="syn-ack"/><service name="ssh" method="table" conf="3"/></port>
+<port protocol="tcp" portid="25"><state state="filtered" reason="no-response"/></port>
+<port protocol="tcp" portid="443"><state state="open" reason="syn-ack"/><service name="https" method="table" conf="3"/></port>
+</ports>
+</host>
+<host><status state="down" reason="no-response"/><address addr="10.0.0.2" addrtype="ipv4"/></host>
+<runstats><finished time="1700000010" elapsed="10.00" exit="success"/><hosts up="1" down="1" total="2"/></runstats>
+</nmaprun>`
+
+func TestParse(t *testing.T) {
+	run, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if len(run.Hosts) != 2 {
+		t.Fatalf("got %d hosts, want 2", len(run.Hosts))
+	}
+	if run.ScanInfo[0].Services != "1,3-4,6-7" {
+		t.Errorf("got services %q, want %q", run.ScanInfo[0].Services, "1,3-4,6-7")
+	}
+
+	h := run.Hosts[0]
+	if h.IP() != "10.0.0.1" {
+		t.Errorf("IP() = %s, want 10.0.0.1", h.IP())
+	}
+	if got := h.OpenPorts("tcp"); !reflect.DeepEqual(got, []int{22, 443}) {
+		t.Errorf("OpenPorts() = %v, want [22 443]", got)
+	}
+	if run.RunStats.Hosts.Up != 1 {
+		t.Errorf("got %d hosts up, want 1", run.RunStats.Hosts.Up)
+	}
+}
+
+func TestFromResults(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	scans := []results.Scan{{
+		Name:   "web1",
+		IP:     "10.0.0.1",
+		Start:  start,
+		End:    start.Add(10 * time.Second),
+		Open:   []string{"22", "443"},
+		Closed: []string{"21", "23", "80"},
+		MAC:    "52:54:00:12:34:56",
+		Vendor: "QEMU",
+
+		Annotations: map[string]string{"443": "public API"},
+	}}
+
+	var buf bytes.Buffer
+	if err := FromResults(scans, "1.2.3").Write(&buf); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	// The output must be readable as an nmap output
+	run, err := Parse(&buf)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if run.Scanner != "scan-exporter" || run.Version != "1.2.3" {
+		t.Errorf("got scanner %s %s, want scan-exporter 1.2.3", run.Scanner, run.Version)
+	}
+	if len(run.Hosts) != 1 {
+		t.Fatalf("got %d hosts, want 1", len(run.Hosts))
+	}
+	h := run.Hosts[0]
+	if h.IP() != "10.0.0.1" || h.Hostnames[0].Name != "web1" {
+		t.Errorf("got host %s (%s), want web1 (10.0.0.1)", h.Hostnames[0].Name, h.IP())
+	}
+	wantMAC := Address{Addr: "52:54:00:12:34:56", AddrType: "mac", Vendor: "QEMU"}
+	if len(h.Addresses) != 2 || h.Addresses[1] != wantMAC {
+		t.Errorf("got addresses %v, want the IP and %v", h.Addresses, wantMAC)
+	}
+	if got := h.OpenPorts("tcp"); !reflect.DeepEqual(got, []int{22, 443}) {
+		t.Errorf("OpenPorts() = %v, want [22 443]", got)
+	}
+	if h.Ports[0].Service != nil || h.Ports[1].Service == nil || h.Ports[1].Service.ExtraInfo != "public API" {
+		t.Errorf("got services %v and %v, want annotation of port 443 only", h.Ports[0].Service, h.Ports[1].Service)
+	}
+	if len(h.ExtraPorts) != 1 || h.ExtraPorts[0].Count != 3 {
+		t.Errorf("got extraports %v, want 3 closed ports", h.ExtraPorts)
+	}
+	if run.RunStats.Finished.Elapsed != "10.00" {
+		t.Errorf("got elapsed %s, want 10.00", run.RunStats.Finished.Elapsed)
+	}
+}
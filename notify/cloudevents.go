@@ -0,0 +1,139 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CloudEvents content modes of the HTTP binding.
+const (
+	ModeStructured = "structured"
+	ModeBinary     = "binary"
+)
+
+const (
+	// defaultSource is the source of the events when none is configured.
+	defaultSource = "scan-exporter"
+	// eventTypePrefix prefixes the kind of the finding in the event type.
+	eventTypePrefix = "io.scanexporter.finding."
+)
+
+// CloudEvents sends findings as CloudEvents using the HTTP binding.
+type CloudEvents struct {
+	URL    string
+	Source string
+	Mode   string
+	client *http.Client
+}
+
+// cloudEvent is a CloudEvent in structured mode.
+type cloudEvent struct {
+	SpecVersion     string    `json:"specversion"`
+	ID              string    `json:"id"`
+	Source          string    `json:"source"`
+	Type            string    `json:"type"`
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            Finding   `json:"data"`
+}
+
+// NewCloudEvents creates a CloudEvents notifier. An empty source and mode
+// default to "scan-exporter" and structured mode.
+func NewCloudEvents(url, source, mode string) (*CloudEvents, error) {
+	if source == "" {
+		source = defaultSource
+	}
+	switch mode {
+	case "":
+		mode = ModeStructured
+	case ModeStructured, ModeBinary:
+	default:
+		return nil, fmt.Errorf("unknown CloudEvents mode %q", mode)
+	}
+	return &CloudEvents{
+		URL:    url,
+		Source: source,
+		Mode:   mode,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// event wraps a finding in a CloudEvent. Resolved findings have their own
+// type, so routers can tell them apart without reading the data.
+func (c *CloudEvents) event(f Finding) (cloudEvent, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return cloudEvent{}, err
+	}
+
+	eventType := eventTypePrefix + f.Kind
+	if f.Resolved {
+		eventType += ".resolved"
+	}
+	subject := f.IP
+	if f.Port != "" {
+		subject += ":" + f.Port
+	}
+
+	return cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              hex.EncodeToString(id),
+		Source:          c.Source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            f.Time,
+		DataContentType: "application/json",
+		Data:            f,
+	}, nil
+}
+
+// Notify sends the finding to the sink.
+func (c *CloudEvents) Notify(f Finding) error {
+	e, err := c.event(f)
+	if err != nil {
+		return err
+	}
+
+	var body []byte
+	header := make(http.Header)
+	switch c.Mode {
+	case ModeBinary:
+		body, err = json.Marshal(e.Data)
+		header.Set("Content-Type", e.DataContentType)
+		header.Set("ce-specversion", e.SpecVersion)
+		header.Set("ce-id", e.ID)
+		header.Set("ce-source", e.Source)
+		header.Set("ce-type", e.Type)
+		header.Set("ce-subject", e.Subject)
+		header.Set("ce-time", e.Time.Format(time.RFC3339Nano))
+	default:
+		body, err = json.Marshal(e)
+		header.Set("Content-Type", "application/cloudevents+json")
+	}
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("CloudEvents sink returned status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCloudEvents_Notify(t *testing.T) {
+	f := Finding{Kind: KindUnexpectedOpen, Name: "db", IP: "10.0.0.1", Port: "3306", Severity: SeverityCritical, Time: time.Now()}
+	resolved := f
+	resolved.Resolved = true
+
+	tests := []struct {
+		name        string
+		mode        string
+		finding     Finding
+		wantType    string
+		contentType string
+	}{
+		{name: "structured", mode: "", finding: f, wantType: "io.scanexporter.finding.unexpected_open", contentType: "application/cloudevents+json"},
+		{name: "structured resolved", mode: ModeStructured, finding: resolved, wantType: "io.scanexporter.finding.unexpected_open.resolved", contentType: "application/cloudevents+json"},
+		{name: "binary", mode: ModeBinary, finding: f, wantType: "io.scanexporter.finding.unexpected_open", contentType: "application/json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ceType, ceSource, ceSubject, ceID string
+			var data Finding
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if ct := r.Header.Get("Content-Type"); ct != tt.contentType {
+					t.Errorf("got content type %s, want %s", ct, tt.contentType)
+				}
+				if tt.mode == ModeBinary {
+					ceType, ceSource, ceSubject, ceID = r.Header.Get("ce-type"), r.Header.Get("ce-source"), r.Header.Get("ce-subject"), r.Header.Get("ce-id")
+					json.NewDecoder(r.Body).Decode(&data)
+				} else {
+					var e cloudEvent
+					json.NewDecoder(r.Body).Decode(&e)
+					if e.SpecVersion != "1.0" {
+						t.Errorf("got specversion %s, want 1.0", e.SpecVersion)
+					}
+					ceType, ceSource, ceSubject, ceID, data = e.Type, e.Source, e.Subject, e.ID, e.Data
+				}
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer srv.Close()
+
+			c, err := NewCloudEvents(srv.URL, "", tt.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Notify(tt.finding); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			if ceType != tt.wantType {
+				t.Errorf("got type %s, want %s", ceType, tt.wantType)
+			}
+			if ceSource != "scan-exporter" || ceSubject != "10.0.0.1:3306" || ceID == "" {
+				t.Errorf("got source %q, subject %q and id %q", ceSource, ceSubject, ceID)
+			}
+			if data.Port != "3306" || data.Resolved != tt.finding.Resolved {
+				t.Errorf("got data %+v, want %+v", data, tt.finding)
+			}
+		})
+	}
+}
+
+func TestNewCloudEvents_invalidMode(t *testing.T) {
+	if _, err := NewCloudEvents("http://localhost", "", "batched"); err == nil {
+		t.Errorf("NewCloudEvents() accepted an unknown mode")
+	}
+}
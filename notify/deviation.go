@@ -0,0 +1,69 @@
+package notify
+
+import (
+	"slices"
+	"time"
+)
+
+// Deviation holds the ports of a target found unexpectedly open or closed by
+// a scan. A deviation without ports means that the target is compliant again.
+type Deviation struct {
+	Target     string    `json:"target"`
+	IP         string    `json:"ip"`
+	Proto      string    `json:"proto"`
+	Unexpected []string  `json:"unexpected_ports"`
+	Closed     []string  `json:"closed_ports"`
+	Time       time.Time `json:"timestamp"`
+}
+
+// compliant reports whether the deviation holds no port.
+func (d Deviation) compliant() bool {
+	return len(d.Unexpected) == 0 && len(d.Closed) == 0
+}
+
+// same reports whether the deviations hold the same ports.
+func (d Deviation) same(other Deviation) bool {
+	return slices.Equal(d.Unexpected, other.Unexpected) && slices.Equal(d.Closed, other.Closed)
+}
+
+// ReportDeviation replaces the deviation of a target, identified by its IP,
+// with the given one. It is sent to the deviations webhook when its ports
+// differ from the last one delivered, so that a target keeping the same
+// deviation scan after scan is only reported once. The deviation of a target
+// becoming compliant is sent without ports.
+func (d *Dispatcher) ReportDeviation(dev Deviation) {
+	if d == nil || d.deviationHook == nil {
+		return
+	}
+
+	select {
+	case d.outgoingDeviations <- dev:
+	default:
+		d.logger.Error().Str("name", dev.Target).Str("ip", dev.IP).Msg("notification queue is full, dropping deviation")
+	}
+}
+
+// deliverDeviation sends a deviation to the deviations webhook, unless it
+// holds the same ports as the last one delivered for the target. Deviations
+// which cannot be delivered are sent again after the next scan.
+func (d *Dispatcher) deliverDeviation(dev Deviation) {
+	if dev.same(d.deviations[dev.IP]) {
+		return
+	}
+	// Receivers get empty lists rather than null
+	if dev.Unexpected == nil {
+		dev.Unexpected = []string{}
+	}
+	if dev.Closed == nil {
+		dev.Closed = []string{}
+	}
+	if err := d.deviationHook.post(dev); err != nil {
+		d.logger.Error().Err(err).Str("name", dev.Target).Str("ip", dev.IP).Msg("cannot send deviation to webhook")
+		return
+	}
+	if dev.compliant() {
+		delete(d.deviations, dev.IP)
+	} else {
+		d.deviations[dev.IP] = dev
+	}
+}
@@ -0,0 +1,85 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+func TestDispatcher_ReportDeviation(t *testing.T) {
+	var mu sync.Mutex
+	var got []Deviation
+	// The first delivery fails, and is sent again after the next scan
+	failed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var dev Deviation
+		if err := json.NewDecoder(r.Body).Decode(&dev); err != nil {
+			t.Errorf("cannot decode deviation: %v", err)
+		}
+		got = append(got, dev)
+	}))
+	defer srv.Close()
+
+	d, err := New(config.Notifications{Webhook: &config.Webhook{URL: srv.URL}}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scans := []Deviation{
+		{Unexpected: []string{"3306"}},
+		{Unexpected: []string{"3306"}},
+		{Unexpected: []string{"3306"}},
+		{Unexpected: []string{"3306"}, Closed: []string{"443"}},
+		{},
+		{},
+	}
+	for _, dev := range scans {
+		dev.Target, dev.IP, dev.Proto = "db", "10.0.0.1", ProtoTCP
+		d.ReportDeviation(dev)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []Deviation{
+		{Unexpected: []string{"3306"}},
+		{Unexpected: []string{"3306"}, Closed: []string{"443"}},
+		{},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("webhook received %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i].Target != "db" || got[i].Proto != ProtoTCP || !got[i].same(want[i]) {
+			t.Errorf("webhook received %+v, want %+v", got[i], want[i])
+		}
+		// Deviations without ports hold empty lists rather than null
+		if got[i].Unexpected == nil || got[i].Closed == nil {
+			t.Errorf("webhook received null ports in %+v", got[i])
+		}
+	}
+}
+
+func TestNew_deviationWebhook(t *testing.T) {
+	if _, err := New(config.Notifications{Webhook: &config.Webhook{}}, zerolog.Nop()); err == nil {
+		t.Errorf("New() without webhook URL error = nil, want an error")
+	}
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultHeartbeatInterval is the interval between two heartbeats when
+	// none is configured.
+	defaultHeartbeatInterval = time.Minute
+	// defaultHeartbeatMaxAge is the time without any scan after which the
+	// scanner is considered stuck when none is configured.
+	defaultHeartbeatMaxAge = time.Hour
+)
+
+// Heartbeat periodically pings an URL, such as a healthchecks.io check, while
+// the scanner is healthy. The monitoring system behind the URL alerts when the
+// pings stop, so that a scanner which silently stopped working is noticed.
+type Heartbeat struct {
+	URL      string
+	interval time.Duration
+	maxAge   time.Duration
+	healthy  func(maxAge time.Duration) error
+	logger   zerolog.Logger
+	client   *http.Client
+}
+
+// NewHeartbeat creates a heartbeat from its configuration. healthy returns why
+// the scanner is unhealthy, given the time after which it is considered stuck.
+// It returns nil if no heartbeat is configured.
+func NewHeartbeat(c *config.Heartbeat, healthy func(maxAge time.Duration) error, logger zerolog.Logger) (*Heartbeat, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.URL == "" {
+		return nil, fmt.Errorf("no URL provided for the heartbeat")
+	}
+	h := &Heartbeat{
+		URL:      c.URL,
+		interval: defaultHeartbeatInterval,
+		maxAge:   defaultHeartbeatMaxAge,
+		healthy:  healthy,
+		logger:   logger,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	var err error
+	if c.Interval != "" {
+		if h.interval, err = time.ParseDuration(c.Interval); err != nil || h.interval <= 0 {
+			return nil, fmt.Errorf("invalid heartbeat interval %q", c.Interval)
+		}
+	}
+	if c.MaxAge != "" {
+		if h.maxAge, err = time.ParseDuration(c.MaxAge); err != nil || h.maxAge <= 0 {
+			return nil, fmt.Errorf("invalid heartbeat max age %q", c.MaxAge)
+		}
+	}
+	return h, nil
+}
+
+// Run sends a heartbeat on every interval, as long as the scanner is healthy.
+// It never returns.
+func (h *Heartbeat) Run() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.beat()
+	}
+}
+
+// beat sends a heartbeat if the scanner is healthy.
+func (h *Heartbeat) beat() {
+	if err := h.healthy(h.maxAge); err != nil {
+		h.logger.Error().Err(err).Msg("scanner is unhealthy, heartbeat not sent")
+		return
+	}
+	if err := h.send(); err != nil {
+		h.logger.Error().Err(err).Msgf("cannot send heartbeat to %s", h.URL)
+	}
+}
+
+// send pings the URL of the heartbeat.
+func (h *Heartbeat) send() error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.interval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("heartbeat returned status %s", resp.Status)
+	}
+	return nil
+}
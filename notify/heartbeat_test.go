@@ -0,0 +1,72 @@
+package notify
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+func TestNewHeartbeat(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.Heartbeat
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "unset", wantNil: true},
+		{name: "default", conf: &config.Heartbeat{URL: "https://hc-ping.com/uuid"}},
+		{name: "custom", conf: &config.Heartbeat{URL: "https://hc-ping.com/uuid", Interval: "30s", MaxAge: "2h"}},
+		{name: "no URL", conf: &config.Heartbeat{}, wantNil: true, wantErr: true},
+		{name: "invalid interval", conf: &config.Heartbeat{URL: "https://hc-ping.com/uuid", Interval: "0s"}, wantNil: true, wantErr: true},
+		{name: "invalid max age", conf: &config.Heartbeat{URL: "https://hc-ping.com/uuid", MaxAge: "1d"}, wantNil: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewHeartbeat(tt.conf, nil, zerolog.Nop())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewHeartbeat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("NewHeartbeat() = %v, want nil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestHeartbeat_beat(t *testing.T) {
+	var pings atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pings.Add(1)
+	}))
+	defer srv.Close()
+
+	var unhealthy error
+	var gotMaxAge time.Duration
+	h, err := NewHeartbeat(&config.Heartbeat{URL: srv.URL, MaxAge: "10m"}, func(maxAge time.Duration) error {
+		gotMaxAge = maxAge
+		return unhealthy
+	}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.beat()
+	if n := pings.Load(); n != 1 {
+		t.Errorf("beat() sent %d pings while healthy, want 1", n)
+	}
+	if gotMaxAge != 10*time.Minute {
+		t.Errorf("beat() checked the health with max age %s, want 10m", gotMaxAge)
+	}
+
+	unhealthy = errors.New("no scan ended for 1h")
+	h.beat()
+	if n := pings.Load(); n != 1 {
+		t.Errorf("beat() sent %d pings while unhealthy, want none", n-1)
+	}
+}
@@ -0,0 +1,465 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+// Severity levels that can be attached to a port.
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Kinds of findings.
+const (
+	KindUnexpectedOpen   = "unexpected_open"
+	KindUnexpectedClosed = "unexpected_closed"
+	KindMisbehaving      = "misbehaving"
+	KindHTTPAssertion    = "http_assertion"
+	KindChangeRate       = "change_rate"
+	KindFamilyMismatch   = "family_mismatch"
+	KindHostDown         = "host_down"
+)
+
+// Protocols of the findings, coming from TCP scans or ICMP pings.
+const (
+	ProtoTCP  = "tcp"
+	ProtoICMP = "icmp"
+)
+
+// ValidSeverity checks if a severity is known.
+func ValidSeverity(s string) bool {
+	return s == SeverityInfo || s == SeverityWarning || s == SeverityCritical
+}
+
+// SeverityRanges associates a severity to ranges of ports, each range holding
+// its first and last port.
+type SeverityRanges struct {
+	Severity string
+	Ranges   [][2]int
+}
+
+// Severities classifies ports. When a port is in several ranges, the first one
+// wins.
+type Severities []SeverityRanges
+
+// Of returns the severity of a port, and whether it is classified.
+func (s Severities) Of(port int) (string, bool) {
+	for _, sr := range s {
+		for _, r := range sr.Ranges {
+			if port >= r[0] && port <= r[1] {
+				return sr.Severity, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Finding is a deviation from the expected state of a target.
+type Finding struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	IP       string `json:"ip"`
+	Port     string `json:"port,omitempty"`
+	Proto    string `json:"proto"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	// Annotation describes what the port is used for, and Service is the
+	// name of the well-known service running on it.
+	Annotation string            `json:"annotation,omitempty"`
+	Service    string            `json:"service,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	Time       time.Time         `json:"time"`
+	// Owner identifies the network of public addresses, when known.
+	Owner *Owner `json:"owner,omitempty"`
+	// Resolved is true when the finding disappeared.
+	Resolved bool `json:"resolved"`
+	// Flapping is true when the port changes state too often.
+	Flapping bool `json:"flapping,omitempty"`
+	// Diff is the number of ports which changed state since the previous
+	// scan, and ScanDuration the duration of the scan, in seconds, for the
+	// findings coming from a scan.
+	Diff         int     `json:"diff,omitempty"`
+	ScanDuration float64 `json:"scan_duration_seconds,omitempty"`
+	// Findings holds the findings gathered by a digest.
+	Findings []Finding `json:"findings,omitempty"`
+}
+
+// Owner identifies the network an address belongs to: its autonomous system,
+// the netblock announcing it, and the organization owning them.
+type Owner struct {
+	ASN      uint   `json:"asn"`
+	Netblock string `json:"netblock"`
+	Name     string `json:"name,omitempty"`
+}
+
+// key identifies a finding on a target.
+func (f Finding) key() string {
+	return f.Kind + "/" + f.Port
+}
+
+// Notifier sends findings to an external system.
+type Notifier interface {
+	Notify(f Finding) error
+}
+
+// Route sends the findings matching its severities and its targets to a
+// notifier. An empty severities or targets list matches all findings.
+type Route struct {
+	Name       string
+	Severities []string
+	// Targets holds the names or IPs of the targets of the findings
+	Targets  []string
+	Notifier Notifier
+	// quiet holds the quiet hours of the route, if any
+	quiet *quietHours
+}
+
+func (r Route) matches(f Finding) bool {
+	if len(r.Targets) > 0 && !common.StringInSlice(f.Name, r.Targets) && !common.StringInSlice(f.IP, r.Targets) {
+		return false
+	}
+	return len(r.Severities) == 0 || common.StringInSlice(f.Severity, r.Severities)
+}
+
+// Dispatcher keeps track of the findings of each target and sends the new and
+// resolved ones to the matching routes.
+type Dispatcher struct {
+	routes      []Route
+	subscribers []func(Finding)
+	logger      zerolog.Logger
+	current     map[string]map[string]Finding
+	outgoing    chan Finding
+	silences    *Silences
+	// queue holds the notifications which could not be delivered yet
+	queue *deliveryQueue
+	// hosts holds the host down findings of the targets, which come from
+	// their pings rather than from their scans
+	hosts map[string]Finding
+	// suppressFlapping is true when the findings of flapping ports are not
+	// sent to the routes
+	suppressFlapping bool
+	// held holds the findings of each route held during its quiet hours. It
+	// is only used by the sending goroutine
+	held map[string][]Finding
+	// deviationHook receives the deviations of the targets, if any. The
+	// deviations are queued in outgoingDeviations, and the last one delivered
+	// for each target is held in deviations, which is only used by the
+	// sending goroutine
+	deviationHook      *Webhook
+	outgoingDeviations chan Deviation
+	deviations         map[string]Deviation
+	// closing is closed to stop the sending goroutine, which closes closed
+	// once the queued findings are delivered
+	closing, closed chan struct{}
+}
+
+// NewDispatcher creates a dispatcher and starts its sending goroutine. The
+// notifications which cannot be delivered are retried, and kept in memory.
+func NewDispatcher(routes []Route, logger zerolog.Logger) *Dispatcher {
+	queue, _ := newDeliveryQueue(nil, logger)
+	return newDispatcher(routes, queue, logger)
+}
+
+// newDispatcher creates a dispatcher retrying the notifications held by queue,
+// and starts its sending goroutine.
+func newDispatcher(routes []Route, queue *deliveryQueue, logger zerolog.Logger) *Dispatcher {
+	d := &Dispatcher{
+		routes:   routes,
+		logger:   logger,
+		current:  make(map[string]map[string]Finding),
+		hosts:    make(map[string]Finding),
+		outgoing: make(chan Finding, 1024),
+		silences: &Silences{},
+		queue:    queue,
+		held:     make(map[string][]Finding),
+		closing:  make(chan struct{}),
+		closed:   make(chan struct{}),
+
+		outgoingDeviations: make(chan Deviation, 1024),
+		deviations:         make(map[string]Deviation),
+	}
+	go d.send()
+	return d
+}
+
+// Silences returns the silences of the findings. It returns nil on a nil
+// dispatcher.
+func (d *Dispatcher) Silences() *Silences {
+	if d == nil {
+		return nil
+	}
+	return d.silences
+}
+
+// Subscribe registers a function called with every new or resolved finding,
+// regardless of the routes. It must be called before the first report.
+func (d *Dispatcher) Subscribe(fn func(Finding)) {
+	d.subscribers = append(d.subscribers, fn)
+}
+
+// Report replaces the findings of a target, identified by its IP, with the
+// given ones. Findings that were not present in the previous report are sent,
+// as well as the ones that disappeared, flagged as resolved. The resolved
+// findings of the flapping ports are flagged as flapping.
+func (d *Dispatcher) Report(ip string, findings []Finding, flapping ...string) {
+	if d == nil {
+		return
+	}
+
+	previous := d.current[ip]
+	current := make(map[string]Finding, len(findings))
+
+	for _, f := range findings {
+		current[f.key()] = f
+		if _, ok := previous[f.key()]; !ok {
+			d.enqueue(f)
+		}
+	}
+
+	for k, f := range previous {
+		if _, ok := current[k]; !ok {
+			f.Resolved = true
+			f.Flapping = slices.Contains(flapping, f.Port)
+			f.Time = time.Now()
+			d.enqueue(f)
+		}
+	}
+
+	d.current[ip] = current
+}
+
+// ReportHost replaces the host down finding of a target, identified by its IP,
+// with the given one, nil meaning that the target is up. The finding is sent
+// when the target goes down, and flagged as resolved when it comes back.
+func (d *Dispatcher) ReportHost(ip string, f *Finding) {
+	if d == nil {
+		return
+	}
+
+	previous, down := d.hosts[ip]
+	switch {
+	case f != nil && !down:
+		d.hosts[ip] = *f
+		d.enqueue(*f)
+	case f == nil && down:
+		delete(d.hosts, ip)
+		previous.Resolved = true
+		previous.Time = time.Now()
+		d.enqueue(previous)
+	}
+}
+
+// enqueue adds a finding to the sending queue. If the queue is full, the
+// finding is dropped to avoid blocking the caller.
+func (d *Dispatcher) enqueue(f Finding) {
+	for _, fn := range d.subscribers {
+		fn(f)
+	}
+
+	select {
+	case d.outgoing <- f:
+	default:
+		d.logger.Error().Str("name", f.Name).Str("ip", f.IP).Msgf("notification queue is full, dropping %s finding", f.Kind)
+	}
+}
+
+// Close delivers the queued findings and stops the sending goroutine. It waits
+// for the deliveries until ctx is done. The findings reported afterwards are
+// dropped once the queue is full. It must only be called once.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	close(d.closing)
+	select {
+	case <-d.closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send delivers the queued findings to the matching routes, retries the
+// notifications which could not be delivered, and delivers the digests of the
+// routes whose quiet hours ended. Once the dispatcher is closed, it delivers
+// the queued findings and returns.
+func (d *Dispatcher) send() {
+	defer close(d.closed)
+
+	routes := make(map[string]Route, len(d.routes))
+	for _, r := range d.routes {
+		routes[r.Name] = r
+	}
+
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case f := <-d.outgoing:
+			d.deliver(f, time.Now())
+		case dev := <-d.outgoingDeviations:
+			d.deliverDeviation(dev)
+		case now := <-ticker.C:
+			d.queue.retry(now, routes, func(r Route, f Finding) error { return r.Notifier.Notify(f) })
+			d.releaseDigests(now)
+		case <-d.closing:
+			for {
+				select {
+				case f := <-d.outgoing:
+					d.deliver(f, time.Now())
+				case dev := <-d.outgoingDeviations:
+					d.deliverDeviation(dev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver sends a finding to the matching routes, or holds it until the end of
+// their quiet hours.
+func (d *Dispatcher) deliver(f Finding, now time.Time) {
+	if d.silences.Silenced(f) {
+		d.logger.Debug().Str("name", f.Name).Str("ip", f.IP).Msgf("%s finding on port %s is silenced", f.Kind, f.Port)
+		return
+	}
+	if d.suppressFlapping && f.Flapping {
+		d.logger.Debug().Str("name", f.Name).Str("ip", f.IP).Msgf("%s finding on port %s is suppressed, the port is flapping", f.Kind, f.Port)
+		return
+	}
+	for _, r := range d.routes {
+		if !r.matches(f) {
+			continue
+		}
+		if r.quiet.holds(f, now) {
+			d.logger.Debug().Str("route", r.Name).Str("name", f.Name).Str("ip", f.IP).Msgf("%s finding on port %s held during quiet hours", f.Kind, f.Port)
+			d.held[r.Name] = hold(d.held[r.Name], f)
+			continue
+		}
+		d.notify(r, f, now)
+	}
+}
+
+// notify sends a finding to a route. The notifications which cannot be
+// delivered are queued, as well as the ones to routes which already have
+// queued notifications, so that they are delivered in order.
+func (d *Dispatcher) notify(r Route, f Finding, now time.Time) {
+	if d.queue.queued(r.Name) {
+		d.queue.push(r.Name, f, false, now)
+		return
+	}
+	if err := r.Notifier.Notify(f); err != nil {
+		d.logger.Error().Err(err).Str("route", r.Name).Str("name", f.Name).Str("ip", f.IP).Msg("cannot send notification, it will be retried")
+		d.queue.push(r.Name, f, true, now)
+	}
+}
+
+// releaseDigests sends the findings held by the routes whose quiet hours
+// ended, as a single digest per route.
+func (d *Dispatcher) releaseDigests(now time.Time) {
+	for _, r := range d.routes {
+		held := d.held[r.Name]
+		if r.quiet.active(now) || len(held) == 0 {
+			continue
+		}
+		delete(d.held, r.Name)
+		d.logger.Info().Str("route", r.Name).Msgf("quiet hours ended, sending digest of %d finding(s)", len(held))
+		d.notify(r, digest(held, now), now)
+	}
+}
+
+// New creates the notification routes described in configuration and returns
+// the dispatcher that feeds them.
+func New(conf config.Notifications, logger zerolog.Logger) (*Dispatcher, error) {
+	var routes []Route
+	names := make(map[string]bool)
+	for i, r := range conf.Routes {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("route-%d", i)
+		}
+		// Queued notifications are associated with their route by name
+		if names[name] {
+			return nil, fmt.Errorf("duplicate route name %s", name)
+		}
+		names[name] = true
+
+		for _, sev := range r.Severities {
+			if !ValidSeverity(sev) {
+				return nil, fmt.Errorf("unknown severity %q in route %s", sev, name)
+			}
+		}
+
+		quiet, err := newQuietHours(r.QuietHours)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quiet hours in route %s: %w", name, err)
+		}
+
+		route := Route{Name: name, Severities: r.Severities, Targets: r.Targets, quiet: quiet}
+		switch {
+		case r.Webhook != nil:
+			if r.Webhook.URL == "" {
+				return nil, fmt.Errorf("no URL provided for webhook in route %s", name)
+			}
+			route.Notifier = NewWebhook(r.Webhook.URL, r.Webhook.Secret)
+		case r.CloudEvents != nil:
+			if r.CloudEvents.URL == "" {
+				return nil, fmt.Errorf("no URL provided for CloudEvents in route %s", name)
+			}
+			ce, err := NewCloudEvents(r.CloudEvents.URL, r.CloudEvents.Source, r.CloudEvents.Mode)
+			if err != nil {
+				return nil, fmt.Errorf("invalid CloudEvents in route %s: %w", name, err)
+			}
+			route.Notifier = ce
+		case r.Opsgenie != nil:
+			if r.Opsgenie.APIKey == "" {
+				return nil, fmt.Errorf("no API key provided for Opsgenie in route %s", name)
+			}
+			route.Notifier = NewOpsgenie(r.Opsgenie.APIURL, r.Opsgenie.APIKey, r.Opsgenie.Tags)
+		case r.Slack != nil:
+			if r.Slack.URL == "" {
+				return nil, fmt.Errorf("no URL provided for Slack in route %s", name)
+			}
+			route.Notifier = NewSlack(r.Slack.URL, r.Slack.Channel)
+		default:
+			return nil, fmt.Errorf("no notifier configured in route %s", name)
+		}
+
+		routes = append(routes, route)
+	}
+
+	silences, err := NewSilences(conf.SilencesFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load silences: %w", err)
+	}
+
+	queue, err := newDeliveryQueue(conf.Delivery, logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delivery: %w", err)
+	}
+
+	var deviationHook *Webhook
+	if conf.Webhook != nil {
+		if conf.Webhook.URL == "" {
+			return nil, errors.New("no URL provided for the deviations webhook")
+		}
+		deviationHook = NewWebhook(conf.Webhook.URL, conf.Webhook.Secret)
+	}
+
+	d := newDispatcher(routes, queue, logger)
+	d.silences = silences
+	d.suppressFlapping = conf.SuppressFlapping
+	d.deviationHook = deviationHook
+	return d, nil
+}
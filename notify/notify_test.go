@@ -0,0 +1,159 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	findings []Finding
+}
+
+func (r *recorder) Notify(f Finding) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.findings = append(r.findings, f)
+	return nil
+}
+
+func (r *recorder) wait(t *testing.T, n int) []Finding {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		r.mu.Lock()
+		if len(r.findings) >= n {
+			f := r.findings
+			r.findings = nil
+			r.mu.Unlock()
+			return f
+		}
+		r.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %d findings", n)
+	return nil
+}
+
+func TestDispatcher_Report(t *testing.T) {
+	all := &recorder{}
+	critical := &recorder{}
+	d := NewDispatcher([]Route{
+		{Name: "all", Notifier: all},
+		{Name: "critical", Severities: []string{SeverityCritical}, Notifier: critical},
+	}, zerolog.Nop())
+
+	mysql := Finding{Kind: KindUnexpectedOpen, IP: "10.0.0.1", Port: "3306", Severity: SeverityCritical}
+	dev := Finding{Kind: KindUnexpectedOpen, IP: "10.0.0.1", Port: "8080", Severity: SeverityWarning}
+
+	d.Report("10.0.0.1", []Finding{mysql, dev})
+	if got := all.wait(t, 2); len(got) != 2 {
+		t.Errorf("got %d findings on the default route, want 2", len(got))
+	}
+	if got := critical.wait(t, 1); len(got) != 1 || got[0].Port != "3306" {
+		t.Errorf("got %v on the critical route, want port 3306 only", got)
+	}
+
+	// Same findings again: nothing is sent. Then port 8080 closes.
+	d.Report("10.0.0.1", []Finding{mysql, dev})
+	d.Report("10.0.0.1", []Finding{mysql})
+	got := all.wait(t, 1)
+	if len(got) != 1 || got[0].Port != "8080" || !got[0].Resolved {
+		t.Errorf("got %v, want port 8080 resolved only", got)
+	}
+}
+
+func TestDispatcher_Report_flapping(t *testing.T) {
+	all := &recorder{}
+	d := NewDispatcher([]Route{{Name: "all", Notifier: all}}, zerolog.Nop())
+	d.suppressFlapping = true
+
+	stable := Finding{Kind: KindUnexpectedOpen, IP: "10.0.0.1", Port: "22"}
+	flapping := Finding{Kind: KindUnexpectedOpen, IP: "10.0.0.1", Port: "8080", Flapping: true}
+
+	d.Report("10.0.0.1", []Finding{stable, flapping}, "8080")
+	if got := all.wait(t, 1); len(got) != 1 || got[0].Port != "22" {
+		t.Errorf("got %v, want port 22 only", got)
+	}
+
+	// The resolution of the finding of a flapping port is suppressed too
+	d.Report("10.0.0.1", nil, "8080")
+	if got := all.wait(t, 1); len(got) != 1 || got[0].Port != "22" || !got[0].Resolved {
+		t.Errorf("got %v, want port 22 resolved only", got)
+	}
+}
+
+func TestDispatcher_ReportHost(t *testing.T) {
+	all := &recorder{}
+	d := NewDispatcher([]Route{{Name: "all", Notifier: all}}, zerolog.Nop())
+
+	down := &Finding{Kind: KindHostDown, IP: "10.0.0.1", Proto: ProtoICMP, Severity: SeverityInfo}
+	open := Finding{Kind: KindUnexpectedOpen, IP: "10.0.0.1", Port: "22"}
+
+	// The host down finding is only sent once, and is not resolved by the
+	// reports of the scans
+	d.ReportHost("10.0.0.1", down)
+	d.ReportHost("10.0.0.1", down)
+	d.Report("10.0.0.1", []Finding{open})
+	if got := all.wait(t, 2); len(got) != 2 || got[0].Kind != KindHostDown || got[1].Kind != KindUnexpectedOpen {
+		t.Errorf("got %v, want the host down and port 22 findings", got)
+	}
+
+	d.ReportHost("10.0.0.1", nil)
+	d.ReportHost("10.0.0.1", nil)
+	d.Report("10.0.0.1", nil)
+	got := all.wait(t, 2)
+	if len(got) != 2 || got[0].Kind != KindHostDown || !got[0].Resolved || got[1].Port != "22" {
+		t.Errorf("got %v, want the host down and port 22 findings resolved", got)
+	}
+}
+
+func TestDispatcher_Close(t *testing.T) {
+	all := &recorder{}
+	d := NewDispatcher([]Route{{Name: "all", Notifier: all}}, zerolog.Nop())
+
+	d.Report("10.0.0.1", []Finding{
+		{Kind: KindUnexpectedOpen, IP: "10.0.0.1", Port: "22"},
+		{Kind: KindUnexpectedOpen, IP: "10.0.0.1", Port: "3306"},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// The findings are delivered once Close returns
+	all.mu.Lock()
+	defer all.mu.Unlock()
+	if len(all.findings) != 2 {
+		t.Errorf("Close() delivered %v, want ports 22 and 3306", all.findings)
+	}
+}
+
+func TestRoute_matches(t *testing.T) {
+	f := Finding{Kind: KindUnexpectedOpen, Name: "db", IP: "10.0.0.1", Port: "3306", Severity: SeverityCritical}
+	tests := []struct {
+		name  string
+		route Route
+		want  bool
+	}{
+		{name: "all", route: Route{}, want: true},
+		{name: "severity", route: Route{Severities: []string{SeverityCritical}}, want: true},
+		{name: "other severity", route: Route{Severities: []string{SeverityInfo}}},
+		{name: "target name", route: Route{Targets: []string{"web", "db"}}, want: true},
+		{name: "target IP", route: Route{Targets: []string{"10.0.0.1"}}, want: true},
+		{name: "other target", route: Route{Targets: []string{"web"}}},
+		{name: "target and other severity", route: Route{Targets: []string{"db"}, Severities: []string{SeverityWarning}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.route.matches(f); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultOpsgenieURL is the URL of the Opsgenie API when none is
+	// configured. Accounts in the EU region use https://api.eu.opsgenie.com.
+	defaultOpsgenieURL = "https://api.opsgenie.com"
+	// opsgenieMaxMessage is the maximum length of the message of an alert.
+	opsgenieMaxMessage = 130
+)
+
+// opsgeniePriorities associates the severities of the findings with the
+// priorities of the alerts.
+var opsgeniePriorities = map[string]string{
+	SeverityCritical: "P1",
+	SeverityWarning:  "P3",
+	SeverityInfo:     "P5",
+}
+
+// Opsgenie creates an Opsgenie alert for each finding, and closes it when the
+// finding is resolved. Alerts are identified by an alias made of the kind of
+// the finding, the target and the port, so a finding appearing again while its
+// alert is open is deduplicated by Opsgenie.
+type Opsgenie struct {
+	URL    string
+	apiKey string
+	tags   []string
+	client *http.Client
+}
+
+// opsgenieAlert is the body of a request creating an alert.
+type opsgenieAlert struct {
+	Message     string            `json:"message"`
+	Alias       string            `json:"alias"`
+	Description string            `json:"description,omitempty"`
+	Entity      string            `json:"entity"`
+	Source      string            `json:"source"`
+	Priority    string            `json:"priority"`
+	Tags        []string          `json:"tags,omitempty"`
+	Details     map[string]string `json:"details,omitempty"`
+}
+
+// opsgenieClose is the body of a request closing an alert.
+type opsgenieClose struct {
+	Source string `json:"source"`
+	Note   string `json:"note,omitempty"`
+}
+
+// NewOpsgenie creates an Opsgenie notifier. An empty URL defaults to the API
+// of the US region.
+func NewOpsgenie(apiURL, apiKey string, tags []string) *Opsgenie {
+	if apiURL == "" {
+		apiURL = defaultOpsgenieURL
+	}
+	return &Opsgenie{
+		URL:    strings.TrimSuffix(apiURL, "/"),
+		apiKey: apiKey,
+		tags:   tags,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// alias returns the alias of the alert of a finding.
+func (o *Opsgenie) alias(f Finding) string {
+	alias := defaultSource + ":" + f.Kind + ":" + f.Name + ":" + f.IP
+	if f.Port != "" {
+		alias += ":" + f.Port
+	}
+	return alias
+}
+
+// Notify creates the alert of the finding, or closes it if the finding is
+// resolved.
+func (o *Opsgenie) Notify(f Finding) error {
+	alias := o.alias(f)
+	if f.Resolved {
+		u := o.URL + "/v2/alerts/" + url.PathEscape(alias) + "/close?identifierType=alias"
+		return o.post(u, opsgenieClose{Source: defaultSource, Note: "Resolved: " + f.Message})
+	}
+
+	// The message is the title of the alert, and the whole finding is in
+	// the description and the details
+	message := f.Message
+	if len(message) > opsgenieMaxMessage {
+		message = message[:opsgenieMaxMessage-3] + "..."
+	}
+	details := map[string]string{
+		"kind":     f.Kind,
+		"name":     f.Name,
+		"ip":       f.IP,
+		"proto":    f.Proto,
+		"severity": f.Severity,
+	}
+	if f.Port != "" {
+		details["port"] = f.Port
+	}
+	if f.Service != "" {
+		details["service"] = f.Service
+	}
+	for k, v := range f.Labels {
+		details["label_"+k] = v
+	}
+	priority, ok := opsgeniePriorities[f.Severity]
+	if !ok {
+		priority = opsgeniePriorities[SeverityWarning]
+	}
+	return o.post(o.URL+"/v2/alerts", opsgenieAlert{
+		Message:     message,
+		Alias:       alias,
+		Description: f.Message,
+		Entity:      f.Name,
+		Source:      defaultSource,
+		Priority:    priority,
+		Tags:        o.tags,
+		Details:     details,
+	})
+}
+
+// post sends a request to the Opsgenie API.
+func (o *Opsgenie) post(u string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "GenieKey "+o.apiKey)
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Opsgenie returned status %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpsgenie_Notify(t *testing.T) {
+	f := Finding{
+		Kind:     KindUnexpectedOpen,
+		Name:     "db",
+		IP:       "10.0.0.1",
+		Port:     "3306",
+		Proto:    ProtoTCP,
+		Severity: SeverityCritical,
+		Message:  "port 3306 of db (10.0.0.1) is open",
+		Labels:   map[string]string{"owner": "data"},
+		Time:     time.Now(),
+	}
+	resolved := f
+	resolved.Resolved = true
+	long := f
+	long.Severity = SeverityInfo
+	long.Message = strings.Repeat("x", 200)
+
+	tests := []struct {
+		name         string
+		finding      Finding
+		wantPath     string
+		wantQuery    string
+		wantPriority string
+		wantMessage  string
+	}{
+		{name: "create", finding: f, wantPath: "/v2/alerts", wantPriority: "P1", wantMessage: f.Message},
+		{name: "close", finding: resolved, wantPath: "/v2/alerts/scan-exporter:unexpected_open:db:10.0.0.1:3306/close", wantQuery: "identifierType=alias"},
+		{name: "truncated", finding: long, wantPath: "/v2/alerts", wantPriority: "P5", wantMessage: strings.Repeat("x", 127) + "..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path, query, auth string
+			var alert opsgenieAlert
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path, query, auth = r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization")
+				json.NewDecoder(r.Body).Decode(&alert)
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer srv.Close()
+
+			o := NewOpsgenie(srv.URL+"/", "secret", []string{"scan"})
+			if err := o.Notify(tt.finding); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			if path != tt.wantPath || query != tt.wantQuery {
+				t.Errorf("got request to %s?%s, want %s?%s", path, query, tt.wantPath, tt.wantQuery)
+			}
+			if auth != "GenieKey secret" {
+				t.Errorf("got authorization %q, want the API key", auth)
+			}
+			if tt.finding.Resolved {
+				return
+			}
+			if alert.Alias != "scan-exporter:unexpected_open:db:10.0.0.1:3306" {
+				t.Errorf("got alias %s, want it keyed by target and port", alert.Alias)
+			}
+			if alert.Priority != tt.wantPriority {
+				t.Errorf("got priority %s, want %s", alert.Priority, tt.wantPriority)
+			}
+			if alert.Message != tt.wantMessage {
+				t.Errorf("got message %q, want %q", alert.Message, tt.wantMessage)
+			}
+			if alert.Details["label_owner"] != "data" || alert.Details["port"] != "3306" {
+				t.Errorf("got details %v, want the port and the labels of the finding", alert.Details)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// retryInitialDelay is the delay before the first retry of a failed
+	// notification. It doubles with each failure of the route.
+	retryInitialDelay = 5 * time.Second
+	// defaultRetryMaxDelay is the maximum delay between two retries when
+	// none is configured.
+	defaultRetryMaxDelay = 10 * time.Minute
+	// defaultRetryMaxAge is the time after which a notification which could
+	// not be delivered is dropped when none is configured.
+	defaultRetryMaxAge = 24 * time.Hour
+	// retryInterval is the interval at which the queue is checked for
+	// notifications to retry.
+	retryInterval = time.Second
+	// maxQueuedDeliveries is the maximum number of queued notifications. The
+	// oldest ones are dropped beyond it.
+	maxQueuedDeliveries = 10000
+)
+
+// delivery is a notification of a finding to a route which could not be
+// delivered yet.
+type delivery struct {
+	Route   string    `json:"route"`
+	Finding Finding   `json:"finding"`
+	Queued  time.Time `json:"queued"`
+}
+
+// deliveryQueue holds the notifications which could not be delivered, until
+// their route is reachable again. Routes are retried with an exponential
+// backoff, and their notifications delivered in order. The queue is saved in a
+// file when it has a path, so that notifications survive restarts. It is only
+// used by the sending goroutine of the dispatcher.
+type deliveryQueue struct {
+	path     string
+	maxDelay time.Duration
+	maxAge   time.Duration
+	logger   zerolog.Logger
+
+	pending []delivery
+	// failures holds the number of consecutive failures of each route, and
+	// retryAt the time of its next attempt
+	failures map[string]int
+	retryAt  map[string]time.Time
+}
+
+// newDeliveryQueue creates a delivery queue from its configuration, which can
+// be nil, loading the notifications saved in its file.
+func newDeliveryQueue(c *config.Delivery, logger zerolog.Logger) (*deliveryQueue, error) {
+	q := &deliveryQueue{
+		maxDelay: defaultRetryMaxDelay,
+		maxAge:   defaultRetryMaxAge,
+		logger:   logger,
+		failures: make(map[string]int),
+		retryAt:  make(map[string]time.Time),
+	}
+	if c == nil {
+		return q, nil
+	}
+	var err error
+	if c.MaxDelay != "" {
+		if q.maxDelay, err = time.ParseDuration(c.MaxDelay); err != nil || q.maxDelay <= 0 {
+			return nil, fmt.Errorf("invalid maximum retry delay %q", c.MaxDelay)
+		}
+	}
+	if c.MaxAge != "" {
+		if q.maxAge, err = time.ParseDuration(c.MaxAge); err != nil || q.maxAge <= 0 {
+			return nil, fmt.Errorf("invalid maximum age %q", c.MaxAge)
+		}
+	}
+
+	q.path = c.QueueFile
+	if q.path == "" {
+		return q, nil
+	}
+	data, err := os.ReadFile(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &q.pending); err != nil {
+		return nil, fmt.Errorf("cannot read notifications from %s: %w", q.path, err)
+	}
+	return q, nil
+}
+
+// queued reports whether notifications are waiting to be delivered to a route,
+// in which case the following ones must be queued behind them.
+func (q *deliveryQueue) queued(route string) bool {
+	return slices.ContainsFunc(q.pending, func(d delivery) bool { return d.Route == route })
+}
+
+// push queues the notification of a finding to a route. A route which failed
+// is retried after a delay.
+func (q *deliveryQueue) push(route string, f Finding, failed bool, now time.Time) {
+	if failed {
+		q.fail(route, now)
+	}
+	q.pending = append(q.pending, delivery{Route: route, Finding: f, Queued: now})
+	if n := len(q.pending) - maxQueuedDeliveries; n > 0 {
+		q.logger.Error().Msgf("notification queue is full, dropping the %d oldest notifications", n)
+		q.pending = slices.Delete(q.pending, 0, n)
+	}
+	q.save()
+}
+
+// fail delays the next attempt to deliver notifications to a route after a
+// failure.
+func (q *deliveryQueue) fail(route string, now time.Time) {
+	delay := q.maxDelay
+	if n := q.failures[route]; n < 32 {
+		delay = min(retryInitialDelay<<n, q.maxDelay)
+	}
+	q.failures[route]++
+	q.retryAt[route] = now.Add(delay)
+}
+
+// retry delivers the queued notifications of the routes whose delay elapsed,
+// in order, using send. The notifications of a route stop being delivered at
+// its first failure. Notifications older than the maximum age, or to routes
+// which do not exist anymore, are dropped.
+func (q *deliveryQueue) retry(now time.Time, routes map[string]Route, send func(Route, Finding) error) {
+	if len(q.pending) == 0 {
+		return
+	}
+
+	failed := make(map[string]bool)
+	changed := false
+	q.pending = slices.DeleteFunc(q.pending, func(d delivery) bool {
+		r, ok := routes[d.Route]
+		switch {
+		case !ok:
+			q.logger.Warn().Str("route", d.Route).Str("name", d.Finding.Name).Str("ip", d.Finding.IP).Msgf("dropping %s notification to unknown route", d.Finding.Kind)
+		case now.Sub(d.Queued) > q.maxAge:
+			q.logger.Error().Str("route", d.Route).Str("name", d.Finding.Name).Str("ip", d.Finding.IP).Msgf("dropping %s notification which could not be delivered since %s", d.Finding.Kind, d.Queued.Format(time.RFC3339))
+		case failed[d.Route] || now.Before(q.retryAt[d.Route]):
+			return false
+		default:
+			if err := send(r, d.Finding); err != nil {
+				q.logger.Error().Err(err).Str("route", d.Route).Str("name", d.Finding.Name).Str("ip", d.Finding.IP).Msg("cannot send queued notification")
+				failed[d.Route] = true
+				q.fail(d.Route, now)
+				return false
+			}
+			delete(q.failures, d.Route)
+		}
+		changed = true
+		return true
+	})
+	if changed {
+		q.save()
+	}
+}
+
+// save writes the queue to its file, replacing it at once so that a crash
+// cannot leave it truncated.
+func (q *deliveryQueue) save() {
+	if q.path == "" {
+		return
+	}
+	if err := q.write(); err != nil {
+		q.logger.Error().Err(err).Msgf("cannot save notification queue to %s", q.path)
+	}
+}
+
+func (q *deliveryQueue) write() error {
+	data, err := json.Marshal(q.pending)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(q.path), filepath.Base(q.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), q.path)
+}
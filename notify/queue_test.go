@@ -0,0 +1,124 @@
+package notify
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+// flaky is a notifier failing while down is true.
+type flaky struct {
+	down     bool
+	attempts int
+	sent     []Finding
+}
+
+func (f *flaky) Notify(finding Finding) error {
+	f.attempts++
+	if f.down {
+		return errors.New("connection refused")
+	}
+	f.sent = append(f.sent, finding)
+	return nil
+}
+
+func TestDispatcher_deliver_retry(t *testing.T) {
+	n := &flaky{down: true}
+	queue, err := newDeliveryQueue(&config.Delivery{QueueFile: filepath.Join(t.TempDir(), "queue.json")}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	route := Route{Name: "hook", Notifier: n}
+	d := &Dispatcher{routes: []Route{route}, queue: queue, logger: zerolog.Nop()}
+	routes := map[string]Route{"hook": route}
+	send := func(r Route, f Finding) error { return r.Notifier.Notify(f) }
+
+	opened := Finding{Kind: KindUnexpectedOpen, Name: "db", IP: "10.0.0.1", Port: "3306"}
+	resolved := opened
+	resolved.Resolved = true
+	d.deliver(opened, time.Now())
+	d.deliver(resolved, time.Now())
+	if n.attempts != 1 {
+		t.Errorf("deliver() made %d attempts, want the resolution queued behind the failed finding", n.attempts)
+	}
+
+	// The route is retried once its delay elapsed
+	now := time.Now()
+	queue.retry(now.Add(time.Second), routes, send)
+	if n.attempts != 1 {
+		t.Errorf("retry() made %d attempts before the delay elapsed", n.attempts-1)
+	}
+	queue.retry(now.Add(retryInitialDelay+time.Second), routes, send)
+	if n.attempts != 2 {
+		t.Errorf("retry() made %d attempts, want 1 stopping at the first failure", n.attempts-1)
+	}
+
+	// Notifications survive restarts, and are delivered in order
+	restarted, err := newDeliveryQueue(&config.Delivery{QueueFile: queue.path}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	n.down = false
+	restarted.retry(now.Add(time.Minute), routes, send)
+	if len(n.sent) != 2 || n.sent[0].Resolved || !n.sent[1].Resolved {
+		t.Errorf("retry() sent %+v, want the finding then its resolution", n.sent)
+	}
+	if restarted.queued("hook") {
+		t.Errorf("queue still holds delivered notifications")
+	}
+}
+
+func Test_deliveryQueue_fail(t *testing.T) {
+	q, err := newDeliveryQueue(&config.Delivery{MaxDelay: "30s"}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i, want := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second} {
+		q.fail("hook", now)
+		if got := q.retryAt["hook"].Sub(now); got != want {
+			t.Errorf("failure %d: retry in %s, want %s", i+1, got, want)
+		}
+	}
+}
+
+func Test_deliveryQueue_retry_drop(t *testing.T) {
+	q, err := newDeliveryQueue(&config.Delivery{MaxAge: "1h"}, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	q.push("hook", Finding{Kind: KindUnexpectedOpen}, true, now.Add(-2*time.Hour))
+	q.push("removed", Finding{Kind: KindUnexpectedOpen}, true, now)
+
+	n := &flaky{}
+	q.retry(now.Add(time.Hour), map[string]Route{"hook": {Name: "hook", Notifier: n}}, func(r Route, f Finding) error { return r.Notifier.Notify(f) })
+	if n.attempts != 0 || len(q.pending) != 0 {
+		t.Errorf("retry() made %d attempts and kept %d notifications, want expired and unrouted ones dropped", n.attempts, len(q.pending))
+	}
+}
+
+func Test_newDeliveryQueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.Delivery
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "custom", conf: &config.Delivery{MaxDelay: "1m", MaxAge: "12h"}},
+		{name: "invalid max delay", conf: &config.Delivery{MaxDelay: "soon"}, wantErr: true},
+		{name: "negative max age", conf: &config.Delivery{MaxAge: "-1h"}, wantErr: true},
+		{name: "unreadable file", conf: &config.Delivery{QueueFile: t.TempDir()}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newDeliveryQueue(tt.conf, zerolog.Nop()); (err != nil) != tt.wantErr {
+				t.Errorf("newDeliveryQueue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
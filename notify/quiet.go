@@ -0,0 +1,113 @@
+package notify
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+// KindDigest is the kind of the findings gathering the findings held during
+// the quiet hours of a route.
+const KindDigest = "digest"
+
+// quietHours is a daily window during which the findings sent to a route,
+// except the critical ones, are held, and delivered as a digest at its end.
+type quietHours struct {
+	// start and end are minutes since midnight in loc. The window spans
+	// midnight when end is before start
+	start, end int
+	loc        *time.Location
+}
+
+// newQuietHours reads quiet hours from configuration. It returns nil if c is
+// nil.
+func newQuietHours(c *config.QuietHours) (*quietHours, error) {
+	if c == nil {
+		return nil, nil
+	}
+	q := &quietHours{loc: time.Local}
+	var err error
+	if q.start, err = minuteOfDay(c.Start); err != nil {
+		return nil, fmt.Errorf("invalid start: %w", err)
+	}
+	if q.end, err = minuteOfDay(c.End); err != nil {
+		return nil, fmt.Errorf("invalid end: %w", err)
+	}
+	if q.start == q.end {
+		return nil, fmt.Errorf("start and end are both %s", c.Start)
+	}
+	if c.Timezone != "" {
+		if q.loc, err = time.LoadLocation(c.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid timezone: %w", err)
+		}
+	}
+	return q, nil
+}
+
+// minuteOfDay parses a time of the day written as 15:04.
+func minuteOfDay(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time such as 22:30", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// active reports whether now is within the quiet hours.
+func (q *quietHours) active(now time.Time) bool {
+	if q == nil {
+		return false
+	}
+	local := now.In(q.loc)
+	m := local.Hour()*60 + local.Minute()
+	if q.start < q.end {
+		return m >= q.start && m < q.end
+	}
+	return m >= q.start || m < q.end
+}
+
+// holds reports whether a finding sent at now is held until the end of the
+// quiet hours. Critical findings, and their resolution, are never held.
+func (q *quietHours) holds(f Finding, now time.Time) bool {
+	return f.Severity != SeverityCritical && q.active(now)
+}
+
+// hold adds a finding to the held ones. A finding resolved during the quiet
+// hours cancels the one it resolves, so that the digest only holds what
+// changed over the window.
+func hold(held []Finding, f Finding) []Finding {
+	if f.Resolved {
+		for i, h := range held {
+			if !h.Resolved && h.IP == f.IP && h.key() == f.key() {
+				return append(held[:i], held[i+1:]...)
+			}
+		}
+	}
+	return append(held, f)
+}
+
+// digest creates the finding gathering the findings held during the quiet
+// hours of a route. Its severity is the highest of theirs.
+func digest(held []Finding, now time.Time) Finding {
+	severity := SeverityInfo
+	lines := make([]string, 0, len(held))
+	for _, f := range held {
+		if f.Severity == SeverityWarning {
+			severity = SeverityWarning
+		}
+		line := f.Message
+		if f.Resolved {
+			line = "resolved: " + line
+		}
+		lines = append(lines, "- "+line)
+	}
+	return Finding{
+		Kind:     KindDigest,
+		Severity: severity,
+		Message:  fmt.Sprintf("%d finding(s) held during quiet hours:\n%s", len(held), strings.Join(lines, "\n")),
+		Time:     now,
+		Findings: held,
+	}
+}
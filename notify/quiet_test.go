@@ -0,0 +1,99 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+func Test_quietHours_active(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.QuietHours
+		at      string
+		want    bool
+		wantErr bool
+	}{
+		{name: "overnight, evening", conf: config.QuietHours{Start: "22:00", End: "07:00"}, at: "23:30", want: true},
+		{name: "overnight, morning", conf: config.QuietHours{Start: "22:00", End: "07:00"}, at: "06:59", want: true},
+		{name: "overnight, end", conf: config.QuietHours{Start: "22:00", End: "07:00"}, at: "07:00", want: false},
+		{name: "overnight, day", conf: config.QuietHours{Start: "22:00", End: "07:00"}, at: "12:00", want: false},
+		{name: "lunch", conf: config.QuietHours{Start: "12:00", End: "14:00"}, at: "12:00", want: true},
+		{name: "after lunch", conf: config.QuietHours{Start: "12:00", End: "14:00"}, at: "15:00", want: false},
+		{name: "timezone", conf: config.QuietHours{Start: "22:00", End: "07:00", Timezone: "Asia/Tokyo"}, at: "14:00", want: true},
+		{name: "invalid start", conf: config.QuietHours{Start: "10pm", End: "07:00"}, wantErr: true},
+		{name: "empty window", conf: config.QuietHours{Start: "07:00", End: "07:00"}, wantErr: true},
+		{name: "unknown timezone", conf: config.QuietHours{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Times are given in UTC, rather than in the local timezone
+			if tt.conf.Timezone == "" {
+				tt.conf.Timezone = "UTC"
+			}
+			q, err := newQuietHours(&tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newQuietHours() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			at, _ := time.Parse("2006-01-02 15:04", "2026-03-02 "+tt.at)
+			if got := q.active(at); got != tt.want {
+				t.Errorf("active(%s UTC) = %v, want %v", tt.at, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDispatcher_quietHours(t *testing.T) {
+	quiet, err := newQuietHours(&config.QuietHours{Start: "22:00", End: "07:00", Timezone: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &flaky{}
+	queue, _ := newDeliveryQueue(nil, zerolog.Nop())
+	d := &Dispatcher{routes: []Route{{Name: "chat", Notifier: n, quiet: quiet}}, queue: queue, logger: zerolog.Nop(), held: make(map[string][]Finding)}
+
+	night := time.Date(2026, 3, 2, 23, 0, 0, 0, time.UTC)
+	dev := Finding{Kind: KindUnexpectedOpen, Name: "app", IP: "10.0.0.1", Port: "8080", Severity: SeverityWarning, Message: "8080 open"}
+	debug := Finding{Kind: KindUnexpectedOpen, Name: "app", IP: "10.0.0.1", Port: "6060", Severity: SeverityInfo, Message: "6060 open"}
+	debugResolved := debug
+	debugResolved.Resolved = true
+	mysql := Finding{Kind: KindUnexpectedOpen, Name: "db", IP: "10.0.0.2", Port: "3306", Severity: SeverityCritical, Message: "3306 open"}
+
+	d.deliver(dev, night)
+	d.deliver(debug, night)
+	d.deliver(mysql, night.Add(time.Hour))
+	d.deliver(debugResolved, night.Add(2*time.Hour))
+	if len(n.sent) != 1 || n.sent[0].Port != "3306" {
+		t.Fatalf("deliver() during quiet hours sent %+v, want the critical finding only", n.sent)
+	}
+
+	// The digest is sent once the quiet hours end, without the finding
+	// resolved in the meantime
+	d.releaseDigests(time.Date(2026, 3, 3, 6, 59, 0, 0, time.UTC))
+	if len(n.sent) != 1 {
+		t.Fatalf("releaseDigests() sent %d notifications during quiet hours", len(n.sent)-1)
+	}
+	d.releaseDigests(time.Date(2026, 3, 3, 7, 0, 0, 0, time.UTC))
+	if len(n.sent) != 2 {
+		t.Fatalf("releaseDigests() sent %d notifications, want a digest", len(n.sent)-1)
+	}
+	got := n.sent[1]
+	if got.Kind != KindDigest || got.Severity != SeverityWarning || len(got.Findings) != 1 || got.Findings[0].Port != "8080" {
+		t.Errorf("releaseDigests() sent %+v, want a warning digest of port 8080", got)
+	}
+	d.releaseDigests(time.Date(2026, 3, 3, 7, 1, 0, 0, time.UTC))
+	if len(n.sent) != 2 {
+		t.Errorf("releaseDigests() sent the digest twice")
+	}
+
+	// Out of quiet hours, findings are sent at once
+	d.deliver(dev, time.Date(2026, 3, 3, 12, 0, 0, 0, time.UTC))
+	if len(n.sent) != 3 {
+		t.Errorf("deliver() out of quiet hours held the finding")
+	}
+}
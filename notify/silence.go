@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Errors returned by the silences store.
+var (
+	// ErrInvalidSilence is returned when adding a silence without target, or
+	// which cannot start before it ends.
+	ErrInvalidSilence = errors.New("invalid silence")
+	// ErrSilenceNotFound is returned when deleting an unknown or expired
+	// silence.
+	ErrSilenceNotFound = errors.New("silence not found")
+)
+
+// Silence suppresses the notifications of the findings of a target until it
+// ends. An empty port or proto matches all of them.
+type Silence struct {
+	ID string `json:"id"`
+	// Target is the name or the IP address of the silenced target
+	Target    string    `json:"target"`
+	Port      string    `json:"port,omitempty"`
+	Proto     string    `json:"proto,omitempty"`
+	Comment   string    `json:"comment"`
+	CreatedBy string    `json:"created_by"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+}
+
+// matches reports whether the silence applies to a finding at a given time.
+func (s Silence) matches(f Finding, now time.Time) bool {
+	if now.Before(s.StartsAt) || !now.Before(s.EndsAt) {
+		return false
+	}
+	if s.Target != f.Name && s.Target != f.IP {
+		return false
+	}
+	return (s.Port == "" || s.Port == f.Port) && (s.Proto == "" || s.Proto == f.Proto)
+}
+
+// Silences holds the silences, and saves them in a file when it has a path so
+// that they survive restarts. It is safe for concurrent use.
+type Silences struct {
+	path string
+
+	mu       sync.Mutex
+	silences []Silence
+}
+
+// NewSilences creates a silences store saved in the file at path, loading the
+// silences it holds. An empty path keeps silences in memory only.
+func NewSilences(path string) (*Silences, error) {
+	s := &Silences{path: path}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.silences); err != nil {
+		return nil, fmt.Errorf("cannot read silences from %s: %w", path, err)
+	}
+	s.expire(time.Now())
+	return s, nil
+}
+
+// Add validates a silence, gives it an ID and saves it. A zero start time
+// starts the silence now.
+func (s *Silences) Add(silence Silence) (Silence, error) {
+	now := time.Now()
+	if silence.Target == "" {
+		return Silence{}, fmt.Errorf("%w: no target provided", ErrInvalidSilence)
+	}
+	if silence.StartsAt.IsZero() {
+		silence.StartsAt = now
+	}
+	if !silence.EndsAt.After(silence.StartsAt) || !silence.EndsAt.After(now) {
+		return Silence{}, fmt.Errorf("%w: it must end in the future, after it starts", ErrInvalidSilence)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Silence{}, err
+	}
+	silence.ID = hex.EncodeToString(id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(now)
+	silences := append(slices.Clone(s.silences), silence)
+	if err := s.save(silences); err != nil {
+		return Silence{}, err
+	}
+	s.silences = silences
+	return silence, nil
+}
+
+// Delete removes a silence, ending it before its time.
+func (s *Silences) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(time.Now())
+
+	i := slices.IndexFunc(s.silences, func(silence Silence) bool { return silence.ID == id })
+	if i < 0 {
+		return ErrSilenceNotFound
+	}
+	silences := slices.Delete(slices.Clone(s.silences), i, i+1)
+	if err := s.save(silences); err != nil {
+		return err
+	}
+	s.silences = silences
+	return nil
+}
+
+// List returns the silences which have not ended yet.
+func (s *Silences) List() []Silence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire(time.Now())
+	return slices.Clone(s.silences)
+}
+
+// Silenced reports whether a finding is silenced. It returns false on a nil
+// store.
+func (s *Silences) Silenced(f Finding) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	return slices.ContainsFunc(s.silences, func(silence Silence) bool { return silence.matches(f, now) })
+}
+
+// expire removes the silences which ended. Expired silences are saved with the
+// next change. It must be called with the lock held.
+func (s *Silences) expire(now time.Time) {
+	s.silences = slices.DeleteFunc(s.silences, func(silence Silence) bool { return !now.Before(silence.EndsAt) })
+}
+
+// save writes silences to the file, replacing it at once so that a crash
+// cannot leave it truncated. It must be called with the lock held.
+func (s *Silences) save(silences []Silence) error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(silences)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("cannot save silences: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("cannot save silences: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("cannot save silences: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("cannot save silences: %w", err)
+	}
+	return nil
+}
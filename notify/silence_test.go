@@ -0,0 +1,127 @@
+package notify
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSilence_matches(t *testing.T) {
+	now := time.Now()
+	f := Finding{Kind: KindUnexpectedOpen, Name: "web", IP: "10.0.0.1", Port: "22", Proto: ProtoTCP}
+	tests := []struct {
+		name    string
+		silence Silence
+		want    bool
+	}{
+		{name: "target name", silence: Silence{Target: "web"}, want: true},
+		{name: "target IP", silence: Silence{Target: "10.0.0.1"}, want: true},
+		{name: "other target", silence: Silence{Target: "db"}, want: false},
+		{name: "same port", silence: Silence{Target: "web", Port: "22", Proto: ProtoTCP}, want: true},
+		{name: "other port", silence: Silence{Target: "web", Port: "80"}, want: false},
+		{name: "other proto", silence: Silence{Target: "web", Proto: "udp"}, want: false},
+		{name: "ended", silence: Silence{Target: "web", StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)}, want: false},
+		{name: "not started", silence: Silence{Target: "web", StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.silence.EndsAt.IsZero() {
+				tt.silence.StartsAt, tt.silence.EndsAt = now.Add(-time.Hour), now.Add(time.Hour)
+			}
+			if got := tt.silence.matches(f, now); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSilences_Add(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		silence Silence
+		wantErr bool
+	}{
+		{name: "valid", silence: Silence{Target: "web", EndsAt: now.Add(time.Hour)}},
+		{name: "no target", silence: Silence{EndsAt: now.Add(time.Hour)}, wantErr: true},
+		{name: "ended", silence: Silence{Target: "web", EndsAt: now.Add(-time.Hour)}, wantErr: true},
+		{name: "ends before start", silence: Silence{Target: "web", StartsAt: now.Add(2 * time.Hour), EndsAt: now.Add(time.Hour)}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSilences("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Add(tt.silence)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Add() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidSilence) {
+					t.Errorf("Add() error = %v, want ErrInvalidSilence", err)
+				}
+				return
+			}
+			if got.ID == "" || got.StartsAt.IsZero() {
+				t.Errorf("Add() = %+v, want an ID and a start time", got)
+			}
+		})
+	}
+}
+
+func TestSilences_persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "silences.json")
+	s, err := NewSilences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := s.Add(Silence{Target: "web", Comment: "maintenance", CreatedBy: "ops", EndsAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := s.Add(Silence{Target: "db", EndsAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(deleted.ID); !errors.Is(err, ErrSilenceNotFound) {
+		t.Errorf("Delete() error = %v, want ErrSilenceNotFound", err)
+	}
+
+	// Silences are loaded back after a restart
+	s, err = NewSilences(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.List()
+	if len(got) != 1 || got[0].ID != kept.ID || got[0].Comment != "maintenance" || got[0].CreatedBy != "ops" {
+		t.Errorf("List() = %+v, want the silence of web only", got)
+	}
+}
+
+func TestDispatcher_silenced(t *testing.T) {
+	rec := &recorder{}
+	d := NewDispatcher([]Route{{Name: "all", Notifier: rec}}, zerolog.Nop())
+	if _, err := d.Silences().Add(Silence{Target: "web", Port: "22", EndsAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	ssh := Finding{Kind: KindUnexpectedOpen, Name: "web", IP: "10.0.0.1", Port: "22", Proto: ProtoTCP}
+	mysql := Finding{Kind: KindUnexpectedOpen, Name: "web", IP: "10.0.0.1", Port: "3306", Proto: ProtoTCP}
+	d.Report("10.0.0.1", []Finding{ssh, mysql})
+
+	got := rec.wait(t, 1)
+	time.Sleep(20 * time.Millisecond)
+	rec.mu.Lock()
+	got = append(got, rec.findings...)
+	rec.mu.Unlock()
+	if len(got) != 1 || got[0].Port != "3306" {
+		t.Errorf("got %v, want port 3306 only", got)
+	}
+}
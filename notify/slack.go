@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// slackColors associates the severities of the findings with the colors of
+// the attachments. Resolved findings are green.
+var slackColors = map[string]string{
+	SeverityCritical: "danger",
+	SeverityWarning:  "warning",
+	SeverityInfo:     "#439fe0",
+}
+
+// Slack posts findings as messages to a Slack or Mattermost incoming webhook,
+// both accepting the same payloads.
+type Slack struct {
+	URL string
+	// channel overrides the channel of the webhook when not empty
+	channel string
+	client  *http.Client
+}
+
+// slackMessage is the payload of an incoming webhook.
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// slackAttachment holds the details of a finding.
+type slackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Fields   []slackField `json:"fields"`
+	Ts       int64        `json:"ts"`
+}
+
+// slackField is a detail of a finding.
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// NewSlack creates a Slack notifier. When channel is not empty, messages are
+// posted to it rather than to the channel of the webhook.
+func NewSlack(url, channel string) *Slack {
+	return &Slack{
+		URL:     url,
+		channel: channel,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// message formats a finding as a message.
+func (s *Slack) message(f Finding) slackMessage {
+	status, color := "["+f.Severity+"]", slackColors[f.Severity]
+	if f.Resolved {
+		status, color = "[resolved]", "good"
+	}
+	text := status + " " + f.Message
+
+	// Digests gather the findings of several targets, listed in their
+	// message
+	var fields []slackField
+	if f.IP != "" {
+		fields = append(fields, slackField{Title: "Target", Value: f.Name + " (" + f.IP + ")", Short: true})
+	}
+	if f.Port != "" {
+		fields = append(fields, slackField{Title: "Port", Value: f.Port + "/" + f.Proto, Short: true})
+	}
+	if f.Diff > 0 {
+		fields = append(fields, slackField{Title: "Diff", Value: strconv.Itoa(f.Diff) + " port(s) changed", Short: true})
+	}
+	if f.ScanDuration > 0 {
+		d := time.Duration(f.ScanDuration * float64(time.Second)).Round(time.Millisecond)
+		fields = append(fields, slackField{Title: "Scan duration", Value: d.String(), Short: true})
+	}
+
+	return slackMessage{
+		Channel:  s.channel,
+		Username: defaultSource,
+		Text:     text,
+		Attachments: []slackAttachment{{
+			Fallback: text,
+			Color:    color,
+			Fields:   fields,
+			Ts:       f.Time.Unix(),
+		}},
+	}
+}
+
+// Notify posts the finding to the webhook.
+func (s *Slack) Notify(f Finding) error {
+	body, err := json.Marshal(s.message(f))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack returned status %s", resp.Status)
+	}
+	return nil
+}
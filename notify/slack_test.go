@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSlack_Notify(t *testing.T) {
+	f := Finding{
+		Kind:         KindUnexpectedOpen,
+		Name:         "db",
+		IP:           "10.0.0.1",
+		Port:         "3306",
+		Proto:        ProtoTCP,
+		Severity:     SeverityCritical,
+		Message:      "db (10.0.0.1) unexpected open port 3306/tcp (mysql)",
+		Time:         time.Unix(1700000000, 0),
+		Diff:         2,
+		ScanDuration: 1.5,
+	}
+	resolved := f
+	resolved.Resolved = true
+
+	tests := []struct {
+		name        string
+		channel     string
+		finding     Finding
+		wantText    string
+		wantColor   string
+		wantChannel string
+	}{
+		{name: "open", finding: f, wantText: "[critical] " + f.Message, wantColor: "danger"},
+		{name: "resolved", finding: resolved, wantText: "[resolved] " + f.Message, wantColor: "good"},
+		{name: "channel", channel: "#db-alerts", finding: f, wantText: "[critical] " + f.Message, wantColor: "danger", wantChannel: "#db-alerts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var msg slackMessage
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&msg)
+			}))
+			defer srv.Close()
+
+			if err := NewSlack(srv.URL, tt.channel).Notify(tt.finding); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if msg.Text != tt.wantText || msg.Channel != tt.wantChannel {
+				t.Errorf("got text %q in channel %q, want %q in %q", msg.Text, msg.Channel, tt.wantText, tt.wantChannel)
+			}
+			if len(msg.Attachments) != 1 || msg.Attachments[0].Color != tt.wantColor {
+				t.Fatalf("got attachments %+v, want one colored %s", msg.Attachments, tt.wantColor)
+			}
+			fields := make(map[string]string)
+			for _, field := range msg.Attachments[0].Fields {
+				fields[field.Title] = field.Value
+			}
+			want := map[string]string{"Target": "db (10.0.0.1)", "Port": "3306/tcp", "Diff": "2 port(s) changed", "Scan duration": "1.5s"}
+			for title, value := range want {
+				if fields[title] != value {
+					t.Errorf("got field %s = %q, want %q", title, fields[title], value)
+				}
+			}
+		})
+	}
+}
+
+func TestSlack_Notify_error(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid_token", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	if err := NewSlack(srv.URL, "").Notify(Finding{Name: "db", IP: "10.0.0.1"}); err == nil {
+		t.Errorf("Notify() error = nil, want an error")
+	}
+}
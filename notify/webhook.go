@@ -0,0 +1,75 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// signatureHeader is the header holding the signature of the payloads of
+// webhooks.
+const signatureHeader = "X-Signature"
+
+// Webhook posts findings as JSON to an URL.
+type Webhook struct {
+	URL string
+	// secret signs the payloads when not empty
+	secret []byte
+	client *http.Client
+}
+
+// NewWebhook creates a webhook notifier. When secret is not empty, payloads
+// are signed with it.
+func NewWebhook(url, secret string) *Webhook {
+	return &Webhook{
+		URL:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Sign returns the signature of a payload: the HMAC-SHA256 of the payload
+// keyed by the secret, in hexadecimal and prefixed with "sha256=".
+func Sign(secret, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notify sends the finding to the webhook.
+func (w *Webhook) Notify(f Finding) error {
+	return w.post(f)
+}
+
+// post sends v as JSON to the webhook.
+func (w *Webhook) post(v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		req.Header.Set(signatureHeader, Sign(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %s", resp.Status)
+	}
+	return nil
+}
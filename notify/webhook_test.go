@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhook_Notify(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		signed bool
+	}{
+		{name: "unsigned"},
+		{name: "signed", secret: "s3cr3t", signed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			var signature string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = io.ReadAll(r.Body)
+				signature = r.Header.Get("X-Signature")
+			}))
+			defer srv.Close()
+
+			w := NewWebhook(srv.URL, tt.secret)
+			if err := w.Notify(Finding{Kind: KindUnexpectedOpen, Name: "db", IP: "10.0.0.1", Port: "3306"}); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			if !tt.signed {
+				if signature != "" {
+					t.Errorf("got signature %s without secret", signature)
+				}
+				return
+			}
+			if want := Sign([]byte(tt.secret), body); signature != want {
+				t.Errorf("got signature %s, want %s", signature, want)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	// Test case 2 of RFC 4231
+	got := Sign([]byte("Jefe"), []byte("what do ya want for nothing?"))
+	want := "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
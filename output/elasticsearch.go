@@ -0,0 +1,164 @@
+package output
+
+import (
+	"bytes"
+	"crypto/tls"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+// defaultIndex is the prefix of the indices when none is configured.
+const defaultIndex = "scan-exporter"
+
+// esTemplate holds the mappings of the indices. It is installed as an index
+// template at startup.
+//
+//go:embed elasticsearch-template.json
+var esTemplate []byte
+
+// Elasticsearch indexes events in Elasticsearch or OpenSearch, in daily indices
+// named <index>-YYYY.MM.DD.
+type Elasticsearch struct {
+	conf   *config.Elasticsearch
+	index  string
+	client *http.Client
+}
+
+// NewElasticsearch creates an Elasticsearch sink and installs the index
+// template. A failure to install the template is not fatal, as the cluster can
+// be unavailable at startup.
+func NewElasticsearch(conf *config.Elasticsearch, logger zerolog.Logger) (*Elasticsearch, error) {
+	if len(conf.URLs) == 0 {
+		return nil, errors.New("no URL provided for Elasticsearch")
+	}
+
+	es := &Elasticsearch{
+		conf:  conf,
+		index: conf.Index,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: conf.InsecureSkipVerify},
+			},
+		},
+	}
+	if es.index == "" {
+		es.index = defaultIndex
+	}
+
+	if err := es.installTemplate(); err != nil {
+		logger.Warn().Err(err).Msg("cannot install Elasticsearch index template")
+	}
+
+	return es, nil
+}
+
+// Name returns the name of the sink.
+func (es *Elasticsearch) Name() string {
+	return "elasticsearch"
+}
+
+// Send indexes the events using the bulk API.
+func (es *Elasticsearch) Send(events []Event) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, e := range events {
+		action := map[string]map[string]string{
+			"index": {"_index": es.index + "-" + e.Time.UTC().Format("2006.01.02")},
+		}
+		if err := enc.Encode(action); err != nil {
+			return err
+		}
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+
+	resp, err := es.do(http.MethodPost, "/_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return fmt.Errorf("cannot decode bulk response: %w", err)
+	}
+	if result.Errors {
+		for _, item := range result.Items {
+			for _, r := range item {
+				if len(r.Error) > 0 {
+					return fmt.Errorf("cannot index event: %s", r.Error)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// installTemplate creates or updates the index template of the indices.
+func (es *Elasticsearch) installTemplate() error {
+	var template map[string]any
+	if err := json.Unmarshal(esTemplate, &template); err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"index_patterns": []string{es.index + "-*"},
+		"template":       template,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = es.do(http.MethodPut, "/_index_template/"+es.index, "application/json", body)
+	return err
+}
+
+// do sends a request to the first URL that answers.
+func (es *Elasticsearch) do(method, path, contentType string, body []byte) ([]byte, error) {
+	var lastErr error
+	for _, u := range es.conf.URLs {
+		req, err := http.NewRequest(method, strings.TrimSuffix(u, "/")+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		switch {
+		case es.conf.APIKey != "":
+			req.Header.Set("Authorization", "ApiKey "+es.conf.APIKey)
+		case es.conf.Username != "":
+			req.SetBasicAuth(es.conf.Username, es.conf.Password)
+		}
+
+		resp, err := es.client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			return nil, fmt.Errorf("%s %s returned status %s: %s", method, path, resp.Status, data)
+		}
+		return data, nil
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,73 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/rs/zerolog"
+)
+
+func TestElasticsearch_Send(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		wantErr  bool
+	}{
+		{name: "indexed", response: `{"errors":false,"items":[]}`, wantErr: false},
+		{name: "rejected", response: `{"errors":true,"items":[{"index":{"error":{"type":"mapper_parsing_exception"}}}]}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var template bool
+			var indices []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/_index_template/scans":
+					template = true
+				case "/_bulk":
+					if r.Header.Get("Authorization") != "ApiKey secret" {
+						t.Errorf("missing API key")
+					}
+					sc := bufio.NewScanner(r.Body)
+					for i := 0; sc.Scan(); i++ {
+						if i%2 != 0 {
+							continue
+						}
+						var action map[string]map[string]string
+						json.Unmarshal(sc.Bytes(), &action)
+						indices = append(indices, action["index"]["_index"])
+					}
+					w.Write([]byte(tt.response))
+				}
+			}))
+			defer srv.Close()
+
+			es, err := NewElasticsearch(&config.Elasticsearch{URLs: []string{srv.URL}, Index: "scans", APIKey: "secret"}, zerolog.Nop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !template {
+				t.Errorf("index template not installed")
+			}
+
+			now := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+			err = es.Send([]Event{
+				ScanEvent(results.Scan{Name: "app", IP: "10.0.0.1", End: now}),
+				FindingEvent(notify.Finding{Kind: notify.KindUnexpectedOpen, IP: "10.0.0.1", Port: "22", Time: now}),
+			})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(indices) != 2 || indices[0] != "scans-2021.03.04" {
+				t.Errorf("Send() indexed in %v, want scans-2021.03.04", indices)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package output
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSONEvents writes scan results and findings to a stream as JSON objects, one
+// per line, so that they can be piped to tools such as jq, Vector or Fluent
+// Bit.
+type JSONEvents struct {
+	w io.Writer
+}
+
+// NewJSONEvents creates a sink writing the events to w.
+func NewJSONEvents(w io.Writer) *JSONEvents {
+	return &JSONEvents{w: w}
+}
+
+// Name returns the name of the sink.
+func (j *JSONEvents) Name() string {
+	return "json-events"
+}
+
+// Send writes the events. Events are sent by a single goroutine, so lines are
+// never interleaved.
+func (j *JSONEvents) Send(events []Event) error {
+	enc := json.NewEncoder(j.w)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func TestJSONEvents_Send(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONEvents(&buf)
+
+	now := time.Now()
+	events := []Event{
+		ScanEvent(results.Scan{Name: "app", IP: "10.0.0.1", End: now, Open: []string{"22"}}),
+		FindingEvent(notify.Finding{Kind: notify.KindUnexpectedOpen, Name: "app", IP: "10.0.0.1", Port: "8080", Time: now}),
+	}
+	if err := sink.Send(events); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := bufio.NewScanner(&buf)
+	var got []Event
+	for sc.Scan() {
+		var e Event
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("cannot decode line %q: %s", sc.Text(), err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Send() wrote %d lines, want 2", len(got))
+	}
+	if got[0].Type != TypeScan || got[0].Scan.Open[0] != "22" {
+		t.Errorf("Send() wrote %+v, want the scan event", got[0])
+	}
+	if got[1].Type != TypeFinding || got[1].Finding.Port != "8080" {
+		t.Errorf("Send() wrote %+v, want the finding event", got[1])
+	}
+}
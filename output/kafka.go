@@ -0,0 +1,295 @@
+package output
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/hamba/avro/v2"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	"github.com/twmb/franz-go/pkg/sr"
+)
+
+const (
+	// kafkaClientID identifies scan-exporter in the logs and quotas of the
+	// brokers.
+	kafkaClientID = "scan-exporter"
+	// kafkaTimeout bounds the publication of a batch of events, retries
+	// included.
+	kafkaTimeout = 30 * time.Second
+)
+
+// Formats of the Kafka messages.
+const (
+	kafkaFormatJSON = "json"
+	kafkaFormatAvro = "avro"
+)
+
+// kafkaAvroSchema is the schema of the events published in Avro. It holds the
+// main fields of the scan results and findings.
+const kafkaAvroSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "works.devops.scanexporter",
+  "fields": [
+    {"name": "type", "type": "string"},
+    {"name": "time", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "name", "type": "string"},
+    {"name": "ip", "type": "string"},
+    {"name": "scan", "default": null, "type": ["null", {
+      "type": "record",
+      "name": "Scan",
+      "fields": [
+        {"name": "range", "type": "string"},
+        {"name": "start", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+        {"name": "end", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+        {"name": "open", "type": {"type": "array", "items": "string"}},
+        {"name": "expected", "type": {"type": "array", "items": "string"}},
+        {"name": "services", "type": {"type": "map", "values": "string"}},
+        {"name": "flapping", "type": {"type": "array", "items": "string"}},
+        {"name": "suspect", "type": "boolean"}
+      ]
+    }]},
+    {"name": "finding", "default": null, "type": ["null", {
+      "type": "record",
+      "name": "Finding",
+      "fields": [
+        {"name": "kind", "type": "string"},
+        {"name": "port", "type": "string"},
+        {"name": "proto", "type": "string"},
+        {"name": "severity", "type": "string"},
+        {"name": "message", "type": "string"},
+        {"name": "service", "type": "string"},
+        {"name": "resolved", "type": "boolean"},
+        {"name": "flapping", "type": "boolean"}
+      ]
+    }]},
+    {"name": "labels", "type": {"type": "map", "values": "string"}}
+  ]
+}`
+
+// avroEvent is an event as encoded with kafkaAvroSchema.
+type avroEvent struct {
+	Type    string            `avro:"type"`
+	Time    time.Time         `avro:"time"`
+	Name    string            `avro:"name"`
+	IP      string            `avro:"ip"`
+	Scan    *avroScan         `avro:"scan"`
+	Finding *avroFinding      `avro:"finding"`
+	Labels  map[string]string `avro:"labels"`
+}
+
+type avroScan struct {
+	Range    string            `avro:"range"`
+	Start    time.Time         `avro:"start"`
+	End      time.Time         `avro:"end"`
+	Open     []string          `avro:"open"`
+	Expected []string          `avro:"expected"`
+	Services map[string]string `avro:"services"`
+	Flapping []string          `avro:"flapping"`
+	Suspect  bool              `avro:"suspect"`
+}
+
+type avroFinding struct {
+	Kind     string `avro:"kind"`
+	Port     string `avro:"port"`
+	Proto    string `avro:"proto"`
+	Severity string `avro:"severity"`
+	Message  string `avro:"message"`
+	Service  string `avro:"service"`
+	Resolved bool   `avro:"resolved"`
+	Flapping bool   `avro:"flapping"`
+}
+
+// Kafka publishes scan results and findings to a Kafka topic, keyed by the name
+// of their target so that the events of a target are kept in order in a single
+// partition. Messages are acknowledged by all the in-sync replicas. They are
+// encoded in JSON, or in Avro with a schema registered in a schema registry.
+type Kafka struct {
+	client *kgo.Client
+	// registry is nil when the events are published in JSON
+	registry *sr.Client
+	schema   avro.Schema
+	subject  string
+
+	// schemaID is the ID of the schema in the registry, registered before
+	// the first events are published, and again until it succeeds
+	mu       sync.Mutex
+	schemaID int
+}
+
+// NewKafka creates a Kafka sink. The brokers and the schema registry are only
+// reached when events are sent, as they can be unavailable at startup.
+func NewKafka(conf *config.Kafka) (*Kafka, error) {
+	if len(conf.Brokers) == 0 {
+		return nil, errors.New("no broker provided for Kafka")
+	}
+	if conf.Topic == "" {
+		return nil, errors.New("no topic provided for Kafka")
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(conf.Brokers...),
+		kgo.DefaultProduceTopic(conf.Topic),
+		kgo.ClientID(kafkaClientID),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+	}
+	if conf.TLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{InsecureSkipVerify: conf.InsecureSkipVerify}))
+	}
+	if conf.SASL != nil {
+		mechanism, err := kafkaSASL(conf.SASL)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.SASL(mechanism))
+	}
+
+	k := &Kafka{}
+	switch conf.Format {
+	case "", kafkaFormatJSON:
+	case kafkaFormatAvro:
+		if conf.SchemaRegistry == nil || conf.SchemaRegistry.URL == "" {
+			return nil, errors.New("no schema registry provided for Kafka Avro messages")
+		}
+		regOpts := []sr.ClientOpt{sr.URLs(conf.SchemaRegistry.URL), sr.UserAgent(kafkaClientID)}
+		if conf.SchemaRegistry.Username != "" {
+			regOpts = append(regOpts, sr.BasicAuth(conf.SchemaRegistry.Username, conf.SchemaRegistry.Password))
+		}
+		var err error
+		if k.registry, err = sr.NewClient(regOpts...); err != nil {
+			return nil, fmt.Errorf("cannot create schema registry client: %w", err)
+		}
+		k.schema = avro.MustParse(kafkaAvroSchema)
+		k.subject = conf.SchemaRegistry.Subject
+		if k.subject == "" {
+			// The subject of the TopicNameStrategy of Confluent serializers
+			k.subject = conf.Topic + "-value"
+		}
+	default:
+		return nil, fmt.Errorf("unknown Kafka format %q", conf.Format)
+	}
+
+	var err error
+	if k.client, err = kgo.NewClient(opts...); err != nil {
+		return nil, fmt.Errorf("cannot create Kafka client: %w", err)
+	}
+	return k, nil
+}
+
+// kafkaSASL returns the SASL mechanism authenticating to the brokers.
+func kafkaSASL(conf *config.KafkaSASL) (sasl.Mechanism, error) {
+	switch strings.ToUpper(conf.Mechanism) {
+	case "", "PLAIN":
+		return plain.Auth{User: conf.Username, Pass: conf.Password}.AsMechanism(), nil
+	case "SCRAM-SHA-256":
+		return scram.Auth{User: conf.Username, Pass: conf.Password}.AsSha256Mechanism(), nil
+	case "SCRAM-SHA-512":
+		return scram.Auth{User: conf.Username, Pass: conf.Password}.AsSha512Mechanism(), nil
+	}
+	return nil, fmt.Errorf("unknown Kafka SASL mechanism %q", conf.Mechanism)
+}
+
+// Name returns the name of the sink.
+func (k *Kafka) Name() string {
+	return "kafka"
+}
+
+// Send publishes the events, and waits for their acknowledgement. The client
+// retries on failures, and follows the leaders of the partitions when they
+// move.
+func (k *Kafka) Send(events []Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaTimeout)
+	defer cancel()
+
+	records := make([]*kgo.Record, 0, len(events))
+	for _, e := range events {
+		value, err := k.encode(ctx, e)
+		if err != nil {
+			return err
+		}
+		records = append(records, &kgo.Record{Key: []byte(e.Name()), Value: value, Timestamp: e.Time})
+	}
+	return k.client.ProduceSync(ctx, records...).FirstErr()
+}
+
+// encode returns the message of an event.
+func (k *Kafka) encode(ctx context.Context, e Event) ([]byte, error) {
+	if k.registry == nil {
+		return json.Marshal(e)
+	}
+
+	id, err := k.registerSchema(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Messages start with the header of the Confluent wire format, holding
+	// the ID of their schema
+	var header sr.ConfluentHeader
+	b, err := header.AppendEncode(nil, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	value, err := avro.Marshal(k.schema, toAvro(e))
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode event in Avro: %w", err)
+	}
+	return append(b, value...), nil
+}
+
+// registerSchema registers the schema of the events in the registry, unless
+// it is already, and returns its ID.
+func (k *Kafka) registerSchema(ctx context.Context) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.schemaID != 0 {
+		return k.schemaID, nil
+	}
+	id, err := k.registry.RegisterSchema(ctx, k.subject, sr.Schema{Schema: kafkaAvroSchema, Type: sr.TypeAvro}, -1, -1)
+	if err != nil {
+		return 0, fmt.Errorf("cannot register Avro schema in subject %s: %w", k.subject, err)
+	}
+	k.schemaID = id
+	return id, nil
+}
+
+// toAvro converts an event to the structure encoded with kafkaAvroSchema.
+func toAvro(e Event) avroEvent {
+	a := avroEvent{Type: e.Type, Time: e.Time, Name: e.Name(), IP: e.IP()}
+	if s := e.Scan; s != nil {
+		a.Labels = s.Labels
+		a.Scan = &avroScan{
+			Range:    s.Range,
+			Start:    s.Start,
+			End:      s.End,
+			Open:     s.Open,
+			Expected: s.Expected,
+			Services: s.Services,
+			Flapping: s.Flapping,
+			Suspect:  s.Suspect,
+		}
+	}
+	if f := e.Finding; f != nil {
+		a.Labels = f.Labels
+		a.Finding = &avroFinding{
+			Kind:     f.Kind,
+			Port:     f.Port,
+			Proto:    f.Proto,
+			Severity: f.Severity,
+			Message:  f.Message,
+			Service:  f.Service,
+			Resolved: f.Resolved,
+			Flapping: f.Flapping,
+		}
+	}
+	return a
+}
@@ -0,0 +1,197 @@
+package output
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/hamba/avro/v2"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// newKafkaCluster starts an in-memory Kafka cluster holding the scans topic.
+func newKafkaCluster(t *testing.T, opts ...kfake.Opt) *kfake.Cluster {
+	t.Helper()
+	cluster, err := kfake.NewCluster(append([]kfake.Opt{kfake.NumBrokers(3), kfake.SeedTopics(4, "scans")}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster
+}
+
+// consume reads n records from the scans topic of a cluster.
+func consume(t *testing.T, cluster *kfake.Cluster, n int, opts ...kgo.Opt) []*kgo.Record {
+	t.Helper()
+	client, err := kgo.NewClient(append([]kgo.Opt{
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics("scans"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var records []*kgo.Record
+	for len(records) < n {
+		fetches := client.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("%d record(s) consumed, want %d", len(records), n)
+		}
+		records = append(records, fetches.Records()...)
+	}
+	return records
+}
+
+func testEvents() []Event {
+	now := time.Now().Truncate(time.Millisecond)
+	return []Event{
+		ScanEvent(results.Scan{Name: "app", IP: "10.0.0.1", End: now, Open: []string{"22"}, Labels: map[string]string{"owner": "web-team"}}),
+		ScanEvent(results.Scan{Name: "db", IP: "10.0.0.2", End: now.Add(time.Second), Open: []string{"5432"}}),
+		FindingEvent(notify.Finding{Kind: "unexpected_open", Name: "app", IP: "10.0.0.1", Port: "22", Proto: notify.ProtoTCP, Time: now.Add(-time.Second)}),
+	}
+}
+
+func TestNewKafka(t *testing.T) {
+	brokers := []string{"localhost:9092"}
+	tests := []struct {
+		name    string
+		conf    *config.Kafka
+		wantErr bool
+	}{
+		{name: "valid", conf: &config.Kafka{Brokers: brokers, Topic: "scans"}},
+		{name: "tls", conf: &config.Kafka{Brokers: brokers, Topic: "scans", TLS: true}},
+		{name: "SASL", conf: &config.Kafka{Brokers: brokers, Topic: "scans", SASL: &config.KafkaSASL{Mechanism: "scram-sha-512", Username: "scanner"}}},
+		{name: "avro", conf: &config.Kafka{Brokers: brokers, Topic: "scans", Format: "avro", SchemaRegistry: &config.SchemaRegistry{URL: "http://localhost:8081"}}},
+		{name: "no broker", conf: &config.Kafka{Topic: "scans"}, wantErr: true},
+		{name: "no topic", conf: &config.Kafka{Brokers: brokers}, wantErr: true},
+		{name: "unknown SASL mechanism", conf: &config.Kafka{Brokers: brokers, Topic: "scans", SASL: &config.KafkaSASL{Mechanism: "GSSAPI"}}, wantErr: true},
+		{name: "unknown format", conf: &config.Kafka{Brokers: brokers, Topic: "scans", Format: "protobuf"}, wantErr: true},
+		{name: "avro without registry", conf: &config.Kafka{Brokers: brokers, Topic: "scans", Format: "avro"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewKafka(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewKafka() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKafka_Send(t *testing.T) {
+	cluster := newKafkaCluster(t, kfake.EnableSASL(), kfake.Superuser("SCRAM-SHA-256", "scanner", "secret"))
+	k, err := NewKafka(&config.Kafka{
+		Brokers: cluster.ListenAddrs()[:1],
+		Topic:   "scans",
+		SASL:    &config.KafkaSASL{Mechanism: "SCRAM-SHA-256", Username: "scanner", Password: "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := testEvents()
+	if err := k.Send(events); err != nil {
+		t.Fatal(err)
+	}
+
+	records := consume(t, cluster, len(events), kgo.SASL(scram.Auth{User: "scanner", Pass: "secret"}.AsSha256Mechanism()))
+	partitions := make(map[string]int32)
+	for _, r := range records {
+		var e Event
+		if err := json.Unmarshal(r.Value, &e); err != nil {
+			t.Fatalf("message is not a JSON event: %v", err)
+		}
+		if e.Name() != string(r.Key) {
+			t.Errorf("message about %s keyed by %s", e.Name(), r.Key)
+		}
+		if !r.Timestamp.Equal(e.Time) {
+			t.Errorf("message has timestamp %s, want %s", r.Timestamp, e.Time)
+		}
+		// The events of a target are kept in order in a single partition
+		if p, ok := partitions[string(r.Key)]; ok && p != r.Partition {
+			t.Errorf("messages of %s published to partitions %d and %d", r.Key, p, r.Partition)
+		}
+		partitions[string(r.Key)] = r.Partition
+	}
+}
+
+func TestKafka_Send_avro(t *testing.T) {
+	var registrations atomic.Int32
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/subjects/scans-value/versions" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Schema     string `json:"schema"`
+			SchemaType string `json:"schemaType"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Schema != kafkaAvroSchema {
+			t.Errorf("schema registered = %+v, %v, want the Avro schema of the events", body, err)
+		}
+		registrations.Add(1)
+		fmt.Fprint(w, `{"id": 7}`)
+	}))
+	defer registry.Close()
+
+	cluster := newKafkaCluster(t)
+	k, err := NewKafka(&config.Kafka{
+		Brokers:        cluster.ListenAddrs(),
+		Topic:          "scans",
+		Format:         "avro",
+		SchemaRegistry: &config.SchemaRegistry{URL: registry.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := testEvents()
+	if err := k.Send(events[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Send(events[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if n := registrations.Load(); n != 1 {
+		t.Errorf("schema registered %d times, want once", n)
+	}
+
+	schema := avro.MustParse(kafkaAvroSchema)
+	for _, r := range consume(t, cluster, len(events)) {
+		// Confluent wire format: magic byte and schema ID
+		if len(r.Value) < 5 || r.Value[0] != 0 || binary.BigEndian.Uint32(r.Value[1:5]) != 7 {
+			t.Fatalf("message does not start with the header of schema 7: %x", r.Value)
+		}
+		var e avroEvent
+		if err := avro.Unmarshal(schema, r.Value[5:], &e); err != nil {
+			t.Fatalf("message is not an Avro event: %v", err)
+		}
+		if e.Name != string(r.Key) || !e.Time.Equal(r.Timestamp) {
+			t.Errorf("message about %s at %s keyed by %s at %s", e.Name, e.Time, r.Key, r.Timestamp)
+		}
+		switch {
+		case e.Type == TypeScan && (e.Scan == nil || e.Finding != nil || len(e.Scan.Open) != 1):
+			t.Errorf("scan message = %+v, want the scan", e)
+		case e.Type == TypeFinding && (e.Finding == nil || e.Scan != nil || e.Finding.Port != "22"):
+			t.Errorf("finding message = %+v, want the finding", e)
+		}
+		if e.Name == "app" && e.Type == TypeScan && e.Labels["owner"] != "web-team" {
+			t.Errorf("scan message labels = %v, want the ones of the target", e.Labels)
+		}
+	}
+}
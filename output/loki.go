@@ -0,0 +1,117 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+// Loki pushes findings to Grafana Loki. Each finding is a log line, in a stream
+// labelled with its target, protocol and severity. Scan results are ignored.
+type Loki struct {
+	conf   *config.Loki
+	client *http.Client
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// NewLoki creates a Loki sink.
+func NewLoki(conf *config.Loki) (*Loki, error) {
+	if conf.URL == "" {
+		return nil, errors.New("no URL provided for Loki")
+	}
+	return &Loki{
+		conf:   conf,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Name returns the name of the sink.
+func (l *Loki) Name() string {
+	return "loki"
+}
+
+// Send pushes the findings using the push API.
+func (l *Loki) Send(events []Event) error {
+	streams := make(map[string]*lokiStream)
+	var keys []string
+	for _, e := range events {
+		if e.Finding == nil {
+			continue
+		}
+
+		labels := l.labels(e)
+		key := fmt.Sprint(labels)
+		s, ok := streams[key]
+		if !ok {
+			s = &lokiStream{Stream: labels}
+			streams[key] = s
+			keys = append(keys, key)
+		}
+
+		line, err := json.Marshal(e.Finding)
+		if err != nil {
+			return err
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), string(line)})
+	}
+	if len(streams) == 0 {
+		return nil
+	}
+
+	var push struct {
+		Streams []*lokiStream `json:"streams"`
+	}
+	for _, k := range keys {
+		push.Streams = append(push.Streams, streams[k])
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(l.conf.URL, "/")+"/loki/api/v1/push", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.conf.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.conf.TenantID)
+	}
+	if l.conf.Username != "" {
+		req.SetBasicAuth(l.conf.Username, l.conf.Password)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Loki returned status %s", resp.Status)
+	}
+	return nil
+}
+
+// labels returns the labels of the stream of a finding.
+func (l *Loki) labels(e Event) map[string]string {
+	labels := make(map[string]string, len(l.conf.Labels)+3)
+	for k, v := range l.conf.Labels {
+		labels[k] = v
+	}
+	labels["target"] = e.Finding.Name
+	labels["proto"] = e.Finding.Proto
+	labels["severity"] = e.Finding.Severity
+	return labels
+}
@@ -0,0 +1,67 @@
+package output
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func TestLoki_Send(t *testing.T) {
+	var pushed struct {
+		Streams []lokiStream `json:"streams"`
+	}
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/loki/api/v1/push" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("X-Scope-OrgID") != "soc" {
+			t.Errorf("missing tenant ID")
+		}
+		json.NewDecoder(r.Body).Decode(&pushed)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	l, err := NewLoki(&config.Loki{URL: srv.URL, TenantID: "soc", Labels: map[string]string{"job": "scan-exporter"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scan results only should not be pushed
+	if err := l.Send([]Event{ScanEvent(results.Scan{Name: "app"})}); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 0 {
+		t.Errorf("Send() pushed scan results")
+	}
+
+	now := time.Now()
+	err = l.Send([]Event{
+		ScanEvent(results.Scan{Name: "app"}),
+		FindingEvent(notify.Finding{Name: "app", Port: "22", Proto: notify.ProtoTCP, Severity: notify.SeverityCritical, Time: now}),
+		FindingEvent(notify.Finding{Name: "app", Port: "3306", Proto: notify.ProtoTCP, Severity: notify.SeverityCritical, Time: now}),
+		FindingEvent(notify.Finding{Name: "app", Port: "8080", Proto: notify.ProtoTCP, Severity: notify.SeverityWarning, Time: now}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pushed.Streams) != 2 {
+		t.Fatalf("Send() pushed %d streams, want 2", len(pushed.Streams))
+	}
+	s := pushed.Streams[0]
+	if s.Stream["target"] != "app" || s.Stream["proto"] != "tcp" || s.Stream["severity"] != "critical" || s.Stream["job"] != "scan-exporter" {
+		t.Errorf("Send() stream labels = %v", s.Stream)
+	}
+	if len(s.Values) != 2 {
+		t.Errorf("Send() pushed %d lines in first stream, want 2", len(s.Values))
+	}
+}
@@ -0,0 +1,108 @@
+package output
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// defaultNATSSubject is the prefix of the subjects when none is
+	// configured.
+	defaultNATSSubject = "scans"
+	// natsTimeout bounds the wait for the server to receive a batch of
+	// events.
+	natsTimeout = 30 * time.Second
+)
+
+// natsTokenEscaper replaces the characters which cannot appear in a token of
+// a subject, such as the separator of the tokens and the wildcards.
+var natsTokenEscaper = strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_", "\t", "_", "\r", "_", "\n", "_")
+
+// NATS publishes scan results on <subject>.<target>.<proto>, and findings, new
+// or resolved, on <subject>.<target>.<proto>.deviations, as JSON messages.
+type NATS struct {
+	conn    *nats.Conn
+	subject string
+}
+
+// NewNATS creates a NATS sink. When the server is unavailable, it is connected
+// in the background, and the events published meanwhile are buffered.
+func NewNATS(conf *config.NATS) (*NATS, error) {
+	if conf.URL == "" {
+		return nil, errors.New("no URL provided for NATS")
+	}
+	subject := conf.Subject
+	if subject == "" {
+		subject = defaultNATSSubject
+	}
+
+	opts := []nats.Option{
+		nats.Name("scan-exporter"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	}
+	if conf.Username != "" {
+		opts = append(opts, nats.UserInfo(conf.Username, conf.Password))
+	}
+	if conf.Token != "" {
+		opts = append(opts, nats.Token(conf.Token))
+	}
+	conn, err := nats.Connect(conf.URL, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot connect to NATS: %w", err)
+	}
+	return &NATS{conn: conn, subject: subject}, nil
+}
+
+// Name returns the name of the sink.
+func (n *NATS) Name() string {
+	return "nats"
+}
+
+// Send publishes the events, and waits for the server to receive them. While
+// the server is not connected, the events are buffered instead, until the
+// buffer of the client is full.
+func (n *NATS) Send(events []Event) error {
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := n.conn.Publish(n.subjectOf(e), data); err != nil {
+			return err
+		}
+	}
+	if !n.conn.IsConnected() {
+		return nil
+	}
+	return n.conn.FlushTimeout(natsTimeout)
+}
+
+// subjectOf returns the subject on which an event is published.
+func (n *NATS) subjectOf(e Event) string {
+	// Scans only cover TCP ports, while findings may be about pings
+	proto := notify.ProtoTCP
+	if e.Finding != nil && e.Finding.Proto != "" {
+		proto = e.Finding.Proto
+	}
+	subject := n.subject + "." + natsToken(e.Name()) + "." + proto
+	if e.Finding != nil {
+		subject += ".deviations"
+	}
+	return subject
+}
+
+// natsToken makes s a valid token of a subject.
+func natsToken(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return natsTokenEscaper.Replace(s)
+}
@@ -0,0 +1,152 @@
+package output
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+// natsMessage is a message received by a fake NATS server.
+type natsMessage struct {
+	subject string
+	data    []byte
+}
+
+// fakeNATS is a NATS server which records the published messages.
+type fakeNATS struct {
+	t  *testing.T
+	ln net.Listener
+
+	mu       sync.Mutex
+	messages []natsMessage
+	connect  map[string]any
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeNATS{t: t, ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	io.WriteString(conn, `INFO {"server_id":"fake","version":"2.10.0","proto":1,"max_payload":1048576}`+"\r\n")
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op, args, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		switch strings.ToUpper(op) {
+		case "CONNECT":
+			s.mu.Lock()
+			json.Unmarshal([]byte(args), &s.connect)
+			s.mu.Unlock()
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+		case "PUB":
+			fields := strings.Fields(args)
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, natsMessage{subject: fields[0], data: data[:size]})
+			s.mu.Unlock()
+		default:
+			s.t.Errorf("unexpected operation %q", line)
+		}
+	}
+}
+
+func TestNewNATS(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.NATS
+		wantErr bool
+	}{
+		// The server is connected in the background
+		{name: "unavailable server", conf: &config.NATS{URL: "nats://127.0.0.1:1"}},
+		{name: "no URL", conf: &config.NATS{}, wantErr: true},
+		{name: "invalid URL", conf: &config.NATS{URL: "nats://[::1"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := NewNATS(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewNATS() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if n == nil {
+				return
+			}
+			defer n.conn.Close()
+			if err := n.Send([]Event{ScanEvent(results.Scan{Name: "web"})}); err != nil {
+				t.Errorf("Send() error = %v, want the event buffered", err)
+			}
+		})
+	}
+}
+
+func TestNATS_Send(t *testing.T) {
+	srv := newFakeNATS(t)
+	n, err := NewNATS(&config.NATS{URL: "nats://" + srv.ln.Addr().String(), Username: "scanner", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer n.conn.Close()
+
+	now := time.Now()
+	events := []Event{
+		ScanEvent(results.Scan{Name: "web", IP: "10.0.0.1", End: now, Open: []string{"22"}}),
+		ScanEvent(results.Scan{Name: "db.prod", IP: "10.0.0.2", End: now}),
+		FindingEvent(notify.Finding{Kind: "unexpected_open", Name: "web", IP: "10.0.0.1", Port: "22", Proto: notify.ProtoTCP, Time: now}),
+		FindingEvent(notify.Finding{Kind: "host_down", Name: "web", IP: "10.0.0.1", Proto: notify.ProtoICMP, Time: now}),
+	}
+	if err := n.Send(events); err != nil {
+		t.Fatal(err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.connect["user"] != "scanner" || srv.connect["pass"] != "secret" {
+		t.Errorf("client connected with %v, want the credentials", srv.connect)
+	}
+	want := []string{"scans.web.tcp", "scans.db_prod.tcp", "scans.web.tcp.deviations", "scans.web.icmp.deviations"}
+	if len(srv.messages) != len(want) {
+		t.Fatalf("server received %d messages, want %d", len(srv.messages), len(want))
+	}
+	for i, m := range srv.messages {
+		if m.subject != want[i] {
+			t.Errorf("message %d published on %s, want %s", i, m.subject, want[i])
+		}
+		var e Event
+		if err := json.Unmarshal(m.data, &e); err != nil || e.Type != events[i].Type || e.Name() != events[i].Name() {
+			t.Errorf("message %d = %s, want event %+v", i, m.data, events[i])
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package output
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// Types of events.
+const (
+	TypeScan    = "scan"
+	TypeFinding = "finding"
+)
+
+const (
+	// queueSize is the number of events that can wait to be sent to a sink.
+	queueSize = 10000
+	// batchSize is the maximum number of events sent at once to a sink.
+	batchSize = 500
+	// flushInterval is the maximum time an event waits before being sent.
+	flushInterval = 5 * time.Second
+)
+
+// Event is either the result of a scan or a finding.
+type Event struct {
+	Type    string          `json:"type"`
+	Time    time.Time       `json:"@timestamp"`
+	Scan    *results.Scan   `json:"scan,omitempty"`
+	Finding *notify.Finding `json:"finding,omitempty"`
+}
+
+// ScanEvent creates an event from the result of a scan.
+func ScanEvent(scan results.Scan) Event {
+	return Event{Type: TypeScan, Time: scan.End, Scan: &scan}
+}
+
+// FindingEvent creates an event from a new or resolved finding.
+func FindingEvent(f notify.Finding) Event {
+	return Event{Type: TypeFinding, Time: f.Time, Finding: &f}
+}
+
+// Name returns the name of the target the event is about.
+func (e Event) Name() string {
+	if e.Scan != nil {
+		return e.Scan.Name
+	}
+	return e.Finding.Name
+}
+
+// IP returns the IP of the target the event is about.
+func (e Event) IP() string {
+	if e.Scan != nil {
+		return e.Scan.IP
+	}
+	return e.Finding.IP
+}
+
+// Sink sends events to an external system.
+type Sink interface {
+	Name() string
+	Send(events []Event) error
+}
+
+// Reasons why events are dropped.
+const (
+	dropQueueFull  = "queue_full"
+	dropSendFailed = "send_failed"
+)
+
+// Dispatcher sends the published events to all the sinks. Each sink has its own
+// queue, so a slow sink does not delay the others.
+type Dispatcher struct {
+	queues []*queue
+	// closing is closed to stop the sending goroutines, which are tracked
+	// by forwarding
+	closing    chan struct{}
+	forwarding sync.WaitGroup
+}
+
+// queue holds the events waiting to be sent to a sink.
+type queue struct {
+	sink   Sink
+	events chan Event
+	// full counts the events dropped because the queue was full since the
+	// last flush
+	full atomic.Int64
+}
+
+// NewDispatcher creates a dispatcher and starts a sending goroutine per sink.
+// Dropped events are counted in dropped, by sink and reason.
+func NewDispatcher(sinks []Sink, dropped *prometheus.CounterVec, logger zerolog.Logger) *Dispatcher {
+	d := &Dispatcher{closing: make(chan struct{})}
+	for _, sink := range sinks {
+		q := &queue{sink: sink, events: make(chan Event, queueSize)}
+		d.queues = append(d.queues, q)
+		d.forwarding.Add(1)
+		go func() {
+			defer d.forwarding.Done()
+			q.forward(d.closing, dropped, logger)
+		}()
+	}
+	return d
+}
+
+// Close sends the queued events and stops the sending goroutines. It waits for
+// the sinks until ctx is done. The events published afterwards are dropped
+// once the queues are full. It must only be called once.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	if d == nil {
+		return nil
+	}
+	close(d.closing)
+	done := make(chan struct{})
+	go func() {
+		d.forwarding.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Publish sends an event to all the sinks. If the queue of a sink is full, the
+// event is dropped for this sink.
+func (d *Dispatcher) Publish(e Event) {
+	if d == nil {
+		return
+	}
+	for _, q := range d.queues {
+		select {
+		case q.events <- e:
+		default:
+			q.full.Add(1)
+		}
+	}
+}
+
+// forward sends the events of the queue to the sink by batches. Once closing is
+// closed, it sends the queued events and returns.
+func (q *queue) forward(closing chan struct{}, dropped *prometheus.CounterVec, logger zerolog.Logger) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	name := q.sink.Name()
+	var batch []Event
+	flush := func() {
+		if n := q.full.Swap(0); n > 0 {
+			logger.Error().Str("sink", name).Msgf("queue is full, %d event(s) dropped", n)
+			dropped.WithLabelValues(name, dropQueueFull).Add(float64(n))
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := q.sink.Send(batch); err != nil {
+			logger.Error().Err(err).Str("sink", name).Msgf("cannot send %d event(s), dropping them", len(batch))
+			dropped.WithLabelValues(name, dropSendFailed).Add(float64(len(batch)))
+		}
+		batch = nil
+	}
+
+	for {
+		select {
+		case e := <-q.events:
+			batch = append(batch, e)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-closing:
+			for {
+				select {
+				case e := <-q.events:
+					batch = append(batch, e)
+					if len(batch) >= batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// New creates the sinks described in configuration and returns the dispatcher
+// that feeds them, along with the extra sinks.
+func New(conf config.Outputs, dropped *prometheus.CounterVec, logger zerolog.Logger, extra ...Sink) (*Dispatcher, error) {
+	sinks := extra
+
+	if conf.Elasticsearch != nil {
+		es, err := NewElasticsearch(conf.Elasticsearch, logger)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, es)
+	}
+
+	if conf.Loki != nil {
+		l, err := NewLoki(conf.Loki)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, l)
+	}
+
+	if conf.StatsD != nil {
+		s, err := NewStatsD(conf.StatsD)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+
+	if conf.Kafka != nil {
+		k, err := NewKafka(conf.Kafka)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, k)
+	}
+
+	if conf.Redis != nil {
+		r, err := NewRedis(conf.Redis)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, r)
+	}
+
+	if conf.NATS != nil {
+		n, err := NewNATS(conf.NATS)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, n)
+	}
+
+	return NewDispatcher(sinks, dropped, logger), nil
+}
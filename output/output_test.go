@@ -0,0 +1,58 @@
+package output
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/rs/zerolog"
+)
+
+func TestDispatcher_Publish_queueFull(t *testing.T) {
+	q := &queue{sink: &Loki{}, events: make(chan Event, 1)}
+	d := &Dispatcher{queues: []*queue{q}}
+
+	d.Publish(ScanEvent(results.Scan{Name: "app"}))
+	d.Publish(ScanEvent(results.Scan{Name: "app"}))
+	d.Publish(ScanEvent(results.Scan{Name: "app"}))
+
+	if len(q.events) != 1 {
+		t.Errorf("Publish() queued %d events, want 1", len(q.events))
+	}
+	if n := q.full.Load(); n != 2 {
+		t.Errorf("Publish() counted %d dropped events, want 2", n)
+	}
+}
+
+// recordingSink records the events it is sent.
+type recordingSink struct {
+	events chan Event
+}
+
+func (r *recordingSink) Name() string { return "recording" }
+
+func (r *recordingSink) Send(events []Event) error {
+	for _, e := range events {
+		r.events <- e
+	}
+	return nil
+}
+
+func TestDispatcher_Close(t *testing.T) {
+	sink := &recordingSink{events: make(chan Event, 10)}
+	d := NewDispatcher([]Sink{sink}, nil, zerolog.Nop())
+
+	// The events are sent on close rather than after the flush interval
+	for range 3 {
+		d.Publish(ScanEvent(results.Scan{Name: "app"}))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := d.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if n := len(sink.events); n != 3 {
+		t.Errorf("Close() sent %d events, want 3", n)
+	}
+}
@@ -0,0 +1,131 @@
+package output
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// defaultRedisPrefix is the prefix of the keys when none is configured.
+	defaultRedisPrefix = "scan-exporter"
+	// redisTimeout bounds the writes of a batch of events.
+	redisTimeout = 30 * time.Second
+)
+
+// Redis stores the latest scan results in Redis, so that other tools can query
+// the state of the targets. For each address of a target, it keeps:
+//   - <prefix>:open:<name>:<ip>, the set of its open ports,
+//   - <prefix>:scan:<name>:<ip>, its latest scan result in JSON,
+//   - <prefix>:history:<name>:<ip>, its latest scan results in JSON, the most
+//     recent first, when a history is configured.
+//
+// Findings are ignored.
+type Redis struct {
+	client  *redis.Client
+	prefix  string
+	history int
+	// ttl is the expiry of the keys, refreshed at each scan, so that the
+	// keys of removed targets do not linger. They never expire when it is 0
+	ttl time.Duration
+}
+
+// NewRedis creates a Redis sink. The server is only reached when events are
+// sent, as it can be unavailable at startup.
+func NewRedis(conf *config.Redis) (*Redis, error) {
+	if conf.Address == "" {
+		return nil, errors.New("no address provided for Redis")
+	}
+	if conf.History < 0 {
+		return nil, fmt.Errorf("invalid Redis history length %d", conf.History)
+	}
+
+	r := &Redis{prefix: conf.Prefix, history: conf.History}
+	if r.prefix == "" {
+		r.prefix = defaultRedisPrefix
+	}
+	if conf.TTL != "" {
+		var err error
+		if r.ttl, err = time.ParseDuration(conf.TTL); err != nil || r.ttl <= 0 {
+			return nil, fmt.Errorf("invalid Redis TTL %q", conf.TTL)
+		}
+	}
+
+	opts := &redis.Options{
+		Addr:     conf.Address,
+		Username: conf.Username,
+		Password: conf.Password,
+		DB:       conf.DB,
+	}
+	if conf.TLS {
+		opts.TLSConfig = &tls.Config{}
+	}
+	r.client = redis.NewClient(opts)
+	return r, nil
+}
+
+// Name returns the name of the sink.
+func (r *Redis) Name() string {
+	return "redis"
+}
+
+// key returns the key of the data of an address of a target.
+func (r *Redis) key(kind, name, ip string) string {
+	return r.prefix + ":" + kind + ":" + name + ":" + ip
+}
+
+// Send stores the scan results in a transaction, so that readers never see
+// the open ports of an address being replaced.
+func (r *Redis) Send(events []Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	pipe := r.client.TxPipeline()
+	var queued bool
+	for _, e := range events {
+		if e.Scan == nil {
+			continue
+		}
+		value, err := json.Marshal(e.Scan)
+		if err != nil {
+			return err
+		}
+
+		open := r.key("open", e.Scan.Name, e.Scan.IP)
+		pipe.Del(ctx, open)
+		if len(e.Scan.Open) > 0 {
+			ports := make([]any, len(e.Scan.Open))
+			for i, p := range e.Scan.Open {
+				ports[i] = p
+			}
+			pipe.SAdd(ctx, open, ports...)
+		}
+		latest := r.key("scan", e.Scan.Name, e.Scan.IP)
+		pipe.Set(ctx, latest, value, r.ttl)
+		keys := []string{open}
+		if r.history > 0 {
+			history := r.key("history", e.Scan.Name, e.Scan.IP)
+			pipe.LPush(ctx, history, value)
+			pipe.LTrim(ctx, history, 0, int64(r.history-1))
+			keys = append(keys, history)
+		}
+		if r.ttl > 0 {
+			for _, k := range keys {
+				pipe.Expire(ctx, k, r.ttl)
+			}
+		}
+		queued = true
+	}
+	if !queued {
+		return nil
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,115 @@
+package output
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func TestNewRedis(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.Redis
+		wantErr bool
+	}{
+		{name: "valid", conf: &config.Redis{Address: "localhost:6379", History: 10, TTL: "24h"}},
+		{name: "no address", conf: &config.Redis{}, wantErr: true},
+		{name: "negative history", conf: &config.Redis{Address: "localhost:6379", History: -1}, wantErr: true},
+		{name: "invalid TTL", conf: &config.Redis{Address: "localhost:6379", TTL: "1d"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRedis(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRedis() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedis_Send(t *testing.T) {
+	srv := miniredis.RunT(t)
+	r, err := NewRedis(&config.Redis{Address: srv.Addr(), Prefix: "scans", History: 2, TTL: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	scans := []results.Scan{
+		{Name: "app", IP: "10.0.0.1", End: now, Open: []string{"22", "80"}},
+		{Name: "app", IP: "10.0.0.1", End: now.Add(time.Minute), Open: []string{"80", "443"}},
+		{Name: "app", IP: "10.0.0.1", End: now.Add(2 * time.Minute), Open: []string{"443"}},
+		{Name: "db", IP: "10.0.0.2", End: now, Open: []string{"5432"}},
+	}
+	for _, s := range scans {
+		err := r.Send([]Event{
+			ScanEvent(s),
+			FindingEvent(notify.Finding{Name: s.Name, IP: s.IP, Port: "22", Time: now}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, _ := srv.Members("scans:open:app:10.0.0.1"); !reflect.DeepEqual(got, []string{"443"}) {
+		t.Errorf("open ports of app = %v, want [443]", got)
+	}
+	if got, _ := srv.Members("scans:open:db:10.0.0.2"); !reflect.DeepEqual(got, []string{"5432"}) {
+		t.Errorf("open ports of db = %v, want [5432]", got)
+	}
+
+	latest, err := srv.Get("scans:scan:app:10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s results.Scan
+	if err := json.Unmarshal([]byte(latest), &s); err != nil || !s.End.Equal(scans[2].End) {
+		t.Errorf("latest scan of app = %s, want the last one", latest)
+	}
+
+	// The history is capped
+	history, err := srv.List("scans:history:app:10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history of app holds %d scans, want 2", len(history))
+	}
+	if err := json.Unmarshal([]byte(history[1]), &s); err != nil || !s.End.Equal(scans[1].End) {
+		t.Errorf("oldest scan in the history of app = %s, want the second one", history[1])
+	}
+
+	// Keys expire unless the target is scanned again
+	for _, k := range []string{"scans:open:app:10.0.0.1", "scans:scan:app:10.0.0.1", "scans:history:app:10.0.0.1"} {
+		if ttl := srv.TTL(k); ttl != time.Hour {
+			t.Errorf("%s expires in %s, want 1h", k, ttl)
+		}
+	}
+
+	// Addresses without open ports have no set
+	if err := r.Send([]Event{ScanEvent(results.Scan{Name: "app", IP: "10.0.0.1", End: now})}); err != nil {
+		t.Fatal(err)
+	}
+	if srv.Exists("scans:open:app:10.0.0.1") {
+		t.Errorf("set of open ports of app still exists after a scan without open port")
+	}
+}
+
+func TestRedis_Send_unavailable(t *testing.T) {
+	srv := miniredis.RunT(t)
+	r, err := NewRedis(&config.Redis{Address: srv.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+
+	if err := r.Send([]Event{ScanEvent(results.Scan{Name: "app", IP: "10.0.0.1"})}); err == nil {
+		t.Errorf("Send() to an unavailable server succeeded")
+	}
+}
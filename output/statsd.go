@@ -0,0 +1,147 @@
+package output
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/devops-works/scan-exporter/config"
+)
+
+const (
+	// defaultStatsDHost and defaultStatsDPort are the address of the StatsD
+	// server when none is configured, the one of the Datadog agent.
+	defaultStatsDHost = "localhost"
+	defaultStatsDPort = 8125
+	// defaultStatsDPrefix is the prefix of the metrics when none is
+	// configured.
+	defaultStatsDPrefix = "scanexporter"
+	// statsDPacketSize is the maximum size of the datagrams, which fits in
+	// the MTU of most networks once the headers are added.
+	statsDPacketSize = 1432
+)
+
+// statsDEscaper replaces the characters delimiting the fields of the
+// DogStatsD lines in the tags.
+var statsDEscaper = strings.NewReplacer("|", "_", ",", "_", "#", "_", "\n", "_")
+
+// StatsD sends scan results as StatsD gauges, and findings as counters, tagged
+// in the DogStatsD format with their target.
+type StatsD struct {
+	prefix string
+	// tags holds the tags added to all the metrics, already formatted
+	tags []string
+	conn net.Conn
+}
+
+// NewStatsD creates a StatsD sink. Metrics are sent over UDP, so that a StatsD
+// server which is down does not delay the scans.
+func NewStatsD(conf *config.StatsD) (*StatsD, error) {
+	host, port, prefix := conf.Host, conf.Port, conf.Prefix
+	if host == "" {
+		host = defaultStatsDHost
+	}
+	if port == 0 {
+		port = defaultStatsDPort
+	}
+	if port < 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid StatsD port %d", port)
+	}
+	if prefix == "" {
+		prefix = defaultStatsDPrefix
+	}
+
+	conn, err := net.Dial("udp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot reach StatsD: %w", err)
+	}
+	return &StatsD{prefix: prefix, tags: statsDTags(conf.Tags), conn: conn}, nil
+}
+
+// Name returns the name of the sink.
+func (s *StatsD) Name() string {
+	return "statsd"
+}
+
+// Send sends the metrics of the events, packing as many lines as possible in
+// each datagram.
+func (s *StatsD) Send(events []Event) error {
+	var packet []byte
+	for _, e := range events {
+		for _, line := range s.lines(e) {
+			if len(packet) > 0 && len(packet)+1+len(line) > statsDPacketSize {
+				if _, err := s.conn.Write(packet); err != nil {
+					return err
+				}
+				packet = packet[:0]
+			}
+			if len(packet) > 0 {
+				packet = append(packet, '\n')
+			}
+			packet = append(packet, line...)
+		}
+	}
+	if len(packet) == 0 {
+		return nil
+	}
+	_, err := s.conn.Write(packet)
+	return err
+}
+
+// lines formats the metrics of an event. Scans report their numbers of open,
+// expected, unexpectedly open and unexpectedly closed ports, and their
+// duration. Findings increment the count of findings of their kind and
+// severity.
+func (s *StatsD) lines(e Event) []string {
+	if e.Finding != nil {
+		f := e.Finding
+		tags := s.withTags(f.Labels, "target", f.Name, "ip", f.IP, "kind", f.Kind,
+			"severity", f.Severity, "resolved", strconv.FormatBool(f.Resolved))
+		return []string{s.prefix + ".findings:1|c|#" + tags}
+	}
+
+	scan := e.Scan
+	open, expected := common.PortSetOf(scan.Open), common.PortSetOf(scan.Expected)
+	tags := s.withTags(scan.Labels, "target", scan.Name, "ip", scan.IP)
+	gauge := func(name string, value float64) string {
+		return s.prefix + "." + name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|g|#" + tags
+	}
+	return []string{
+		gauge("open_ports", float64(open.Len())),
+		gauge("expected_ports", float64(expected.Len())),
+		gauge("unexpected_open_ports", float64(open.Minus(expected).Len())),
+		gauge("unexpected_closed_ports", float64(expected.Minus(open).Len())),
+		gauge("scan_duration_seconds", scan.End.Sub(scan.Start).Round(time.Millisecond).Seconds()),
+	}
+}
+
+// withTags formats the tags of a metric: the tags of the sink, the labels of
+// the target and the given key and value pairs, which take precedence.
+func (s *StatsD) withTags(labels map[string]string, kv ...string) string {
+	merged := make(map[string]string, len(labels)+len(kv)/2)
+	maps.Copy(merged, labels)
+	for i := 0; i+1 < len(kv); i += 2 {
+		merged[kv[i]] = kv[i+1]
+	}
+	return strings.Join(append(slices.Clone(s.tags), statsDTags(merged)...), ",")
+}
+
+// statsDTags formats tags, sorted by key.
+func statsDTags(m map[string]string) []string {
+	tags := make([]string, 0, len(m))
+	for k, v := range m {
+		tags = append(tags, statsDTag(k, v))
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// statsDTag formats a tag.
+func statsDTag(k, v string) string {
+	return statsDEscaper.Replace(k) + ":" + statsDEscaper.Replace(v)
+}
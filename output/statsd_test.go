@@ -0,0 +1,116 @@
+package output
+
+import (
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func TestNewStatsD(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.StatsD
+		wantErr bool
+	}{
+		{name: "defaults", conf: &config.StatsD{}},
+		{name: "custom address", conf: &config.StatsD{Host: "127.0.0.1", Port: 9125}},
+		{name: "invalid port", conf: &config.StatsD{Port: 70000}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewStatsD(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewStatsD() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStatsD_Send(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	s, err := NewStatsD(&config.StatsD{Host: "127.0.0.1", Port: port, Prefix: "scans", Tags: map[string]string{"env": "prod"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	err = s.Send([]Event{
+		ScanEvent(results.Scan{
+			Name: "app", IP: "10.0.0.1", Start: start, End: start.Add(1500 * time.Millisecond),
+			Open: []string{"22", "80", "3306"}, Expected: []string{"22", "80", "443"},
+			Labels: map[string]string{"owner": "team|a", "target": "ignored"},
+		}),
+		FindingEvent(notify.Finding{Kind: "unexpected_open", Name: "app", IP: "10.0.0.1", Port: "3306", Severity: notify.SeverityCritical}),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, statsDPacketSize)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanTags := "|g|#env:prod,ip:10.0.0.1,owner:team_a,target:app"
+	want := []string{
+		"scans.open_ports:3" + scanTags,
+		"scans.expected_ports:3" + scanTags,
+		"scans.unexpected_open_ports:1" + scanTags,
+		"scans.unexpected_closed_ports:1" + scanTags,
+		"scans.scan_duration_seconds:1.5" + scanTags,
+		"scans.findings:1|c|#env:prod,ip:10.0.0.1,kind:unexpected_open,resolved:false,severity:critical,target:app",
+	}
+	if got := strings.Split(string(buf[:n]), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Send() sent\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStatsD_Send_split(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s, err := NewStatsD(&config.StatsD{Host: "127.0.0.1", Port: pc.LocalAddr().(*net.UDPAddr).Port})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The lines of the scans do not fit in a single datagram
+	var events []Event
+	for i := range 50 {
+		events = append(events, ScanEvent(results.Scan{Name: "app" + strconv.Itoa(i), IP: "10.0.0.1"}))
+	}
+	if err := s.Send(events); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines int
+	buf := make([]byte, 2*statsDPacketSize)
+	for lines < 5*len(events) {
+		pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("received %d lines, want %d: %v", lines, 5*len(events), err)
+		}
+		if n > statsDPacketSize {
+			t.Errorf("received a datagram of %d bytes, want at most %d", n, statsDPacketSize)
+		}
+		lines += len(strings.Split(string(buf[:n]), "\n"))
+	}
+}
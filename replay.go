@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/devops-works/scan-exporter/scan"
+)
+
+// recordedScan is a recorded scan result. It is either an event sent to the
+// outputs, holding the result in Event, or a bare scan result.
+type recordedScan struct {
+	Type  string        `json:"type"`
+	Event *results.Scan `json:"scan"`
+	results.Scan
+}
+
+// runReplay replays recorded scan results through the metrics and the
+// notifications, then keeps serving the metrics until scan-exporter is
+// stopped.
+// Usage: scan-exporter replay [-config <file>] [-speed <n>] [-notify] <results.json>
+func runReplay(args []string, stdout io.Writer) error {
+	const usage = "usage: scan-exporter replay [OPTIONS] <results.json>"
+
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	var confFile, metricAddr, loglvl string
+	var speed float64
+	var notifications bool
+	fs.StringVar(&confFile, "config", "", "path to config file holding the targets, severities and notifications")
+	fs.Float64Var(&speed, "speed", 60, "replay speed factor. 0 replays all the results at once")
+	fs.BoolVar(&notifications, "notify", false, "send findings to the notification routes of the configuration")
+	fs.StringVar(&metricAddr, "metric.addr", ":2112", "metric server addr")
+	fs.StringVar(&loglvl, "log.lvl", "info", "log level. Can be {trace,debug,info,warn,error,fatal}")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(usage)
+	}
+	if speed < 0 {
+		return errors.New("speed cannot be negative")
+	}
+
+	c := &config.Conf{}
+	if confFile != "" {
+		var err error
+		if c, err = config.New(confFile); err != nil {
+			return fmt.Errorf("error reading %s: %w", confFile, err)
+		}
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scans, err := readRecordedScans(f)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %w", fs.Arg(0), err)
+	}
+
+	scanner := scan.Scanner{
+		Logger:  logger.New(loglvl),
+		Results: results.New(),
+		Version: Version,
+	}
+	scanner.MetricsServ = *metrics.Init(metricAddr)
+	scanner.MetricsServ.Results = scanner.Results
+	scanner.MetricsServ.Version = Version
+
+	// Findings are only sent when asked, as replaying old results would
+	// notify about them again
+	if notifications {
+		scanner.MetricsServ.Notifier, err = notify.New(c.Notifications, scanner.Logger)
+		if err != nil {
+			return fmt.Errorf("cannot configure notifications: %w", err)
+		}
+	}
+
+	failed := make(chan error, 1)
+	go func() { failed <- scanner.MetricsServ.Start() }()
+
+	fmt.Fprintf(stdout, "replaying %d scans at speed %v\n", len(scans), speed)
+	if err := scanner.Replay(c, scans, speed); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "replay is over, serving metrics on %s\n", metricAddr)
+
+	return fmt.Errorf("metrics server failed: %w", <-failed)
+}
+
+// readRecordedScans reads JSON scan results, either as an array, as served by
+// the API, or as a stream of values. Each value is either an event as sent to
+// the outputs, in which case findings are skipped, or a bare scan result.
+func readRecordedScans(r io.Reader) ([]results.Scan, error) {
+	var records []recordedScan
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		err := dec.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if raw[0] == '[' {
+			var array []recordedScan
+			if err := json.Unmarshal(raw, &array); err != nil {
+				return nil, err
+			}
+			records = append(records, array...)
+			continue
+		}
+		var rec recordedScan
+		if err := json.Unmarshal(raw, &rec); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+
+	var scans []results.Scan
+	for _, rec := range records {
+		switch {
+		case rec.Event != nil:
+			scans = append(scans, *rec.Event)
+		case rec.Type == "" && rec.IP != "":
+			scans = append(scans, rec.Scan)
+		}
+	}
+	return scans, nil
+}
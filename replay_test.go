@@ -0,0 +1,42 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func Test_readRecordedScans(t *testing.T) {
+	input := `{"type":"scan","@timestamp":"2024-01-01T00:00:00Z","scan":{"name":"web","ip":"10.0.0.1","end":"2024-01-01T00:00:00Z","open":["80"],"expected":["80"]}}
+{"type":"finding","@timestamp":"2024-01-01T00:00:00Z","finding":{"kind":"unexpected_open","name":"web","ip":"10.0.0.1","port":"22"}}
+{"name":"db","ip":"10.0.0.2","end":"2024-01-01T01:00:00Z","open":["5432"]}
+`
+	got, err := readRecordedScans(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("readRecordedScans() error = %v", err)
+	}
+	want := []results.Scan{
+		{Name: "web", IP: "10.0.0.1", End: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Open: []string{"80"}, Expected: []string{"80"}},
+		{Name: "db", IP: "10.0.0.2", End: time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC), Open: []string{"5432"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readRecordedScans() = %+v, want %+v", got, want)
+	}
+
+	array := `[{"name":"web","ip":"10.0.0.1","end":"2024-01-01T00:00:00Z","open":["80"],"expected":["80"]},
+  {"name":"db","ip":"10.0.0.2","end":"2024-01-01T01:00:00Z","open":["5432"]}]`
+	got, err = readRecordedScans(strings.NewReader(array))
+	if err != nil {
+		t.Fatalf("readRecordedScans() of an array error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readRecordedScans() of an array = %+v, want %+v", got, want)
+	}
+
+	if _, err := readRecordedScans(strings.NewReader(`{"name":`)); err == nil {
+		t.Error("readRecordedScans() with truncated input should fail")
+	}
+}
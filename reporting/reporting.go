@@ -0,0 +1,148 @@
+package reporting
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/getsentry/sentry-go"
+)
+
+const (
+	// flushTimeout is the maximum time spent sending pending events before
+	// exiting.
+	flushTimeout = 2 * time.Second
+	// defaultThreshold is the number of occurrences of an error after which it
+	// is reported, when none is configured.
+	defaultThreshold = 3
+	// defaultInterval is the minimum time between two reports of the same
+	// error, when none is configured.
+	defaultInterval = "1h"
+)
+
+// tracked counts the occurrences of the errors since their last report. It is
+// nil until Init is called, so nothing is reported when Sentry is disabled.
+var tracked *repeats
+
+// repeats counts errors, indexed by message and target, and decides when they
+// must be reported.
+type repeats struct {
+	mu        sync.Mutex
+	threshold int
+	interval  time.Duration
+	counts    map[string]int
+	reported  map[string]time.Time
+}
+
+func newRepeats(threshold int, interval time.Duration) *repeats {
+	return &repeats{
+		threshold: threshold,
+		interval:  interval,
+		counts:    make(map[string]int),
+		reported:  make(map[string]time.Time),
+	}
+}
+
+// hit records an occurrence of an error and returns the number of occurrences
+// since its last report if it must be reported now, or 0. An error is reported
+// once it occurred threshold times, and at most once per interval.
+func (r *repeats) hit(key string, now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.counts[key]++
+	if r.counts[key] < r.threshold || now.Sub(r.reported[key]) < r.interval {
+		return 0
+	}
+
+	n := r.counts[key]
+	r.counts[key] = 0
+	r.reported[key] = now
+	return n
+}
+
+// Init configures the Sentry client. If conf is nil, reporting stays disabled
+// and the functions of this package do nothing. The returned function sends
+// the pending events.
+func Init(conf *config.Sentry, release string) (func(), error) {
+	if conf == nil {
+		return func() {}, nil
+	}
+	if conf.DSN == "" {
+		return nil, fmt.Errorf("no DSN provided for Sentry")
+	}
+
+	threshold := conf.Threshold
+	if threshold <= 0 {
+		threshold = defaultThreshold
+	}
+	rawInterval := conf.Interval
+	if rawInterval == "" {
+		rawInterval = defaultInterval
+	}
+	interval, err := time.ParseDuration(rawInterval)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse Sentry interval %s: %w", rawInterval, err)
+	}
+
+	err = sentry.Init(sentry.ClientOptions{
+		Dsn:         conf.DSN,
+		Environment: conf.Environment,
+		Release:     release,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot configure Sentry: %w", err)
+	}
+	tracked = newRepeats(threshold, interval)
+
+	return func() { sentry.Flush(flushTimeout) }, nil
+}
+
+// Error records an error of the scan subsystem. It is only reported once it
+// has been repeated enough times for the same target, identified by its name
+// and IP, which are attached to the event.
+func Error(err error, msg, name, ip string) {
+	if tracked == nil {
+		return
+	}
+	n := tracked.hit(msg+"/"+ip, time.Now())
+	if n == 0 {
+		return
+	}
+
+	sentry.WithScope(func(scope *sentry.Scope) {
+		setTarget(scope, name, ip)
+		scope.SetFingerprint([]string{msg, ip})
+		scope.SetContext("error", sentry.Context{"occurrences": n})
+		sentry.CaptureException(fmt.Errorf("%s: %w", msg, err))
+	})
+}
+
+// Recover reports a panic with the target it concerns, if any, then panics
+// again. It must be deferred at the start of goroutines.
+func Recover(name, ip string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	if tracked != nil {
+		sentry.WithScope(func(scope *sentry.Scope) {
+			setTarget(scope, name, ip)
+			sentry.CurrentHub().Recover(r)
+		})
+		sentry.Flush(flushTimeout)
+	}
+	panic(r)
+}
+
+// setTarget attaches the target an event is about to the scope.
+func setTarget(scope *sentry.Scope, name, ip string) {
+	if name == "" && ip == "" {
+		return
+	}
+	scope.SetTag("target.name", name)
+	scope.SetTag("target.ip", ip)
+	scope.SetContext("target", sentry.Context{"name": name, "ip": ip})
+}
@@ -0,0 +1,34 @@
+package reporting
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_repeats_hit(t *testing.T) {
+	start := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	tests := []struct {
+		name  string
+		key   string
+		after time.Duration
+		want  int
+	}{
+		{name: "first occurrence", key: "a", after: 0, want: 0},
+		{name: "second occurrence", key: "a", after: time.Minute, want: 0},
+		{name: "threshold reached", key: "a", after: 2 * time.Minute, want: 3},
+		{name: "other key", key: "b", after: 2 * time.Minute, want: 0},
+		{name: "within interval", key: "a", after: 3 * time.Minute, want: 0},
+		{name: "within interval again", key: "a", after: 4 * time.Minute, want: 0},
+		{name: "threshold reached within interval", key: "a", after: 5 * time.Minute, want: 0},
+		{name: "after interval", key: "a", after: 2*time.Minute + time.Hour, want: 4},
+	}
+
+	r := newRepeats(3, time.Hour)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.hit(tt.key, start.Add(tt.after)); got != tt.want {
+				t.Errorf("hit() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
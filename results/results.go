@@ -0,0 +1,105 @@
+package results
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/devops-works/scan-exporter/notify"
+)
+
+// Scan is the result of a TCP scan of a target.
+type Scan struct {
+	Name     string            `json:"name"`
+	IP       string            `json:"ip"`
+	Range    string            `json:"range"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Open     []string          `json:"open"`
+	Closed   []string          `json:"-"`
+	Expected []string          `json:"expected"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// Annotations describes what ports are used for, and Services the
+	// well-known services running on the open ports, indexed by port.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Services    map[string]string `json:"services,omitempty"`
+	// TTL is the TTL of the last echo reply of the target, and TCPWindow
+	// the TCP window advertised by its first open port. OSFamily is the OS
+	// family guessed from the TTL.
+	TTL       int    `json:"ttl,omitempty"`
+	TCPWindow int    `json:"tcp_window,omitempty"`
+	OSFamily  string `json:"os_family,omitempty"`
+	// MAC is the MAC address of targets on the local segment, and Vendor
+	// the vendor it is assigned to.
+	MAC    string `json:"mac,omitempty"`
+	Vendor string `json:"vendor,omitempty"`
+	// Country is the ISO code of the country of public targets, and ASN
+	// and ASOrg the number and the organization of their autonomous system.
+	Country string `json:"country,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+	// Owner identifies the netblock of public targets and its owner.
+	Owner *notify.Owner `json:"owner,omitempty"`
+	// Flapping holds the ports changing state too often, and HostFlapping
+	// is true when the target itself goes up and down too often.
+	Flapping     []string `json:"flapping,omitempty"`
+	HostFlapping bool     `json:"host_flapping,omitempty"`
+	// Suspect is true when no port was found open while some were before,
+	// which may be caused by a blackhole of the probes.
+	Suspect bool `json:"suspect,omitempty"`
+}
+
+// Store holds the latest scan of each target, and the summaries of its previous
+// scans. It is safe for concurrent use.
+type Store struct {
+	mu        sync.RWMutex
+	scans     map[string]Scan
+	summaries map[string][]Summary
+}
+
+// New creates an empty store.
+func New() *Store {
+	return &Store{scans: make(map[string]Scan), summaries: make(map[string][]Summary)}
+}
+
+// Set replaces the latest scan of the target.
+func (s *Store) Set(scan Scan) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scans[scan.IP] = scan
+}
+
+// Get returns the latest scan of the target with the given IP.
+func (s *Store) Get(ip string) (Scan, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	scan, ok := s.scans[ip]
+	return scan, ok
+}
+
+// Delete removes the scans of the target with the given IP, and their
+// summaries.
+func (s *Store) Delete(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.scans, ip)
+	delete(s.summaries, ip)
+}
+
+// All returns the latest scan of each target, sorted by name and IP.
+func (s *Store) All() []Scan {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scans := make([]Scan, 0, len(s.scans))
+	for _, scan := range s.scans {
+		scans = append(scans, scan)
+	}
+	sort.Slice(scans, func(i, j int) bool {
+		if scans[i].Name != scans[j].Name {
+			return scans[i].Name < scans[j].Name
+		}
+		return scans[i].IP < scans[j].IP
+	})
+	return scans
+}
@@ -0,0 +1,64 @@
+package results
+
+import (
+	"sort"
+	"time"
+
+	"github.com/devops-works/scan-exporter/notify"
+)
+
+// MaxSummaries is the number of summaries kept for each address of a target.
+const MaxSummaries = 100
+
+// Summary is a short account of a scan of one of the addresses of a target.
+type Summary struct {
+	// ID is the ID of the scan job, found in the logs and the traces.
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	IP       string    `json:"ip"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration float64   `json:"duration_seconds"`
+	// Open, Closed and Expected are the numbers of open, closed and
+	// expected ports.
+	Open     int              `json:"open"`
+	Closed   int              `json:"closed"`
+	Expected int              `json:"expected"`
+	Findings []notify.Finding `json:"findings,omitempty"`
+}
+
+// AddSummary records the summary of a scan. Only the latest MaxSummaries
+// summaries of each address are kept.
+func (s *Store) AddSummary(sum Summary) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sums := append(s.summaries[sum.IP], sum)
+	if len(sums) > MaxSummaries {
+		sums = sums[len(sums)-MaxSummaries:]
+	}
+	s.summaries[sum.IP] = sums
+}
+
+// Summaries returns the summaries of the latest scans of the target with the
+// given name, the most recent first. At most limit summaries are returned.
+func (s *Store) Summaries(name string, limit int) []Summary {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sums []Summary
+	for _, addrSums := range s.summaries {
+		for _, sum := range addrSums {
+			if sum.Name == name {
+				sums = append(sums, sum)
+			}
+		}
+	}
+	sort.SliceStable(sums, func(i, j int) bool {
+		return sums[i].Start.After(sums[j].Start)
+	})
+	if len(sums) > limit {
+		sums = sums[:limit]
+	}
+	return sums
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/devops-works/scan-exporter/scan"
+	"github.com/devops-works/scan-exporter/services"
+)
+
+// Exit codes of the scan subcommand.
+const (
+	scanCompliant = 0
+	scanDeviated  = 1
+	scanFailed    = 2
+)
+
+// scanReport is the result of a one-shot scan, rendered by the scan
+// subcommand.
+type scanReport struct {
+	results.Scan
+	Proto string `json:"proto"`
+	// Filtered holds the UDP ports which did not answer, which may be open
+	// or filtered.
+	Filtered []string `json:"open_filtered,omitempty"`
+	// Unexpected holds the open ports which are not expected, and Missing
+	// the expected ports which are closed.
+	Unexpected []string `json:"unexpected_open"`
+	Missing    []string `json:"unexpected_closed"`
+}
+
+// runScan scans the ports of a target once, prints its open ports and exits
+// with 1 if ports are unexpectedly open or closed, and 2 if the scan failed.
+// Usage: scan-exporter scan -target <ip> -ports <range> [-proto tcp] [-expected <range>] [-format {text,json}]
+func runScan(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("scan", flag.ContinueOnError)
+	var target, portList, proto, expectedList, format string
+	var timeout time.Duration
+	var workers int
+	fs.StringVar(&target, "target", "", "IP address of the scanned target")
+	fs.StringVar(&portList, "ports", "", "range of ports to scan")
+	fs.StringVar(&proto, "proto", notify.ProtoTCP, "protocol of the ports. Can be {tcp,udp}")
+	fs.StringVar(&expectedList, "expected", "", "range of ports expected to be open")
+	fs.StringVar(&format, "format", "text", "output format. Can be {text,json}")
+	fs.DurationVar(&timeout, "timeout", 2*time.Second, "probe timeout")
+	fs.IntVar(&workers, "workers", 64, "number of ports probed at the same time")
+	if err := fs.Parse(args); err != nil {
+		return &exitError{code: scanFailed, err: err}
+	}
+
+	fail := func(err error) error {
+		return &exitError{code: scanFailed, err: err}
+	}
+	if target == "" || portList == "" || fs.NArg() != 0 {
+		return fail(errors.New("usage: scan-exporter scan -target <ip> -ports <range> [OPTIONS]"))
+	}
+	if net.ParseIP(target) == nil {
+		return fail(fmt.Errorf("invalid IP address %q", target))
+	}
+	if proto != notify.ProtoTCP && proto != services.UDP {
+		return fail(fmt.Errorf("unsupported protocol %q", proto))
+	}
+	if format != "text" && format != "json" {
+		return fail(fmt.Errorf("unsupported format %q", format))
+	}
+	if workers < 1 {
+		return fail(errors.New("at least one worker is required"))
+	}
+	ports, err := scan.ParsePorts(portList)
+	if err != nil {
+		return fail(fmt.Errorf("invalid ports: %w", err))
+	}
+	if len(ports) == 0 {
+		return fail(errors.New("no ports to scan"))
+	}
+	expected, err := scan.ParsePorts(expectedList)
+	if err != nil {
+		return fail(fmt.Errorf("invalid expected ports: %w", err))
+	}
+
+	report := scanReport{
+		Scan:  results.Scan{Name: target, IP: target, Range: portList, Start: time.Now()},
+		Proto: proto,
+	}
+	if proto == services.UDP {
+		for _, r := range scan.ProbeUDP(target, ports, workers, timeout) {
+			switch r.State {
+			case scan.UDPOpen:
+				report.Open = append(report.Open, strconv.Itoa(r.Port))
+			case scan.UDPOpenFiltered:
+				report.Filtered = append(report.Filtered, strconv.Itoa(r.Port))
+			}
+		}
+	} else {
+		for _, r := range scan.Probe(target, ports, workers, timeout) {
+			if r.Open {
+				report.Open = append(report.Open, strconv.Itoa(r.Port))
+			}
+		}
+	}
+	report.End = time.Now()
+	report.deviations(expected)
+
+	if format == "json" {
+		err = json.NewEncoder(stdout).Encode(report)
+	} else {
+		err = report.write(stdout)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if len(report.Unexpected) > 0 || len(report.Missing) > 0 {
+		return &exitError{code: scanDeviated}
+	}
+	return nil
+}
+
+// deviations sets the expected ports of the report, and the ports which are
+// unexpectedly open or closed. Expected ports which may be open or filtered are
+// not reported as closed. Lists are never nil, so that they are rendered as
+// empty arrays in JSON.
+func (r *scanReport) deviations(expected []int) {
+	r.Open = append([]string{}, r.Open...)
+	r.Expected, r.Unexpected, r.Missing = []string{}, []string{}, []string{}
+	for _, p := range expected {
+		r.Expected = append(r.Expected, strconv.Itoa(p))
+	}
+
+	open, exp := common.PortSetOf(r.Open), common.NewPortSet(expected...)
+	for p := range open.Minus(exp).All() {
+		r.Unexpected = append(r.Unexpected, strconv.Itoa(p))
+	}
+	for p := range exp.Minus(open).Minus(common.PortSetOf(r.Filtered)).All() {
+		r.Missing = append(r.Missing, strconv.Itoa(p))
+	}
+	r.Services = services.Names(r.Proto, r.Open)
+}
+
+// write prints the report as text: the open ports and the expected closed
+// ones, followed by a summary.
+func (r scanReport) write(out io.Writer) error {
+	unexpected, missing := common.PortSetOf(r.Unexpected), common.PortSetOf(r.Missing)
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PORT\tSTATE\tSERVICE")
+	for _, port := range r.Open {
+		state := "open"
+		if unexpected.HasString(port) {
+			state = "unexpected"
+		}
+		fmt.Fprintf(w, "%s/%s\t%s\t%s\n", port, r.Proto, state, services.Name(r.Proto, port))
+	}
+	for _, port := range r.Filtered {
+		fmt.Fprintf(w, "%s/%s\t%s\t%s\n", port, r.Proto, scan.UDPOpenFiltered, services.Name(r.Proto, port))
+	}
+	for p := range missing.All() {
+		port := strconv.Itoa(p)
+		fmt.Fprintf(w, "%s/%s\t%s\t%s\n", port, r.Proto, "closed", services.Name(r.Proto, port))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(out, "\n%s: %d open, %d unexpected open, %d unexpected closed ports, scanned in %s\n",
+		r.IP, len(r.Open), len(r.Unexpected), len(r.Missing), r.End.Sub(r.Start).Round(time.Millisecond))
+	return err
+}
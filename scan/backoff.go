@@ -0,0 +1,161 @@
+package scan
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+// Defaults of the backoff settings.
+const (
+	defaultBackoffWindow     = 100
+	defaultBackoffMaxDelay   = "1s"
+	defaultBackoffRetryAfter = "10m"
+)
+
+// minBackoffDelay is the delay between two probes when the probe rate is
+// first slowed down without configured delay.
+const minBackoffDelay = time.Millisecond
+
+// backoffConf holds the parsed backoff settings of a target.
+type backoffConf struct {
+	// errorRate and abortRate are the shares of dial errors above which
+	// probes are slowed down and the scan is aborted. Zero disables them.
+	errorRate, abortRate float64
+	// window is the number of probes over which the dial errors are counted
+	window     int
+	maxDelay   time.Duration
+	retryAfter time.Duration
+}
+
+// readBackoff parses backoff settings. It returns nil if the backoff is
+// disabled.
+func readBackoff(c *config.Backoff) (*backoffConf, error) {
+	if c == nil || (c.ErrorRate == 0 && c.AbortRate == 0) {
+		return nil, nil
+	}
+	for _, rate := range []float64{c.ErrorRate, c.AbortRate} {
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("rate %v is not between 0 and 1", rate)
+		}
+	}
+	if c.Window < 0 {
+		return nil, fmt.Errorf("window %d cannot be negative", c.Window)
+	}
+
+	b := &backoffConf{errorRate: c.ErrorRate, abortRate: c.AbortRate, window: c.Window}
+	if b.window == 0 {
+		b.window = defaultBackoffWindow
+	}
+
+	maxDelay, retryAfter := c.MaxDelay, c.RetryAfter
+	if maxDelay == "" {
+		maxDelay = defaultBackoffMaxDelay
+	}
+	if retryAfter == "" {
+		retryAfter = defaultBackoffRetryAfter
+	}
+	var err error
+	if b.maxDelay, err = getDuration(maxDelay); err != nil {
+		return nil, fmt.Errorf("invalid max delay: %w", err)
+	}
+	if b.retryAfter, err = getDuration(retryAfter); err != nil {
+		return nil, fmt.Errorf("invalid retry delay: %w", err)
+	}
+	return b, nil
+}
+
+// backoff adapts the delay between the probes of a scan to the dial errors.
+// The errors are counted over consecutive windows of probes: after a window
+// with too many errors the delay is doubled, up to the maximum one, and after
+// a window below the error rate it is halved, down to the configured one.
+// It is safe for concurrent use.
+type backoff struct {
+	conf *backoffConf
+
+	mu              sync.Mutex
+	probes, errors  int
+	base, current   time.Duration
+	highest         time.Duration
+	aborted         bool
+	abortedErrorPct float64
+}
+
+// newBackoff creates the backoff of a scan whose probes are normally separated
+// by base. It returns nil if the backoff is disabled.
+func newBackoff(conf *backoffConf, base time.Duration) *backoff {
+	if conf == nil {
+		return nil
+	}
+	base = max(base, 0)
+	return &backoff{conf: conf, base: base, current: base, highest: base}
+}
+
+// observe records the outcome of a probe. It does nothing on a nil backoff.
+func (b *backoff) observe(failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probes++
+	if failed {
+		b.errors++
+	}
+	if b.probes < b.conf.window {
+		return
+	}
+
+	rate := float64(b.errors) / float64(b.probes)
+	b.probes, b.errors = 0, 0
+
+	switch {
+	case b.conf.abortRate > 0 && rate >= b.conf.abortRate:
+		if !b.aborted {
+			b.aborted = true
+			b.abortedErrorPct = rate * 100
+		}
+	case b.conf.errorRate > 0 && rate >= b.conf.errorRate:
+		b.current = min(max(b.current*2, minBackoffDelay), max(b.conf.maxDelay, b.base))
+		b.highest = max(b.highest, b.current)
+	default:
+		b.current /= 2
+		if b.current < max(b.base, minBackoffDelay) {
+			b.current = b.base
+		}
+	}
+}
+
+// delay returns the delay to wait before the next probe.
+func (b *backoff) delay(base time.Duration) time.Duration {
+	if b == nil {
+		return base
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.current
+}
+
+// abort reports whether the scan must be aborted, and the share of dial errors
+// that caused it, in percent.
+func (b *backoff) abort() (bool, float64) {
+	if b == nil {
+		return false, 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.aborted, b.abortedErrorPct
+}
+
+// maxDelay returns the highest delay used between two probes.
+func (b *backoff) maxDelay() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.highest
+}
@@ -0,0 +1,149 @@
+package scan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/sync/semaphore"
+)
+
+func Test_readBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.Backoff
+		want    *backoffConf
+		wantErr bool
+	}{
+		{name: "not configured", conf: nil, want: nil},
+		{name: "disabled", conf: &config.Backoff{Window: 10}, want: nil},
+		{
+			name: "defaults",
+			conf: &config.Backoff{ErrorRate: 0.2},
+			want: &backoffConf{errorRate: 0.2, window: 100, maxDelay: time.Second, retryAfter: 10 * time.Minute},
+		},
+		{
+			name: "abort",
+			conf: &config.Backoff{AbortRate: 0.5, Window: 20, MaxDelay: "100ms", RetryAfter: "1h"},
+			want: &backoffConf{abortRate: 0.5, window: 20, maxDelay: 100 * time.Millisecond, retryAfter: time.Hour},
+		},
+		{name: "rate above 1", conf: &config.Backoff{ErrorRate: 2}, wantErr: true},
+		{name: "negative window", conf: &config.Backoff{ErrorRate: 0.2, Window: -1}, wantErr: true},
+		{name: "invalid delay", conf: &config.Backoff{ErrorRate: 0.2, MaxDelay: "long"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readBackoff(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readBackoff() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != (tt.want == nil) || (got != nil && *got != *tt.want) {
+				t.Errorf("readBackoff() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_backoff(t *testing.T) {
+	conf := &backoffConf{errorRate: 0.5, abortRate: 0.9, window: 4, maxDelay: 4 * time.Millisecond}
+	b := newBackoff(conf, 0)
+
+	observe := func(failures, successes int) {
+		for range failures {
+			b.observe(true)
+		}
+		for range successes {
+			b.observe(false)
+		}
+	}
+
+	steps := []struct {
+		name                string
+		failures, successes int
+		wantDelay           time.Duration
+		wantAborted         bool
+	}{
+		{name: "few errors", failures: 1, successes: 3, wantDelay: 0},
+		{name: "spike", failures: 2, successes: 2, wantDelay: time.Millisecond},
+		{name: "spike goes on", failures: 3, successes: 1, wantDelay: 2 * time.Millisecond},
+		{name: "capped", failures: 3, successes: 1, wantDelay: 4 * time.Millisecond},
+		{name: "capped again", failures: 3, successes: 1, wantDelay: 4 * time.Millisecond},
+		{name: "recovery", failures: 0, successes: 4, wantDelay: 2 * time.Millisecond},
+		{name: "recovered", failures: 0, successes: 8, wantDelay: 0},
+		{name: "window not over", failures: 3, successes: 0, wantDelay: 0},
+		{name: "host down", failures: 1, successes: 0, wantDelay: 0, wantAborted: true},
+	}
+	for _, step := range steps {
+		observe(step.failures, step.successes)
+		if got := b.delay(-1); got != step.wantDelay {
+			t.Errorf("%s: delay() = %v, want %v", step.name, got, step.wantDelay)
+		}
+		if aborted, _ := b.abort(); aborted != step.wantAborted {
+			t.Errorf("%s: abort() = %v, want %v", step.name, aborted, step.wantAborted)
+		}
+	}
+	if got := b.maxDelay(); got != 4*time.Millisecond {
+		t.Errorf("maxDelay() = %v, want 4ms", got)
+	}
+
+	var disabled *backoff
+	disabled.observe(true)
+	if got := disabled.delay(time.Second); got != time.Second {
+		t.Errorf("delay() of a disabled backoff = %v, want the base delay", got)
+	}
+}
+
+func TestScanner_run_aborted(t *testing.T) {
+	aborted := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "aborted"}, []string{"name", "ip", "owner"})
+	s := &Scanner{
+		Logger:      logger.New("error"),
+		Timeout:     time.Nanosecond,
+		Lock:        semaphore.NewWeighted(4),
+		pool:        newPool(4),
+		MetricsServ: metrics.Server{AbortedScans: aborted},
+		trigger:     make(chan job, 1),
+	}
+
+	// The timeout is too short for any dial to succeed
+	tgt := &target{
+		name:      "unreachable",
+		ip:        "127.0.0.1",
+		ports:     "1-100",
+		intervals: [][2]int{{1, 100}},
+		stop:      make(chan struct{}),
+		backoff:   &backoffConf{abortRate: 0.5, window: 8, retryAfter: time.Millisecond},
+	}
+	s.Targets = []*target{tgt}
+
+	scanIsOver := make(chan scanReport, 1)
+	singleResult := make(chan portResult, 100)
+	if err := s.run(context.Background(), newJob(tgt.ip), scanIsOver, singleResult); err != nil {
+		t.Fatal(err)
+	}
+
+	report := <-scanIsOver
+	if !report.aborted {
+		t.Errorf("run() did not abort the scan")
+	}
+	if n := len(singleResult); n >= 100 {
+		t.Errorf("run() probed %d ports, want the scan to stop early", n)
+	}
+	if got := testutil.ToFloat64(aborted.WithLabelValues(tgt.name, tgt.ip, "")); got != 1 {
+		t.Errorf("run() counted %v aborted scans, want 1", got)
+	}
+
+	select {
+	case j := <-s.trigger:
+		if j.ip != tgt.ip {
+			t.Errorf("run() retried %s, want %s", j.ip, tgt.ip)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("run() did not retry the aborted scan")
+	}
+	close(tgt.stop)
+}
@@ -0,0 +1,83 @@
+package scan
+
+import (
+	"slices"
+	"time"
+)
+
+// benchTolerance is the share of the best throughput a worker count must reach
+// to be recommended.
+const benchTolerance = 0.9
+
+// BenchResult is the outcome of probing ports with a number of workers and a
+// timeout.
+type BenchResult struct {
+	Workers  int
+	Timeout  time.Duration
+	Probes   int
+	Open     int
+	Duration time.Duration
+	// Latencies holds the duration of each probe, sorted
+	Latencies []time.Duration
+}
+
+// Throughput returns the number of probes realised per second.
+func (r BenchResult) Throughput() float64 {
+	if r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.Probes) / r.Duration.Seconds()
+}
+
+// Percentile returns the latency under which p percent of the probes were
+// realised.
+func (r BenchResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies)-1) * p / 100)
+	return r.Latencies[i]
+}
+
+// Bench probes the ports of ip with the given number of workers and timeout,
+// using the same probe as the scans.
+func Bench(ip string, ports []int, workers int, timeout time.Duration) BenchResult {
+	start := time.Now()
+	probes := Probe(ip, ports, workers, timeout)
+	r := BenchResult{
+		Workers:  workers,
+		Timeout:  timeout,
+		Probes:   len(probes),
+		Duration: time.Since(start),
+	}
+
+	for _, p := range probes {
+		if p.Open {
+			r.Open++
+		}
+		r.Latencies = append(r.Latencies, p.Latency)
+	}
+	slices.Sort(r.Latencies)
+	return r
+}
+
+// Recommend returns the result with the smallest number of workers whose
+// throughput is close to the best one. More workers would open more files
+// without scanning faster.
+func Recommend(results []BenchResult) BenchResult {
+	var best float64
+	for _, r := range results {
+		best = max(best, r.Throughput())
+	}
+
+	var recommended BenchResult
+	for _, r := range results {
+		if r.Throughput() < best*benchTolerance {
+			continue
+		}
+		if recommended.Workers == 0 || r.Workers < recommended.Workers {
+			recommended = r
+		}
+	}
+	return recommended
+}
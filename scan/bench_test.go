@@ -0,0 +1,66 @@
+package scan
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBench(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	open := ln.Addr().(*net.TCPAddr).Port
+	got := Bench("127.0.0.1", []int{open, closedPort, open}, 2, time.Second)
+	if got.Probes != 3 || got.Open != 2 || got.Workers != 2 {
+		t.Errorf("Bench() = %+v, want 3 probes, 2 open ports and 2 workers", got)
+	}
+	if len(got.Latencies) != 3 || got.Percentile(100) < got.Percentile(0) {
+		t.Errorf("Bench() latencies = %v, want 3 sorted latencies", got.Latencies)
+	}
+	if got.Throughput() <= 0 {
+		t.Errorf("Bench() throughput = %v, want a positive throughput", got.Throughput())
+	}
+}
+
+func TestRecommend(t *testing.T) {
+	result := func(workers int, probesPerSec int) BenchResult {
+		return BenchResult{Workers: workers, Probes: probesPerSec, Duration: time.Second}
+	}
+	tests := []struct {
+		name    string
+		results []BenchResult
+		want    int
+	}{
+		{name: "no results", results: nil, want: 0},
+		{name: "throughput plateaus", results: []BenchResult{result(64, 500), result(256, 1900), result(1024, 2000), result(2048, 1950)}, want: 256},
+		{name: "throughput grows", results: []BenchResult{result(64, 500), result(256, 1000), result(1024, 2000)}, want: 1024},
+		{name: "unsorted", results: []BenchResult{result(1024, 2000), result(512, 1950), result(64, 100)}, want: 512},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Recommend(tt.results); got.Workers != tt.want {
+				t.Errorf("Recommend() workers = %d, want %d", got.Workers, tt.want)
+			}
+		})
+	}
+}
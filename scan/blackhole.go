@@ -0,0 +1,122 @@
+package scan
+
+import (
+	"fmt"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/metrics"
+)
+
+// blackholeDetector detects that the probes cannot leave the host, because of
+// a local firewall or an uplink failure, when all the targets which had open
+// ports suddenly report none. The scans finding no open port are held until
+// another target proves that the probes get through, so that such a failure
+// does not raise findings for every target. It is only used by the receiver,
+// and nil when the detection is disabled.
+type blackholeDetector struct {
+	minTargets int
+
+	// dark holds the targets which had open ports, and whether their last
+	// scan found none
+	dark map[*target]bool
+	// held holds the metrics of the last scan of the dark targets, which
+	// are sent once the probes are known to get through
+	held map[*target][]metrics.NewMetrics
+	// active is true when the probes are blackholed
+	active bool
+}
+
+// newBlackholeDetector creates a blackhole detector from its configuration. It
+// returns nil if the detection is disabled.
+func newBlackholeDetector(c *config.Blackhole) (*blackholeDetector, error) {
+	if c == nil || c.MinTargets == 0 {
+		return nil, nil
+	}
+	if c.MinTargets < 0 {
+		return nil, fmt.Errorf("number of targets %d cannot be negative", c.MinTargets)
+	}
+	return &blackholeDetector{
+		minTargets: c.MinTargets,
+		dark:       make(map[*target]bool),
+		held:       make(map[*target][]metrics.NewMetrics),
+	}, nil
+}
+
+// observe records whether the last scan of t found open ports, and reports
+// whether the scan is suspect: it found none while the target had some, so it
+// may be caused by a blackhole.
+func (b *blackholeDetector) observe(t *target, open bool) bool {
+	if b == nil {
+		return false
+	}
+	for tgt := range b.dark {
+		if removed(tgt) {
+			delete(b.dark, tgt)
+			delete(b.held, tgt)
+		}
+	}
+
+	// Open ports prove that the probes get through, and outdate the held
+	// metrics of the target
+	if open {
+		b.dark[t] = false
+		delete(b.held, t)
+		b.active = false
+		return false
+	}
+	if _, ok := b.dark[t]; !ok {
+		return false
+	}
+	b.dark[t] = true
+
+	if len(b.dark) < b.minTargets {
+		return true
+	}
+	for _, dark := range b.dark {
+		if !dark {
+			return true
+		}
+	}
+	b.active = true
+	return true
+}
+
+// blackholed reports whether the probes are blackholed.
+func (b *blackholeDetector) blackholed() bool {
+	return b != nil && b.active
+}
+
+// hold keeps the metrics of a suspect scan of t until the probes are known to
+// get through, replacing the ones of its previous scan.
+func (b *blackholeDetector) hold(t *target, nms []metrics.NewMetrics) {
+	b.held[t] = nms
+}
+
+// release returns the held metrics, and forgets them.
+func (b *blackholeDetector) release() []metrics.NewMetrics {
+	if b == nil {
+		return nil
+	}
+	var nms []metrics.NewMetrics
+	for t, held := range b.held {
+		nms = append(nms, held...)
+		delete(b.held, t)
+	}
+	return nms
+}
+
+// drop forgets the held metrics, as their scans were blackholed.
+func (b *blackholeDetector) drop() {
+	clear(b.held)
+}
+
+// setBlackholed exports whether the probes are blackholed.
+func (s *Scanner) setBlackholed(blackholed bool) {
+	if !blackholed {
+		s.MetricsServ.EgressBlackhole.Set(0)
+		s.Logger.Info().Msg("probes get through again, scan results are trusted")
+		return
+	}
+	s.MetricsServ.EgressBlackhole.Set(1)
+	s.Logger.Error().Msg("no target has open ports anymore, probes are likely blackholed by a local firewall or an uplink failure: results are suspect and findings are not raised")
+}
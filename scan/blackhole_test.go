@@ -0,0 +1,154 @@
+package scan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func Test_newBlackholeDetector(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.Blackhole
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "unset", wantNil: true},
+		{name: "disabled", conf: &config.Blackhole{}, wantNil: true},
+		{name: "enabled", conf: &config.Blackhole{MinTargets: 3}},
+		{name: "negative", conf: &config.Blackhole{MinTargets: -1}, wantNil: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newBlackholeDetector(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newBlackholeDetector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("newBlackholeDetector() = %v, want nil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_blackholeDetector_observe(t *testing.T) {
+	b, _ := newBlackholeDetector(&config.Blackhole{MinTargets: 2})
+	web := &target{name: "web", stop: make(chan struct{})}
+	db := &target{name: "db", stop: make(chan struct{})}
+	empty := &target{name: "empty", stop: make(chan struct{})}
+
+	steps := []struct {
+		t              *target
+		open           bool
+		wantSuspect    bool
+		wantBlackholed bool
+	}{
+		// Targets which never had open ports are ignored
+		{t: empty, open: false},
+		{t: web, open: true},
+		{t: web, open: false, wantSuspect: true},
+		{t: empty, open: false},
+		{t: db, open: true},
+		{t: db, open: false, wantSuspect: true, wantBlackholed: true},
+		{t: web, open: false, wantSuspect: true, wantBlackholed: true},
+		{t: db, open: true},
+		{t: web, open: false, wantSuspect: true},
+	}
+	for i, step := range steps {
+		if got := b.observe(step.t, step.open); got != step.wantSuspect {
+			t.Errorf("step %d: observe(%s, %v) = %v, want %v", i, step.t.name, step.open, got, step.wantSuspect)
+		}
+		if got := b.blackholed(); got != step.wantBlackholed {
+			t.Errorf("step %d: blackholed() = %v, want %v", i, got, step.wantBlackholed)
+		}
+	}
+
+	// Removed targets are forgotten, and too few targets remain to detect a
+	// blackhole
+	close(web.stop)
+	b.observe(db, false)
+	if b.blackholed() {
+		t.Errorf("blackholed() = true with a single target left")
+	}
+}
+
+func TestScanner_receiver_blackhole(t *testing.T) {
+	bh, _ := newBlackholeDetector(&config.Blackhole{MinTargets: 2})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "blackhole"})
+	s := &Scanner{
+		Results:     results.New(),
+		conf:        &config.Conf{},
+		blackhole:   bh,
+		MetricsServ: metrics.Server{EgressBlackhole: gauge},
+	}
+	scanIsOver := make(chan scanReport)
+	singleResult := make(chan portResult)
+	mchan := make(chan metrics.NewMetrics, 16)
+	startReceiver(t, s, scanIsOver, singleResult, mchan)
+
+	web := &target{name: "web", ip: "10.0.0.1", stop: make(chan struct{})}
+	db := &target{name: "db", ip: "10.0.0.2", stop: make(chan struct{})}
+	dns := &target{name: "dns", ip: "10.0.0.3", stop: make(chan struct{})}
+	scan := func(tgt *target, ports ...string) {
+		for _, port := range ports {
+			singleResult <- portResult{ip: tgt.ip, port: port, open: true}
+		}
+		scanIsOver <- scanReport{t: tgt, ctx: context.Background()}
+	}
+	// sent returns the names of the targets whose metrics were sent
+	sent := func() []string {
+		// The receiver is done with the previous report once it takes a
+		// new one
+		scanIsOver <- scanReport{t: &target{ip: "10.0.0.9", stop: make(chan struct{})}, ctx: context.Background()}
+		var names []string
+		for len(mchan) > 0 {
+			if nm := <-mchan; nm.Name != "" {
+				names = append(names, nm.Name)
+			}
+		}
+		return names
+	}
+
+	scan(web, "80")
+	scan(db, "5432")
+	if got := sent(); len(got) != 2 {
+		t.Fatalf("receiver() sent metrics of %v, want web and db", got)
+	}
+
+	// The dark scan of web is held until db proves that the probes get
+	// through
+	scan(web)
+	if got := sent(); len(got) != 0 {
+		t.Errorf("receiver() sent metrics of %v for a suspect scan", got)
+	}
+	if got, _ := s.Results.Get(web.ip); !got.Suspect {
+		t.Errorf("receiver() did not flag the results of web as suspect")
+	}
+	scan(db, "5432")
+	if got := sent(); len(got) != 2 {
+		t.Errorf("receiver() sent metrics of %v, want the held ones of web and the ones of db", got)
+	}
+
+	// Once all targets are dark, their scans are dropped
+	scan(web)
+	scan(db)
+	if got := sent(); len(got) != 0 {
+		t.Errorf("receiver() sent metrics of %v while blackholed", got)
+	}
+	if v := testutil.ToFloat64(gauge); v != 1 {
+		t.Errorf("blackhole metric = %v, want 1", v)
+	}
+
+	scan(dns, "53")
+	if got := sent(); len(got) != 1 || got[0] != "dns" {
+		t.Errorf("receiver() sent metrics of %v, want the ones of dns", got)
+	}
+	if v := testutil.ToFloat64(gauge); v != 0 {
+		t.Errorf("blackhole metric = %v after the blackhole, want 0", v)
+	}
+}
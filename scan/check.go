@@ -0,0 +1,114 @@
+package scan
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+// maxCheckResponse is the maximum number of bytes read from a port when
+// verifying its response.
+const maxCheckResponse = 4096
+
+// checkBuffers holds the buffers the responses of the ports are read into, so
+// that the checks and banners of large scans do not allocate one per port.
+var checkBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, maxCheckResponse)
+		return &buf
+	},
+}
+
+// tcpCheck holds what has to be sent once a port is connected, and the pattern
+// the response must match for the port to be considered open.
+type tcpCheck struct {
+	send   []byte
+	expect *regexp.Regexp
+}
+
+// readChecks transforms the checks from configuration into a map of tcpCheck
+// indexed by port.
+func readChecks(checks []config.Check) (map[int]*tcpCheck, error) {
+	m := make(map[int]*tcpCheck)
+	for _, c := range checks {
+		if c.Port < 1 || c.Port > 65535 {
+			return nil, fmt.Errorf("check port %d is out of the valid range (1-65535)", c.Port)
+		}
+		if _, ok := m[c.Port]; ok {
+			return nil, fmt.Errorf("more than one check defined for port %d", c.Port)
+		}
+
+		tc := &tcpCheck{send: []byte(c.Send)}
+		if c.Expect != "" {
+			re, err := regexp.Compile(c.Expect)
+			if err != nil {
+				return nil, fmt.Errorf("invalid expect pattern for port %d: %w", c.Port, err)
+			}
+			tc.expect = re
+		}
+		m[c.Port] = tc
+	}
+	return m, nil
+}
+
+// readBanners transforms the banners patterns from configuration into a map of
+// tcpCheck indexed by port. Those checks only read what the server sends first.
+func readBanners(banners map[int]string) (map[int]*tcpCheck, error) {
+	m := make(map[int]*tcpCheck)
+	for port, pattern := range banners {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("banner port %d is out of the valid range (1-65535)", port)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid banner pattern for port %d: %w", port, err)
+		}
+		m[port] = &tcpCheck{expect: re}
+	}
+	return m, nil
+}
+
+// run sends the check payload over conn and verifies the response against the
+// expected pattern. A nil error means that the port speaks the expected
+// protocol.
+func (c *tcpCheck) run(conn net.Conn, timeout time.Duration) error {
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	if len(c.send) > 0 {
+		if _, err := conn.Write(c.send); err != nil {
+			return fmt.Errorf("cannot send check payload: %w", err)
+		}
+	}
+
+	if c.expect == nil {
+		return nil
+	}
+
+	// The response can arrive in several segments, so keep reading until it
+	// matches, the buffer is full or the deadline is reached.
+	bp := checkBuffers.Get().(*[]byte)
+	defer checkBuffers.Put(bp)
+	buf := *bp
+	read := 0
+	for read < len(buf) {
+		n, err := conn.Read(buf[read:])
+		read += n
+		if c.expect.Match(buf[:read]) {
+			return nil
+		}
+		if err != nil {
+			if read == 0 {
+				return fmt.Errorf("cannot read response: %w", err)
+			}
+			break
+		}
+	}
+
+	return fmt.Errorf("response %q does not match %q", buf[:read], c.expect.String())
+}
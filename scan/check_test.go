@@ -0,0 +1,173 @@
+package scan
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+func Test_readChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		checks  []config.Check
+		want    int
+		wantErr bool
+	}{
+		{name: "no checks", checks: nil, want: 0, wantErr: false},
+		{name: "valid", checks: []config.Check{{Port: 25, Expect: "^220"}, {Port: 80, Send: "HEAD / HTTP/1.0\r\n\r\n"}}, want: 2, wantErr: false},
+		{name: "port out of range", checks: []config.Check{{Port: 0}}, wantErr: true},
+		{name: "duplicate port", checks: []config.Check{{Port: 25}, {Port: 25}}, wantErr: true},
+		{name: "invalid pattern", checks: []config.Check{{Port: 25, Expect: "("}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readChecks(tt.checks)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readChecks() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.want {
+				t.Errorf("readChecks() returned %d checks, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func Test_tcpCheck_run(t *testing.T) {
+	tests := []struct {
+		name    string
+		check   config.Check
+		reply   string
+		wantErr bool
+	}{
+		{name: "matching reply", check: config.Check{Port: 1, Send: "PING\r\n", Expect: "^\\+PONG"}, reply: "+PONG\r\n", wantErr: false},
+		{name: "wrong reply", check: config.Check{Port: 1, Send: "PING\r\n", Expect: "^\\+PONG"}, reply: "-ERR\r\n", wantErr: true},
+		{name: "send only", check: config.Check{Port: 1, Send: "PING\r\n"}, reply: "", wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checks, err := readChecks([]config.Check{tt.check})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			client, server := net.Pipe()
+			defer client.Close()
+			go func() {
+				defer server.Close()
+				buf := make([]byte, 64)
+				server.Read(buf)
+				if tt.reply != "" {
+					server.Write([]byte(tt.reply))
+				}
+			}()
+
+			err = checks[1].run(client, time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_tcpCheck_run_reusedBuffer(t *testing.T) {
+	checks, err := readChecks([]config.Check{{Port: 1, Expect: "^\\+PONG"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The buffers are shared between the checks, so a response must not be
+	// matched against what was read by a previous one
+	for _, reply := range []string{"+PONG and a long trailer", "-ERR"} {
+		client, server := net.Pipe()
+		go func() {
+			defer server.Close()
+			server.Write([]byte(reply))
+		}()
+		err := checks[1].run(client, time.Second)
+		client.Close()
+		if wantErr := reply == "-ERR"; (err != nil) != wantErr {
+			t.Errorf("run() with reply %q error = %v, wantErr %v", reply, err, wantErr)
+		}
+		if err != nil && strings.Contains(err.Error(), "trailer") {
+			t.Errorf("run() error = %v, contains a previous response", err)
+		}
+	}
+}
+
+func Test_readBanners(t *testing.T) {
+	tests := []struct {
+		name    string
+		banners map[int]string
+		want    int
+		wantErr bool
+	}{
+		{name: "no banners", banners: nil, want: 0, wantErr: false},
+		{name: "valid", banners: map[int]string{22: "^SSH-2.0-OpenSSH"}, want: 1, wantErr: false},
+		{name: "port out of range", banners: map[int]string{70000: "^SSH"}, wantErr: true},
+		{name: "invalid pattern", banners: map[int]string{22: "("}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readBanners(tt.banners)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readBanners() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != tt.want {
+				t.Errorf("readBanners() returned %d banners, want %d", len(got), tt.want)
+			}
+		})
+	}
+}
+
+func TestScanner_scanPort_banner(t *testing.T) {
+	tests := []struct {
+		name            string
+		banner          string
+		sent            string
+		wantMisbehaving bool
+	}{
+		{name: "matching banner", banner: "^SSH-2.0-", sent: "SSH-2.0-OpenSSH_8.4\r\n", wantMisbehaving: false},
+		{name: "wrong banner", banner: "^SSH-2.0-", sent: "SSH-1.99-dropbear\r\n", wantMisbehaving: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+				conn.Write([]byte(tt.sent))
+			}()
+
+			port := ln.Addr().(*net.TCPAddr).Port
+			banners, err := readBanners(map[int]string{port: tt.banner})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := &Scanner{Timeout: time.Second}
+			results := make(chan portResult, 1)
+			s.scanPort(context.Background(), "127.0.0.1", port, banners[port], nil, nil, nil, nil, nil, results)
+			res := <-results
+
+			if !res.open {
+				t.Errorf("scanPort() reported port as closed")
+			}
+			if (res.bannerErr != nil) != tt.wantMisbehaving {
+				t.Errorf("scanPort() banner error = %v, wantMisbehaving %v", res.bannerErr, tt.wantMisbehaving)
+			}
+		})
+	}
+}
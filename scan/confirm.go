@@ -0,0 +1,93 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+)
+
+// defaultRetryDelay is the delay between the probes confirming the change of
+// state of a port, when none is configured.
+const defaultRetryDelay = 500 * time.Millisecond
+
+// readRetries returns the number of retries confirming the changes of state of
+// the ports, and the delay between them, the global ones being used when the
+// ones of the target are not set.
+func readRetries(retries, globalRetries int, delay, globalDelay string) (int, time.Duration, error) {
+	if retries == 0 {
+		retries = globalRetries
+	}
+	if retries < 0 {
+		return 0, 0, fmt.Errorf("negative number of retries %d", retries)
+	}
+	if delay == "" {
+		delay = globalDelay
+	}
+	d, err := readTimeout(delay, defaultRetryDelay)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid retry delay: %w", err)
+	}
+	return retries, d, nil
+}
+
+// setLastOpen records the ports found open on an address by a reported scan.
+// A nil set forgets them, so that the next scan is not confirmed.
+func (t *target) setLastOpen(addr string, open *common.PortSet) {
+	if t.retries == 0 {
+		return
+	}
+	if open == nil {
+		t.lastOpen.Delete(addr)
+		return
+	}
+	t.lastOpen.Store(addr, open)
+}
+
+// lastOpenPorts returns the ports found open on an address by the latest
+// reported scan, or nil if there is none.
+func (t *target) lastOpenPorts(addr string) *common.PortSet {
+	open, ok := t.lastOpen.Load(addr)
+	if !ok {
+		return nil
+	}
+	return open.(*common.PortSet)
+}
+
+// confirmPort scans a port like scanPort. When the port changed state since
+// the previous scan, whose open ports are given by before, it is probed again
+// up to the number of retries of the target, until a probe finds it in its
+// previous state. The change is only reported if all the probes agree, and the
+// result of the last probe is sent through singleResult. Its dial error is
+// returned.
+func (s *Scanner) confirmPort(ctx context.Context, t *target, ip string, port int, before *common.PortSet, dials *dialStats, singleResult chan portResult) error {
+	if t.retries == 0 || before == nil {
+		return s.scanPort(ctx, ip, port, t.banners[port], t.checks[port], t.http, t.tls, t.dialer, dials, singleResult)
+	}
+
+	wasOpen := before.Has(port)
+	probe := make(chan portResult, 1)
+	for i := 0; ; i++ {
+		err := s.scanPort(ctx, ip, port, t.banners[port], t.checks[port], t.http, t.tls, t.dialer, dials, probe)
+		res := <-probe
+		if res.open == wasOpen || i == t.retries {
+			if i > 0 && res.open == wasOpen {
+				s.Logger.Debug().Str("name", t.name).Str("ip", ip).Int("port", port).Int("probes", i+1).Msgf("change of state of port %d of %s (%s) not confirmed", port, t.name, ip)
+			}
+			singleResult <- res
+			return err
+		}
+
+		select {
+		case <-time.After(t.jittered(t.retryDelay)):
+		case <-ctx.Done():
+			singleResult <- res
+			return err
+		}
+		if s.waitRate(ctx, t) != nil {
+			singleResult <- res
+			return err
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package scan
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/rs/zerolog"
+)
+
+func Test_readRetries(t *testing.T) {
+	tests := []struct {
+		name          string
+		retries       int
+		globalRetries int
+		delay         string
+		globalDelay   string
+		wantRetries   int
+		wantDelay     time.Duration
+		wantErr       bool
+	}{
+		{name: "disabled", wantDelay: defaultRetryDelay},
+		{name: "global", globalRetries: 2, globalDelay: "1s", wantRetries: 2, wantDelay: time.Second},
+		{name: "target", retries: 1, globalRetries: 2, delay: "100ms", globalDelay: "1s", wantRetries: 1, wantDelay: 100 * time.Millisecond},
+		{name: "negative retries", retries: -1, wantErr: true},
+		{name: "invalid delay", retries: 1, delay: "500", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retries, delay, err := readRetries(tt.retries, tt.globalRetries, tt.delay, tt.globalDelay)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readRetries() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (retries != tt.wantRetries || delay != tt.wantDelay) {
+				t.Errorf("readRetries() = %d, %s, want %d, %s", retries, delay, tt.wantRetries, tt.wantDelay)
+			}
+		})
+	}
+}
+
+func TestScanner_confirmPort(t *testing.T) {
+	tests := []struct {
+		name    string
+		retries int
+		// wasOpen is nil when there is no previous scan
+		wasOpen *bool
+		// opensAfter is the delay after which the port starts listening,
+		// -1 if it never does
+		opensAfter time.Duration
+		wantOpen   bool
+		wantProbes int
+	}{
+		{name: "unchanged open port", retries: 2, wasOpen: ptr(true), wantOpen: true, wantProbes: 1},
+		{name: "unchanged closed port", retries: 2, wasOpen: ptr(false), opensAfter: -1, wantProbes: 1},
+		{name: "confirmed closing", retries: 2, wasOpen: ptr(true), opensAfter: -1, wantProbes: 3},
+		{name: "confirmed opening", retries: 2, wasOpen: ptr(false), wantOpen: true, wantProbes: 3},
+		{name: "transient closing", retries: 2, wasOpen: ptr(true), opensAfter: 100 * time.Millisecond, wantOpen: true, wantProbes: 2},
+		{name: "no previous scan", retries: 2, opensAfter: -1, wantProbes: 1},
+		{name: "no retries", wasOpen: ptr(true), opensAfter: -1, wantProbes: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The port is reserved, then released until it opens
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			port := ln.Addr().(*net.TCPAddr).Port
+			if tt.opensAfter != 0 {
+				ln.Close()
+			}
+			if tt.opensAfter > 0 {
+				opened := make(chan net.Listener, 1)
+				timer := time.AfterFunc(tt.opensAfter, func() {
+					ln, err := net.Listen("tcp", "127.0.0.1:"+strconv.Itoa(port))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					opened <- ln
+				})
+				defer func() {
+					timer.Stop()
+					select {
+					case ln := <-opened:
+						ln.Close()
+					default:
+					}
+				}()
+			} else if tt.opensAfter == 0 {
+				defer ln.Close()
+			}
+
+			var before *common.PortSet
+			if tt.wasOpen != nil {
+				before = common.NewPortSet()
+				if *tt.wasOpen {
+					before.Add(port)
+				}
+			}
+			s := &Scanner{Timeout: time.Second, Logger: zerolog.Nop()}
+			tgt := &target{name: "app", ip: "127.0.0.1", retries: tt.retries, retryDelay: 200 * time.Millisecond}
+			dials := &dialStats{}
+			results := make(chan portResult, 1)
+			if err := s.confirmPort(context.Background(), tgt, "127.0.0.1", port, before, dials, results); err != nil {
+				t.Fatalf("confirmPort() error = %v", err)
+			}
+
+			if res := <-results; res.open != tt.wantOpen {
+				t.Errorf("confirmPort() reported open %v, want %v", res.open, tt.wantOpen)
+			}
+			if dials.count != tt.wantProbes {
+				t.Errorf("confirmPort() probed the port %d times, want %d", dials.count, tt.wantProbes)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
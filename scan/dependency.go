@@ -0,0 +1,61 @@
+package scan
+
+// down reports whether a target is unreachable: its last ping got no reply,
+// or none of the probes of its last scan could reach it.
+func (t *target) down() bool {
+	return t.pingDown.Load() || t.scanDown.Load()
+}
+
+// downDependency returns the name of the target t depends on, directly or
+// through other targets, which is down. It returns an empty string if all the
+// dependencies are up or unknown.
+func (s *Scanner) downDependency(t *target) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := map[string]bool{t.name: true}
+	for name := t.dependsOn; name != "" && !seen[name]; {
+		seen[name] = true
+		dep := s.targetByName(name)
+		if dep == nil {
+			return ""
+		}
+		if dep.down() {
+			return dep.name
+		}
+		name = dep.dependsOn
+	}
+	return ""
+}
+
+// targetByName returns the target with the given name, or nil. It must be
+// called with the lock held.
+func (s *Scanner) targetByName(name string) *target {
+	for _, t := range s.Targets {
+		if t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// setUnreachable exports whether the target is unreachable because the given
+// dependency is down. An empty dependency means that the target is reachable.
+func (s *Scanner) setUnreachable(t *target, dependency string) {
+	// Targets are removed with the lock held, so the metrics of the target
+	// cannot be deleted before they are updated
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if removed(t) {
+		return
+	}
+
+	labels := map[string]string{"name": t.name}
+	for _, addr := range t.addresses() {
+		labels["ip"] = addr
+		s.MetricsServ.UnreachableViaDependency.DeletePartialMatch(labels)
+		if dependency != "" {
+			s.MetricsServ.UnreachableViaDependency.WithLabelValues(t.name, addr, t.labels["owner"], dependency).Set(1)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package scan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestScanner_downDependency(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []*target
+		down    string
+		want    string
+	}{
+		{
+			name:    "no dependency",
+			targets: []*target{{name: "host"}},
+			want:    "",
+		},
+		{
+			name:    "dependency up",
+			targets: []*target{{name: "gateway"}, {name: "host", dependsOn: "gateway"}},
+			want:    "",
+		},
+		{
+			name:    "dependency down",
+			targets: []*target{{name: "gateway"}, {name: "host", dependsOn: "gateway"}},
+			down:    "gateway",
+			want:    "gateway",
+		},
+		{
+			name:    "indirect dependency down",
+			targets: []*target{{name: "vpn"}, {name: "gateway", dependsOn: "vpn"}, {name: "host", dependsOn: "gateway"}},
+			down:    "vpn",
+			want:    "vpn",
+		},
+		{
+			name:    "unknown dependency",
+			targets: []*target{{name: "host", dependsOn: "gateway"}},
+			want:    "",
+		},
+		{
+			name:    "circular dependencies",
+			targets: []*target{{name: "gateway", dependsOn: "host"}, {name: "host", dependsOn: "gateway"}},
+			want:    "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{Targets: tt.targets}
+			for _, tgt := range tt.targets {
+				if tgt.name == tt.down {
+					tgt.pingDown.Store(true)
+				}
+			}
+			host := tt.targets[len(tt.targets)-1]
+			if got := s.downDependency(host); got != tt.want {
+				t.Errorf("downDependency() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanner_run_dependencyDown(t *testing.T) {
+	unreachable := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "unreachable"}, []string{"name", "ip", "owner", "dependency"})
+	s := &Scanner{
+		Logger:      logger.New("error"),
+		Timeout:     time.Second,
+		Lock:        semaphore.NewWeighted(4),
+		pool:        newPool(4),
+		MetricsServ: metrics.Server{UnreachableViaDependency: unreachable},
+	}
+	gateway := &target{name: "gateway", ip: "127.0.0.2", ports: "1", intervals: [][2]int{{1, 1}}, stop: make(chan struct{})}
+	host := &target{name: "host", ip: "127.0.0.1", ports: "1", intervals: [][2]int{{1, 1}}, dependsOn: "gateway", stop: make(chan struct{})}
+	s.Targets = []*target{gateway, host}
+
+	// scanned reports whether running the scan of the host sends a report
+	scanned := func() bool {
+		scanIsOver := make(chan scanReport, 1)
+		if err := s.run(context.Background(), newJob(host.ip), scanIsOver, make(chan portResult, 1)); err != nil {
+			t.Fatal(err)
+		}
+		return len(scanIsOver) == 1
+	}
+
+	gateway.pingDown.Store(true)
+	if scanned() {
+		t.Errorf("run() scanned a target whose dependency is down")
+	}
+	if got := testutil.ToFloat64(unreachable.WithLabelValues("host", "127.0.0.1", "", "gateway")); got != 1 {
+		t.Errorf("unreachable metric = %v, want 1", got)
+	}
+
+	gateway.pingDown.Store(false)
+	if !scanned() {
+		t.Errorf("run() did not scan a target whose dependency is up")
+	}
+	if n := testutil.CollectAndCount(unreachable); n != 0 {
+		t.Errorf("%d unreachable series once the dependency is up, want 0", n)
+	}
+}
+
+func TestScanner_run_scanDown(t *testing.T) {
+	s := &Scanner{
+		Logger:  logger.New("error"),
+		Lock:    semaphore.NewWeighted(4),
+		pool:    newPool(4),
+		Timeout: time.Nanosecond,
+	}
+	tgt := &target{name: "gateway", ip: "127.0.0.1", ports: "1-4", intervals: [][2]int{{1, 4}}, stop: make(chan struct{})}
+	s.Targets = []*target{tgt}
+
+	// The timeout is too short for any dial to succeed
+	if err := s.run(context.Background(), newJob(tgt.ip), make(chan scanReport, 1), make(chan portResult, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if !tgt.down() {
+		t.Errorf("target is up after a scan where no probe reached it")
+	}
+
+	s.Timeout = time.Second
+	if err := s.run(context.Background(), newJob(tgt.ip), make(chan scanReport, 1), make(chan portResult, 4)); err != nil {
+		t.Fatal(err)
+	}
+	if tgt.down() {
+		t.Errorf("target is down after a scan where probes reached it")
+	}
+}
@@ -0,0 +1,254 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// dialer opens the connections of the probes of a target. A nil dialer uses
+// the system settings.
+type dialer struct {
+	// sourcePorts holds the local ports available for the probes. When nil,
+	// the system picks them
+	sourcePorts *portPool
+	// sourceAddrs holds the local addresses the probes are sent from, in
+	// turn. When nil, the system picks them
+	sourceAddrs *addrPool
+	// ttl is the TTL, or hop limit, of the outgoing packets. Zero keeps the
+	// system one
+	ttl int
+	// iface is the name of the network interface the probes are sent through.
+	// When empty, the routing table picks it
+	iface string
+	// timeout is the timeout of the probes. Zero keeps the global one
+	timeout time.Duration
+	// retries is the number of times a dial which timed out is tried again
+	retries int
+	// proxy relays the connections of the probes when not nil
+	proxy *proxy
+}
+
+// probeTimeout returns the timeout of the probes, def being the global one.
+func (d *dialer) probeTimeout(def time.Duration) time.Duration {
+	if d == nil || d.timeout == 0 {
+		return def
+	}
+	return d.timeout
+}
+
+// control sets the options of the sockets of the probes before they connect.
+func (d *dialer) control(network, address string, c syscall.RawConn) error {
+	if d.sourcePorts != nil {
+		if err := reuseAddr(network, address, c); err != nil {
+			return err
+		}
+	}
+	if d.ttl > 0 {
+		if err := setTTL(network, c, d.ttl); err != nil {
+			return err
+		}
+	}
+	if d.iface != "" {
+		return bindToDevice(c, d.iface)
+	}
+	return nil
+}
+
+// interfaceAddr returns the first IPv4, or IPv6, address of a network
+// interface.
+func interfaceAddr(name string, ipv6 bool) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || (ipnet.IP.To4() == nil) != ipv6 {
+			continue
+		}
+		return ipnet.IP.String(), nil
+	}
+	return "", fmt.Errorf("no address found on %s", name)
+}
+
+// dial connects to the address using TCP. Dials which time out are tried
+// again, up to the number of retries of the dialer.
+func (d *dialer) dial(address string, timeout time.Duration) (net.Conn, error) {
+	if d == nil {
+		return net.DialTimeout("tcp", address, timeout)
+	}
+	for range d.retries {
+		conn, err := d.dialOnce(address, timeout)
+		var netErr net.Error
+		if err == nil || !errors.As(err, &netErr) || !netErr.Timeout() {
+			return conn, err
+		}
+	}
+	return d.dialOnce(address, timeout)
+}
+
+// dialOnce connects to the address using TCP, through the proxy of the dialer
+// if it has one, without retry.
+func (d *dialer) dialOnce(address string, timeout time.Duration) (net.Conn, error) {
+	if d.proxy != nil {
+		return d.proxy.dial(address, timeout, d.dialTCP)
+	}
+	return d.dialTCP(address, timeout)
+}
+
+// dialTCP connects to the address using TCP.
+func (d *dialer) dialTCP(address string, timeout time.Duration) (net.Conn, error) {
+	source := d.sourceAddr(address)
+	if d.sourcePorts == nil {
+		nd := net.Dialer{Timeout: timeout, Control: d.control}
+		if source != nil {
+			nd.LocalAddr = &net.TCPAddr{IP: source}
+		}
+		return nd.Dial("tcp", address)
+	}
+
+	// A source port can still be used by a connection which is not fully
+	// closed, or by another program, in which case the next one is tried
+	var err error
+	for range d.sourcePorts.size {
+		port := d.sourcePorts.take()
+		nd := net.Dialer{
+			Timeout:   timeout,
+			LocalAddr: &net.TCPAddr{IP: source, Port: port},
+			Control:   d.control,
+		}
+
+		var conn net.Conn
+		conn, err = nd.Dial("tcp", address)
+		if err == nil {
+			return &pooledConn{Conn: conn, release: func() { d.sourcePorts.put(port) }}, nil
+		}
+		d.sourcePorts.put(port)
+		if !errors.Is(err, syscall.EADDRINUSE) && !errors.Is(err, syscall.EADDRNOTAVAIL) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// sourceAddr returns the local address a probe to address is sent from, or nil
+// to let the system pick it.
+func (d *dialer) sourceAddr(address string) net.IP {
+	if d == nil || d.sourceAddrs == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	return d.sourceAddrs.next(ip.To4() == nil)
+}
+
+// addrPool holds local addresses, which are used in turn by the probes to
+// spread them over the connection tracking tables of the firewalls on their
+// way. It is safe for concurrent use.
+type addrPool struct {
+	ipv4, ipv6 []net.IP
+	next4      atomic.Uint64
+	next6      atomic.Uint64
+}
+
+// newAddrPool creates a pool holding the given IPv4 and IPv6 addresses. It
+// returns nil if there are none.
+func newAddrPool(addrs []string) (*addrPool, error) {
+	if len(addrs) == 0 {
+		return nil, nil
+	}
+	p := &addrPool{}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IP address", addr)
+		}
+		if ip.To4() != nil {
+			p.ipv4 = append(p.ipv4, ip)
+		} else {
+			p.ipv6 = append(p.ipv6, ip)
+		}
+	}
+	return p, nil
+}
+
+// next returns the next IPv4, or IPv6, address of the pool, or nil if it has
+// none of this family.
+func (p *addrPool) next(ipv6 bool) net.IP {
+	ips, counter := p.ipv4, &p.next4
+	if ipv6 {
+		ips, counter = p.ipv6, &p.next6
+	}
+	if len(ips) == 0 {
+		return nil
+	}
+	return ips[(counter.Add(1)-1)%uint64(len(ips))]
+}
+
+// portPool holds local ports. Probes wait for a port to be available, so the
+// number of ports limits the number of simultaneous probes.
+type portPool struct {
+	size  int
+	ports chan int
+}
+
+// newPortPool creates a pool holding the ports of a range, which has the same
+// format as TCP's range. It returns nil if the range is empty.
+func newPortPool(ranges string) (*portPool, error) {
+	if ranges == "" {
+		return nil, nil
+	}
+	ports, err := readPortsRange(ranges)
+	if err != nil {
+		return nil, err
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no ports in %s", ranges)
+	}
+
+	p := &portPool{size: len(ports), ports: make(chan int, len(ports))}
+	for _, port := range ports {
+		p.ports <- port
+	}
+	return p, nil
+}
+
+// take waits for a port to be available and removes it from the pool.
+func (p *portPool) take() int {
+	return <-p.ports
+}
+
+// put gives back a port to the pool.
+func (p *portPool) put(port int) {
+	p.ports <- port
+}
+
+// pooledConn is a connection whose source port is given back to its pool once
+// closed.
+type pooledConn struct {
+	net.Conn
+	release func()
+	once    sync.Once
+}
+
+// Close closes the connection and gives back its source port.
+func (c *pooledConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,225 @@
+package scan
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_newPortPool(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranges   string
+		wantSize int
+		wantErr  bool
+	}{
+		{name: "empty", ranges: "", wantSize: 0},
+		{name: "single port", ranges: "40000", wantSize: 1},
+		{name: "range", ranges: "40000-40009", wantSize: 10},
+		{name: "list", ranges: "40000,40005-40006", wantSize: 3},
+		{name: "invalid", ranges: "40000-foo", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newPortPool(tt.ranges)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newPortPool() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantSize == 0 {
+				if got != nil {
+					t.Errorf("newPortPool() = %v, want nil", got)
+				}
+				return
+			}
+			if got.size != tt.wantSize || len(got.ports) != tt.wantSize {
+				t.Errorf("newPortPool() size = %d (%d available), want %d", got.size, len(got.ports), tt.wantSize)
+			}
+		})
+	}
+}
+
+func Test_dialer_dial(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Find a free port to use as source port
+	free, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := free.Addr().(*net.TCPAddr).Port
+	free.Close()
+
+	pool, err := newPortPool(strconv.Itoa(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &dialer{sourcePorts: pool}
+
+	// Dial twice, to check that the port is given back and can be reused
+	for range 2 {
+		conn, err := d.dial(l.Addr().String(), time.Second)
+		if err != nil {
+			t.Fatalf("dial() error = %v", err)
+		}
+		if len(pool.ports) != 0 {
+			t.Errorf("source port still available while in use")
+		}
+
+		accepted, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := accepted.RemoteAddr().(*net.TCPAddr).Port; got != source {
+			t.Errorf("connection from port %d, want %d", got, source)
+		}
+		accepted.Close()
+
+		conn.Close()
+		conn.Close()
+		if len(pool.ports) != 1 {
+			t.Fatalf("%d source ports available after close, want 1", len(pool.ports))
+		}
+	}
+}
+
+func Test_newAddrPool(t *testing.T) {
+	tests := []struct {
+		name     string
+		addrs    []string
+		wantIPv4 int
+		wantIPv6 int
+		wantNil  bool
+		wantErr  bool
+	}{
+		{name: "empty", wantNil: true},
+		{name: "both families", addrs: []string{"192.0.2.1", "2001:db8::1", "192.0.2.2"}, wantIPv4: 2, wantIPv6: 1},
+		{name: "invalid", addrs: []string{"192.0.2.1", "eth0"}, wantNil: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newAddrPool(tt.addrs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newAddrPool() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got == nil {
+				if !tt.wantNil {
+					t.Errorf("newAddrPool() = nil")
+				}
+				return
+			}
+			if len(got.ipv4) != tt.wantIPv4 || len(got.ipv6) != tt.wantIPv6 {
+				t.Errorf("newAddrPool() holds %d IPv4 and %d IPv6 addresses, want %d and %d", len(got.ipv4), len(got.ipv6), tt.wantIPv4, tt.wantIPv6)
+			}
+		})
+	}
+}
+
+func Test_dialer_sourceAddr(t *testing.T) {
+	pool, err := newAddrPool([]string{"192.0.2.1", "192.0.2.2", "2001:db8::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &dialer{sourceAddrs: pool}
+
+	var got []string
+	for _, address := range []string{"198.51.100.1:22", "198.51.100.1:80", "[2001:db8::2]:22", "198.51.100.2", "198.51.100.1:443"} {
+		got = append(got, d.sourceAddr(address).String())
+	}
+	want := []string{"192.0.2.1", "192.0.2.2", "2001:db8::1", "192.0.2.1", "192.0.2.2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sourceAddr() = %v, want %v", got, want)
+	}
+
+	// Probes to a family without source addresses are left to the system
+	v4only, _ := newAddrPool([]string{"192.0.2.1"})
+	if src := (&dialer{sourceAddrs: v4only}).sourceAddr("[2001:db8::2]:22"); src != nil {
+		t.Errorf("sourceAddr() = %s without IPv6 source address, want nil", src)
+	}
+	if src := (*dialer)(nil).sourceAddr("198.51.100.1:22"); src != nil {
+		t.Errorf("sourceAddr() of a nil dialer = %s, want nil", src)
+	}
+}
+
+func Test_dialer_dial_sourceAddrs(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	pool, err := newAddrPool([]string{"127.0.0.1", "127.0.0.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &dialer{sourceAddrs: pool}
+
+	for _, want := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.1"} {
+		conn, err := d.dial(l.Addr().String(), time.Second)
+		if errors.Is(err, syscall.EADDRNOTAVAIL) {
+			t.Skip("127.0.0.2 is not a local address")
+		}
+		if err != nil {
+			t.Fatalf("dial() error = %v", err)
+		}
+		accepted, err := l.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := accepted.RemoteAddr().(*net.TCPAddr).IP.String(); got != want {
+			t.Errorf("connection from %s, want %s", got, want)
+		}
+		accepted.Close()
+		conn.Close()
+	}
+}
+
+func Test_interfaceAddr(t *testing.T) {
+	lo := loopbackInterface(t)
+	tests := []struct {
+		name    string
+		iface   string
+		ipv6    bool
+		want    string
+		wantErr bool
+	}{
+		{name: "IPv4", iface: lo, want: "127.0.0.1"},
+		{name: "unknown interface", iface: "scanexporter0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := interfaceAddr(tt.iface, tt.ipv6)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("interfaceAddr() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("interfaceAddr() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// loopbackInterface returns the name of the loopback interface.
+func loopbackInterface(t *testing.T) string {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
@@ -0,0 +1,101 @@
+package scan
+
+import (
+	"cmp"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/consul"
+	"github.com/devops-works/scan-exporter/filesd"
+	"github.com/devops-works/scan-exporter/netbox"
+	"github.com/devops-works/scan-exporter/reporting"
+)
+
+const (
+	// defaultRefreshInterval is the interval between two discoveries when
+	// none is configured.
+	defaultRefreshInterval = "1h"
+	// defaultFileSDRefreshInterval is the interval between two reads of the
+	// files of file_sd when none is configured. As the files are watched, it
+	// only catches the changes the watcher missed.
+	defaultFileSDRefreshInterval = "5m"
+)
+
+// discoverNetBox periodically generates targets from NetBox services and
+// synchronises them with the scanned ones.
+func (s *Scanner) discoverNetBox(c *config.NetBox) {
+	defer reporting.Recover("", "")
+
+	client, err := netbox.New(c)
+	if err != nil {
+		s.Logger.Error().Err(err).Msg("cannot create NetBox client, discovery disabled")
+		reporting.Error(err, "cannot create NetBox client", "", "")
+		return
+	}
+	s.discover("NetBox", sourceNetBox, c.RefreshInterval, client.Targets, nil)
+}
+
+// discoverConsul periodically generates targets from the services registered
+// in Consul and synchronises them with the scanned ones, so that the targets of
+// deregistered services are removed.
+func (s *Scanner) discoverConsul(c *config.Consul) {
+	defer reporting.Recover("", "")
+
+	client, err := consul.New(c)
+	if err != nil {
+		s.Logger.Error().Err(err).Msg("cannot create Consul client, discovery disabled")
+		reporting.Error(err, "cannot create Consul client", "", "")
+		return
+	}
+	s.discover("Consul", sourceConsul, c.RefreshInterval, client.Targets, nil)
+}
+
+// discoverFiles reads targets from the files of file_sd and synchronises them
+// with the scanned ones each time the files change, so that targets are added
+// and removed without reloading the configuration.
+func (s *Scanner) discoverFiles(c *config.FileSD) {
+	defer reporting.Recover("", "")
+
+	client, err := filesd.New(c)
+	if err != nil {
+		s.Logger.Error().Err(err).Msg("cannot create file_sd client, discovery disabled")
+		reporting.Error(err, "cannot create file_sd client", "", "")
+		return
+	}
+	changes, err := client.Watch(nil)
+	if err != nil {
+		s.Logger.Error().Err(err).Msg("cannot watch file_sd files, relying on the refresh interval")
+		reporting.Error(err, "cannot watch file_sd files", "", "")
+	}
+	s.discover("file_sd", sourceFileSD, cmp.Or(c.RefreshInterval, defaultFileSDRefreshInterval), client.Targets, changes)
+}
+
+// discover synchronises the targets returned by fetch with the ones of source
+// every refreshInterval, and each time changes receives. It never returns
+// unless the interval is invalid.
+func (s *Scanner) discover(name, source, refreshInterval string, fetch func() ([]config.Target, error), changes <-chan struct{}) {
+	if refreshInterval == "" {
+		refreshInterval = defaultRefreshInterval
+	}
+	interval, err := getDuration(refreshInterval)
+	if err != nil {
+		s.Logger.Error().Err(err).Msgf("cannot parse %s refresh interval %s, discovery disabled", name, refreshInterval)
+		reporting.Error(err, "cannot parse "+name+" refresh interval", "", "")
+		return
+	}
+
+	for {
+		targets, err := fetch()
+		if err != nil {
+			s.Logger.Error().Err(err).Msgf("cannot fetch targets from %s", name)
+			reporting.Error(err, "cannot fetch targets from "+name, "", "")
+		} else {
+			s.Logger.Info().Msgf("%d target(s) found in %s", len(targets), name)
+			s.Sync(source, targets)
+		}
+		select {
+		case <-time.After(interval):
+		case <-changes:
+		}
+	}
+}
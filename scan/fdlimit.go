@@ -0,0 +1,87 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"math"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/semaphore"
+)
+
+// fdReserved is the number of file descriptors left to the rest of the process,
+// such as the metrics server, the ICMP sockets and the outputs.
+const fdReserved = 64
+
+// fdLimiter caps the number of dials in flight by the number of file
+// descriptors the process can open, so that probes wait for a descriptor
+// rather than failing with "too many open files". It is safe for concurrent
+// use.
+type fdLimiter struct {
+	size int64
+	sem  *semaphore.Weighted
+	// inUse counts the descriptors held by the probes, and throttled the
+	// probes which had to wait for one. They may be nil
+	inUse     prometheus.Gauge
+	throttled prometheus.Counter
+}
+
+// newFDLimiter creates a limiter of the dials sized after the limit of open
+// files of the process, minus the descriptors reserved to the rest of the
+// process. Small limits are shared equally with the rest of the process. It
+// returns nil when the limit is unknown or unlimited.
+func newFDLimiter(inUse prometheus.Gauge, throttled prometheus.Counter) *fdLimiter {
+	limit, ok := fileLimit()
+	if !ok || limit >= math.MaxInt32 {
+		return nil
+	}
+	size := int64(limit) - fdReserved
+	if size < int64(limit)/2 {
+		size = int64(limit) / 2
+	}
+	size = max(size, 1)
+	return &fdLimiter{
+		size:      size,
+		sem:       semaphore.NewWeighted(size),
+		inUse:     inUse,
+		throttled: throttled,
+	}
+}
+
+// acquire waits until a descriptor is available for a dial, and returns the
+// function to call once it is closed. It returns the error of ctx if it is done
+// first. It does not wait on a nil limiter.
+func (l *fdLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	if !l.sem.TryAcquire(1) {
+		l.throttle()
+		if err := l.sem.Acquire(ctx, 1); err != nil {
+			return nil, err
+		}
+	}
+	if l.inUse != nil {
+		l.inUse.Inc()
+	}
+	return func() {
+		if l.inUse != nil {
+			l.inUse.Dec()
+		}
+		l.sem.Release(1)
+	}, nil
+}
+
+// throttle counts a probe waiting for a descriptor.
+func (l *fdLimiter) throttle() {
+	if l != nil && l.throttled != nil {
+		l.throttled.Inc()
+	}
+}
+
+// isFileLimit reports whether err is caused by the limit of open files of the
+// process or of the system.
+func isFileLimit(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
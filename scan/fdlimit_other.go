@@ -0,0 +1,8 @@
+//go:build !unix
+
+package scan
+
+// fileLimit returns false, as the limit of open files is unknown.
+func fileLimit() (uint64, bool) {
+	return 0, false
+}
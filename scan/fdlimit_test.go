@@ -0,0 +1,92 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/sync/semaphore"
+)
+
+func Test_newFDLimiter(t *testing.T) {
+	limit, ok := fileLimit()
+	l := newFDLimiter(nil, nil)
+	if !ok {
+		if l != nil {
+			t.Errorf("newFDLimiter() = %+v with an unknown limit, want nil", l)
+		}
+		return
+	}
+	if l != nil && (l.size < 1 || uint64(l.size) > limit) {
+		t.Errorf("newFDLimiter() size = %d, want between 1 and %d", l.size, limit)
+	}
+}
+
+func Test_fdLimiter_acquire(t *testing.T) {
+	inUse := prometheus.NewGauge(prometheus.GaugeOpts{Name: "fd_in_use"})
+	throttled := prometheus.NewCounter(prometheus.CounterOpts{Name: "fd_throttled"})
+	l := &fdLimiter{size: 2, sem: semaphore.NewWeighted(2), inUse: inUse, throttled: throttled}
+
+	first, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := testutil.ToFloat64(inUse); v != 2 {
+		t.Errorf("descriptors in use = %v, want 2", v)
+	}
+
+	// The third dial waits for a descriptor to be released
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(ctx); err == nil {
+		t.Error("acquire() did not wait for a descriptor")
+	}
+	time.AfterFunc(20*time.Millisecond, first)
+	third, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	third()
+	second()
+
+	if v := testutil.ToFloat64(inUse); v != 0 {
+		t.Errorf("descriptors in use = %v, want 0", v)
+	}
+	if v := testutil.ToFloat64(throttled); v != 2 {
+		t.Errorf("throttled probes = %v, want 2", v)
+	}
+
+	var nilLimiter *fdLimiter
+	if _, err := nilLimiter.acquire(context.Background()); err != nil {
+		t.Errorf("acquire() on a nil limiter error = %v", err)
+	}
+}
+
+func Test_isFileLimit(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil"},
+		{name: "process", err: &os.SyscallError{Syscall: "socket", Err: syscall.EMFILE}, want: true},
+		{name: "system", err: fmt.Errorf("dial: %w", syscall.ENFILE), want: true},
+		{name: "refused", err: syscall.ECONNREFUSED},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isFileLimit(tt.err); got != tt.want {
+				t.Errorf("isFileLimit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package scan
+
+import "syscall"
+
+// fileLimit returns the soft limit of open files of the process, which Go
+// raises to the hard limit at startup, and whether it is known.
+func fileLimit() (uint64, bool) {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0, false
+	}
+	return uint64(rl.Cur), true
+}
@@ -0,0 +1,155 @@
+package scan
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+// defaultFlapWindow is the default duration over which the state changes are
+// counted.
+const defaultFlapWindow = "1h"
+
+// flapDetector flags the ports and the hosts changing state more than a given
+// number of times within a window. Ports are identified by their address and
+// port, and hosts by their address. It is safe for concurrent use, and nil
+// when the detection is disabled.
+type flapDetector struct {
+	changes int
+	window  time.Duration
+	now     func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*flapState
+	// scanned holds the addresses whose ports have been observed, so that
+	// the ports they open later count as a change
+	scanned map[string]bool
+}
+
+// flapState holds the latest state of a port or a host, and the times at
+// which it changed within the window.
+type flapState struct {
+	up      bool
+	changes []time.Time
+}
+
+// readFlapping parses flap detection settings. It returns nil if the detection
+// is disabled.
+func readFlapping(c *config.Flapping) (*flapDetector, error) {
+	if c == nil || c.Changes == 0 {
+		return nil, nil
+	}
+	if c.Changes < 0 {
+		return nil, fmt.Errorf("number of changes %d cannot be negative", c.Changes)
+	}
+	window := c.Window
+	if window == "" {
+		window = defaultFlapWindow
+	}
+	d, err := getDuration(window)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window: %w", err)
+	}
+	return &flapDetector{
+		changes: c.Changes,
+		window:  d,
+		now:     time.Now,
+		states:  make(map[string]*flapState),
+		scanned: make(map[string]bool),
+	}, nil
+}
+
+// record records the state of a port or a host, and reports whether it is
+// flapping.
+func (f *flapDetector) record(key string, up bool) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.recordLocked(key, up)
+}
+
+// recordLocked is record for callers holding the lock.
+func (f *flapDetector) recordLocked(key string, up bool) bool {
+	now := f.now()
+	st, ok := f.states[key]
+	if !ok {
+		st = &flapState{up: up}
+		f.states[key] = st
+	}
+	if st.up != up {
+		st.up = up
+		st.changes = append(st.changes, now)
+	}
+	st.changes = slices.DeleteFunc(st.changes, func(t time.Time) bool {
+		return now.Sub(t) > f.window
+	})
+	return len(st.changes) > f.changes
+}
+
+// flapping reports whether a port or a host is flapping, without recording
+// its state.
+func (f *flapDetector) flapping(key string) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st, ok := f.states[key]
+	if !ok {
+		return false
+	}
+	now := f.now()
+	n := 0
+	for _, t := range st.changes {
+		if now.Sub(t) <= f.window {
+			n++
+		}
+	}
+	return n > f.changes
+}
+
+// observePorts records the open ports of an address after a scan, and returns
+// the ports which are flapping, sorted. Only the ports which have been open
+// are tracked, the other ones being closed.
+func (f *flapDetector) observePorts(addr string, open []string) []string {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	prefix := addr + "/"
+	ports := make(map[string]bool)
+	for key := range f.states {
+		if port, ok := strings.CutPrefix(key, prefix); ok {
+			ports[port] = false
+		}
+	}
+	for _, port := range open {
+		ports[port] = true
+		// Ports opened after the first scan were closed before
+		if _, ok := f.states[prefix+port]; !ok && f.scanned[addr] {
+			f.states[prefix+port] = &flapState{}
+		}
+	}
+	f.scanned[addr] = true
+
+	var flapping []string
+	for port, up := range ports {
+		key := prefix + port
+		if f.recordLocked(key, up) {
+			flapping = append(flapping, port)
+		}
+		// Closed ports which became stable are forgotten
+		if st := f.states[key]; !st.up && len(st.changes) == 0 {
+			delete(f.states, key)
+		}
+	}
+	return sortedPorts(flapping)
+}
@@ -0,0 +1,122 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+func Test_readFlapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.Flapping
+		want    *flapDetector
+		wantErr bool
+	}{
+		{name: "not configured", conf: nil, want: nil},
+		{name: "disabled", conf: &config.Flapping{Window: "10m"}, want: nil},
+		{name: "default window", conf: &config.Flapping{Changes: 4}, want: &flapDetector{changes: 4, window: time.Hour}},
+		{name: "window", conf: &config.Flapping{Changes: 4, Window: "10m"}, want: &flapDetector{changes: 4, window: 10 * time.Minute}},
+		{name: "negative changes", conf: &config.Flapping{Changes: -1}, wantErr: true},
+		{name: "invalid window", conf: &config.Flapping{Changes: 4, Window: "soon"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readFlapping(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readFlapping() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got == nil || tt.want == nil {
+				if (got == nil) != (tt.want == nil) {
+					t.Errorf("readFlapping() = %+v, want %+v", got, tt.want)
+				}
+				return
+			}
+			if got.changes != tt.want.changes || got.window != tt.want.window {
+				t.Errorf("readFlapping() = %d changes in %s, want %d in %s", got.changes, got.window, tt.want.changes, tt.want.window)
+			}
+		})
+	}
+}
+
+// newTestFlapDetector creates a detector flagging more than 2 changes in an
+// hour, whose clock is advanced by the returned function.
+func newTestFlapDetector(t *testing.T) (*flapDetector, func(time.Duration)) {
+	t.Helper()
+	f, err := readFlapping(&config.Flapping{Changes: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	f.now = func() time.Time { return now }
+	return f, func(d time.Duration) { now = now.Add(d) }
+}
+
+func Test_flapDetector_record(t *testing.T) {
+	f, advance := newTestFlapDetector(t)
+
+	states := []struct {
+		up   bool
+		want bool
+	}{
+		{up: true, want: false},
+		{up: false, want: false},
+		{up: true, want: false},
+		{up: false, want: true},
+		{up: false, want: true},
+	}
+	for i, s := range states {
+		if got := f.record("10.0.0.1", s.up); got != s.want {
+			t.Errorf("record() #%d = %v, want %v", i, got, s.want)
+		}
+		advance(time.Minute)
+	}
+
+	// The host stabilizes once its changes are out of the window
+	advance(time.Hour)
+	if f.record("10.0.0.1", false) || f.flapping("10.0.0.1") {
+		t.Errorf("host still flapping once stable for the whole window")
+	}
+
+	var disabled *flapDetector
+	if disabled.record("10.0.0.1", true) || disabled.flapping("10.0.0.1") || disabled.observePorts("10.0.0.1", nil) != nil {
+		t.Errorf("disabled detector flagged a flapping host")
+	}
+}
+
+func Test_flapDetector_observePorts(t *testing.T) {
+	f, advance := newTestFlapDetector(t)
+
+	scans := []struct {
+		open []string
+		want []string
+	}{
+		{open: []string{"22", "80"}},
+		{open: []string{"22", "8080"}},
+		{open: []string{"22", "80"}},
+		{open: []string{"22", "8080"}, want: []string{"80", "8080"}},
+		{open: []string{"22"}, want: []string{"80", "8080"}},
+	}
+	for i, s := range scans {
+		if got := f.observePorts("10.0.0.1", s.open); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("observePorts() #%d = %v, want %v", i, got, s.want)
+		}
+		advance(time.Minute)
+	}
+
+	// Ports of other addresses are tracked separately
+	if got := f.observePorts("10.0.0.2", []string{"80"}); got != nil {
+		t.Errorf("observePorts() of another address = %v, want none", got)
+	}
+
+	// Closed ports are forgotten once stable
+	advance(time.Hour)
+	f.observePorts("10.0.0.1", []string{"22"})
+	for _, port := range []string{"80", "8080"} {
+		if _, ok := f.states["10.0.0.1/"+port]; ok {
+			t.Errorf("closed port %s still tracked once stable", port)
+		}
+	}
+}
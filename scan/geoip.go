@@ -0,0 +1,91 @@
+package scan
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoIP finds the country and the autonomous system of public addresses in
+// local MaxMind databases, such as GeoLite2-Country and GeoLite2-ASN. It is
+// nil when disabled, and safe for concurrent use.
+type geoIP struct {
+	country, asn *maxminddb.Reader
+}
+
+// geoLocation is the location of an address. Its fields are empty when
+// unknown.
+type geoLocation struct {
+	Country string
+	ASN     uint
+	ASOrg   string
+}
+
+// countryRecord and asnRecord hold the fields read from the country and ASN
+// databases.
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// openGeoIP opens the databases described in configuration. It returns nil if
+// none is configured.
+func openGeoIP(c *config.GeoIP) (*geoIP, error) {
+	if c == nil || (c.CountryDB == "" && c.ASNDB == "") {
+		return nil, nil
+	}
+	g := &geoIP{}
+	var err error
+	if c.CountryDB != "" {
+		if g.country, err = maxminddb.Open(c.CountryDB); err != nil {
+			return nil, fmt.Errorf("cannot open country database: %w", err)
+		}
+	}
+	if c.ASNDB != "" {
+		if g.asn, err = maxminddb.Open(c.ASNDB); err != nil {
+			return nil, fmt.Errorf("cannot open ASN database: %w", err)
+		}
+	}
+	return g, nil
+}
+
+// isPublic reports whether an address is routed on the Internet, excluding
+// private, loopback and link-local addresses.
+func isPublic(ip net.IP) bool {
+	return ip != nil && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() && !ip.IsUnspecified()
+}
+
+// locate returns the location of a public address. Private, loopback and
+// link-local addresses, and addresses missing from the databases, have no
+// location.
+func (g *geoIP) locate(addr string) geoLocation {
+	var loc geoLocation
+	ip := net.ParseIP(addr)
+	if g == nil || !isPublic(ip) {
+		return loc
+	}
+
+	// Lookup errors come from IPv6 addresses in IPv4 databases, which have
+	// no location
+	if g.country != nil {
+		var rec countryRecord
+		if err := g.country.Lookup(ip, &rec); err == nil {
+			loc.Country = rec.Country.ISOCode
+		}
+	}
+	if g.asn != nil {
+		var rec asnRecord
+		if err := g.asn.Lookup(ip, &rec); err == nil {
+			loc.ASN, loc.ASOrg = rec.Number, rec.Organization
+		}
+	}
+	return loc
+}
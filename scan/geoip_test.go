@@ -0,0 +1,178 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// mmdbString encodes a string in the MaxMind DB data format.
+func mmdbString(s string) []byte {
+	if len(s) < 29 {
+		return append([]byte{0x40 | byte(len(s))}, s...)
+	}
+	return append([]byte{0x40 | 29, byte(len(s) - 29)}, s...)
+}
+
+// mmdbUint16 and mmdbUint32 encode unsigned integers in the MaxMind DB data
+// format.
+func mmdbUint16(v uint16) []byte {
+	return []byte{0xA2, byte(v >> 8), byte(v)}
+}
+
+func mmdbUint32(v uint32) []byte {
+	return []byte{0xC4, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+// mmdbMap encodes a map whose keys and values are already encoded.
+func mmdbMap(pairs ...[]byte) []byte {
+	b := []byte{0xE0 | byte(len(pairs)/2)}
+	for _, p := range pairs {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// writeMMDB writes an IPv4 MaxMind database locating 0.0.0.0/1 in France in
+// the AS 64500, and leaving 128.0.0.0/1 unknown. It returns its path.
+func writeMMDB(t *testing.T) string {
+	t.Helper()
+
+	// The single node of the search tree points to the first record of the
+	// data section for the left half, and to no record for the right half
+	const nodeCount = 1
+	left := nodeCount + 16
+	db := []byte{0, 0, byte(left), 0, 0, nodeCount}
+	db = append(db, make([]byte, 16)...)
+	db = append(db, mmdbMap(
+		mmdbString("country"), mmdbMap(mmdbString("iso_code"), mmdbString("FR")),
+		mmdbString("autonomous_system_number"), mmdbUint32(64500),
+		mmdbString("autonomous_system_organization"), mmdbString("Example Networks"),
+	)...)
+	db = append(db, "\xAB\xCD\xEFMaxMind.com"...)
+	db = append(db, mmdbMap(
+		mmdbString("node_count"), mmdbUint32(nodeCount),
+		mmdbString("record_size"), mmdbUint16(24),
+		mmdbString("ip_version"), mmdbUint16(4),
+		mmdbString("database_type"), mmdbString("Test"),
+		mmdbString("binary_format_major_version"), mmdbUint16(2),
+		mmdbString("binary_format_minor_version"), mmdbUint16(0),
+	)...)
+
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	if err := os.WriteFile(path, db, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_openGeoIP(t *testing.T) {
+	path := writeMMDB(t)
+	tests := []struct {
+		name    string
+		conf    *config.GeoIP
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "unset", wantNil: true},
+		{name: "empty", conf: &config.GeoIP{}, wantNil: true},
+		{name: "country only", conf: &config.GeoIP{CountryDB: path}},
+		{name: "both", conf: &config.GeoIP{CountryDB: path, ASNDB: path}},
+		{name: "missing", conf: &config.GeoIP{ASNDB: filepath.Join(t.TempDir(), "missing.mmdb")}, wantNil: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := openGeoIP(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("openGeoIP() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("openGeoIP() = %v, want nil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_geoIP_locate(t *testing.T) {
+	path := writeMMDB(t)
+	both, err := openGeoIP(&config.GeoIP{CountryDB: path, ASNDB: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	country, err := openGeoIP(&config.GeoIP{CountryDB: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		geo  *geoIP
+		addr string
+		want geoLocation
+	}{
+		{name: "public", geo: both, addr: "8.8.8.8", want: geoLocation{Country: "FR", ASN: 64500, ASOrg: "Example Networks"}},
+		{name: "country only", geo: country, addr: "8.8.8.8", want: geoLocation{Country: "FR"}},
+		{name: "unknown", geo: both, addr: "193.0.6.139"},
+		{name: "private", geo: both, addr: "10.0.0.1"},
+		{name: "loopback", geo: both, addr: "127.0.0.1"},
+		{name: "link-local", geo: both, addr: "fe80::1"},
+		{name: "IPv6 in IPv4 database", geo: both, addr: "2001:4860:4860::8888"},
+		{name: "invalid", geo: both, addr: "app.example.com"},
+		{name: "disabled", addr: "8.8.8.8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.geo.locate(tt.addr); got != tt.want {
+				t.Errorf("locate(%s) = %+v, want %+v", tt.addr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanner_receiver_geoIP(t *testing.T) {
+	path := writeMMDB(t)
+	geo, err := openGeoIP(&config.GeoIP{CountryDB: path, ASNDB: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "geo"}, []string{"name", "ip", "country", "asn", "as_org", "owner"})
+	s := &Scanner{
+		Results:     results.New(),
+		conf:        &config.Conf{},
+		geo:         geo,
+		MetricsServ: metrics.Server{TargetGeo: info},
+	}
+	scanIsOver := make(chan scanReport)
+	singleResult := make(chan portResult)
+	startReceiver(t, s, scanIsOver, singleResult, make(chan metrics.NewMetrics, 4))
+
+	public := &target{name: "www", ip: "8.8.8.8", labels: map[string]string{"owner": "web"}, stop: make(chan struct{})}
+	private := &target{name: "db", ip: "10.0.0.1", stop: make(chan struct{})}
+	singleResult <- portResult{ip: public.ip, port: "443", open: true}
+	scanIsOver <- scanReport{t: public, ctx: context.Background()}
+	scanIsOver <- scanReport{t: private, ctx: context.Background()}
+
+	// The receiver is done with the previous report once it takes a new one
+	scanIsOver <- scanReport{t: &target{ip: "10.0.0.3", stop: make(chan struct{})}, ctx: context.Background()}
+
+	got, _ := s.Results.Get(public.ip)
+	if got.Country != "FR" || got.ASN != 64500 || got.ASOrg != "Example Networks" {
+		t.Errorf("receiver() saved location %s, AS%d %s, want FR, AS64500 Example Networks", got.Country, got.ASN, got.ASOrg)
+	}
+	if got, _ := s.Results.Get(private.ip); got.Country != "" || got.ASN != 0 {
+		t.Errorf("receiver() located private target in %s, AS%d", got.Country, got.ASN)
+	}
+	if n := testutil.CollectAndCount(info); n != 1 {
+		t.Errorf("geo info metric has %d series, want only the one of the public target", n)
+	}
+	if v := testutil.ToFloat64(info.WithLabelValues("www", "8.8.8.8", "FR", "64500", "Example Networks", "web")); v != 1 {
+		t.Errorf("geo info metric = %v, want 1", v)
+	}
+}
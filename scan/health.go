@@ -0,0 +1,24 @@
+package scan
+
+import (
+	"fmt"
+	"time"
+)
+
+// Healthy returns why the scanner is unhealthy, or nil if it is healthy: a
+// scan must have ended less than maxAge ago, or the scanner started less than
+// maxAge ago, and the scheduler must not have skipped scans during maxAge
+// because the scan queue was full.
+func (s *Scanner) Healthy(maxAge time.Duration) error {
+	last := s.lastScan.Load()
+	if last == 0 {
+		return fmt.Errorf("scanner not started")
+	}
+	if age := time.Since(time.Unix(0, last)); age > maxAge {
+		return fmt.Errorf("no scan ended for %s", age.Truncate(time.Second))
+	}
+	if missed := s.lastMissedTick.Load(); missed != 0 && time.Since(time.Unix(0, missed)) <= maxAge {
+		return fmt.Errorf("scans skipped because the scan queue is full, last one at %s", time.Unix(0, missed).Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package scan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func TestScanner_Healthy(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		lastScan   time.Time
+		lastMissed time.Time
+		wantErr    bool
+	}{
+		{name: "not started", wantErr: true},
+		{name: "recent scan", lastScan: now.Add(-time.Minute)},
+		{name: "stuck", lastScan: now.Add(-2 * time.Hour), wantErr: true},
+		{name: "recently missed tick", lastScan: now.Add(-time.Minute), lastMissed: now.Add(-10 * time.Minute), wantErr: true},
+		{name: "old missed tick", lastScan: now.Add(-time.Minute), lastMissed: now.Add(-2 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{}
+			if !tt.lastScan.IsZero() {
+				s.lastScan.Store(tt.lastScan.UnixNano())
+			}
+			if !tt.lastMissed.IsZero() {
+				s.lastMissedTick.Store(tt.lastMissed.UnixNano())
+			}
+			if err := s.Healthy(time.Hour); (err != nil) != tt.wantErr {
+				t.Errorf("Healthy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScanner_receiver_lastScan(t *testing.T) {
+	s := &Scanner{Results: results.New(), conf: &config.Conf{}}
+	scanIsOver := make(chan scanReport)
+	startReceiver(t, s, scanIsOver, make(chan portResult), make(chan metrics.NewMetrics, 4))
+
+	if err := s.Healthy(time.Hour); err == nil {
+		t.Errorf("Healthy() = nil before any scan")
+	}
+	scanIsOver <- scanReport{t: &target{ip: "10.0.0.1", stop: make(chan struct{})}, ctx: context.Background()}
+
+	// The receiver is done with the previous report once it takes a new one
+	scanIsOver <- scanReport{t: &target{ip: "10.0.0.2", stop: make(chan struct{})}, ctx: context.Background()}
+	if err := s.Healthy(time.Hour); err != nil {
+		t.Errorf("Healthy() error = %v after a scan", err)
+	}
+}
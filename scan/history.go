@@ -0,0 +1,50 @@
+package scan
+
+import (
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/devops-works/scan-exporter/history"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/services"
+)
+
+// lastRecorded returns the open ports of an address of a target found by the
+// last scan recorded in the history, and whether there is one. It lets the
+// changes of the first scan after a restart be computed.
+func (s *Scanner) lastRecorded(t *target, addr string) (*common.PortSet, bool) {
+	r, ok, err := s.History.Last(t.name, addr, services.TCP)
+	if err != nil {
+		s.Logger.Error().Err(err).Str("name", t.name).Str("ip", addr).Msg("cannot read the history of the target")
+	}
+	if !ok {
+		return nil, false
+	}
+	return common.PortSetOf(r.Open), true
+}
+
+// record adds the results of a scan of an address to the history. The ports
+// which changed state since the ports open in before are recorded as well,
+// unless the address was never scanned before.
+func (s *Scanner) record(nm metrics.NewMetrics, before *common.PortSet) {
+	if s.History == nil {
+		return
+	}
+
+	r := history.Record{Name: nm.Name, IP: nm.IP, Proto: services.TCP, Time: nm.End, Open: nm.Open}
+	if before != nil {
+		current := common.PortSetOf(nm.Open)
+		r.Opened = setPorts(current.Minus(before))
+		r.Closed = setPorts(before.Minus(current))
+	}
+	if err := s.History.Add(r); err != nil {
+		s.Logger.Error().Err(err).Str("name", nm.Name).Str("ip", nm.IP).Msg("cannot record the scan in the history")
+	}
+}
+
+// setPorts returns the ports of a set, in ascending order.
+func setPorts(set *common.PortSet) []string {
+	var ports []string
+	for p := range set.All() {
+		ports = append(ports, portString(p))
+	}
+	return ports
+}
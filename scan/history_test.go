@@ -0,0 +1,57 @@
+package scan
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/history"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func TestScanner_receiver_history(t *testing.T) {
+	hist, err := history.Open(&config.History{Path: filepath.Join(t.TempDir(), "history.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hist.Close()
+
+	// The last scan before the restart found ports 22 and 80 open
+	tgt := &target{name: "web", ip: "10.0.0.1", stop: make(chan struct{})}
+	if err := hist.Add(history.Record{Name: "web", IP: tgt.ip, Proto: "tcp", Time: time.Now().Add(-time.Hour), Open: []string{"22", "80"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Scanner{Logger: logger.New("error"), Results: results.New(), conf: &config.Conf{}, History: hist}
+	scanIsOver := make(chan scanReport)
+	singleResult := make(chan portResult)
+	mchan := make(chan metrics.NewMetrics, 1)
+	startReceiver(t, s, scanIsOver, singleResult, mchan)
+
+	end := time.Now()
+	singleResult <- portResult{ip: tgt.ip, port: "80", open: true}
+	singleResult <- portResult{ip: tgt.ip, port: "443", open: true}
+	scanIsOver <- scanReport{t: tgt, end: end, ctx: context.Background()}
+
+	nm := <-mchan
+	if nm.Baseline || nm.Diff != 2 {
+		t.Errorf("receiver() sent diff %d, baseline %v, want 2 changes since the last recorded scan", nm.Diff, nm.Baseline)
+	}
+
+	// The receiver is done with the previous report once it takes a new one
+	scanIsOver <- scanReport{t: &target{ip: "10.0.0.2", stop: make(chan struct{})}, ctx: context.Background()}
+	last, ok, err := hist.Last("web", tgt.ip, "tcp")
+	if err != nil || !ok {
+		t.Fatalf("Last() = %v, %v, want the scan recorded by the receiver", ok, err)
+	}
+	want := history.Record{Name: "web", IP: tgt.ip, Proto: "tcp", Open: []string{"80", "443"}, Opened: []string{"443"}, Closed: []string{"22"}}
+	want.Time = last.Time
+	if !reflect.DeepEqual(last, want) || !last.Time.Equal(end) {
+		t.Errorf("receiver() recorded %+v, want %+v at %s", last, want, end)
+	}
+}
@@ -0,0 +1,158 @@
+package scan
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/metrics"
+)
+
+// maxBodySize is the maximum number of bytes read from an HTTP response body
+// when matching it against the body pattern.
+const maxBodySize = 1 << 20
+
+// httpCheck holds the HTTP assertions realised on open web ports.
+type httpCheck struct {
+	ports    map[int]bool
+	tlsPorts map[int]bool
+	path     string
+	host     string
+	insecure bool
+	headers  map[string]*regexp.Regexp
+	body     *regexp.Regexp
+}
+
+// readHTTPCheck transforms the HTTP check from configuration into an
+// httpCheck. It returns nil if no check is configured.
+func readHTTPCheck(c *config.HTTPCheck) (*httpCheck, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	hc := &httpCheck{
+		ports:    make(map[int]bool),
+		tlsPorts: make(map[int]bool),
+		path:     c.Path,
+		host:     c.Host,
+		insecure: c.InsecureSkipVerify,
+		headers:  make(map[string]*regexp.Regexp),
+	}
+	if hc.path == "" {
+		hc.path = "/"
+	}
+
+	ports, err := readPortsRange(c.Ports)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTP ports: %w", err)
+	}
+	for _, p := range ports {
+		hc.ports[p] = true
+	}
+
+	tlsPorts, err := readPortsRange(c.TLSPorts)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTPS ports: %w", err)
+	}
+	for _, p := range tlsPorts {
+		hc.tlsPorts[p] = true
+	}
+
+	for name, pattern := range c.Headers {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern for header %s: %w", name, err)
+		}
+		hc.headers[http.CanonicalHeaderKey(name)] = re
+	}
+
+	if c.Body != "" {
+		re, err := regexp.Compile(c.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body pattern: %w", err)
+		}
+		hc.body = re
+	}
+
+	return hc, nil
+}
+
+// handles reports whether the port has to be checked using HTTP.
+func (h *httpCheck) handles(port int) bool {
+	return h != nil && (h.ports[port] || h.tlsPorts[port])
+}
+
+// run issues a GET request on the port, using a connection opened by d, and
+// verifies the response headers and body. It returns the status, size and
+// latency of the response, or nil if none was received. A nil error means that
+// all the assertions succeeded.
+func (h *httpCheck) run(ip string, port int, timeout time.Duration, d *dialer) (*metrics.HTTPResponse, error) {
+	scheme := "http"
+	if h.tlsPorts[port] {
+		scheme = "https"
+	}
+	url := scheme + "://" + net.JoinHostPort(ip, portString(port)) + h.path
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: h.insecure},
+			DisableKeepAlives: true,
+			DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return d.dial(address, timeout)
+			},
+		},
+		// Redirections are not followed, the assertions are realised on the
+		// first response.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.host != "" {
+		req.Host = h.host
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	latency := time.Since(start)
+	defer resp.Body.Close()
+
+	// The latency is the time to the response headers, and the size is the
+	// one of the body read, at most maxBodySize
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+	r := &metrics.HTTPResponse{
+		Status:  resp.StatusCode,
+		Size:    len(body),
+		Latency: latency,
+	}
+	if err != nil {
+		return r, fmt.Errorf("cannot read body: %w", err)
+	}
+
+	for name, re := range h.headers {
+		value := resp.Header.Get(name)
+		if !re.MatchString(value) {
+			return r, fmt.Errorf("header %s value %q does not match %q", name, value, re.String())
+		}
+	}
+
+	if h.body != nil && !h.body.Match(body) {
+		return r, fmt.Errorf("body does not match %q", h.body.String())
+	}
+
+	return r, nil
+}
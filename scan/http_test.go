@@ -0,0 +1,77 @@
+package scan
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+func Test_httpCheck_run(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		fmt.Fprint(w, "<title>Grafana</title>")
+	}))
+	defer srv.Close()
+
+	host, p, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, _ := strconv.Atoi(p)
+
+	tests := []struct {
+		name    string
+		conf    config.HTTPCheck
+		wantErr bool
+	}{
+		{name: "no assertion", conf: config.HTTPCheck{Ports: p}, wantErr: false},
+		{name: "matching header and body", conf: config.HTTPCheck{Ports: p, Headers: map[string]string{"server": "^nginx"}, Body: "Grafana"}, wantErr: false},
+		{name: "wrong header", conf: config.HTTPCheck{Ports: p, Headers: map[string]string{"Server": "^apache"}}, wantErr: true},
+		{name: "missing header", conf: config.HTTPCheck{Ports: p, Headers: map[string]string{"X-App": "."}}, wantErr: true},
+		{name: "wrong body", conf: config.HTTPCheck{Ports: p, Body: "Kibana"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc, err := readHTTPCheck(&tt.conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !hc.handles(port) {
+				t.Fatalf("handles(%d) = false, want true", port)
+			}
+			resp, err := hc.run(host, port, time.Second, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			// The response is described whether the assertions succeed
+			// or not
+			if resp == nil || resp.Status != http.StatusOK || resp.Size != len("<title>Grafana</title>") || resp.Latency <= 0 {
+				t.Errorf("run() response = %+v, want a 200 response of %d bytes", resp, len("<title>Grafana</title>"))
+			}
+		})
+	}
+}
+
+func Test_httpCheck_run_unreachable(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	hc, err := readHTTPCheck(&config.HTTPCheck{Ports: strconv.Itoa(port)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := hc.run("127.0.0.1", port, time.Second, nil)
+	if err == nil || resp != nil {
+		t.Errorf("run() = %+v, %v, want no response and an error", resp, err)
+	}
+}
@@ -1,17 +1,59 @@
 package scan
 
 import (
+	"errors"
+	"fmt"
 	"math/rand"
+	"net"
 	"time"
 
 	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/reporting"
 	"github.com/go-ping/ping"
 	"github.com/rs/zerolog"
 )
 
-// ping realises an ICMP echo request to a specified target.
-// Each error is followed by a continue, which will not stop the goroutine.
-func (t *target) ping(logger zerolog.Logger, timeout time.Duration, pchan chan metrics.PingInfo) {
+// ICMP modes, selecting the sockets through which echo requests are sent.
+const (
+	icmpAuto         = "auto"
+	icmpPrivileged   = "privileged"
+	icmpUnprivileged = "unprivileged"
+)
+
+// readICMPMode returns whether echo requests are sent through raw sockets,
+// which need root or the CAP_NET_RAW capability, rather than through the
+// datagram ICMP sockets that unprivileged users can open. In auto mode, raw
+// sockets are used if canRaw reports that they can be opened.
+func readICMPMode(mode string, canRaw func() bool) (bool, error) {
+	switch mode {
+	case "", icmpAuto:
+		return canRaw(), nil
+	case icmpPrivileged:
+		return true, nil
+	case icmpUnprivileged:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unknown ICMP mode %q", mode)
+	}
+}
+
+// rawICMPAllowed reports whether the process can open raw ICMP sockets.
+func rawICMPAllowed() bool {
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// ping periodically realises ICMP echo requests to the addresses of a target,
+// through raw sockets if privileged is true. Each error is followed by a
+// continue, which will not stop the goroutine. It only stops when the target
+// is removed.
+func (t *target) ping(logger zerolog.Logger, timeout time.Duration, privileged bool, pchan chan metrics.PingInfo) {
+	defer reporting.Recover(t.name, t.ip)
+
 	p, err := getDuration(t.icmpPeriod)
 	if err != nil {
 		logger.Fatal().Err(err).Msgf("cannot parse duration %s", t.icmpPeriod)
@@ -24,49 +66,102 @@ func (t *target) ping(logger zerolog.Logger, timeout time.Duration, pchan chan m
 	randPeriod := p + (time.Duration(n) * time.Millisecond)
 
 	ticker := time.NewTicker(randPeriod)
+	defer ticker.Stop()
 
 	for {
 		select {
+		case <-t.stop:
+			return
 		case <-ticker.C:
-			pinfo := metrics.PingInfo{
-				Name:         t.name,
-				IP:           t.ip,
-				IsResponding: false,
-				RTT:          0,
-				Labels:       t.labels,
+			for _, addr := range t.addresses() {
+				t.pingAddress(logger, addr, timeout, privileged, pchan)
 			}
+		}
+	}
+}
 
-			pinger, err := ping.NewPinger(t.ip)
-			if err != nil {
-				logger.Error().Err(err).Msgf("error creating pinger for %s (%s)", t.name, t.ip)
-				continue
-			}
+// pingAddress realises an ICMP echo request to one of the addresses of the
+// target. With raw sockets, IPv6 addresses on the local segment are also probed
+// using neighbor discovery.
+func (t *target) pingAddress(logger zerolog.Logger, addr string, timeout time.Duration, privileged bool, pchan chan metrics.PingInfo) {
+	isIPv6 := net.ParseIP(addr).To4() == nil
+	pinfo := metrics.PingInfo{
+		Name:         t.name,
+		IP:           addr,
+		IsResponding: false,
+		RTT:          0,
+		Labels:       t.labels,
+		DownSeverity: t.downSeverity,
+		NotifyDown:   t.notifyDown,
+		Stop:         t.stop,
+	}
 
-			pinger.Timeout = timeout
-			pinger.SetPrivileged(true)
-			pinger.Count = 3
-
-			pinger.OnFinish = func(stats *ping.Statistics) {
-				logger.Debug().Str("name", t.name).Str("ip", t.ip).Msgf("ping ended")
-				pinfo.RTT = stats.AvgRtt
-				if stats.AvgRtt != 0 {
-					pinfo.IsResponding = true
-				} else {
-					pinfo.IsResponding = false
-				}
-				pchan <- pinfo
-			}
+	if isIPv6 && privileged {
+		reachable, err := ndpProbe(addr, timeout)
+		switch {
+		case errors.Is(err, errNotOnLink):
+		case err != nil:
+			logger.Error().Err(err).Msgf("error probing neighbor %s (%s)", t.name, addr)
+			reporting.Error(err, "error probing neighbor", t.name, addr)
+		default:
+			pinfo.NeighborChecked = true
+			pinfo.NeighborReachable = reachable
+		}
+	}
 
-			pinger.OnRecv = func(p *ping.Packet) {
-				logger.Debug().Str("name", t.name).Str("ip", t.ip).Msgf("received one ICMP reply")
-			}
+	pinger, err := ping.NewPinger(addr)
+	if err != nil {
+		logger.Error().Err(err).Msgf("error creating pinger for %s (%s)", t.name, addr)
+		reporting.Error(err, "error creating pinger", t.name, addr)
+		return
+	}
 
-			logger.Debug().Str("name", t.name).Str("ip", t.ip).Msgf("running a new ping")
-			err = pinger.Run()
-			if err != nil {
-				logger.Error().Err(err).Msgf("error running pinger for %s (%s)", t.name, t.ip)
-				continue
-			}
+	pinger.Timeout = timeout
+	pinger.SetPrivileged(privileged)
+	pinger.Count = 3
+	if t.ttl > 0 {
+		pinger.TTL = t.ttl
+	}
+	// Echo requests are sent from the address of the interface, as they
+	// cannot be bound to it
+	if t.iface != "" {
+		source, err := interfaceAddr(t.iface, isIPv6)
+		if err != nil {
+			logger.Error().Err(err).Msgf("cannot find source address for %s (%s)", t.name, addr)
+			reporting.Error(err, "cannot find source address", t.name, addr)
+			return
+		}
+		pinger.Source = source
+	} else if source := t.dialer.sourceAddr(addr); source != nil {
+		pinger.Source = source.String()
+	}
+
+	pinger.OnFinish = func(stats *ping.Statistics) {
+		logger.Debug().Str("name", t.name).Str("ip", addr).Msgf("ping ended")
+		pinfo.RTT = stats.AvgRtt
+		if stats.AvgRtt != 0 {
+			pinfo.IsResponding = true
+		} else {
+			pinfo.IsResponding = false
+		}
+		if addr == t.ip {
+			t.pingDown.Store(!pinfo.IsResponding)
+		}
+		pinfo.Flapping = t.flaps.record(addr, pinfo.IsResponding)
+		pchan <- pinfo
+	}
+
+	pinger.OnRecv = func(p *ping.Packet) {
+		logger.Debug().Str("name", t.name).Str("ip", addr).Msgf("received one ICMP reply")
+		if addr == t.ip {
+			t.replyTTL.Store(int32(p.Ttl))
 		}
 	}
+
+	logger.Debug().Str("name", t.name).Str("ip", addr).Msgf("running a new ping")
+	err = pinger.Run()
+	if err != nil {
+		logger.Error().Err(err).Msgf("error running pinger for %s (%s)", t.name, addr)
+		reporting.Error(err, "error running pinger", t.name, addr)
+	}
 }
@@ -0,0 +1,31 @@
+package scan
+
+import "testing"
+
+func Test_readICMPMode(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		canRaw  bool
+		want    bool
+		wantErr bool
+	}{
+		{name: "default with raw sockets", canRaw: true, want: true},
+		{name: "default without raw sockets", canRaw: false, want: false},
+		{name: "auto", mode: "auto", canRaw: true, want: true},
+		{name: "privileged", mode: "privileged", canRaw: false, want: true},
+		{name: "unprivileged", mode: "unprivileged", canRaw: true, want: false},
+		{name: "unknown", mode: "raw", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readICMPMode(tt.mode, func() bool { return tt.canRaw })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readICMPMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readICMPMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package scan
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// job is a scan of a target, from the moment it is triggered until its
+// results are processed. Its ID identifies it in logs and traces.
+type job struct {
+	id string
+	ip string
+	// queued is the time at which the scan was triggered
+	queued time.Time
+	// scheduled is the time at which the scheduler planned the scan. It is
+	// zero for the scans triggered otherwise
+	scheduled time.Time
+}
+
+// newJob creates a job scanning the target with the given IP, queued now.
+func newJob(ip string) job {
+	id := make([]byte, 8)
+	// rand.Read never returns an error
+	rand.Read(id)
+	return job{id: hex.EncodeToString(id), ip: ip, queued: time.Now()}
+}
@@ -0,0 +1,114 @@
+package scan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+	"golang.org/x/sync/semaphore"
+)
+
+func Test_newJob(t *testing.T) {
+	a, b := newJob("10.0.0.1"), newJob("10.0.0.1")
+	if a.id == "" || a.id == b.id {
+		t.Errorf("newJob() IDs are %q and %q, want distinct ones", a.id, b.id)
+	}
+	if a.ip != "10.0.0.1" || a.queued.IsZero() {
+		t.Errorf("newJob() = %+v, want a job for 10.0.0.1 queued now", a)
+	}
+}
+
+func TestScanner_run_job(t *testing.T) {
+	s := &Scanner{
+		Logger:  logger.New("error"),
+		Lock:    semaphore.NewWeighted(4),
+		pool:    newPool(4),
+		Timeout: time.Second,
+	}
+	tgt := &target{name: "app", ip: "127.0.0.1", ports: "1-1100", intervals: [][2]int{{1, 1100}}, stop: make(chan struct{})}
+	s.Targets = []*target{tgt}
+
+	j := newJob(tgt.ip)
+	scanIsOver := make(chan scanReport, 1)
+	if err := s.run(context.Background(), j, scanIsOver, make(chan portResult, 1100)); err != nil {
+		t.Fatal(err)
+	}
+
+	report := <-scanIsOver
+	if report.job.id != j.id {
+		t.Errorf("run() reported job %q, want %q", report.job.id, j.id)
+	}
+	if report.start.Before(j.queued) || report.end.Before(report.start) {
+		t.Errorf("run() reported job queued at %s, started at %s and finished at %s", j.queued, report.start, report.end)
+	}
+	// The ports are split in a full batch and a partial one
+	if len(report.batches) != 2 {
+		t.Errorf("run() reported %d batches, want 2", len(report.batches))
+	}
+}
+
+func TestScanner_receiver_jobTiming(t *testing.T) {
+	s := &Scanner{Logger: logger.New("error"), Results: results.New(), conf: &config.Conf{}}
+	scanIsOver := make(chan scanReport)
+	mchan := make(chan metrics.NewMetrics, 2)
+	startReceiver(t, s, scanIsOver, make(chan portResult), mchan)
+
+	dual := &target{name: "web", ip: "10.0.0.1", ipv6: "fd00::1", stop: make(chan struct{})}
+	j := newJob(dual.ip)
+	start := j.queued.Add(time.Second)
+	scanIsOver <- scanReport{
+		t:       dual,
+		job:     j,
+		start:   start,
+		end:     start.Add(time.Minute),
+		batches: []time.Duration{time.Minute},
+		ctx:     context.Background(),
+	}
+
+	v4, v6 := <-mchan, <-mchan
+	if v4.Job == nil || !v4.Job.Queued.Equal(j.queued) || !v4.Job.Started.Equal(start) || len(v4.Job.Batches) != 1 {
+		t.Errorf("receiver() sent job timing %+v, want the one of the report", v4.Job)
+	}
+	if v6.Job != nil {
+		t.Errorf("receiver() sent job timing with the IPv6 metrics")
+	}
+	for _, nm := range []metrics.NewMetrics{v4, v6} {
+		if nm.ScanID != j.id || !nm.Start.Equal(start) {
+			t.Errorf("receiver() sent scan %s started at %s for %s, want %s started at %s", nm.ScanID, nm.Start, nm.IP, j.id, start)
+		}
+	}
+}
+
+func TestTarget_scheduler_missedTicks(t *testing.T) {
+	tgt := &target{name: "web", ip: "10.0.0.1", tcpPeriod: "10ms", stop: make(chan struct{})}
+	// The scan queue only holds the scan started at launch
+	trigger := make(chan job, 1)
+	missed := make(chan time.Time, 16)
+	tgt.scheduler(logger.New("error"), trigger, nil, func(tick time.Time) { missed <- tick })
+
+	j := <-trigger
+	if j.scheduled.IsZero() {
+		t.Errorf("scheduler() sent a job without schedule at launch")
+	}
+	trigger <- j
+	select {
+	case <-missed:
+	case <-time.After(time.Second):
+		t.Fatalf("scheduler() did not report missed ticks while the queue was full")
+	}
+
+	<-trigger
+	select {
+	case j := <-trigger:
+		if j.scheduled.IsZero() {
+			t.Errorf("scheduler() sent a job without schedule")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("scheduler() did not trigger scans once the queue was free")
+	}
+	close(tgt.stop)
+}
@@ -0,0 +1,108 @@
+package scan
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// arpTablePath is the path of the ARP table of the system, which holds the
+// MAC addresses of the IPv4 neighbours.
+const arpTablePath = "/proc/net/arp"
+
+// defaultOUIPaths are the paths where systems install the IEEE OUI
+// registry, tried when none is configured.
+var defaultOUIPaths = []string{
+	"/usr/share/ieee-data/oui.txt",
+	"/usr/share/hwdata/oui.txt",
+	"/usr/share/misc/oui.txt",
+}
+
+// lookupMAC returns the MAC address of a neighbour from the ARP table at path,
+// or an empty string if the address is not on the local segment or has not
+// been resolved.
+func lookupMAC(path, ip string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	// Lines hold the IP address, the hardware type, the flags and the MAC
+	// address, the first one being a header
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 || fields[0] != ip {
+			continue
+		}
+		// Incomplete entries have no MAC address
+		if fields[2] == "0x0" || fields[3] == "00:00:00:00:00:00" {
+			return ""
+		}
+		return fields[3]
+	}
+	return ""
+}
+
+// ouiRegistry associates the OUI of MAC addresses, as 6 uppercase hexadecimal
+// digits, with the name of their vendor.
+type ouiRegistry map[string]string
+
+// loadOUI reads the IEEE OUI registry at path. Without path, the registry is
+// read from the usual locations, and an empty registry is returned if none
+// exists.
+func loadOUI(path string) (ouiRegistry, error) {
+	if path != "" {
+		return readOUI(path)
+	}
+	for _, p := range defaultOUIPaths {
+		reg, err := readOUI(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return reg, err
+	}
+	return ouiRegistry{}, nil
+}
+
+// readOUI reads an IEEE OUI registry, whose vendors are given on lines such
+// as "00-1A-2B   (hex)		Vendor".
+func readOUI(path string) (ouiRegistry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reg := make(ouiRegistry)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		prefix, vendor, ok := strings.Cut(sc.Text(), "(hex)")
+		if !ok {
+			continue
+		}
+		oui := strings.ReplaceAll(strings.TrimSpace(prefix), "-", "")
+		if len(oui) != 6 {
+			continue
+		}
+		reg[strings.ToUpper(oui)] = strings.TrimSpace(vendor)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read OUI registry %s: %w", path, err)
+	}
+	return reg, nil
+}
+
+// vendor returns the vendor of a MAC address, or an empty string if it is
+// unknown.
+func (r ouiRegistry) vendor(mac string) string {
+	oui := strings.ToUpper(strings.NewReplacer(":", "", "-", "").Replace(mac))
+	if len(oui) < 6 {
+		return ""
+	}
+	return r[oui[:6]]
+}
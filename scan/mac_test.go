@@ -0,0 +1,118 @@
+package scan
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const arpTable = `IP address       HW type     Flags       HW address            Mask     Device
+10.0.0.1         0x1         0x2         52:54:00:12:34:56     *        eth0
+10.0.0.2         0x1         0x0         00:00:00:00:00:00     *        eth0
+`
+
+const ouiFile = `OUI/MA-L                                                    Organization
+company_id                                                  Organization
+                                                            Address
+
+52-54-00   (hex)		QEMU virtual NIC
+525400     (base 16)		QEMU virtual NIC
+
+00-1A-2B   (hex)		Ayecom Technology Co., Ltd.
+001A2B     (base 16)		Ayecom Technology Co., Ltd.
+`
+
+// writeFile writes content to a temporary file and returns its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func Test_lookupMAC(t *testing.T) {
+	path := writeFile(t, "arp", arpTable)
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "10.0.0.1", want: "52:54:00:12:34:56"},
+		{ip: "10.0.0.2", want: ""},
+		{ip: "10.0.0.3", want: ""},
+	}
+	for _, tt := range tests {
+		if got := lookupMAC(path, tt.ip); got != tt.want {
+			t.Errorf("lookupMAC(%s) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func Test_ouiRegistry_vendor(t *testing.T) {
+	reg, err := loadOUI(writeFile(t, "oui.txt", ouiFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		mac  string
+		want string
+	}{
+		{mac: "52:54:00:12:34:56", want: "QEMU virtual NIC"},
+		{mac: "00:1a:2b:00:00:01", want: "Ayecom Technology Co., Ltd."},
+		{mac: "00-1A-2B-00-00-01", want: "Ayecom Technology Co., Ltd."},
+		{mac: "02:fc:00:00:00:05", want: ""},
+		{mac: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := reg.vendor(tt.mac); got != tt.want {
+			t.Errorf("vendor(%s) = %q, want %q", tt.mac, got, tt.want)
+		}
+	}
+
+	if _, err := loadOUI(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Errorf("loadOUI() of a missing configured file succeeded")
+	}
+}
+
+func TestScanner_receiver_mac(t *testing.T) {
+	reg, err := loadOUI(writeFile(t, "oui.txt", ouiFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	macs := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "macs"}, []string{"name", "ip", "mac", "vendor", "owner"})
+	s := &Scanner{
+		Results:     results.New(),
+		conf:        &config.Conf{},
+		oui:         reg,
+		arpTable:    writeFile(t, "arp", arpTable),
+		MetricsServ: metrics.Server{TargetMAC: macs},
+	}
+	scanIsOver := make(chan scanReport)
+	singleResult := make(chan portResult)
+	startReceiver(t, s, scanIsOver, singleResult, make(chan metrics.NewMetrics, 2))
+
+	tgt := &target{name: "rogue", ip: "10.0.0.1", stop: make(chan struct{})}
+	singleResult <- portResult{ip: tgt.ip, port: "22", open: true}
+	scanIsOver <- scanReport{t: tgt, ctx: context.Background()}
+
+	// The receiver is done with the previous report once it takes a new one
+	scanIsOver <- scanReport{t: &target{ip: "10.0.0.3", stop: make(chan struct{})}, ctx: context.Background()}
+
+	got, _ := s.Results.Get(tgt.ip)
+	if got.MAC != "52:54:00:12:34:56" || got.Vendor != "QEMU virtual NIC" {
+		t.Errorf("receiver() saved MAC %q and vendor %q, want the ones of the ARP table", got.MAC, got.Vendor)
+	}
+	if v := testutil.ToFloat64(macs.WithLabelValues("rogue", "10.0.0.1", "52:54:00:12:34:56", "QEMU virtual NIC", "")); v != 1 {
+		t.Errorf("MAC info metric = %v, want 1", v)
+	}
+}
@@ -0,0 +1,143 @@
+package scan
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+// ndpHopLimit is the hop limit of neighbor discovery messages, which are
+// dropped by receivers when they crossed a router.
+const ndpHopLimit = 255
+
+// errNotOnLink is returned when probing a neighbor which is not on the local
+// segment.
+var errNotOnLink = errors.New("not on the local segment")
+
+// onLinkInterface returns the interface through which an IPv6 address is
+// directly reachable, with the address of the interface on the same network.
+func onLinkInterface(ip net.IP) (*net.Interface, net.IP, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if ok && ipnet.IP.To4() == nil && ipnet.Contains(ip) {
+				return &iface, ipnet.IP, nil
+			}
+		}
+	}
+	return nil, nil, errNotOnLink
+}
+
+// solicitedNodeAddr returns the solicited-node multicast address of an IPv6
+// address, to which its neighbor solicitations are sent.
+func solicitedNodeAddr(ip net.IP) net.IP {
+	addr := net.ParseIP("ff02::1:ff00:0")
+	copy(addr[13:], ip.To16()[13:])
+	return addr
+}
+
+// neighborSolicitation builds a neighbor solicitation for target, announcing
+// the link-layer address of the sender.
+func neighborSolicitation(target net.IP, mac net.HardwareAddr) ([]byte, error) {
+	// The reserved field is followed by the target address and the source
+	// link-layer address option, whose length is given in units of 8 bytes
+	body := make([]byte, 4, 4+net.IPv6len+2+len(mac))
+	body = append(body, target.To16()...)
+	if len(mac) > 0 {
+		body = append(body, 1, byte((2+len(mac)+7)/8))
+		body = append(body, mac...)
+	}
+	msg := icmp.Message{
+		Type: ipv6.ICMPTypeNeighborSolicitation,
+		Body: &icmp.RawBody{Data: body},
+	}
+	// The checksum of ICMPv6 messages is computed by the kernel
+	return msg.Marshal(nil)
+}
+
+// isNeighborAdvertisement reports whether a message is a neighbor
+// advertisement for target.
+func isNeighborAdvertisement(b []byte, target net.IP) bool {
+	msg, err := icmp.ParseMessage(ipv6.ICMPTypeNeighborAdvertisement.Protocol(), b)
+	if err != nil || msg.Type != ipv6.ICMPTypeNeighborAdvertisement {
+		return false
+	}
+	body, ok := msg.Body.(*icmp.RawBody)
+	if !ok || len(body.Data) < 4+net.IPv6len {
+		return false
+	}
+	return bytes.Equal(body.Data[4:4+net.IPv6len], target.To16())
+}
+
+// ndpProbe checks that an IPv6 address on the local segment is reachable
+// using neighbor discovery: a neighbor solicitation is sent to the address,
+// which must answer with a neighbor advertisement before the timeout.
+// errNotOnLink is returned for addresses which are not on the local segment.
+func ndpProbe(addr string, timeout time.Duration) (bool, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil || ip.To4() != nil {
+		return false, fmt.Errorf("%s is not an IPv6 address", addr)
+	}
+	iface, src, err := onLinkInterface(ip)
+	if err != nil {
+		return false, err
+	}
+
+	c, err := icmp.ListenPacket("ip6:ipv6-icmp", src.String())
+	if err != nil {
+		return false, err
+	}
+	defer c.Close()
+	p := c.IPv6PacketConn()
+
+	var filter ipv6.ICMPFilter
+	filter.SetAll(true)
+	filter.Accept(ipv6.ICMPTypeNeighborAdvertisement)
+	if err := p.SetICMPFilter(&filter); err != nil {
+		return false, err
+	}
+
+	msg, err := neighborSolicitation(ip, iface.HardwareAddr)
+	if err != nil {
+		return false, err
+	}
+	cm := &ipv6.ControlMessage{HopLimit: ndpHopLimit, IfIndex: iface.Index}
+	dst := &net.IPAddr{IP: solicitedNodeAddr(ip), Zone: iface.Name}
+	if _, err := p.WriteTo(msg, cm, dst); err != nil {
+		return false, err
+	}
+
+	if err := p.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return false, err
+	}
+	b := make([]byte, 1500)
+	for {
+		n, _, _, err := p.ReadFrom(b)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if isNeighborAdvertisement(b[:n], ip) {
+			return true, nil
+		}
+	}
+}
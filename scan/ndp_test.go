@@ -0,0 +1,86 @@
+package scan
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv6"
+)
+
+func Test_solicitedNodeAddr(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "fe80::2aa:ff:fe28:9c5a", want: "ff02::1:ff28:9c5a"},
+		{ip: "2001:db8::1", want: "ff02::1:ff00:1"},
+	}
+	for _, tt := range tests {
+		if got := solicitedNodeAddr(net.ParseIP(tt.ip)).String(); got != tt.want {
+			t.Errorf("solicitedNodeAddr(%s) = %s, want %s", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func Test_neighborSolicitation(t *testing.T) {
+	target := net.ParseIP("fd00::2")
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+
+	b, err := neighborSolicitation(target, mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := icmp.ParseMessage(ipv6.ICMPTypeNeighborSolicitation.Protocol(), b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := msg.Body.(*icmp.RawBody).Data
+	if msg.Type != ipv6.ICMPTypeNeighborSolicitation || !bytes.Equal(body[4:20], target.To16()) {
+		t.Errorf("neighborSolicitation() = %v, want a solicitation for %s", msg, target)
+	}
+	if opt := body[20:]; !bytes.Equal(opt, append([]byte{1, 1}, mac...)) {
+		t.Errorf("neighborSolicitation() has option %v, want the source link-layer address", opt)
+	}
+}
+
+func Test_isNeighborAdvertisement(t *testing.T) {
+	target := net.ParseIP("fd00::2")
+	message := func(typ icmp.Type, ip net.IP) []byte {
+		b, err := (&icmp.Message{Type: typ, Body: &icmp.RawBody{Data: append(make([]byte, 4), ip.To16()...)}}).Marshal(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	tests := []struct {
+		name string
+		msg  []byte
+		want bool
+	}{
+		{name: "advertisement", msg: message(ipv6.ICMPTypeNeighborAdvertisement, target), want: true},
+		{name: "other target", msg: message(ipv6.ICMPTypeNeighborAdvertisement, net.ParseIP("fd00::3")), want: false},
+		{name: "solicitation", msg: message(ipv6.ICMPTypeNeighborSolicitation, target), want: false},
+		{name: "truncated", msg: message(ipv6.ICMPTypeNeighborAdvertisement, target)[:10], want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isNeighborAdvertisement(tt.msg, target); got != tt.want {
+				t.Errorf("isNeighborAdvertisement() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ndpProbe_invalid(t *testing.T) {
+	if _, err := ndpProbe("10.0.0.1", time.Second); err == nil {
+		t.Errorf("ndpProbe() of an IPv4 address succeeded")
+	}
+	// The documentation prefix is never on the local segment
+	if _, err := ndpProbe("2001:db8::1", time.Second); !errors.Is(err, errNotOnLink) {
+		t.Errorf("ndpProbe() error = %v, want errNotOnLink", err)
+	}
+}
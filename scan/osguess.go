@@ -0,0 +1,26 @@
+package scan
+
+// OS families guessed from the TTL of the replies of targets.
+const (
+	osLinux         = "linux"
+	osWindows       = "windows"
+	osNetworkDevice = "network-device"
+)
+
+// osFamily guesses the OS family of a target from the TTL of its replies.
+// Systems send packets with an initial TTL of 64 (Linux and other Unix
+// systems), 128 (Windows) or 255 (routers, switches and firewalls), which is
+// decremented by each hop, so the observed TTL is rounded up to the closest
+// initial one. It returns an empty string when no TTL has been observed.
+func osFamily(ttl int) string {
+	switch {
+	case ttl <= 0:
+		return ""
+	case ttl <= 64:
+		return osLinux
+	case ttl <= 128:
+		return osWindows
+	default:
+		return osNetworkDevice
+	}
+}
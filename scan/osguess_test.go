@@ -0,0 +1,57 @@
+package scan
+
+import (
+	"context"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func Test_osFamily(t *testing.T) {
+	tests := []struct {
+		ttl  int
+		want string
+	}{
+		{ttl: 0, want: ""},
+		{ttl: 64, want: osLinux},
+		{ttl: 52, want: osLinux},
+		{ttl: 65, want: osWindows},
+		{ttl: 116, want: osWindows},
+		{ttl: 128, want: osWindows},
+		{ttl: 242, want: osNetworkDevice},
+		{ttl: 255, want: osNetworkDevice},
+	}
+	for _, tt := range tests {
+		if got := osFamily(tt.ttl); got != tt.want {
+			t.Errorf("osFamily(%d) = %q, want %q", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestScanner_receiver_osFamily(t *testing.T) {
+	s := &Scanner{Results: results.New(), conf: &config.Conf{}}
+	scanIsOver := make(chan scanReport)
+	singleResult := make(chan portResult)
+	startReceiver(t, s, scanIsOver, singleResult, make(chan metrics.NewMetrics, 2))
+
+	tgt := &target{name: "unknown", ip: "10.0.0.1", ipv6: "fd00::1", stop: make(chan struct{})}
+	tgt.replyTTL.Store(117)
+	singleResult <- portResult{ip: tgt.ip, port: "22", open: true}
+	singleResult <- portResult{ip: tgt.ip, port: "3389", open: true, window: 64240}
+	singleResult <- portResult{ip: tgt.ipv6, port: "3389", open: true, window: 65535}
+	scanIsOver <- scanReport{t: tgt, ctx: context.Background()}
+
+	// The receiver is done with the previous report once it takes a new one
+	scanIsOver <- scanReport{t: &target{ip: "10.0.0.2", stop: make(chan struct{})}, ctx: context.Background()}
+
+	v4, _ := s.Results.Get(tgt.ip)
+	if v4.TTL != 117 || v4.TCPWindow != 64240 || v4.OSFamily != osWindows {
+		t.Errorf("receiver() saved %+v, want TTL 117, window 64240 and OS family windows", v4)
+	}
+	v6, _ := s.Results.Get(tgt.ipv6)
+	if v6.TTL != 0 || v6.TCPWindow != 65535 || v6.OSFamily != "" {
+		t.Errorf("receiver() saved %+v, want window 65535 only", v6)
+	}
+}
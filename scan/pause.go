@@ -0,0 +1,101 @@
+package scan
+
+import (
+	"time"
+)
+
+// Pause suspends the scans of the targets with the given name for a duration,
+// or until they are resumed when d is not positive. Their findings are not
+// updated meanwhile. It reports whether such a target exists.
+func (s *Scanner) Pause(name string, d time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.targetByName(name) == nil {
+		return false
+	}
+
+	if s.pauses == nil {
+		s.pauses = make(map[string]time.Time)
+	}
+	if d <= 0 {
+		// The zero time marks the pauses without end
+		s.pauses[name] = time.Time{}
+		s.setPausedMetrics(name)
+		s.Logger.Info().Str("name", name).Msgf("scans of %s paused until resumed", name)
+		return true
+	}
+
+	until := time.Now().Add(d)
+	s.pauses[name] = until
+	s.setPausedMetrics(name)
+	s.Logger.Info().Str("name", name).Msgf("scans of %s paused until %s", name, until.Format(time.RFC3339))
+
+	time.AfterFunc(d, func() { s.endPause(name, until) })
+	return true
+}
+
+// Resume ends the pause of the targets with the given name, if any. Targets
+// paused in configuration stay paused. It reports whether such a target
+// exists.
+func (s *Scanner) Resume(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.targetByName(name) == nil {
+		return false
+	}
+	if _, ok := s.pauses[name]; !ok {
+		return true
+	}
+	delete(s.pauses, name)
+	s.setPausedMetrics(name)
+	s.Logger.Info().Str("name", name).Msgf("scans of %s resumed", name)
+	return true
+}
+
+// endPause ends the pause of the targets with the given name if it is still
+// the one ending at until.
+func (s *Scanner) endPause(name string, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.pauses[name]; !ok || !current.Equal(until) {
+		return
+	}
+	delete(s.pauses, name)
+	s.setPausedMetrics(name)
+	s.Logger.Info().Str("name", name).Msgf("scans of %s resumed", name)
+}
+
+// paused reports whether the scans of a target are suspended, either by its
+// configuration or through the API.
+func (s *Scanner) paused(t *target) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.pausedLocked(t)
+}
+
+// pausedLocked is paused for callers holding the lock.
+func (s *Scanner) pausedLocked(t *target) bool {
+	until, ok := s.pauses[t.name]
+	return t.paused || ok && (until.IsZero() || time.Now().Before(until))
+}
+
+// setPausedMetrics exports the pause state of the targets with the given
+// name. It must be called with the lock held, so that the metrics of removed
+// targets are not recreated.
+func (s *Scanner) setPausedMetrics(name string) {
+	for _, t := range s.Targets {
+		if t.name != name {
+			continue
+		}
+		paused := 0.
+		if s.pausedLocked(t) {
+			paused = 1
+		}
+		for _, addr := range t.addresses() {
+			s.MetricsServ.TargetPaused.WithLabelValues(t.name, addr, t.labels["owner"]).Set(paused)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package scan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestScanner_Pause(t *testing.T) {
+	paused := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "paused"}, []string{"name", "ip", "owner"})
+	s := &Scanner{
+		Logger:  logger.New("error"),
+		Timeout: time.Second,
+		Lock:    semaphore.NewWeighted(4),
+		pool:    newPool(4),
+		conf:    &config.Conf{},
+		MetricsServ: metrics.Server{
+			NumOfTargets:    prometheus.NewGauge(prometheus.GaugeOpts{Name: "targets"}),
+			PortAnnotations: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "annotations"}, []string{"name", "ip", "port", "annotation", "owner"}),
+			TargetInfo:      prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "info"}, []string{"name", "ip", "owner", "description"}),
+			TargetPaused:    paused,
+		},
+	}
+	for _, tgt := range []config.Target{
+		{Name: "web", IP: "127.0.0.1", Range: "1"},
+		{Name: "rebuilt", IP: "127.0.0.2", Range: "1", Paused: true},
+	} {
+		if err := s.AddTarget(tgt, sourceConfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// scanned reports whether running the scan of ip sends a report
+	scanned := func(ip string) bool {
+		scanIsOver := make(chan scanReport, 1)
+		if err := s.run(context.Background(), newJob(ip), scanIsOver, make(chan portResult, 2)); err != nil {
+			t.Fatal(err)
+		}
+		return len(scanIsOver) == 1
+	}
+
+	if got := testutil.ToFloat64(paused.WithLabelValues("rebuilt", "127.0.0.2", "")); got != 1 {
+		t.Errorf("target paused in configuration has paused metric %v, want 1", got)
+	}
+	if scanned("127.0.0.2") {
+		t.Errorf("target paused in configuration was scanned")
+	}
+
+	if s.Pause("unknown", time.Hour) {
+		t.Errorf("Pause() of an unknown target = true, want false")
+	}
+	if !s.Pause("web", 50*time.Millisecond) {
+		t.Fatalf("Pause() = false, want true")
+	}
+	if got := testutil.ToFloat64(paused.WithLabelValues("web", "127.0.0.1", "")); got != 1 {
+		t.Errorf("paused target has paused metric %v, want 1", got)
+	}
+	if scanned("127.0.0.1") {
+		t.Errorf("paused target was scanned")
+	}
+
+	// The pause ends by itself
+	time.Sleep(100 * time.Millisecond)
+	if got := testutil.ToFloat64(paused.WithLabelValues("web", "127.0.0.1", "")); got != 0 {
+		t.Errorf("target has paused metric %v after its pause, want 0", got)
+	}
+	if !scanned("127.0.0.1") {
+		t.Errorf("target was not scanned after its pause")
+	}
+
+	// Pauses without duration last until the target is resumed
+	if !s.Pause("web", 0) {
+		t.Fatalf("Pause() = false, want true")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if scanned("127.0.0.1") {
+		t.Errorf("target paused until resumed was scanned")
+	}
+	if s.Resume("unknown") {
+		t.Errorf("Resume() of an unknown target = true, want false")
+	}
+	if !s.Resume("web") {
+		t.Fatalf("Resume() = false, want true")
+	}
+	if got := testutil.ToFloat64(paused.WithLabelValues("web", "127.0.0.1", "")); got != 0 {
+		t.Errorf("resumed target has paused metric %v, want 0", got)
+	}
+	if !scanned("127.0.0.1") {
+		t.Errorf("resumed target was not scanned")
+	}
+
+	// Resuming does not override the configuration
+	if !s.Resume("rebuilt") {
+		t.Fatalf("Resume() = false, want true")
+	}
+	if scanned("127.0.0.2") {
+		t.Errorf("target paused in configuration was scanned after a resume")
+	}
+}
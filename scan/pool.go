@@ -0,0 +1,115 @@
+package scan
+
+import (
+	"context"
+	"sync"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// pool runs the probes of all the scans on a bounded set of workers. Each scan
+// queues its probes in its own queue, and the workers take the next probe of
+// the queues in turn, so that the scan of a full range cannot starve the scans
+// running alongside it. It is safe for concurrent use.
+type pool struct {
+	mu    sync.Mutex
+	ready *sync.Cond
+	// queues holds the queues with pending probes, served in turn from
+	// next
+	queues []*poolQueue
+	next   int
+	closed bool
+	// workers is the number of workers, and the number of pending probes
+	// of each queue
+	workers int
+	wg      sync.WaitGroup
+}
+
+// poolQueue holds the pending probes of a scan.
+type poolQueue struct {
+	p     *pool
+	tasks []func()
+	// space limits the number of pending probes, so that the memory used
+	// by the scans of full ranges stays flat
+	space *semaphore.Weighted
+}
+
+// newPool starts a pool of workers.
+func newPool(workers int) *pool {
+	p := &pool{workers: workers}
+	p.ready = sync.NewCond(&p.mu)
+	for range workers {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// work runs the pending probes until the pool is closed and no probe is
+// pending anymore.
+func (p *pool) work() {
+	defer p.wg.Done()
+	for {
+		p.mu.Lock()
+		for len(p.queues) == 0 && !p.closed {
+			p.ready.Wait()
+		}
+		if len(p.queues) == 0 {
+			p.mu.Unlock()
+			return
+		}
+
+		// Queues leave the ring once empty, so that the following one is
+		// served next
+		p.next %= len(p.queues)
+		q := p.queues[p.next]
+		task := q.tasks[0]
+		q.tasks[0] = nil
+		q.tasks = q.tasks[1:]
+		if len(q.tasks) == 0 {
+			p.queues = append(p.queues[:p.next], p.queues[p.next+1:]...)
+		} else {
+			p.next++
+		}
+		p.mu.Unlock()
+
+		q.space.Release(1)
+		task()
+	}
+}
+
+// close stops the workers once the pending probes are run, and waits for
+// them.
+func (p *pool) close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.ready.Broadcast()
+	p.wg.Wait()
+}
+
+// queue creates the queue of a scan, holding at most as many pending probes as
+// there are workers.
+func (p *pool) queue() *poolQueue {
+	return &poolQueue{p: p, space: semaphore.NewWeighted(int64(max(p.workers, 1)))}
+}
+
+// submit queues a probe, waiting for room in the queue. It returns the error
+// of ctx if it is done first.
+func (q *poolQueue) submit(ctx context.Context, task func()) error {
+	if err := q.space.Acquire(ctx, 1); err != nil {
+		return err
+	}
+
+	q.p.mu.Lock()
+	if len(q.tasks) == 0 {
+		q.p.queues = append(q.p.queues, q)
+	}
+	q.tasks = append(q.tasks, task)
+	q.p.mu.Unlock()
+	q.p.ready.Signal()
+	return nil
+}
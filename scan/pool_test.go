@@ -0,0 +1,110 @@
+package scan
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+func Test_pool_fairness(t *testing.T) {
+	p := newPool(1)
+	defer p.close()
+
+	// The worker is held while the probes of both scans are queued
+	started, blocked := make(chan struct{}), make(chan struct{})
+	if err := p.queue().submit(context.Background(), func() { close(started); <-blocked }); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	var mu sync.Mutex
+	var order []string
+	wg := sync.WaitGroup{}
+	huge, small := p.queue(), p.queue()
+	huge.space = semaphore.NewWeighted(10)
+	probe := func(q *poolQueue, name string) {
+		wg.Add(1)
+		err := q.submit(context.Background(), func() {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			order = append(order, name)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for range 3 {
+		probe(huge, "huge")
+	}
+	probe(small, "small")
+	close(blocked)
+	wg.Wait()
+
+	want := []string{"huge", "small", "huge", "huge"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("probes ran in order %v, want %v", order, want)
+	}
+}
+
+func Test_pool_bounded(t *testing.T) {
+	p := newPool(3)
+	var running, maxRunning, done atomic.Int64
+	wg := sync.WaitGroup{}
+	for range 4 {
+		q := p.queue()
+		for range 10 {
+			wg.Add(1)
+			err := q.submit(context.Background(), func() {
+				defer wg.Done()
+				n := running.Add(1)
+				for m := maxRunning.Load(); n > m && !maxRunning.CompareAndSwap(m, n); m = maxRunning.Load() {
+				}
+				time.Sleep(time.Millisecond)
+				running.Add(-1)
+				done.Add(1)
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	wg.Wait()
+	p.close()
+
+	if done.Load() != 40 {
+		t.Errorf("%d probes ran, want 40", done.Load())
+	}
+	if maxRunning.Load() > 3 {
+		t.Errorf("%d probes ran at the same time, want at most 3", maxRunning.Load())
+	}
+}
+
+func Test_poolQueue_submit_canceled(t *testing.T) {
+	p := newPool(1)
+	defer p.close()
+
+	// The worker is held and the queue is full, so the next probe cannot
+	// be queued
+	started, blocked := make(chan struct{}), make(chan struct{})
+	defer close(blocked)
+	q := p.queue()
+	if err := q.submit(context.Background(), func() { close(started); <-blocked }); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := q.submit(context.Background(), func() {}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.submit(ctx, func() {}); err == nil {
+		t.Error("submit() queued a probe in a full queue")
+	}
+}
@@ -0,0 +1,85 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/devops-works/scan-exporter/handlers"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/semaphore"
+)
+
+// maxProbePorts is the maximum number of ports probed on demand through the
+// API, so that a scrape cannot hold the probes of the scans for long.
+const maxProbePorts = 1024
+
+// ProbeResult is the result of probing a single port.
+type ProbeResult struct {
+	Port    int
+	Open    bool
+	Latency time.Duration
+}
+
+// Probe probes the ports of ip with the given number of workers and timeout,
+// using the same probe as the scans. The results are in the order of the
+// ports.
+func Probe(ip string, ports []int, workers int, timeout time.Duration) []ProbeResult {
+	s := &Scanner{Timeout: timeout, Logger: zerolog.Nop()}
+	results, _ := s.probe(context.Background(), ip, ports, semaphore.NewWeighted(int64(workers)))
+	return results
+}
+
+// ProbePorts probes the ports of ip on demand, sharing the limit of
+// simultaneous probes and the timeout of the scans. The results are in the
+// order of the ports.
+func (s *Scanner) ProbePorts(ctx context.Context, ip, ranges string) ([]handlers.PortProbe, error) {
+	ports, err := readPortsRange(ranges)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", handlers.ErrInvalidProbe, err)
+	}
+	if len(ports) == 0 || len(ports) > maxProbePorts {
+		return nil, fmt.Errorf("%w: between 1 and %d ports are expected, got %d", handlers.ErrInvalidProbe, maxProbePorts, len(ports))
+	}
+
+	results, err := s.probe(ctx, ip, ports, s.Lock)
+	if err != nil {
+		return nil, err
+	}
+	probes := make([]handlers.PortProbe, len(results))
+	for i, r := range results {
+		probes[i] = handlers.PortProbe{Port: r.Port, Open: r.Open, Latency: r.Latency}
+	}
+	return probes, nil
+}
+
+// probe probes the ports of ip, each one holding lock while it is probed. It
+// stops starting probes once ctx is done, and returns its error.
+func (s *Scanner) probe(ctx context.Context, ip string, ports []int, lock *semaphore.Weighted) ([]ProbeResult, error) {
+	results := make([]ProbeResult, len(ports))
+	wg := sync.WaitGroup{}
+	for i, port := range ports {
+		if err := lock.Acquire(ctx, 1); err != nil {
+			wg.Wait()
+			return nil, err
+		}
+		wg.Add(1)
+		go func() {
+			defer lock.Release(1)
+			defer wg.Done()
+
+			singleResult := make(chan portResult, 1)
+			start := time.Now()
+			s.scanPort(ctx, ip, port, nil, nil, nil, nil, nil, nil, singleResult)
+			res := <-singleResult
+			results[i] = ProbeResult{
+				Port:    port,
+				Open:    res.open,
+				Latency: time.Since(start),
+			}
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
@@ -0,0 +1,77 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/handlers"
+	"github.com/rs/zerolog"
+	"golang.org/x/sync/semaphore"
+)
+
+func TestScanner_ProbePorts(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	open := ln.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name     string
+		ports    string
+		canceled bool
+		want     map[int]bool
+		wantErr  error
+	}{
+		{name: "open and closed", ports: fmt.Sprintf("%d,%d", closedPort, open), want: map[int]bool{open: true, closedPort: false}},
+		{name: "invalid ports", ports: "22-abc", wantErr: handlers.ErrInvalidProbe},
+		{name: "too many ports", ports: "1-2000", wantErr: handlers.ErrInvalidProbe},
+		{name: "canceled", ports: fmt.Sprint(open), canceled: true, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{Timeout: time.Second, Logger: zerolog.Nop(), Lock: semaphore.NewWeighted(4)}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.canceled {
+				// The limit is held by the scans
+				s.Lock.Acquire(ctx, 4)
+				cancel()
+			}
+
+			got, err := s.ProbePorts(ctx, "127.0.0.1", tt.ports)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ProbePorts() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ProbePorts() = %+v, want %d results", got, len(tt.want))
+			}
+			for _, p := range got {
+				if open, ok := tt.want[p.Port]; !ok || p.Open != open {
+					t.Errorf("ProbePorts() port %d open = %v, want %v", p.Port, p.Open, open)
+				}
+			}
+		})
+	}
+}
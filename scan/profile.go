@@ -0,0 +1,60 @@
+package scan
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+)
+
+// timingProfile bundles the settings controlling how fast and how hard the
+// ports of a target are probed, like the timing templates of nmap.
+type timingProfile struct {
+	// timeout is the timeout of the probes
+	timeout time.Duration
+	// retries is the number of times a probe which timed out is sent again
+	retries int
+	// qps is the number of probes per second. A negative value removes the
+	// limit
+	qps int
+	// jitter is the share of the delay between two probes which is randomly
+	// added to it
+	jitter float64
+}
+
+// timingProfiles holds the timing profiles, from the slowest to the fastest.
+// The normal profile keeps the configured settings.
+var timingProfiles = map[string]*timingProfile{
+	"paranoid":   {timeout: 5 * time.Second, retries: 2, qps: 1, jitter: 1},
+	"polite":     {timeout: 3 * time.Second, retries: 1, qps: 10, jitter: 0.5},
+	"normal":     nil,
+	"aggressive": {timeout: 500 * time.Millisecond, qps: -1},
+}
+
+// readProfile returns the timing profile with the given name. It returns nil
+// for the normal profile, or when no profile is set.
+func readProfile(name string) (*timingProfile, error) {
+	if name == "" {
+		return nil, nil
+	}
+	p, ok := timingProfiles[name]
+	if !ok {
+		names := make([]string, 0, len(timingProfiles))
+		for n := range timingProfiles {
+			names = append(names, n)
+		}
+		slices.Sort(names)
+		return nil, fmt.Errorf("unknown timing profile %q, must be one of %s", name, strings.Join(names, ", "))
+	}
+	return p, nil
+}
+
+// jittered returns the delay d between two probes of the target, increased by
+// a random share of itself up to the jitter of the target.
+func (t *target) jittered(d time.Duration) time.Duration {
+	if d <= 0 || t.jitter == 0 {
+		return d
+	}
+	return d + time.Duration(rand.Float64()*t.jitter*float64(d))
+}
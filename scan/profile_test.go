@@ -0,0 +1,78 @@
+package scan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+func TestScanner_newTarget_profile(t *testing.T) {
+	tests := []struct {
+		name          string
+		globalProfile string
+		globalQPS     int
+		profile       string
+		qps           int
+		wantQPS       int
+		wantTimeout   time.Duration
+		wantRetries   int
+		wantErr       bool
+	}{
+		{name: "no profile", globalQPS: 100, wantQPS: 100, wantTimeout: 2 * time.Second},
+		{name: "normal profile", globalQPS: 100, profile: "normal", wantQPS: 100, wantTimeout: 2 * time.Second},
+		{name: "global profile", globalProfile: "polite", globalQPS: 100, wantQPS: 10, wantTimeout: 3 * time.Second, wantRetries: 1},
+		{name: "target profile", globalProfile: "polite", profile: "paranoid", wantQPS: 1, wantTimeout: 5 * time.Second, wantRetries: 2},
+		{name: "target rate", profile: "paranoid", qps: 50, wantQPS: 50, wantTimeout: 5 * time.Second, wantRetries: 2},
+		{name: "unlimited rate", globalQPS: 100, profile: "aggressive", wantQPS: -1, wantTimeout: 500 * time.Millisecond},
+		{name: "unknown profile", profile: "insane", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{
+				Logger:  zerolog.Nop(),
+				Timeout: 2 * time.Second,
+				conf:    &config.Conf{Profile: tt.globalProfile, QueriesPerSecond: tt.globalQPS},
+			}
+			conf := config.Target{Name: "app", IP: "127.0.0.1", Profile: tt.profile, QueriesPerSecond: tt.qps}
+			conf.TCP.Range = "reserved"
+
+			got, err := s.newTarget(conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.qps != tt.wantQPS {
+				t.Errorf("newTarget() qps = %d, want %d", got.qps, tt.wantQPS)
+			}
+			if timeout := got.dialer.probeTimeout(s.Timeout); timeout != tt.wantTimeout {
+				t.Errorf("newTarget() timeout = %s, want %s", timeout, tt.wantTimeout)
+			}
+			var retries int
+			if got.dialer != nil {
+				retries = got.dialer.retries
+			}
+			if retries != tt.wantRetries {
+				t.Errorf("newTarget() retries = %d, want %d", retries, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func Test_target_jittered(t *testing.T) {
+	tgt := &target{jitter: 0.5}
+	for range 100 {
+		if got := tgt.jittered(100 * time.Millisecond); got < 100*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("jittered(100ms) = %s, want between 100ms and 150ms", got)
+		}
+	}
+	if got := tgt.jittered(-1); got != -1 {
+		t.Errorf("jittered(-1) = %s, want no delay", got)
+	}
+	if got := (&target{}).jittered(time.Second); got != time.Second {
+		t.Errorf("jittered(1s) without jitter = %s, want 1s", got)
+	}
+}
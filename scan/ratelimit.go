@@ -0,0 +1,61 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// readRate parses a rate of probes written as <n>/<period>, such as 500/s,
+// 6000/m or 100/10s. An empty rate is unlimited, and returns rate.Inf.
+func readRate(r string) (rate.Limit, error) {
+	if r == "" {
+		return rate.Inf, nil
+	}
+	count, period, ok := strings.Cut(strings.ReplaceAll(r, " ", ""), "/")
+	if !ok {
+		return 0, fmt.Errorf("rate %q is not written as <n>/<period>", r)
+	}
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid number of probes in rate %q", r)
+	}
+	// The period may be a bare unit
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid period in rate %q", r)
+	}
+	return rate.Limit(n / d.Seconds()), nil
+}
+
+// newRateLimiter returns a token bucket limiting the probes to the given rate,
+// or nil if it is unlimited. The bucket holds a single token, so that the
+// probes are evenly spaced rather than sent in bursts.
+func newRateLimiter(r string) (*rate.Limiter, error) {
+	limit, err := readRate(r)
+	if err != nil || limit == rate.Inf {
+		return nil, err
+	}
+	return rate.NewLimiter(limit, 1), nil
+}
+
+// waitRate waits until the rate of the target and the global one allow a new
+// probe. It returns the error of ctx if it is done first.
+func (s *Scanner) waitRate(ctx context.Context, t *target) error {
+	if t.rate != nil {
+		if err := t.rate.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if s.rate != nil {
+		return s.rate.Wait(ctx)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package scan
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func Test_readRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    string
+		want    rate.Limit
+		wantErr bool
+	}{
+		{name: "unlimited", want: rate.Inf},
+		{name: "per second", rate: "500/s", want: 500},
+		{name: "per minute", rate: "6000/m", want: 100},
+		{name: "period", rate: "100/10s", want: 10},
+		{name: "spaces", rate: "50 / 500ms", want: 100},
+		{name: "fraction", rate: "0.5/s", want: 0.5},
+		{name: "no period", rate: "500", wantErr: true},
+		{name: "invalid number", rate: "many/s", wantErr: true},
+		{name: "zero", rate: "0/s", wantErr: true},
+		{name: "invalid period", rate: "500/day", wantErr: true},
+		{name: "zero period", rate: "500/0s", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readRate(tt.rate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readRate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("readRate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanner_waitRate(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		global string
+		// min is the minimum duration of 5 probes
+		min time.Duration
+	}{
+		{name: "unlimited"},
+		{name: "target", target: "50/s", min: 80 * time.Millisecond},
+		{name: "global", global: "50/s", min: 80 * time.Millisecond},
+		{name: "slowest", target: "100/s", global: "25/s", min: 160 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Scanner
+			var tg target
+			var err error
+			if s.rate, err = newRateLimiter(tt.global); err != nil {
+				t.Fatal(err)
+			}
+			if tg.rate, err = newRateLimiter(tt.target); err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			for range 5 {
+				if err := s.waitRate(context.Background(), &tg); err != nil {
+					t.Fatalf("waitRate() error = %v", err)
+				}
+			}
+			if d := time.Since(start); d < tt.min {
+				t.Errorf("5 probes took %s, want at least %s", d, tt.min)
+			}
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		s := Scanner{rate: rate.NewLimiter(1, 1)}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := s.waitRate(ctx, &target{}); err == nil {
+			t.Error("waitRate() returned no error after the context was canceled")
+		}
+	})
+}
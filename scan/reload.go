@@ -0,0 +1,58 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+// splitTargets separates the targets having an IP from the ones having only a
+// hostname, which are added once resolved.
+func splitTargets(targets []config.Target) (static, hosts []config.Target) {
+	for _, t := range targets {
+		if t.IP == "" && t.Host != "" {
+			hosts = append(hosts, t)
+		} else {
+			static = append(static, t)
+		}
+	}
+	return static, hosts
+}
+
+// Reload applies a new configuration to the running scanner. The targets of
+// the configuration file are synchronised with the new ones: removed targets
+// stop being scanned, new ones start and modified ones are replaced, while the
+// others keep their state. Nothing changes if one of the new targets is
+// invalid. The other settings and the hostname targets are only applied on
+// restart, which is logged when they changed.
+func (s *Scanner) Reload(c *config.Conf) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	if s.conf == nil {
+		return errors.New("scanner not started")
+	}
+
+	static, hosts := splitTargets(c.Targets)
+	for _, t := range static {
+		if _, err := s.validateTarget(t); err != nil && !errors.Is(err, errInvalidIP) {
+			return fmt.Errorf("invalid target %s: %w", t.Name, err)
+		}
+	}
+
+	previous, current := *s.conf, *c
+	previous.Targets, current.Targets = nil, nil
+	previous.TargetTemplates, current.TargetTemplates = nil, nil
+	if !reflect.DeepEqual(previous, current) {
+		s.Logger.Warn().Msg("settings other than the targets changed, restart scan-exporter to apply them")
+	}
+	if _, previousHosts := splitTargets(s.conf.Targets); !reflect.DeepEqual(previousHosts, hosts) {
+		s.Logger.Warn().Msg("hostname targets changed, restart scan-exporter to apply them")
+	}
+
+	s.Sync(sourceConfig, static)
+	s.Logger.Info().Msgf("configuration reloaded, %d target(s) with an IP", len(static))
+	return nil
+}
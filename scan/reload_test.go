@@ -0,0 +1,74 @@
+package scan
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+// testMetrics is the metrics server of the tests, whose metrics can only be
+// registered once.
+var testMetrics = sync.OnceValue(func() *metrics.Server { return metrics.Init("") })
+
+func TestScanner_Reload(t *testing.T) {
+	s := &Scanner{Logger: logger.New("error"), Results: results.New(), MetricsServ: *testMetrics()}
+	if err := s.Reload(&config.Conf{}); err == nil {
+		t.Errorf("Reload() before Start() error = nil, want an error")
+	}
+
+	c := &config.Conf{
+		Timeout: 1,
+		Targets: []config.Target{
+			{Name: "web", IP: "10.0.0.1"},
+			{Name: "db", IP: "10.0.0.2"},
+			{Name: "cache", IP: "10.0.0.3"},
+		},
+	}
+	s.conf = c
+	if err := s.addTargets(c.Targets, 0); err != nil {
+		t.Fatal(err)
+	}
+	web := s.Targets[0]
+
+	// A new target with an invalid range leaves the targets as they are
+	invalid := &config.Conf{Timeout: 1, Targets: []config.Target{{Name: "web", IP: "10.0.0.1"}, {Name: "bad", IP: "10.0.0.9"}}}
+	invalid.Targets[1].TCP.Range = "1-abc"
+	if err := s.Reload(invalid); err == nil {
+		t.Errorf("Reload() with an invalid target error = nil, want an error")
+	}
+	if len(s.Targets) != 3 {
+		t.Fatalf("Reload() with an invalid target left %d targets, want 3", len(s.Targets))
+	}
+
+	// db is removed, cache modified and mail added, while web is kept as is
+	err := s.Reload(&config.Conf{
+		Timeout: 1,
+		Targets: []config.Target{
+			{Name: "web", IP: "10.0.0.1"},
+			{Name: "cache", IP: "10.0.0.3", Owner: "team-cache"},
+			{Name: "mail", IP: "10.0.0.4"},
+			{Name: "resolved", Host: "mail.example.com"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+
+	got := make(map[string]*target)
+	for _, tgt := range s.Targets {
+		got[tgt.name] = tgt
+	}
+	if len(got) != 3 || got["web"] == nil || got["cache"] == nil || got["mail"] == nil {
+		t.Fatalf("Reload() left targets %v, want web, cache and mail", got)
+	}
+	if got["web"] != web {
+		t.Errorf("Reload() replaced the unchanged target web")
+	}
+	if owner := got["cache"].labels["owner"]; owner != "team-cache" {
+		t.Errorf("Reload() cache owner = %q, want team-cache", owner)
+	}
+}
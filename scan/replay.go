@@ -0,0 +1,135 @@
+package scan
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/devops-works/scan-exporter/services"
+)
+
+// Replay sends recorded scans through the metrics updater and the results
+// store, without scanning anything. The scans are replayed in the order they
+// ended, with the delays between them divided by speed. A zero speed replays
+// them without delay.
+// Targets of the configuration are used to classify the ports of their scans,
+// and the expected ports of the other targets are the recorded ones.
+func (s *Scanner) Replay(c *config.Conf, scans []results.Scan, speed float64) error {
+	s.conf = c
+
+	targets := make(map[string]bool)
+	for _, scan := range scans {
+		targets[scan.IP] = true
+	}
+	s.MetricsServ.NumOfTargets.Set(float64(len(targets)))
+
+	mchan := make(chan metrics.NewMetrics)
+	go s.MetricsServ.Updater(mchan, make(chan metrics.PingInfo), make(chan int))
+
+	return s.replay(scans, speed, mchan)
+}
+
+// replay sends the metrics of the recorded scans to mchan and saves their
+// results.
+func (s *Scanner) replay(scans []results.Scan, speed float64, mchan chan metrics.NewMetrics) error {
+	targets := make(map[string]*target)
+	for _, t := range s.conf.Targets {
+		target, err := s.newTarget(t)
+		if err != nil {
+			return err
+		}
+		targets[target.ip] = target
+	}
+
+	scans = slices.Clone(scans)
+	sort.SliceStable(scans, func(i, j int) bool {
+		return scans[i].End.Before(scans[j].End)
+	})
+
+	previous := make(map[string]*common.PortSet)
+	for i, scan := range scans {
+		if i > 0 {
+			time.Sleep(replayDelay(scans[i-1].End, scan.End, speed))
+		}
+
+		t, ok := targets[scan.IP]
+		if !ok {
+			var err error
+			t, err = s.recordedTarget(scan)
+			if err != nil {
+				return err
+			}
+			targets[t.ip] = t
+		}
+
+		open := sortedPorts(scan.Open)
+		current := common.PortSetOf(open)
+		before, scannedBefore := previous[t.ip]
+		mchan <- metrics.NewMetrics{
+			Name:     t.name,
+			IP:       t.ip,
+			Diff:     before.Diff(current),
+			Baseline: !scannedBefore,
+			Open:     open,
+			Expected: t.expected,
+			Labels:   t.labels,
+
+			ExpectedPorts: t.expectedSet,
+
+			Severities:  t.severities,
+			Annotations: t.annotations,
+
+			ChangeThreshold: t.changeThreshold,
+		}
+		previous[t.ip] = current
+
+		scan.Name = t.name
+		scan.Open = slices.Clone(open)
+		scan.Expected = t.expected
+		scan.Labels = t.labels
+		scan.Annotations = t.annotations
+		scan.Services = services.Names(services.TCP, open)
+		s.Results.Set(scan)
+	}
+	return nil
+}
+
+// recordedTarget creates a target from a recorded scan, for targets which are
+// not in the configuration.
+func (s *Scanner) recordedTarget(scan results.Scan) (*target, error) {
+	severities, err := readSeverities(s.conf.Severities, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid severities: %w", err)
+	}
+	intervals, err := readPortIntervals(scan.Range)
+	if err != nil {
+		return nil, fmt.Errorf("invalid range: %w", err)
+	}
+	return &target{
+		name:        scan.Name,
+		ip:          scan.IP,
+		ports:       scan.Range,
+		intervals:   intervals,
+		expected:    sortedPorts(scan.Expected),
+		expectedSet: common.PortSetOf(scan.Expected),
+		labels:      scan.Labels,
+		severities:  severities,
+		annotations: scan.Annotations,
+
+		changeThreshold: s.conf.ChangeThreshold,
+	}, nil
+}
+
+// replayDelay returns the time to wait between the replay of two scans ended
+// at prev and next.
+func replayDelay(prev, next time.Time, speed float64) time.Duration {
+	if speed <= 0 || !next.After(prev) {
+		return 0
+	}
+	return time.Duration(float64(next.Sub(prev)) / speed)
+}
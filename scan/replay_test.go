@@ -0,0 +1,89 @@
+package scan
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func TestScanner_replay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	conf := &config.Conf{
+		Severities: map[string]string{"critical": "22"},
+		Targets: []config.Target{{
+			Name: "web",
+			IP:   "10.0.0.1",
+		}},
+	}
+	conf.Targets[0].TCP.Expected = "80,443"
+
+	s := &Scanner{Results: results.New(), conf: conf, Logger: logger.New("error")}
+	scans := []results.Scan{
+		{Name: "db", IP: "10.0.0.2", End: start.Add(2 * time.Hour), Open: []string{"5432", "22"}, Expected: []string{"5432"}},
+		{Name: "web", IP: "10.0.0.1", End: start.Add(time.Hour), Open: []string{"80", "443", "22"}, Expected: []string{"22"}},
+		{Name: "web", IP: "10.0.0.1", End: start, Open: []string{"443", "80"}},
+	}
+	mchan := make(chan metrics.NewMetrics, len(scans))
+	if err := s.replay(scans, 0, mchan); err != nil {
+		t.Fatalf("replay() error = %v", err)
+	}
+	close(mchan)
+
+	var got []metrics.NewMetrics
+	for nm := range mchan {
+		got = append(got, nm)
+	}
+	if len(got) != len(scans) {
+		t.Fatalf("replay() sent %d metrics, want %d", len(got), len(scans))
+	}
+
+	// Scans are replayed in the order they ended
+	if got[0].IP != "10.0.0.1" || !got[0].Baseline || !reflect.DeepEqual(got[0].Open, []string{"80", "443"}) {
+		t.Errorf("replay() first metrics = %+v, want the baseline of web", got[0])
+	}
+	// The expected ports of configured targets come from the configuration
+	if got[1].Baseline || got[1].Diff != 1 || !reflect.DeepEqual(got[1].Expected, []string{"80", "443"}) {
+		t.Errorf("replay() second metrics = %+v, want a diff of 1 and configured expected ports", got[1])
+	}
+	// The expected ports of other targets are the recorded ones
+	if got[2].Name != "db" || !reflect.DeepEqual(got[2].Expected, []string{"5432"}) {
+		t.Errorf("replay() third metrics = %+v, want recorded expected ports of db", got[2])
+	}
+	for _, nm := range got {
+		if sev, _ := nm.Severities.Of(22); sev != "critical" {
+			t.Errorf("replay() severity of port 22 of %s = %q, want critical", nm.Name, sev)
+		}
+	}
+
+	web, ok := s.Results.Get("10.0.0.1")
+	if !ok || !web.End.Equal(start.Add(time.Hour)) || !reflect.DeepEqual(web.Open, []string{"22", "80", "443"}) {
+		t.Errorf("replay() saved results of web = %+v, want the latest scan", web)
+	}
+}
+
+func Test_replayDelay(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		next  time.Time
+		speed float64
+		want  time.Duration
+	}{
+		{name: "accelerated", next: start.Add(time.Hour), speed: 60, want: time.Minute},
+		{name: "real time", next: start.Add(time.Minute), speed: 1, want: time.Minute},
+		{name: "no delay", next: start.Add(time.Hour), speed: 0, want: 0},
+		{name: "same time", next: start, speed: 60, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replayDelay(start, tt.next, tt.speed); got != tt.want {
+				t.Errorf("replayDelay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
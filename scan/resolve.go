@@ -0,0 +1,164 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/reporting"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// defaultDNSTimeout is the timeout of a DNS query when none is
+	// configured.
+	defaultDNSTimeout = "5s"
+	// defaultDNSRefreshInterval is the interval between two resolutions of
+	// the hostnames of targets when none is configured.
+	defaultDNSRefreshInterval = "5m"
+)
+
+// resolver resolves the hostnames of targets. Without configured servers, the
+// system resolver is used.
+type resolver struct {
+	resolver *net.Resolver
+	search   []string
+	timeout  time.Duration
+}
+
+// newResolver creates a resolver from its configuration, which can be nil.
+func newResolver(c *config.DNS) (*resolver, error) {
+	var conf config.DNS
+	if c != nil {
+		conf = *c
+	}
+
+	timeout := conf.Timeout
+	if timeout == "" {
+		timeout = defaultDNSTimeout
+	}
+	d, err := getDuration(timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS timeout: %w", err)
+	}
+
+	r := &resolver{resolver: net.DefaultResolver, search: conf.Search, timeout: d}
+	if len(conf.Servers) == 0 {
+		return r, nil
+	}
+
+	// Servers without port listen on the DNS one
+	var servers []string
+	for _, server := range conf.Servers {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		host, _, _ := net.SplitHostPort(server)
+		if net.ParseIP(host) == nil {
+			return nil, fmt.Errorf("DNS server %s is not an IP address", server)
+		}
+		servers = append(servers, server)
+	}
+
+	// Queries are spread over the servers, so a failing server is skipped
+	// when the query is retried
+	var next atomic.Uint32
+	dialer := net.Dialer{Timeout: d}
+	r.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			server := servers[int(next.Add(1)-1)%len(servers)]
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+	return r, nil
+}
+
+// lookup returns the IP address of host, preferring IPv4 addresses. Relative
+// names are tried with each search domain first, then as they are. Names
+// ending with a dot are absolute.
+func (r *resolver) lookup(ctx context.Context, host string) (string, error) {
+	ctx, span := tracer.Start(ctx, "resolve", trace.WithAttributes(attribute.String("host", host)))
+	defer span.End()
+
+	names := []string{host}
+	if !strings.HasSuffix(host, ".") {
+		names = nil
+		for _, domain := range r.search {
+			names = append(names, host+"."+strings.Trim(domain, ".")+".")
+		}
+		names = append(names, host)
+	}
+
+	var err error
+	for _, name := range names {
+		var addrs []net.IPAddr
+		queryCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		addrs, err = r.resolver.LookupIPAddr(queryCtx, name)
+		cancel()
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+
+		ip := addrs[0].IP
+		for _, addr := range addrs {
+			if addr.IP.To4() != nil {
+				ip = addr.IP
+				break
+			}
+		}
+		span.SetAttributes(attribute.String("ip", ip.String()))
+		return ip.String(), nil
+	}
+
+	if err == nil {
+		err = fmt.Errorf("no address found")
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return "", fmt.Errorf("cannot resolve %s: %w", host, err)
+}
+
+// resolveHosts periodically resolves the hostnames of targets and synchronises
+// the resolved targets with the scanned ones.
+func (s *Scanner) resolveHosts(r *resolver, targets []config.Target, interval time.Duration) {
+	defer reporting.Recover("", "")
+
+	ips := make([]string, len(targets))
+	for {
+		s.syncHosts(r, targets, ips)
+		time.Sleep(interval)
+	}
+}
+
+// syncHosts resolves the hostnames of targets and synchronises the resolved
+// targets with the scanned ones. ips holds the previous IP of each target,
+// which is kept when its hostname cannot be resolved anymore.
+func (s *Scanner) syncHosts(r *resolver, targets []config.Target, ips []string) {
+	var resolved []config.Target
+	for i, t := range targets {
+		ip, err := r.lookup(context.Background(), t.Host)
+		if err != nil {
+			s.Logger.Error().Err(err).Str("name", t.Name).Msgf("cannot resolve %s", t.Host)
+			reporting.Error(err, "cannot resolve target", t.Name, t.Host)
+		} else {
+			if ips[i] != "" && ips[i] != ip {
+				s.Logger.Info().Str("name", t.Name).Msgf("%s now resolves to %s instead of %s", t.Host, ip, ips[i])
+			}
+			ips[i] = ip
+		}
+
+		if ips[i] == "" {
+			continue
+		}
+		t.IP = ips[i]
+		resolved = append(resolved, t)
+	}
+	s.Sync(sourceDNS, resolved)
+}
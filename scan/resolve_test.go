@@ -0,0 +1,160 @@
+package scan
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsServer answers A queries over UDP with the addresses returned by lookup
+// for fully qualified names. Names unknown to lookup do not exist.
+func dnsServer(t *testing.T, lookup func(name string) ([4]byte, bool)) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) != 1 {
+				continue
+			}
+			q := req.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true, RCode: dnsmessage.RCodeNameError},
+				Questions: req.Questions,
+			}
+			if a, ok := lookup(q.Name.String()); ok {
+				resp.RCode = dnsmessage.RCodeSuccess
+				if q.Type == dnsmessage.TypeA {
+					resp.Answers = []dnsmessage.Resource{{
+						Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+						Body:   &dnsmessage.AResource{A: a},
+					}}
+				}
+			}
+			out, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(out, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func Test_resolver_lookup(t *testing.T) {
+	records := map[string][4]byte{
+		"web.internal.":  {10, 0, 0, 7},
+		"db.example.":    {10, 0, 0, 8},
+		"web.other.org.": {10, 0, 0, 9},
+	}
+	server := dnsServer(t, func(name string) ([4]byte, bool) {
+		a, ok := records[name]
+		return a, ok
+	})
+	r, err := newResolver(&config.DNS{Servers: []string{server}, Search: []string{"internal", "other.org."}, Timeout: "1s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		host    string
+		want    string
+		wantErr bool
+	}{
+		{name: "first search domain", host: "web", want: "10.0.0.7"},
+		{name: "name as is", host: "db.example", want: "10.0.0.8"},
+		{name: "absolute name", host: "web.other.org.", want: "10.0.0.9"},
+		{name: "absolute name without search", host: "web.", wantErr: true},
+		{name: "unknown", host: "mail", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := r.lookup(context.Background(), tt.host)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("lookup() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newResolver(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.DNS
+		wantErr bool
+	}{
+		{name: "system resolver", conf: nil},
+		{name: "servers", conf: &config.DNS{Servers: []string{"10.0.0.53", "10.0.0.54:5353", "[fd00::53]:53"}}},
+		{name: "server hostname", conf: &config.DNS{Servers: []string{"ns1.internal"}}, wantErr: true},
+		{name: "invalid timeout", conf: &config.DNS{Timeout: "soon"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newResolver(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("newResolver() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScanner_syncHosts(t *testing.T) {
+	var exists atomic.Bool
+	exists.Store(true)
+	server := dnsServer(t, func(name string) ([4]byte, bool) {
+		return [4]byte{10, 0, 0, 7}, name == "web.internal." && exists.Load()
+	})
+	r, err := newResolver(&config.DNS{Servers: []string{server}, Timeout: "1s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Scanner{
+		Results: results.New(),
+		Logger:  logger.New("error"),
+		conf:    &config.Conf{},
+		MetricsServ: metrics.Server{
+			NumOfTargets:    prometheus.NewGauge(prometheus.GaugeOpts{Name: "targets"}),
+			PortAnnotations: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "annotations"}, []string{"name", "ip", "port", "annotation", "owner"}),
+			TargetInfo:      prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "info"}, []string{"name", "ip", "owner", "description"}),
+			TargetPaused:    prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "paused"}, []string{"name", "ip", "owner"}),
+		},
+	}
+	targets := []config.Target{{Name: "web", Host: "web.internal."}, {Name: "mail", Host: "mail.internal."}}
+	ips := make([]string, len(targets))
+
+	s.syncHosts(r, targets, ips)
+	if len(s.Targets) != 1 || s.Targets[0].ip != "10.0.0.7" || s.Targets[0].source != sourceDNS {
+		t.Fatalf("syncHosts() targets = %+v, want web resolved to 10.0.0.7", s.Targets)
+	}
+
+	// A target whose hostname cannot be resolved anymore keeps its IP
+	exists.Store(false)
+	s.syncHosts(r, targets, ips)
+	if len(s.Targets) != 1 || s.Targets[0].ip != "10.0.0.7" {
+		t.Errorf("syncHosts() targets = %+v, want web kept on 10.0.0.7", s.Targets)
+	}
+	if targets[0].IP != "" {
+		t.Errorf("syncHosts() modified the configuration of the targets")
+	}
+}
@@ -1,26 +1,69 @@
 package scan
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
+	"reflect"
+	"slices"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/devops-works/scan-exporter/common"
 	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/history"
 	"github.com/devops-works/scan-exporter/metrics"
-	"github.com/devops-works/scan-exporter/storage"
+	"github.com/devops-works/scan-exporter/nmap"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/output"
+	"github.com/devops-works/scan-exporter/reporting"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/devops-works/scan-exporter/services"
 	"github.com/rs/zerolog"
-	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
 )
 
+// Sources of targets.
+const (
+	sourceConfig = "config"
+	sourceNetBox = "netbox"
+	sourceDNS    = "dns"
+	sourceConsul = "consul"
+	sourceFileSD = "file_sd"
+)
+
+// Address families of dual-stack targets.
+const (
+	familyIPv4 = "ipv4"
+	familyIPv6 = "ipv6"
+)
+
+// probeBatchSize is the number of ports covered by a probe batch span.
+const probeBatchSize = 1024
+
+// defaultShutdownTimeout is the time given to the running scans to end when
+// the scanner is stopped, when none is configured.
+const defaultShutdownTimeout = "25s"
+
+var tracer = otel.Tracer("github.com/devops-works/scan-exporter/scan")
+
+// errInvalidIP is returned when the IP of a target cannot be parsed.
+var errInvalidIP = errors.New("cannot parse IP")
+
 type target struct {
-	ip         string
+	ip string
+	// ipv6 is the IPv6 address of a dual-stack target, probed along with ip
+	ipv6       string
 	name       string
 	ports      string
 	expected   []string
@@ -30,23 +73,215 @@ type target struct {
 	icmpPeriod string
 	qps        int
 	labels     map[string]string
+	checks     map[int]*tcpCheck
+	banners    map[int]*tcpCheck
+	http       *httpCheck
+	tls        *tlsCheck
+	severities notify.Severities
+	// intervals holds the scanned ports, parsed from ports once the target is
+	// read, and expectedSet the expected ports, so that they are not parsed
+	// again on each scan
+	intervals   [][2]int
+	expectedSet *common.PortSet
+	// annotations describes what ports are used for, indexed by port
+	annotations map[string]string
+	// source identifies where the target comes from (configuration file or
+	// discovery), and conf is the configuration it has been created from
+	source string
+	conf   config.Target
+	// stop is closed when the target is removed
+	stop chan struct{}
+	// changeThreshold is the number of port state changes between two scans
+	// above which the changes are flagged
+	changeThreshold int
+	// backoff holds the adaptation of the probe rate to dial errors. It is
+	// nil when disabled
+	backoff *backoffConf
+	// dialer opens the connections of the probes
+	dialer *dialer
+	// icmpTimeout is the timeout of the pings. Zero keeps the global one
+	icmpTimeout time.Duration
+	// ttl is the TTL, or hop limit, of the probes. Zero keeps the system one
+	ttl int
+	// iface is the network interface the probes are sent through, if any
+	iface string
+	// paused is true when the scans of the target are suspended by its
+	// configuration
+	paused bool
+	// dependsOn is the name of the target through which this one is
+	// reached. Its scans are skipped while that target is down
+	dependsOn string
+	// pingDown and scanDown are true when the last ping, or the last scan,
+	// could not reach the target
+	pingDown, scanDown atomic.Bool
+	// unreachableVia is the name of the dependency which was down during
+	// the last scan. It is only accessed by the scan loop
+	unreachableVia string
+	// replyTTL is the TTL of the last echo reply of the target, zero if none
+	// was received
+	replyTTL atomic.Int32
+	// startDelay is the time the first scan of the target waits, so that the
+	// scans of the targets started together are spread
+	startDelay time.Duration
+	// flaps detects the ports and addresses of the target changing state
+	// too often. It is nil when disabled
+	flaps *flapDetector
+	// jitter is the share of the delay between two probes which is randomly
+	// added to it
+	jitter float64
+	// downSeverity is the severity of the target not responding to pings,
+	// and notifyDown is true when it is sent to the notification routes
+	downSeverity string
+	notifyDown   bool
+	// syn sends the SYN probes of the target. It is nil for connect scans
+	syn *synEngine
+	// retries is the number of times a port whose state changed since the
+	// previous scan is probed again, retryDelay apart, to confirm the change
+	retries    int
+	retryDelay time.Duration
+	// rate limits the probes of the target. It is nil when unlimited
+	rate *rate.Limiter
+	// scanning is held while the target is scanned
+	scanning sync.Mutex
+	// lastOpen holds the ports found open by the latest reported scan of
+	// each address, as a *common.PortSet, so that the changes found by the
+	// next scan can be confirmed
+	lastOpen sync.Map
+}
+
+// addresses returns the addresses of the target, the IPv6 one of dual-stack
+// targets coming last.
+func (t *target) addresses() []string {
+	if t.ipv6 == "" {
+		return []string{t.ip}
+	}
+	return []string{t.ip, t.ipv6}
+}
+
+// removed checks if a target has been removed.
+func removed(t *target) bool {
+	select {
+	case <-t.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// scanReport informs the receiver that the scan of a target is over. ctx holds
+// the span of the scan, which is ended by the receiver.
+type scanReport struct {
+	t          *target
+	job        job
+	start, end time.Time
+	// batches holds the duration of each probe batch of the scan
+	batches []time.Duration
+	ctx     context.Context
+	// aborted is true if the scan has been aborted, in which case its
+	// results are dropped
+	aborted bool
+}
+
+// portResult is the result of a single port scan.
+type portResult struct {
+	ip   string
+	port string
+	open bool
+	// bannerErr holds the reason why the banner sent by an open port does not
+	// match the expected one. Such a port is misbehaving.
+	bannerErr error
+	// httpErr holds the reason why the HTTP assertions failed on this port.
+	// It is only relevant if httpChecked is true.
+	httpChecked bool
+	httpErr     error
+	// httpResp describes the response to the HTTP check, if one was
+	// received
+	httpResp *metrics.HTTPResponse
+	// cert describes the certificate presented by a TLS port, if it was
+	// inspected
+	cert *metrics.TLSCert
+	// window is the TCP window advertised by an open port, zero if unknown
+	window uint32
 }
 
 // Scanner holds the targets list, global settings such as timeout and lock size,
 // the logger and the metrics server.
 type Scanner struct {
-	Targets     []target
+	Targets     []*target
 	Timeout     time.Duration
 	Lock        *semaphore.Weighted
 	Logger      zerolog.Logger
 	MetricsServ metrics.Server
+	Results     *results.Store
+	Outputs     *output.Dispatcher
+	// History records the results of the scans, if enabled
+	History *history.Store
+	// Version is the version of scan-exporter
+	Version string
+
+	// mu protects Targets, which can be modified by discovery goroutines
+	mu      sync.RWMutex
+	conf    *config.Conf
+	trigger chan job
+	pchan   chan metrics.PingInfo
+	// reloadMu serialises the reloads of the configuration
+	reloadMu sync.Mutex
+	// subnets limits the simultaneous probes per destination subnet. It is
+	// nil when disabled
+	subnets *subnetLimiter
+	// rate limits the probes of all the targets. It is nil when unlimited
+	rate *rate.Limiter
+	// pool runs the probes of the connect scans of all the targets
+	pool *pool
+	// icmpPrivileged is true when echo requests are sent through raw
+	// sockets
+	icmpPrivileged bool
+	// fds limits the dials in flight by the file descriptors available. It
+	// is nil when unlimited
+	fds *fdLimiter
+	// sourcePorts holds the source ports of the probes of targets without
+	// their own. It is nil when the system picks them
+	sourcePorts *portPool
+	// sourceAddrs holds the source addresses of the probes of targets
+	// without their own. It is nil when the system picks them
+	sourceAddrs *addrPool
+	// pauses holds the end of the pauses requested through the API, indexed
+	// by target name, or the zero time for pauses lasting until resumed. It
+	// is protected by mu
+	pauses map[string]time.Time
+	// oui holds the vendors of MAC addresses
+	oui ouiRegistry
+	// arpTable is the path of the ARP table the MAC addresses are read
+	// from, the one of the system when empty
+	arpTable string
+	// geo locates the public targets. It is nil when disabled
+	geo *geoIP
+	// owners finds the owners of the public targets. It is nil when
+	// disabled
+	owners *ownerLookup
+	// blackhole detects that the probes cannot leave the host. It is nil
+	// when disabled
+	blackhole *blackholeDetector
+	// syn sends the SYN probes of all the targets. It is created with the
+	// first target using SYN scans, and protected by synMu
+	syn   *synEngine
+	synMu sync.Mutex
+	// done is closed when the scanner is stopped, which stops the
+	// schedulers of the targets
+	done <-chan struct{}
+	// lastScan and lastMissedTick hold, as Unix times in nanoseconds, the
+	// time at which the last scan ended and the time of the last scan
+	// skipped by the scheduler. lastScan holds the start time of the
+	// scanner until a scan ends
+	lastScan, lastMissedTick atomic.Int64
 }
 
-// Start configure targets and launches scans.
-func (s *Scanner) Start(c *config.Conf) error {
+// Start configure targets and launches scans, until ctx is done. The running
+// scan is then given the shutdown timeout to end, and Start returns once the
+// metrics of the ended scans are updated.
+func (s *Scanner) Start(ctx context.Context, c *config.Conf) error {
 
 	s.Logger.Info().Msgf("%d target(s) found in configuration file", len(c.Targets))
-	s.MetricsServ.NumOfTargets.Set(float64(len(c.Targets)))
 
 	// Check if shared values are set
 	if c.Timeout == 0 {
@@ -55,7 +290,63 @@ func (s *Scanner) Start(c *config.Conf) error {
 	if c.Limit == 0 {
 		s.Logger.Fatal().Msgf("no limit provided in configuration file")
 	}
+	// Targets generated from NetBox are never scanned without a period
+	if c.NetBox != nil && c.NetBox.Period == "" && c.TcpPeriod == "" {
+		return errors.New("no period provided for NetBox targets, and no global TCP period")
+	}
+	if c.Discovery.Consul != nil && c.Discovery.Consul.Period == "" && c.TcpPeriod == "" {
+		return errors.New("no period provided for Consul targets, and no global TCP period")
+	}
+	if c.Discovery.FileSD != nil && c.Discovery.FileSD.Period == "" && c.TcpPeriod == "" {
+		return errors.New("no period provided for file_sd targets, and no global TCP period")
+	}
+	// Reloads wait for the targets of the configuration to be added
+	s.reloadMu.Lock()
+	reloadable := sync.OnceFunc(s.reloadMu.Unlock)
+	defer reloadable()
+
+	s.conf = c
+	s.lastScan.Store(time.Now().UnixNano())
 	s.Lock = semaphore.NewWeighted(int64(c.Limit))
+	subnets, err := newSubnetLimiter(c.SubnetLimit)
+	if err != nil {
+		return fmt.Errorf("invalid subnet limit: %w", err)
+	}
+	s.subnets = subnets
+	if s.rate, err = newRateLimiter(c.Rate); err != nil {
+		return fmt.Errorf("invalid rate: %w", err)
+	}
+	if s.icmpPrivileged, err = readICMPMode(c.ICMPMode, rawICMPAllowed); err != nil {
+		return err
+	}
+	if !s.icmpPrivileged && cmp.Or(c.ICMPMode, icmpAuto) == icmpAuto {
+		s.Logger.Info().Msg("raw ICMP sockets cannot be opened, pinging the targets through unprivileged ICMP sockets")
+	}
+	s.fds = newFDLimiter(s.MetricsServ.FDInUse, s.MetricsServ.FDThrottled)
+	if s.fds != nil {
+		s.MetricsServ.FDLimit.Set(float64(s.fds.size))
+		if int64(c.Limit) > s.fds.size {
+			s.Logger.Warn().Msgf("limit %d exceeds the %d file descriptors available to the probes, which will wait for them", c.Limit, s.fds.size)
+		}
+	}
+	if s.sourcePorts, err = newPortPool(c.SourcePorts); err != nil {
+		return fmt.Errorf("invalid source ports: %w", err)
+	}
+	if s.sourceAddrs, err = newAddrPool(c.SourceAddresses); err != nil {
+		return fmt.Errorf("invalid source addresses: %w", err)
+	}
+	if s.oui, err = loadOUI(c.OUIFile); err != nil {
+		return fmt.Errorf("cannot load OUI registry: %w", err)
+	}
+	if s.geo, err = openGeoIP(c.GeoIP); err != nil {
+		return fmt.Errorf("cannot load GeoIP databases: %w", err)
+	}
+	if s.owners, err = newOwnerLookup(c.Whois, c.DNS, s.Logger); err != nil {
+		return fmt.Errorf("invalid whois lookup: %w", err)
+	}
+	if s.blackhole, err = newBlackholeDetector(c.Blackhole); err != nil {
+		return fmt.Errorf("invalid blackhole detection: %w", err)
+	}
 	s.Timeout = time.Second * time.Duration(c.Timeout)
 
 	// If an ICMP period has been provided, it means that we want to ping the
@@ -64,291 +355,1042 @@ func (s *Scanner) Start(c *config.Conf) error {
 		s.Logger.Warn().Msgf("scan-exporter not launched as superuser, ICMP requests can fail")
 	}
 
+	// Targets can be added after startup by discovery, so channels are sized
+	// with a minimal capacity
+	capacity := max(len(c.Targets)*2, 64)
+
 	// ping channel to send ICMP update to metrics
-	pchan := make(chan metrics.PingInfo, len(c.Targets)*2)
-
-	// Configure local target objects
-	for _, t := range c.Targets {
-		target := target{
-			ip:         t.IP,
-			name:       t.Name,
-			tcpPeriod:  t.TCP.Period,
-			icmpPeriod: t.ICMP.Period,
-			ports:      t.TCP.Range,
-			qps:        t.QueriesPerSecond,
-			labels:     t.Labels,
-		}
+	s.pchan = make(chan metrics.PingInfo, capacity)
+
+	s.trigger = make(chan job, capacity)
 
-		// Set to global values if specific values are not set
-		if target.qps == 0 {
-			target.qps = c.QueriesPerSecond
+	// Hostname targets are added once resolved
+	static, hosts := splitTargets(c.Targets)
+	var res *resolver
+	var resolveInterval time.Duration
+	if len(hosts) > 0 {
+		var err error
+		if res, err = newResolver(c.DNS); err != nil {
+			return err
 		}
-		if target.tcpPeriod == "" {
-			target.tcpPeriod = c.TcpPeriod
+		refreshInterval := defaultDNSRefreshInterval
+		if c.DNS != nil && c.DNS.RefreshInterval != "" {
+			refreshInterval = c.DNS.RefreshInterval
 		}
-		if target.icmpPeriod == "" {
-			target.icmpPeriod = c.IcmpPeriod
+		if resolveInterval, err = getDuration(refreshInterval); err != nil {
+			return fmt.Errorf("invalid DNS refresh interval: %w", err)
 		}
+	}
+
+	// Configure local target objects and start their schedulers, spreading
+	// their first scans over the startup window
+	var spread time.Duration
+	if c.StartupSpread != "" {
+		if spread, err = getDuration(c.StartupSpread); err != nil || spread < 0 {
+			return fmt.Errorf("invalid startup spread %q", c.StartupSpread)
+		}
+	}
+	shutdownTimeout, err := getDuration(cmp.Or(c.ShutdownTimeout, defaultShutdownTimeout))
+	if err != nil || shutdownTimeout < 0 {
+		return fmt.Errorf("invalid shutdown timeout %q", c.ShutdownTimeout)
+	}
+	s.done = ctx.Done()
+	// The raw socket of the SYN probes is closed once the scans are over
+	defer s.closeSYN()
+	if err := s.addTargets(static, spread); err != nil {
+		return err
+	}
+	reloadable()
+
+	// scanIsOver is used by s.run() to notify the receiver that all the ports
+	// have been scanned
+	scanIsOver := make(chan scanReport, capacity)
+
+	// singleResult is used by s.scanPort() to send a port result to the
+	// receiver.
+	singleResult := make(chan portResult, c.Limit)
+
+	// Create channel for communication with metrics server
+	mchan := make(chan metrics.NewMetrics, capacity)
+
+	// Channel that will hold the number of scans in the waiting line (len of
+	// the trigger chan)
+	pendingchan := make(chan int, capacity)
 
-		// Truth table for icmpPeriod value
-		//
-		// | global | target | doPing | period |
-		// | ------ | ------ | ------ | :----: |
-		// | ""     | ""     | false  |   -    |
-		// | ""     | "0"    | false  |   -    |
-		// | ""     | "y"    | true   |   y    |
-		// | "0"    | ""     | false  |   -    |
-		// | "0"    | "0"    | false  |   -    |
-		// | "0"    | "y"    | true   |   y    |
-		// | "x"    | ""     | true   |   x    |
-		// | "x"    | "0"    | false  |   -    |
-		// | "x"    | "y"    | true   |   y    |
-		switch c.IcmpPeriod {
-		case "", "0":
-			if target.icmpPeriod != "" && target.icmpPeriod != "0" {
-				target.doPing = true
+	// Goroutine that will send to metrics the number of pendings scan
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				pendingchan <- len(s.trigger)
+			case <-ctx.Done():
+				return
 			}
-		default:
-			if target.icmpPeriod != "0" {
-				target.doPing = true
-				if target.icmpPeriod == "" {
-					target.icmpPeriod = c.IcmpPeriod
-				}
+		}
+	}()
+
+	// Start the metrics updater, which returns once the receiver is over
+	updated := make(chan struct{})
+	go func() {
+		defer close(updated)
+		s.MetricsServ.Updater(mchan, s.pchan, pendingchan)
+	}()
+
+	// Start the receiver
+	go s.receiver(scanIsOver, singleResult, mchan)
+
+	// Start targets discovery
+	if c.NetBox != nil {
+		go s.discoverNetBox(c.NetBox)
+	}
+	if c.Discovery.Consul != nil {
+		go s.discoverConsul(c.Discovery.Consul)
+	}
+	if c.Discovery.FileSD != nil {
+		go s.discoverFiles(c.Discovery.FileSD)
+	}
+	if len(hosts) > 0 {
+		go s.resolveHosts(res, hosts, resolveInterval)
+	}
+
+	// The scan running when ctx is done is interrupted once the shutdown
+	// timeout elapsed
+	drain, interrupt := context.WithCancel(context.WithoutCancel(ctx))
+	defer interrupt()
+	context.AfterFunc(ctx, func() { time.AfterFunc(shutdownTimeout, interrupt) })
+
+	// Wait for triggers, and run up to concurrent_scans scans at a time. Their
+	// probes share the workers of the pool
+	s.pool = newPool(c.Limit)
+	defer s.pool.close()
+	scans := semaphore.NewWeighted(int64(max(c.ConcurrentScans, 1)))
+	running := sync.WaitGroup{}
+	for ctx.Err() == nil {
+		select {
+		case j := <-s.trigger:
+			if scans.Acquire(ctx, 1) != nil {
+				break
 			}
+			running.Add(1)
+			go func() {
+				defer reporting.Recover("", j.ip)
+				defer running.Done()
+				defer scans.Release(1)
+				s.Logger.Debug().Str("job", j.id).Msgf("starting new scan for %s", j.ip)
+				if err := s.run(drain, j, scanIsOver, singleResult); err != nil {
+					s.Logger.Error().Err(err).Str("job", j.id).Msg("error running scan")
+					reporting.Error(err, "error running scan", "", j.ip)
+				}
+			}()
+		case <-ctx.Done():
 		}
-		// Inform that ping is disabled
-		if !target.doPing {
-			s.Logger.Warn().Msgf("ping explicitly disabled for %s (%s) in configuration",
-				target.name,
-				target.ip)
+	}
+	running.Wait()
+
+	// No scan is running anymore: the receiver processes the last reports,
+	// and the updater returns once their metrics are updated
+	s.Logger.Info().Msg("scans stopped, updating the metrics of the last ones")
+	close(scanIsOver)
+	<-updated
+	return nil
+}
+
+// AddTarget configures a target and starts its ping goroutine and its
+// scheduler. source identifies where the target comes from.
+func (s *Scanner) AddTarget(t config.Target, source string) error {
+	target, err := s.validateTarget(t)
+	if err != nil {
+		return err
+	}
+	return s.addTarget(target, source)
+}
+
+// validateTarget checks the addresses of a target and configures it, without
+// adding it to the scanner.
+func (s *Scanner) validateTarget(t config.Target) (*target, error) {
+	// Inform that we can't parse the IP
+	if ok := net.ParseIP(t.IP); ok == nil {
+		return nil, fmt.Errorf("%w %s", errInvalidIP, t.IP)
+	}
+	if t.IPv6 != "" {
+		if ip := net.ParseIP(t.IPv6); ip == nil || ip.To4() != nil {
+			return nil, fmt.Errorf("%w %s, which is not an IPv6 address", errInvalidIP, t.IPv6)
 		}
+	}
+	return s.newTarget(t)
+}
 
-		// Read target's expected port range
-		exp, err := readPortsRange(t.TCP.Expected)
-		if err != nil {
-			return err
+// addTarget adds a configured target to the scanner and starts its scans.
+func (s *Scanner) addTarget(target *target, source string) error {
+	target.source = source
+	target.stop = make(chan struct{})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.Targets {
+		for _, addr := range target.addresses() {
+			if slices.Contains(existing.addresses(), addr) {
+				return fmt.Errorf("target %s has the same IP as target %s: %s", target.name, existing.name, addr)
+			}
 		}
+	}
+	s.Targets = append(s.Targets, target)
+	s.MetricsServ.NumOfTargets.Inc()
+	s.setPausedMetrics(target.name)
 
-		// Append them to the target
-		for _, port := range exp {
-			target.expected = append(target.expected, strconv.Itoa(port))
+	// Launch target's ping goroutine. It embeds its own ticker
+	if target.doPing {
+		go target.ping(s.Logger, cmp.Or(target.icmpTimeout, s.Timeout), s.icmpPrivileged, s.pchan)
+	}
+
+	if target.doTCP {
+		s.Logger.Debug().Msgf("start scheduler for %s", target.name)
+		go target.scheduler(s.Logger, s.trigger, s.done, func(tick time.Time) { s.countMissedTick(target, tick) })
+	}
+
+	for _, addr := range target.addresses() {
+		s.MetricsServ.TargetInfo.WithLabelValues(target.name, addr, target.labels["owner"], target.labels["description"]).Set(1)
+		if target.doTCP {
+			s.MetricsServ.TargetTimeout.WithLabelValues(target.name, addr, notify.ProtoTCP).Set(target.dialer.probeTimeout(s.Timeout).Seconds())
 		}
+		if target.doPing {
+			s.MetricsServ.TargetTimeout.WithLabelValues(target.name, addr, notify.ProtoICMP).Set(cmp.Or(target.icmpTimeout, s.Timeout).Seconds())
+		}
+	}
+	for port, annotation := range target.annotations {
+		s.MetricsServ.PortAnnotations.WithLabelValues(target.name, target.ip, port, annotation, target.labels["owner"]).Set(1)
+	}
 
-		// Inform that we can't parse the IP, and skip this target
-		if ok := net.ParseIP(target.ip); ok == nil {
-			s.Logger.Error().Msgf("cannot parse IP %s", target.ip)
+	return nil
+}
+
+// RemoveTarget stops the scans of the target with the given IP and deletes its
+// metrics.
+func (s *Scanner) RemoveTarget(ip string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, t := range s.Targets {
+		if t.ip != ip {
 			continue
 		}
+		close(t.stop)
+		s.Targets = append(s.Targets[:i], s.Targets[i+1:]...)
+		s.MetricsServ.NumOfTargets.Dec()
+		for _, addr := range t.addresses() {
+			s.MetricsServ.DeleteTarget(t.name, addr)
+			s.Results.Delete(addr)
+		}
+		s.Logger.Info().Str("name", t.name).Str("ip", t.ip).Msgf("target %s (%s) removed", t.name, t.ip)
+		return
+	}
+}
 
-		// If TCP period or ports range has been provided, it means that we want
-		// to do TCP scan on the target
-		if target.tcpPeriod != "" || target.ports != "" || len(target.expected) != 0 {
-			target.doTCP = true
+// Sync replaces the targets coming from source with the given ones. Targets
+// that are not in the list anymore are removed, new ones are added and
+// modified ones are replaced.
+func (s *Scanner) Sync(source string, targets []config.Target) {
+	wanted := make(map[string]config.Target, len(targets))
+	for _, t := range targets {
+		wanted[t.IP] = t
+	}
+
+	s.mu.RLock()
+	current := make(map[string]*target)
+	for _, t := range s.Targets {
+		if t.source == source {
+			current[t.ip] = t
 		}
+	}
+	s.mu.RUnlock()
 
-		// Launch target's ping goroutine. It embeds its own ticker
-		if target.doPing {
-			go target.ping(s.Logger, time.Duration(c.Timeout)*time.Second, pchan)
+	for ip, t := range current {
+		w, ok := wanted[ip]
+		if ok && reflect.DeepEqual(w, t.conf) {
+			delete(wanted, ip)
+			continue
 		}
+		s.RemoveTarget(ip)
+	}
 
-		if target.doTCP {
-			s.Targets = append(s.Targets, target)
+	for _, t := range wanted {
+		if err := s.AddTarget(t, source); err != nil {
+			s.Logger.Error().Err(err).Str("source", source).Msgf("cannot add target %s", t.Name)
+			reporting.Error(err, "cannot add target", t.Name, t.IP)
 		}
 	}
+}
 
-	trigger := make(chan string, len(s.Targets)*2)
+// run scans the target of a job, and sends its report to the receiver once all
+// the ports have been probed. When ctx is done, no more port is probed, and the
+// scan is reported as aborted.
+func (s *Scanner) run(ctx context.Context, j job, scanIsOver chan scanReport, singleResult chan portResult) error {
+	s.mu.RLock()
+	var t *target
+	for _, candidate := range s.Targets {
+		// Find which target to scan
+		if candidate.ip == j.ip {
+			t = candidate
+			break
+		}
+	}
+	s.mu.RUnlock()
 
-	// scanIsOver is used by s.run() to notify the receiver that all the ports
-	// have been scanned
-	scanIsOver := make(chan target, len(s.Targets))
+	if t == nil {
+		return fmt.Errorf("IP to scan not found: %s", j.ip)
+	}
+	// Scans of the same target are not run concurrently, as their results
+	// would be mixed
+	t.scanning.Lock()
+	defer t.scanning.Unlock()
+	if s.paused(t) {
+		s.Logger.Debug().Str("job", j.id).Str("name", t.name).Str("ip", t.ip).Msgf("skipping scan of paused target %s", t.name)
+		return nil
+	}
 
-	// singleResult is used by s.scanPort() to send an open port to the receiver.
-	// The format is ip:port
-	singleResult := make(chan string, c.Limit)
+	// Targets reached through a target which is down are not scanned, so
+	// that they do not all raise findings
+	dependency := s.downDependency(t)
+	if dependency != t.unreachableVia {
+		if dependency != "" {
+			s.Logger.Warn().Str("job", j.id).Str("name", t.name).Str("ip", t.ip).Msgf("%s (%s) unreachable via dependency %s, skipping its scans", t.name, t.ip, dependency)
+		} else {
+			s.Logger.Info().Str("job", j.id).Str("name", t.name).Str("ip", t.ip).Msgf("%s (%s) reachable again, resuming its scans", t.name, t.ip)
+		}
+		t.unreachableVia = dependency
+		s.setUnreachable(t, dependency)
+	}
+	if dependency != "" {
+		return nil
+	}
 
-	s.Logger.Debug().Msgf("%d targets will be scanned using TCP", len(s.Targets))
+	wg := sync.WaitGroup{}
+	start := time.Now()
 
-	// Start scheduler for each target
-	for _, t := range s.Targets {
-		t := t
-		s.Logger.Debug().Msgf("start scheduler for %s", t.name)
-		go t.scheduler(s.Logger, trigger)
+	// The changes of state of the ports since the latest reported scan are
+	// confirmed by probing them again
+	lastOpen := make(map[string]*common.PortSet)
+	for _, addr := range t.addresses() {
+		lastOpen[addr] = t.lastOpenPorts(addr)
 	}
 
-	// Create channel for communication with metrics server
-	mchan := make(chan metrics.NewMetrics, len(s.Targets)*2)
+	// Ports are generated batch after batch rather than listed, so that the
+	// memory used by the scans of full ranges stays flat
+	ports := t.intervals
 
-	// Channel that will hold the number of scans in the waiting line (len of
-	// the trigger chan)
-	pendingchan := make(chan int, len(s.Targets))
+	// Configure sleeping time for rate limiting
+	var sleepingTime time.Duration
+	if t.qps > 1000000 || t.qps <= 0 {
+		// We want to wait less than a microsecond between each port scanning
+		// so, we do not wait at all.
+		// From time.Sleep documentation:
+		// A negative or zero duration causes Sleep to return immediately
+		sleepingTime = -1
+	} else {
+		sleepingTime = time.Second / time.Duration(t.qps)
+	}
 
-	// Goroutine that will send to metrics the number of pendings scan
-	go func() {
-		for {
-			time.Sleep(500 * time.Millisecond)
-			pendingchan <- len(trigger)
-		}
-	}()
+	// The span of the scan is ended by the receiver, once the results are
+	// processed
+	ctx, _ = tracer.Start(ctx, "scan", trace.WithAttributes(
+		attribute.String("job.id", j.id),
+		attribute.String("target.name", t.name),
+		attribute.String("target.ip", t.ip),
+		attribute.Int("ports", intervalsLen(ports)),
+	))
 
-	// Start the metrics updater
-	go s.MetricsServ.Updater(mchan, pchan, pendingchan)
+	// Probes are slowed down, or the scan is aborted, when too many dials
+	// fail
+	bo := newBackoff(t.backoff, sleepingTime)
+	var probes, failures atomic.Int64
 
-	// Start the receiver
-	go receiver(scanIsOver, singleResult, pchan, mchan)
+	// The probes are run by the workers shared by all the scans
+	queue := s.pool.queue()
 
-	// Wait for triggers, build the scanner and run it
-	for {
-		select {
-		case triggeredIP := <-trigger:
-			s.Logger.Debug().Msgf("starting new scan for %s", triggeredIP)
-			if err := s.run(triggeredIP, scanIsOver, singleResult); err != nil {
-				s.Logger.Error().Err(err).Msg("error running scan")
-			}
+	// Ports are grouped in batches, each with its own span ending when all
+	// its ports have been probed. The duration of each batch is reported,
+	// so that the slow parts of a scan can be found
+	var batches []time.Duration
+	var batchesMu sync.Mutex
+	batchesWg := sync.WaitGroup{}
+	var batchCount int
+	// interrupted is true when ctx is done before all the ports are probed
+	var interrupted bool
+	for batch := range portBatches(ports, probeBatchSize) {
+		if aborted, _ := bo.abort(); aborted {
+			break
+		}
+		if interrupted = ctx.Err() != nil; interrupted {
+			break
 		}
-	}
-}
 
-func (s *Scanner) run(ip string, scanIsOver chan target, singleResult chan string) error {
-	for _, t := range s.Targets {
-		// Find which target to scan
-		if t.ip == ip {
-			wg := sync.WaitGroup{}
+		batchStart := time.Now()
+		batchIndex := batchCount
+		batchCount++
+		// The buffer of the batch is reused by the next one
+		first, last := batch[0], batch[len(batch)-1]
+		batchCtx, batchSpan := tracer.Start(ctx, "probe batch", trace.WithAttributes(
+			attribute.Int("ports.first", first),
+			attribute.Int("ports.last", last),
+		))
+		batchWg := &sync.WaitGroup{}
+		dials := &dialStats{}
 
-			ports, err := readPortsRange(t.ports)
+		// SYN probes do not hold sockets, so they are not limited. Their
+		// replies are awaited while the next batch is sent
+		if t.syn != nil {
+			sent, err := t.syn.send(t.ip, batch, func() time.Duration {
+				s.waitRate(ctx, t)
+				return t.jittered(bo.delay(sleepingTime))
+			})
 			if err != nil {
-				return err
-			}
-
-			// Configure sleeping time for rate limiting
-			var sleepingTime time.Duration
-			if t.qps > 1000000 || t.qps <= 0 {
-				// We want to wait less than a microsecond between each port scanning
-				// so, we do not wait at all.
-				// From time.Sleep documentation:
-				// A negative or zero duration causes Sleep to return immediately
-				sleepingTime = -1
-				t.qps = 0
-			} else {
-				sleepingTime = time.Second / time.Duration(t.qps)
+				s.Logger.Warn().Str("job", j.id).Str("name", t.name).Str("ip", t.ip).Err(err).Msgf("cannot send SYN probes to %s (%s)", t.name, t.ip)
 			}
-
-			for _, p := range ports {
+			if sent != nil {
 				wg.Add(1)
-				s.Lock.Acquire(context.TODO(), 1)
-				go func(port int) {
-					defer s.Lock.Release(1)
+				batchWg.Add(1)
+				go func() {
+					defer reporting.Recover(t.name, t.ip)
 					defer wg.Done()
-					s.scanPort(ip, port, singleResult)
-				}(p)
-				time.Sleep(sleepingTime)
+					defer batchWg.Done()
+					unanswered := s.collectSYN(batchCtx, t, sent, lastOpen[t.ip], dials, singleResult)
+					for i := range sent.ports {
+						bo.observe(i < unanswered)
+					}
+					probes.Add(int64(len(sent.ports)))
+					failures.Add(int64(unanswered))
+				}()
+			}
+		} else {
+			for _, p := range batch {
+				if aborted, _ := bo.abort(); aborted {
+					break
+				}
+				if interrupted = ctx.Err() != nil; interrupted {
+					break
+				}
+				// Both addresses of dual-stack targets are probed concurrently
+				for _, addr := range t.addresses() {
+					if s.waitRate(ctx, t) != nil {
+						break
+					}
+					// The subnet is acquired first, so that waiting for it
+					// does not hold a worker
+					releaseSubnet := s.subnets.acquire(addr)
+					wg.Add(1)
+					batchWg.Add(1)
+					err := queue.submit(ctx, func() {
+						defer reporting.Recover(t.name, addr)
+						defer releaseSubnet()
+						defer wg.Done()
+						defer batchWg.Done()
+						s.Lock.Acquire(context.TODO(), 1)
+						defer s.Lock.Release(1)
+						err := s.confirmPort(batchCtx, t, addr, p, lastOpen[addr], dials, singleResult)
+						bo.observe(err != nil)
+						probes.Add(1)
+						if err != nil {
+							failures.Add(1)
+						}
+					})
+					if err != nil {
+						releaseSubnet()
+						wg.Done()
+						batchWg.Done()
+						break
+					}
+				}
+				time.Sleep(t.jittered(bo.delay(sleepingTime)))
 			}
-			wg.Wait()
-
-			// Inform the receiver that the scan for the target is over
-			scanIsOver <- t
-			return nil
 		}
+
+		batchesWg.Add(1)
+		go func() {
+			defer batchesWg.Done()
+			batchWg.Wait()
+			duration := time.Since(batchStart)
+			batchSpan.SetAttributes(dials.attributes()...)
+			batchSpan.End()
+			s.Logger.Debug().Str("job", j.id).Str("name", t.name).Str("ip", t.ip).
+				Int("batch", batchIndex).Int("first_port", first).Int("last_port", last).
+				Dur("duration", duration).Msgf("probe batch %d of %s (%s) done", batchIndex, t.name, t.ip)
+
+			batchesMu.Lock()
+			defer batchesMu.Unlock()
+			batches = append(batches, duration)
+		}()
+	}
+	wg.Wait()
+	batchesWg.Wait()
+	t.scanDown.Store(probes.Load() > 0 && failures.Load() == probes.Load())
+
+	span := trace.SpanFromContext(ctx)
+	if bo != nil {
+		span.SetAttributes(attribute.Float64("backoff.max_delay_ms", float64(bo.maxDelay())/float64(time.Millisecond)))
+	}
+
+	// Interrupted scans are neither reported nor retried
+	if interrupted {
+		s.Logger.Warn().Str("job", j.id).Str("name", t.name).Str("ip", t.ip).Msgf("scan of %s (%s) interrupted by the shutdown, dropping its results", t.name, t.ip)
+		span.SetAttributes(attribute.Bool("interrupted", true))
+		scanIsOver <- scanReport{t: t, job: j, start: start, end: time.Now(), batches: batches, ctx: ctx, aborted: true}
+		return nil
+	}
+
+	// Aborted scans are retried later, their results being dropped
+	if aborted, errorPct := bo.abort(); aborted {
+		s.Logger.Warn().Str("job", j.id).Str("name", t.name).Str("ip", t.ip).Msgf("scan of %s (%s) aborted, %.0f%% of the dials failed, retrying in %s", t.name, t.ip, errorPct, t.backoff.retryAfter)
+		span.SetAttributes(attribute.Bool("aborted", true))
+		s.countAborted(t)
+		go t.retry(t.backoff.retryAfter, s.trigger)
+		scanIsOver <- scanReport{t: t, job: j, start: start, end: time.Now(), batches: batches, ctx: ctx, aborted: true}
+		return nil
+	}
+
+	// Inform the receiver that the scan for the target is over
+	scanIsOver <- scanReport{t: t, job: j, start: start, end: time.Now(), batches: batches, ctx: ctx}
+	return nil
+}
+
+// countAborted counts an aborted scan of the target, unless it has been
+// removed.
+func (s *Scanner) countAborted(t *target) {
+	// Targets are removed with the lock held, so the metrics of the target
+	// cannot be deleted before they are updated
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if removed(t) {
+		return
+	}
+	for _, addr := range t.addresses() {
+		s.MetricsServ.AbortedScans.WithLabelValues(t.name, addr, t.labels["owner"]).Inc()
+	}
+}
+
+// countMissedTick counts a scan of the target which was not triggered at tick
+// because the scan queue was full, unless the target has been removed. The
+// scanner is unhealthy for a while after such a scan.
+func (s *Scanner) countMissedTick(t *target, tick time.Time) {
+	s.lastMissedTick.Store(time.Now().UnixNano())
+	s.Logger.Warn().Str("name", t.name).Str("ip", t.ip).Msgf("scan of %s (%s) scheduled at %s skipped, the scan queue is full", t.name, t.ip, tick.Format(time.RFC3339))
+
+	// Targets are removed with the lock held, so the metrics of the target
+	// cannot be deleted before they are updated
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if removed(t) {
+		return
+	}
+	for _, addr := range t.addresses() {
+		s.MetricsServ.MissedTicks.WithLabelValues(t.name, addr, t.labels["owner"]).Inc()
+	}
+}
+
+// retry triggers a new scan of the target after the given delay, unless the
+// target is removed in the meantime.
+func (t *target) retry(after time.Duration, trigger chan job) {
+	timer := time.NewTimer(after)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-t.stop:
+		return
+	}
+	select {
+	case trigger <- newJob(t.ip):
+	case <-t.stop:
 	}
-	return fmt.Errorf("IP to scan not found: %s", ip)
 }
 
 // scanPort scans a single port and sends the result through singleResult.
-// There is 2 formats: when a port is open, it sends `ip:port:OK`, and when it is
-// closed, it sends `ip:port:NOP`
-func (s *Scanner) scanPort(ip string, port int, singleResult chan string) {
-	p := strconv.Itoa(port)
-	target := ip + ":" + p
-	conn, err := net.DialTimeout("tcp", target, s.Timeout)
+// If a banner is given, the port is reported as misbehaving when the banner
+// sent by the server does not match it. If a check is given, the port is only
+// considered open if the check succeeds. If the port is handled by the HTTP
+// check, its assertions are verified once the port is known to be open. If the
+// port is handled by the TLS check, the certificate it presents is inspected.
+// Connections are opened by d. The dial latency is recorded in dials, and the
+// probes are traced as children of the span held by ctx.
+// The dial error is returned when the port could not be reached, which is not
+// the case of ports refusing the connection.
+func (s *Scanner) scanPort(ctx context.Context, ip string, port int, banner, check *tcpCheck, hc *httpCheck, tc *tlsCheck, d *dialer, dials *dialStats, singleResult chan portResult) error {
+	p := portString(port)
+	res := portResult{ip: ip, port: p}
+	timeout := d.probeTimeout(s.Timeout)
+
+	// The connection and the one of the HTTP check, opened once it is
+	// closed, hold a single descriptor
+	release, err := s.fds.acquire(ctx)
+	if err != nil {
+		singleResult <- res
+		return err
+	}
+	defer release()
+
+	dialStart := time.Now()
+	conn, err := d.dial(net.JoinHostPort(ip, p), timeout)
+	// Descriptors may still run out when they are held by the rest of the
+	// process, in which case the dial is retried a little later
+	for isFileLimit(err) && ctx.Err() == nil {
+		s.fds.throttle()
+		time.Sleep(timeout)
+		dialStart = time.Now()
+		conn, err = d.dial(net.JoinHostPort(ip, p), timeout)
+	}
+	dials.add(time.Since(dialStart))
 	if err != nil {
-		// If the error contains the message "too many open files", wait a little
-		// and retry
-		if strings.Contains(err.Error(), "too many open files") {
-			time.Sleep(s.Timeout)
-			s.scanPort(ip, port, singleResult)
+		singleResult <- res
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			return nil
 		}
-		// The result follows the format ip:port:NOP
-		singleResult <- ip + ":" + p + ":NOP"
-		return
+		return err
+	}
+
+	// The banner is read first, as servers send it before anything else
+	if banner != nil {
+		res.bannerErr = traceProbe(ctx, "banner", port, func() error {
+			return banner.run(conn, timeout)
+		})
 	}
-	conn.Close()
 
-	// The result follows the format ip:port:OK
-	singleResult <- ip + ":" + p + ":OK"
+	if check != nil {
+		err := traceProbe(ctx, "check", port, func() error {
+			return check.run(conn, timeout)
+		})
+		if err != nil {
+			conn.Close()
+			s.Logger.Warn().Str("ip", ip).Str("port", p).Err(err).Msg("port is open but check failed")
+			singleResult <- res
+			return nil
+		}
+	}
+	res.window = tcpWindow(conn)
+
+	if tc.handles(port) {
+		// The certificate is inspected on the connection of the probe,
+		// unless the banner or the check already used it
+		if banner != nil || check != nil {
+			conn.Close()
+			conn, err = d.dial(net.JoinHostPort(ip, p), timeout)
+		}
+		if err == nil {
+			err = traceProbe(ctx, "tls check", port, func() error {
+				var err error
+				res.cert, err = tc.run(conn, timeout)
+				return err
+			})
+		}
+		if err != nil {
+			s.Logger.Warn().Str("ip", ip).Str("port", p).Err(err).Msg("port is open but its certificate cannot be inspected")
+		}
+	}
+	if conn != nil {
+		conn.Close()
+	}
+
+	res.open = true
+	if hc.handles(port) {
+		res.httpChecked = true
+		res.httpErr = traceProbe(ctx, "http check", port, func() error {
+			var err error
+			res.httpResp, err = hc.run(ip, port, timeout, d)
+			return err
+		})
+	}
+
+	singleResult <- res
+	return nil
 }
 
 // scheduler create tickers for each protocol given and when they tick,
 // it sends the protocol name in the trigger's channel in order to alert
-// feeder that a scan must be started.
-func (t *target) scheduler(logger zerolog.Logger, trigger chan string) {
+// feeder that a scan must be started. Ticks are dropped when the channel is
+// full, in which case missed is called with their time.
+// The scheduler stops when the target is removed, or when done is closed.
+func (t *target) scheduler(logger zerolog.Logger, trigger chan job, done <-chan struct{}, missed func(tick time.Time)) {
 	var ticker *time.Ticker
 	tcpFreq, err := getDuration(t.tcpPeriod)
 	if err != nil {
 		logger.Error().Msgf("error getting TCP frequency for %s scheduler: %s", t.name, err)
+		reporting.Error(err, "error getting TCP frequency", t.name, t.ip)
+		return
 	}
 	ticker = time.NewTicker(tcpFreq)
 
 	// starts its own ticker
-	go func(trigger chan string, ticker *time.Ticker, ip string) {
-		// Start scan at launch
-		trigger <- t.ip
+	go func(trigger chan job, ticker *time.Ticker, ip string) {
+		defer reporting.Recover(t.name, t.ip)
+		defer ticker.Stop()
+
+		// Start scan at launch, or once the start delay elapsed. The ticks
+		// then follow the first scan
+		if t.startDelay > 0 {
+			delay := time.NewTimer(t.startDelay)
+			select {
+			case <-delay.C:
+			case <-t.stop:
+				delay.Stop()
+				return
+			case <-done:
+				delay.Stop()
+				return
+			}
+			ticker.Reset(tcpFreq)
+		}
+		j := newJob(t.ip)
+		j.scheduled = j.queued
+		select {
+		case trigger <- j:
+		case <-t.stop:
+			return
+		case <-done:
+			return
+		}
 		for {
 			select {
-			case <-ticker.C:
-				trigger <- t.ip
+			case tick := <-ticker.C:
+				j := newJob(t.ip)
+				j.scheduled = tick
+				select {
+				case trigger <- j:
+				default:
+					missed(tick)
+				}
+			case <-t.stop:
+				return
+			case <-done:
+				return
 			}
 		}
 	}(trigger, ticker, t.ip)
 }
 
-func receiver(scanIsOver chan target, singleResult chan string, pchan chan metrics.PingInfo, mchan chan metrics.NewMetrics) {
+// receiver gathers the ports results of each target, and sends them to the
+// metrics updater and the results store once the scan of the target is over.
+func (s *Scanner) receiver(scanIsOver chan scanReport, singleResult chan portResult, mchan chan metrics.NewMetrics) {
+	defer reporting.Recover("", "")
+
 	// openPorts holds the ports that are open for each target
 	openPorts := make(map[string][]string)
 	// closedPorts holds the ports that are closed
 	closedPorts := make(map[string][]string)
+	// misbehavingPorts holds the reason why the banner of a port does not
+	// match the expected one, for each target, indexed by port
+	misbehavingPorts := make(map[string]map[string]string)
+	// httpMismatches holds the result of the HTTP assertions for each
+	// target, indexed by port
+	httpMismatches := make(map[string]map[string]string)
+	// httpResponses holds the responses to the HTTP checks of each target,
+	// indexed by port
+	httpResponses := make(map[string]map[string]metrics.HTTPResponse)
+	// certificates holds the certificates presented by the inspected TLS
+	// ports of each target, indexed by port
+	certificates := make(map[string]map[string]metrics.TLSCert)
 
-	// Create the store for the values
-	store := storage.Create()
+	// windows holds the TCP window advertised by the first open port of each
+	// address
+	windows := make(map[string]uint32)
+
+	// previous holds the ports found open by the previous scan of each
+	// address
+	previous := make(map[string]*common.PortSet)
 
 	for {
 		select {
-		case t := <-scanIsOver:
-			// Compare stored results with current results and get the delta
-			delta := common.CompareStringSlices(store.Get(t.ip), openPorts[t.ip])
-
-			// Update metrics
-			updatedMetrics := metrics.NewMetrics{
-				Name:     t.name,
-				IP:       t.ip,
-				Diff:     delta,
-				Open:     openPorts[t.ip],
-				Closed:   closedPorts[t.ip],
-				Expected: t.expected,
-				Labels:   t.labels,
+		case report, ok := <-scanIsOver:
+			if !ok {
+				close(mchan)
+				return
+			}
+			s.lastScan.Store(time.Now().UnixNano())
+			t := report.t
+			_, span := tracer.Start(report.ctx, "process results")
+
+			// The target may have been removed or paused while it was
+			// scanned, or its scan aborted, in which case its results are
+			// dropped
+			if report.aborted || removed(t) || s.paused(t) {
+				for _, addr := range t.addresses() {
+					delete(previous, addr)
+					t.setLastOpen(addr, nil)
+					openPorts[addr] = nil
+					closedPorts[addr] = nil
+					delete(misbehavingPorts, addr)
+					delete(httpMismatches, addr)
+					delete(httpResponses, addr)
+					delete(certificates, addr)
+					delete(windows, addr)
+				}
+				span.End()
+				trace.SpanFromContext(report.ctx).End()
+				continue
+			}
+
+			// Open ports are reported in numerical order
+			for _, addr := range t.addresses() {
+				openPorts[addr] = sortedPorts(openPorts[addr])
+			}
+
+			// Ports open on a single address of a dual-stack target are
+			// reported with the IPv6 address
+			var familyMismatches map[string]string
+			if t.ipv6 != "" {
+				familyMismatches = make(map[string]string)
+				open4, open6 := common.PortSetOf(openPorts[t.ip]), common.PortSetOf(openPorts[t.ipv6])
+				for _, port := range openPorts[t.ip] {
+					if !open6.HasString(port) {
+						familyMismatches[port] = familyIPv4
+					}
+				}
+				for _, port := range openPorts[t.ipv6] {
+					if !open4.HasString(port) {
+						familyMismatches[port] = familyIPv6
+					}
+				}
+			}
+
+			// A scan finding no open port may be caused by a blackhole, in
+			// which case its metrics are held, or dropped once the
+			// blackhole is confirmed. A scan finding open ports proves
+			// that the probes get through
+			open := len(openPorts[t.ip])+len(openPorts[t.ipv6]) > 0
+			wasBlackholed := s.blackhole.blackholed()
+			suspect := s.blackhole.observe(t, open)
+			if blackholed := s.blackhole.blackholed(); blackholed != wasBlackholed {
+				s.setBlackholed(blackholed)
+			}
+			if s.blackhole.blackholed() {
+				s.blackhole.drop()
 			}
+			if open {
+				for _, nm := range s.blackhole.release() {
+					mchan <- nm
+					s.record(nm, previous[nm.IP])
+					previous[nm.IP] = common.PortSetOf(nm.Open)
+				}
+			}
+			var held []metrics.NewMetrics
+
+			for _, addr := range t.addresses() {
+				// Compare the previous results with current results and get
+				// the delta
+				current := common.PortSetOf(openPorts[addr])
+				before, scannedBefore := previous[addr]
+				if !scannedBefore {
+					before, scannedBefore = s.lastRecorded(t, addr)
+				}
+				delta := before.Diff(current)
+				var flapping []string
+				if !suspect {
+					flapping = t.flaps.observePorts(addr, openPorts[addr])
+				}
+
+				owner := s.owners.owner(addr)
+
+				// Update metrics
+				updatedMetrics := metrics.NewMetrics{
+					Name:     t.name,
+					IP:       addr,
+					Diff:     delta,
+					Baseline: !scannedBefore,
+					Open:     openPorts[addr],
+					Closed:   closedPorts[addr],
+					Expected: t.expected,
+					Labels:   t.labels,
+
+					ExpectedPorts: t.expectedSet,
+
+					Severities:  t.severities,
+					Annotations: t.annotations,
 
-			// Send new metrics
-			mchan <- updatedMetrics
+					ChangeThreshold: t.changeThreshold,
+					Misbehaving:     misbehavingPorts[addr],
+					HTTPMismatches:  httpMismatches[addr],
+					HTTPResponses:   httpResponses[addr],
+					Certificates:    certificates[addr],
+					Flapping:        flapping,
+					Owner:           owner,
+
+					ScanID: report.job.id,
+					Start:  report.start,
+					End:    report.end,
+
+					Stop: t.stop,
+				}
+				if addr == t.ipv6 {
+					updatedMetrics.FamilyMismatches = familyMismatches
+				}
+				// The timing of the job is only exported once per scan
+				if addr == t.ip {
+					updatedMetrics.Job = &metrics.JobTiming{
+						Queued:    report.job.queued,
+						Scheduled: report.job.scheduled,
+						Started:   report.start,
+						Finished:  report.end,
+						Batches:   report.batches,
+					}
+				}
+
+				// Send new metrics, and update the store
+				switch {
+				case !suspect:
+					mchan <- updatedMetrics
+					s.record(updatedMetrics, before)
+					previous[addr] = current
+					t.setLastOpen(addr, current)
+				case !s.blackhole.blackholed():
+					held = append(held, updatedMetrics)
+				}
+
+				// Keep the latest results available for the API and
+				// exports. They are read by other goroutines, so they get
+				// their own copy of the ports
+				// Echo requests are only sent to the first address, and
+				// MAC addresses are only known for IPv4 neighbours
+				var ttl int
+				var mac string
+				if addr == t.ip {
+					ttl = int(t.replyTTL.Load())
+					mac = lookupMAC(cmp.Or(s.arpTable, arpTablePath), addr)
+				}
+				loc := s.geo.locate(addr)
+				s.saveResults(t, results.Scan{
+					Name:     t.name,
+					IP:       addr,
+					Range:    t.ports,
+					Start:    report.start,
+					End:      report.end,
+					Open:     sortedPorts(openPorts[addr]),
+					Closed:   sortedPorts(closedPorts[addr]),
+					Expected: t.expected,
+					Labels:   t.labels,
 
-			// Update the store
-			store.Update(t.ip, openPorts[t.ip])
+					Annotations: t.annotations,
+					Services:    services.Names(services.TCP, openPorts[addr]),
+
+					TTL:       ttl,
+					TCPWindow: int(windows[addr]),
+					OSFamily:  osFamily(ttl),
+					MAC:       mac,
+					Vendor:    s.oui.vendor(mac),
+
+					Country: loc.Country,
+					ASN:     loc.ASN,
+					ASOrg:   loc.ASOrg,
+					Owner:   owner,
+
+					Flapping:     flapping,
+					HostFlapping: t.flaps.flapping(addr),
+					Suspect:      suspect,
+				})
+			}
+			if held != nil {
+				s.blackhole.hold(t, held)
+			}
+
+			span.SetAttributes(attribute.Int("ports.open", len(openPorts[t.ip])+len(openPorts[t.ipv6])))
+			span.End()
+			trace.SpanFromContext(report.ctx).End()
+
+			s.Logger.Debug().Str("job", report.job.id).Str("name", t.name).Str("ip", t.ip).
+				Time("queued_at", report.job.queued).Time("started_at", report.start).Time("finished_at", report.end).
+				Dur("queued", report.start.Sub(report.job.queued)).Dur("probing", report.end.Sub(report.start)).
+				Dur("processing", time.Since(report.end)).Int("batches", len(report.batches)).
+				Msgf("scan of %s (%s) done", t.name, t.ip)
 
 			// Clear slices
-			openPorts[t.ip] = nil
-			closedPorts[t.ip] = nil
+			for _, addr := range t.addresses() {
+				openPorts[addr] = nil
+				closedPorts[addr] = nil
+				delete(misbehavingPorts, addr)
+				delete(httpMismatches, addr)
+				delete(httpResponses, addr)
+				delete(certificates, addr)
+				delete(windows, addr)
+			}
 		case res := <-singleResult:
-			split := strings.Split(res, ":")
-			// Useless allocations, but it's easier to read
-			ip := string(split[0])
-			port := string(split[1])
-			status := string(split[2])
-
-			if status == "OK" {
-				openPorts[ip] = append(openPorts[ip], port)
-			} else if status == "NOP" {
-				closedPorts[ip] = append(closedPorts[ip], port)
-			} else {
-				log.Fatal().Msgf("port status not recognised: %s (%s)", status, ip)
+			if !res.open {
+				closedPorts[res.ip] = append(closedPorts[res.ip], res.port)
+				continue
+			}
+			openPorts[res.ip] = append(openPorts[res.ip], res.port)
+			if _, ok := windows[res.ip]; !ok && res.window > 0 {
+				windows[res.ip] = res.window
+			}
+
+			if res.bannerErr != nil {
+				if misbehavingPorts[res.ip] == nil {
+					misbehavingPorts[res.ip] = make(map[string]string)
+				}
+				misbehavingPorts[res.ip][res.port] = res.bannerErr.Error()
+			}
+
+			if res.httpChecked {
+				if httpMismatches[res.ip] == nil {
+					httpMismatches[res.ip] = make(map[string]string)
+				}
+				httpMismatches[res.ip][res.port] = ""
+				if res.httpErr != nil {
+					httpMismatches[res.ip][res.port] = res.httpErr.Error()
+				}
+			}
+			if res.httpResp != nil {
+				if httpResponses[res.ip] == nil {
+					httpResponses[res.ip] = make(map[string]metrics.HTTPResponse)
+				}
+				httpResponses[res.ip][res.port] = *res.httpResp
+			}
+
+			if res.cert != nil {
+				if certificates[res.ip] == nil {
+					certificates[res.ip] = make(map[string]metrics.TLSCert)
+				}
+				certificates[res.ip][res.port] = *res.cert
 			}
 		}
 	}
 }
+
+// saveResults stores the results of a scan, publishes them to the outputs and,
+// if configured, writes all the latest results in an nmap XML file. Results of
+// removed targets are ignored.
+func (s *Scanner) saveResults(t *target, scan results.Scan) {
+	// Targets are removed with the lock held, so the target cannot be removed
+	// between the check and the storage of its results
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if removed(t) {
+		return
+	}
+
+	s.Results.Set(scan)
+	s.Outputs.Publish(output.ScanEvent(scan))
+
+	// The last MAC address seen is kept, as neighbours expire from the ARP
+	// table
+	if scan.MAC != "" {
+		s.MetricsServ.TargetMAC.DeletePartialMatch(map[string]string{"name": scan.Name, "ip": scan.IP})
+		s.MetricsServ.TargetMAC.WithLabelValues(scan.Name, scan.IP, scan.MAC, scan.Vendor, t.labels["owner"]).Set(1)
+	}
+	if scan.Country != "" || scan.ASN != 0 {
+		s.MetricsServ.TargetGeo.DeletePartialMatch(map[string]string{"name": scan.Name, "ip": scan.IP})
+		s.MetricsServ.TargetGeo.WithLabelValues(scan.Name, scan.IP, scan.Country, strconv.FormatUint(uint64(scan.ASN), 10), scan.ASOrg, t.labels["owner"]).Set(1)
+	}
+	if s.conf.ServiceInfo {
+		s.MetricsServ.PortService.DeletePartialMatch(map[string]string{"name": scan.Name, "ip": scan.IP})
+		for port, service := range scan.Services {
+			s.MetricsServ.PortService.WithLabelValues(scan.Name, scan.IP, port, service, t.labels["owner"]).Set(1)
+		}
+	}
+
+	if s.conf.NmapOutput == "" {
+		return
+	}
+	if err := nmap.FromResults(s.Results.All(), s.Version).WriteFile(s.conf.NmapOutput); err != nil {
+		s.Logger.Error().Err(err).Msgf("cannot write nmap results to %s", s.conf.NmapOutput)
+		reporting.Error(err, "cannot write nmap results", scan.Name, scan.IP)
+	}
+}
@@ -0,0 +1,181 @@
+package scan
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// startReceiver runs the receiver of s until the end of the test, so that it
+// does not outlive the state set up by the test. The metrics it still sends
+// are discarded, and mchan is closed once it returned.
+func startReceiver(t *testing.T, s *Scanner, scanIsOver chan scanReport, singleResult chan portResult, mchan chan metrics.NewMetrics) {
+	t.Helper()
+	go s.receiver(scanIsOver, singleResult, mchan)
+	t.Cleanup(func() {
+		close(scanIsOver)
+		for range mchan {
+		}
+	})
+}
+
+func TestScanner_receiver_removedTarget(t *testing.T) {
+	s := &Scanner{Results: results.New(), conf: &config.Conf{}}
+	scanIsOver := make(chan scanReport)
+	singleResult := make(chan portResult)
+	mchan := make(chan metrics.NewMetrics, 2)
+	startReceiver(t, s, scanIsOver, singleResult, mchan)
+
+	removedTarget := &target{name: "old", ip: "10.0.0.1", stop: make(chan struct{})}
+	close(removedTarget.stop)
+	liveTarget := &target{name: "app", ip: "10.0.0.2", stop: make(chan struct{})}
+
+	singleResult <- portResult{ip: removedTarget.ip, port: "22", open: true}
+	scanIsOver <- scanReport{t: removedTarget, ctx: context.Background()}
+	singleResult <- portResult{ip: liveTarget.ip, port: "22", open: true}
+	scanIsOver <- scanReport{t: liveTarget, ctx: context.Background()}
+
+	nm := <-mchan
+	if nm.IP != liveTarget.ip {
+		t.Errorf("receiver() sent metrics of %s, want only %s", nm.IP, liveTarget.ip)
+	}
+
+	// The receiver is done with the previous report once it takes a new one
+	scanIsOver <- scanReport{t: removedTarget, ctx: context.Background()}
+	if _, ok := s.Results.Get(removedTarget.ip); ok {
+		t.Errorf("receiver() saved results of removed target")
+	}
+	if _, ok := s.Results.Get(liveTarget.ip); !ok {
+		t.Errorf("receiver() did not save results of %s", liveTarget.ip)
+	}
+}
+
+func TestScanner_receiver_dualStack(t *testing.T) {
+	s := &Scanner{Results: results.New(), conf: &config.Conf{}}
+	scanIsOver := make(chan scanReport)
+	singleResult := make(chan portResult)
+	mchan := make(chan metrics.NewMetrics, 2)
+	startReceiver(t, s, scanIsOver, singleResult, mchan)
+
+	dual := &target{name: "web", ip: "10.0.0.1", ipv6: "fd00::1", stop: make(chan struct{})}
+	singleResult <- portResult{ip: dual.ip, port: "80", open: true}
+	singleResult <- portResult{ip: dual.ip, port: "443", open: true}
+	singleResult <- portResult{ip: dual.ipv6, port: "80", open: true}
+	singleResult <- portResult{ip: dual.ipv6, port: "8080", open: true}
+	singleResult <- portResult{ip: dual.ipv6, port: "443"}
+	scanIsOver <- scanReport{t: dual, ctx: context.Background()}
+
+	v4, v6 := <-mchan, <-mchan
+	if v4.IP != dual.ip || !reflect.DeepEqual(v4.Open, []string{"80", "443"}) || v4.FamilyMismatches != nil {
+		t.Errorf("receiver() sent IPv4 metrics %+v, want open ports 80 and 443 without mismatches", v4)
+	}
+	wantMismatches := map[string]string{"443": familyIPv4, "8080": familyIPv6}
+	if v6.IP != dual.ipv6 || !reflect.DeepEqual(v6.Closed, []string{"443"}) || !reflect.DeepEqual(v6.FamilyMismatches, wantMismatches) {
+		t.Errorf("receiver() sent IPv6 metrics %+v, want closed port 443 and mismatches %v", v6, wantMismatches)
+	}
+
+	// The receiver is done with the previous report once it takes a new one
+	scanIsOver <- scanReport{t: &target{ip: "10.0.0.2", stop: make(chan struct{})}, ctx: context.Background()}
+	for _, ip := range dual.addresses() {
+		if _, ok := s.Results.Get(ip); !ok {
+			t.Errorf("receiver() did not save results of %s", ip)
+		}
+	}
+}
+
+func TestScanner_AddTarget_ipv6(t *testing.T) {
+	tests := []struct {
+		name    string
+		ipv6    string
+		wantErr bool
+	}{
+		{name: "dual-stack", ipv6: "fd00::2"},
+		{name: "IPv4 address", ipv6: "10.0.0.3", wantErr: true},
+		{name: "invalid address", ipv6: "fd00::zz", wantErr: true},
+		{name: "address of another target", ipv6: "fd00::1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{
+				Logger: logger.New("error"),
+				conf:   &config.Conf{},
+				MetricsServ: metrics.Server{
+					NumOfTargets:    prometheus.NewGauge(prometheus.GaugeOpts{Name: "targets"}),
+					PortAnnotations: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "annotations"}, []string{"name", "ip", "port", "annotation", "owner"}),
+					TargetInfo:      prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "info"}, []string{"name", "ip", "owner", "description"}),
+					TargetPaused:    prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "paused"}, []string{"name", "ip", "owner"}),
+				},
+			}
+			if err := s.AddTarget(config.Target{Name: "db", IP: "10.0.0.1", IPv6: "fd00::1"}, sourceConfig); err != nil {
+				t.Fatal(err)
+			}
+
+			err := s.AddTarget(config.Target{Name: "web", IP: "10.0.0.2", IPv6: tt.ipv6}, sourceConfig)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AddTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScanner_receiver_aborted(t *testing.T) {
+	s := &Scanner{Results: results.New(), conf: &config.Conf{}}
+	scanIsOver := make(chan scanReport)
+	singleResult := make(chan portResult)
+	mchan := make(chan metrics.NewMetrics, 2)
+	startReceiver(t, s, scanIsOver, singleResult, mchan)
+
+	tgt := &target{name: "app", ip: "10.0.0.1", stop: make(chan struct{})}
+	singleResult <- portResult{ip: tgt.ip, port: "22", open: true}
+	scanIsOver <- scanReport{t: tgt, ctx: context.Background(), aborted: true}
+	singleResult <- portResult{ip: tgt.ip, port: "80", open: true}
+	scanIsOver <- scanReport{t: tgt, ctx: context.Background()}
+
+	nm := <-mchan
+	if !reflect.DeepEqual(nm.Open, []string{"80"}) || !nm.Baseline {
+		t.Errorf("receiver() sent metrics %+v, want only the results of the complete scan", nm)
+	}
+	if len(mchan) != 0 {
+		t.Errorf("receiver() sent metrics of the aborted scan")
+	}
+}
+
+func TestScanner_receiver_services(t *testing.T) {
+	services := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "services"}, []string{"name", "ip", "port", "service", "owner"})
+	s := &Scanner{
+		Results:     results.New(),
+		conf:        &config.Conf{ServiceInfo: true},
+		MetricsServ: metrics.Server{PortService: services},
+	}
+	scanIsOver := make(chan scanReport)
+	singleResult := make(chan portResult)
+	startReceiver(t, s, scanIsOver, singleResult, make(chan metrics.NewMetrics, 4))
+
+	tgt := &target{name: "app", ip: "10.0.0.1", stop: make(chan struct{})}
+	singleResult <- portResult{ip: tgt.ip, port: "6379", open: true}
+	singleResult <- portResult{ip: tgt.ip, port: "31337", open: true}
+	scanIsOver <- scanReport{t: tgt, ctx: context.Background()}
+	singleResult <- portResult{ip: tgt.ip, port: "22", open: true}
+	scanIsOver <- scanReport{t: tgt, ctx: context.Background()}
+
+	// The receiver is done with the previous report once it takes a new one
+	scanIsOver <- scanReport{t: &target{ip: "10.0.0.3", stop: make(chan struct{})}, ctx: context.Background()}
+
+	got, _ := s.Results.Get(tgt.ip)
+	if want := map[string]string{"22": "ssh"}; !reflect.DeepEqual(got.Services, want) {
+		t.Errorf("receiver() saved services %v, want %v", got.Services, want)
+	}
+	if n := testutil.CollectAndCount(services); n != 1 {
+		t.Errorf("service info metric has %d series, want only the one of the last scan", n)
+	}
+	if v := testutil.ToFloat64(services.WithLabelValues("app", "10.0.0.1", "22", "ssh", "")); v != 1 {
+		t.Errorf("service info metric = %v, want 1", v)
+	}
+}
@@ -0,0 +1,69 @@
+package scan
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/results"
+)
+
+func TestScanner_Start_shutdown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+
+	tests := []struct {
+		name            string
+		ip              string
+		shutdownTimeout string
+		wantResults     bool
+	}{
+		{name: "drained", ip: "127.0.0.1", wantResults: true},
+		{name: "interrupted", ip: "127.0.0.2", shutdownTimeout: "0s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{Logger: logger.New("error"), Results: results.New(), MetricsServ: *testMetrics()}
+
+			// Probing the 4 ports at 10 queries per second takes longer
+			// than the delay before the shutdown
+			tgt := config.Target{Name: tt.name, IP: tt.ip}
+			tgt.TCP.Period = "1h"
+			tgt.TCP.Range = port + ",1-3"
+			tgt.ICMP.Period = "0"
+			c := &config.Conf{Timeout: 1, Limit: 8, QueriesPerSecond: 10, ShutdownTimeout: tt.shutdownTimeout, Targets: []config.Target{tgt}}
+
+			ctx, stop := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() { done <- s.Start(ctx, c) }()
+			time.Sleep(100 * time.Millisecond)
+			stop()
+
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("Start() error = %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Start() did not return once stopped")
+			}
+
+			got, ok := s.Results.Get(tt.ip)
+			if ok != tt.wantResults {
+				t.Fatalf("Start() saved results %v, want %v", ok, tt.wantResults)
+			}
+			if ok && !slices.Contains(got.Open, port) {
+				t.Errorf("Start() saved open ports %v, want %s", got.Open, port)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux
+
+package scan
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// bindToDevice sends the packets of a socket through a network interface,
+// whatever the routing table says.
+func bindToDevice(c syscall.RawConn, iface string) error {
+	var err error
+	if ctrlErr := c.Control(func(fd uintptr) {
+		err = syscall.BindToDevice(int(fd), iface)
+	}); ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
+
+// tcpWindow returns the TCP window advertised by the remote end of a
+// connection, or zero if it is unknown.
+func tcpWindow(conn net.Conn) uint32 {
+	if pc, ok := conn.(*pooledConn); ok {
+		conn = pc.Conn
+	}
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return 0
+	}
+	raw, err := tc.SyscallConn()
+	if err != nil {
+		return 0
+	}
+
+	var window uint32
+	raw.Control(func(fd uintptr) {
+		if info, err := unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO); err == nil {
+			window = info.Snd_wnd
+		}
+	})
+	return window
+}
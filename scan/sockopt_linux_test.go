@@ -0,0 +1,61 @@
+//go:build linux
+
+package scan
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_dialer_dial_iface(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	tests := []struct {
+		name    string
+		iface   string
+		wantErr bool
+	}{
+		{name: "loopback", iface: loopbackInterface(t)},
+		{name: "unknown interface", iface: "scanexporter0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := &dialer{iface: tt.iface}
+			conn, err := d.dial(l.Addr().String(), time.Second)
+			if errors.Is(err, syscall.EPERM) {
+				t.Skip("binding to an interface needs CAP_NET_RAW")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("dial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				conn.Close()
+			}
+		})
+	}
+}
+
+func Test_tcpWindow(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conn, err := (&dialer{}).dial(l.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if got := tcpWindow(conn); got == 0 {
+		t.Errorf("tcpWindow() = 0, want the window of the listener")
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package scan
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// bindToDevice fails on systems where sockets cannot be bound to a network
+// interface.
+func bindToDevice(c syscall.RawConn, iface string) error {
+	return errors.New("selecting the interface is not supported on this system")
+}
+
+// tcpWindow returns zero, as the TCP window of connections is not known on
+// this system.
+func tcpWindow(conn net.Conn) uint32 {
+	return 0
+}
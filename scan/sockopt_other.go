@@ -0,0 +1,19 @@
+//go:build !unix
+
+package scan
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reuseAddr does nothing on systems without SO_REUSEADDR for outgoing
+// connections.
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	return nil
+}
+
+// setTTL fails on systems where the TTL of connections cannot be set.
+func setTTL(network string, c syscall.RawConn, ttl int) error {
+	return errors.New("setting the TTL is not supported on this system")
+}
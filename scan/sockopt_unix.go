@@ -0,0 +1,37 @@
+//go:build unix
+
+package scan
+
+import (
+	"strings"
+	"syscall"
+)
+
+// reuseAddr allows binding a source port still used by a connection which is
+// not fully closed.
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	var err error
+	if ctrlErr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	}); ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
+
+// setTTL sets the TTL of the outgoing IPv4 packets, or the hop limit of the
+// IPv6 ones.
+func setTTL(network string, c syscall.RawConn, ttl int) error {
+	level, opt := syscall.IPPROTO_IP, syscall.IP_TTL
+	if strings.HasSuffix(network, "6") {
+		level, opt = syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS
+	}
+
+	var err error
+	if ctrlErr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(int(fd), level, opt, ttl)
+	}); ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
@@ -0,0 +1,62 @@
+//go:build unix
+
+package scan
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_dialer_dial_ttl(t *testing.T) {
+	tests := []struct {
+		name    string
+		network string
+		address string
+		level   int
+		opt     int
+	}{
+		{name: "IPv4", network: "tcp4", address: "127.0.0.1:0", level: syscall.IPPROTO_IP, opt: syscall.IP_TTL},
+		{name: "IPv6", network: "tcp6", address: "[::1]:0", level: syscall.IPPROTO_IPV6, opt: syscall.IPV6_UNICAST_HOPS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := net.Listen(tt.network, tt.address)
+			if err != nil {
+				t.Skipf("cannot listen on %s: %v", tt.address, err)
+			}
+			defer l.Close()
+
+			// Port 0 lets the system pick the source port, while going through
+			// the pool
+			pool := &portPool{size: 1, ports: make(chan int, 1)}
+			pool.put(0)
+			for _, d := range []*dialer{{ttl: 7}, {ttl: 7, sourcePorts: pool}} {
+				conn, err := d.dial(l.Addr().String(), time.Second)
+				if err != nil {
+					t.Fatalf("dial() error = %v", err)
+				}
+
+				if pc, ok := conn.(*pooledConn); ok {
+					conn = pc.Conn
+				}
+				raw, err := conn.(*net.TCPConn).SyscallConn()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got int
+				raw.Control(func(fd uintptr) {
+					got, err = syscall.GetsockoptInt(int(fd), tt.level, tt.opt)
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != 7 {
+					t.Errorf("TTL = %d, want 7", got)
+				}
+				conn.Close()
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package scan
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+// startupProgressInterval is the interval at which the progress of the
+// validation of the targets is logged at startup.
+const startupProgressInterval = 5 * time.Second
+
+// addTargets validates the targets concurrently, as configuring thousands of
+// them one after the other takes minutes, then adds them in order. Targets with
+// an invalid IP are skipped, and any other error is returned. The first scans
+// of the targets are spread over spread.
+func (s *Scanner) addTargets(confs []config.Target, spread time.Duration) error {
+	start := time.Now()
+	targets := make([]*target, len(confs))
+	errs := make([]error, len(confs))
+
+	var validated atomic.Int64
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+	for range min(runtime.GOMAXPROCS(0), len(confs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				targets[i], errs[i] = s.validateTarget(confs[i])
+				validated.Add(1)
+			}
+		}()
+	}
+
+	go func() {
+		for i := range confs {
+			indexes <- i
+		}
+		close(indexes)
+	}()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(startupProgressInterval)
+	defer ticker.Stop()
+wait:
+	for {
+		select {
+		case <-done:
+			break wait
+		case <-ticker.C:
+			s.Logger.Info().Msgf("%d/%d target(s) validated", validated.Load(), len(confs))
+		}
+	}
+	s.Logger.Info().Msgf("%d target(s) validated in %s", len(confs), time.Since(start).Truncate(time.Millisecond))
+
+	for i, t := range confs {
+		if err := errs[i]; err != nil {
+			if errors.Is(err, errInvalidIP) {
+				s.Logger.Error().Err(err).Msgf("skipping target %s", t.Name)
+				continue
+			}
+			return err
+		}
+		targets[i].startDelay = spread * time.Duration(i) / time.Duration(len(confs))
+		if err := s.addTarget(targets[i], sourceConfig); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package scan
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestScanner_addTargets(t *testing.T) {
+	newScanner := func() *Scanner {
+		return &Scanner{
+			Logger: logger.New("error"),
+			conf:   &config.Conf{},
+			MetricsServ: metrics.Server{
+				NumOfTargets:    prometheus.NewGauge(prometheus.GaugeOpts{Name: "targets"}),
+				PortAnnotations: prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "annotations"}, []string{"name", "ip", "port", "annotation", "owner"}),
+				TargetInfo:      prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "info"}, []string{"name", "ip", "owner", "description"}),
+				TargetPaused:    prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "paused"}, []string{"name", "ip", "owner"}),
+			},
+		}
+	}
+
+	var confs []config.Target
+	for i := range 40 {
+		confs = append(confs, config.Target{Name: fmt.Sprintf("host%d", i), IP: fmt.Sprintf("10.0.0.%d", i+1)})
+	}
+	confs[10].IP = "10.0.0"
+
+	s := newScanner()
+	if err := s.addTargets(confs, 40*time.Second); err != nil {
+		t.Fatalf("addTargets() error = %v", err)
+	}
+	if len(s.Targets) != 39 {
+		t.Fatalf("addTargets() added %d targets, want 39 without the invalid IP", len(s.Targets))
+	}
+	for _, tgt := range s.Targets {
+		var i int
+		fmt.Sscanf(tgt.name, "host%d", &i)
+		if tgt.ip != confs[i].IP {
+			t.Errorf("target %s has IP %s, want %s", tgt.name, tgt.ip, confs[i].IP)
+		}
+		if want := time.Duration(i) * time.Second; tgt.startDelay != want {
+			t.Errorf("target %s has start delay %s, want %s", tgt.name, tgt.startDelay, want)
+		}
+	}
+	if s.Targets[0].name != "host0" || s.Targets[38].name != "host39" {
+		t.Errorf("addTargets() did not keep the order of the targets")
+	}
+
+	// Errors other than invalid IPs are returned
+	confs[20].TCP.Range = "1-abc"
+	if err := newScanner().addTargets(confs, 0); err == nil {
+		t.Errorf("addTargets() with an invalid range error = nil, want an error")
+	}
+}
+
+func Test_target_scheduler_startDelay(t *testing.T) {
+	tgt := &target{name: "app", ip: "127.0.0.1", tcpPeriod: "1h", startDelay: 100 * time.Millisecond, stop: make(chan struct{})}
+	defer close(tgt.stop)
+
+	trigger := make(chan job, 1)
+	start := time.Now()
+	tgt.scheduler(logger.New("error"), trigger, nil, func(time.Time) {})
+
+	select {
+	case <-trigger:
+		if elapsed := time.Since(start); elapsed < tgt.startDelay {
+			t.Errorf("first scan queued after %s, want at least %s", elapsed, tgt.startDelay)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("first scan not queued")
+	}
+}
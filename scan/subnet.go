@@ -0,0 +1,92 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/devops-works/scan-exporter/config"
+	"golang.org/x/sync/semaphore"
+)
+
+// Default prefix lengths of the subnets sharing a probe limit.
+const (
+	defaultSubnetIPv4Prefix = 24
+	defaultSubnetIPv6Prefix = 64
+)
+
+// subnetLimiter limits the number of simultaneous probes per destination
+// subnet, so that targets behind the same firewall do not trigger its flood
+// protection. It is safe for concurrent use.
+type subnetLimiter struct {
+	limit      int64
+	ipv4, ipv6 net.IPMask
+
+	mu   sync.Mutex
+	sems map[string]*semaphore.Weighted
+}
+
+// newSubnetLimiter creates a subnet limiter from its configuration. It returns
+// nil if the limit is disabled.
+func newSubnetLimiter(c *config.SubnetLimit) (*subnetLimiter, error) {
+	if c == nil || c.Probes == 0 {
+		return nil, nil
+	}
+	if c.Probes < 0 {
+		return nil, fmt.Errorf("number of probes %d cannot be negative", c.Probes)
+	}
+
+	ipv4, ipv6 := c.IPv4Prefix, c.IPv6Prefix
+	if ipv4 == 0 {
+		ipv4 = defaultSubnetIPv4Prefix
+	}
+	if ipv6 == 0 {
+		ipv6 = defaultSubnetIPv6Prefix
+	}
+	if ipv4 < 1 || ipv4 > 32 {
+		return nil, fmt.Errorf("IPv4 prefix length %d is not between 1 and 32", ipv4)
+	}
+	if ipv6 < 1 || ipv6 > 128 {
+		return nil, fmt.Errorf("IPv6 prefix length %d is not between 1 and 128", ipv6)
+	}
+
+	return &subnetLimiter{
+		limit: int64(c.Probes),
+		ipv4:  net.CIDRMask(ipv4, 32),
+		ipv6:  net.CIDRMask(ipv6, 128),
+		sems:  make(map[string]*semaphore.Weighted),
+	}, nil
+}
+
+// subnet returns the subnet of an IP address.
+func (l *subnetLimiter) subnet(ip string) string {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return ip
+	}
+	if v4 := addr.To4(); v4 != nil {
+		return v4.Mask(l.ipv4).String()
+	}
+	return addr.Mask(l.ipv6).String()
+}
+
+// acquire waits until a probe of ip can start, and returns the function to
+// call once it is over. It does not wait on a nil limiter.
+func (l *subnetLimiter) acquire(ip string) func() {
+	if l == nil {
+		return func() {}
+	}
+
+	subnet := l.subnet(ip)
+	l.mu.Lock()
+	sem, ok := l.sems[subnet]
+	if !ok {
+		sem = semaphore.NewWeighted(l.limit)
+		l.sems[subnet] = sem
+	}
+	l.mu.Unlock()
+
+	sem.Acquire(context.TODO(), 1)
+	return func() { sem.Release(1) }
+}
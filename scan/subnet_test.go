@@ -0,0 +1,99 @@
+package scan
+
+import (
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+)
+
+func Test_newSubnetLimiter(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.SubnetLimit
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "not configured", conf: nil, wantNil: true},
+		{name: "disabled", conf: &config.SubnetLimit{IPv4Prefix: 16}, wantNil: true},
+		{name: "defaults", conf: &config.SubnetLimit{Probes: 32}},
+		{name: "negative probes", conf: &config.SubnetLimit{Probes: -1}, wantErr: true},
+		{name: "invalid IPv4 prefix", conf: &config.SubnetLimit{Probes: 32, IPv4Prefix: 33}, wantErr: true},
+		{name: "invalid IPv6 prefix", conf: &config.SubnetLimit{Probes: 32, IPv6Prefix: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newSubnetLimiter(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newSubnetLimiter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (got == nil) != tt.wantNil {
+				t.Errorf("newSubnetLimiter() = %v, want nil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_subnetLimiter_subnet(t *testing.T) {
+	l, err := newSubnetLimiter(&config.SubnetLimit{Probes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "10.0.0.1", want: "10.0.0.0"},
+		{ip: "10.0.0.254", want: "10.0.0.0"},
+		{ip: "10.0.1.1", want: "10.0.1.0"},
+		{ip: "fd00::1", want: "fd00::"},
+		{ip: "fd00:0:0:1::1", want: "fd00:0:0:1::"},
+	}
+	for _, tt := range tests {
+		if got := l.subnet(tt.ip); got != tt.want {
+			t.Errorf("subnet(%s) = %s, want %s", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func Test_subnetLimiter_acquire(t *testing.T) {
+	l, err := newSubnetLimiter(&config.SubnetLimit{Probes: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	release := l.acquire("10.0.0.1")
+
+	// Another subnet is not limited by the probe in progress
+	done := make(chan struct{})
+	go func() {
+		l.acquire("10.0.1.1")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("acquire() of another subnet blocked")
+	}
+
+	// The same subnet waits for the probe in progress
+	acquired := make(chan struct{})
+	go func() {
+		l.acquire("10.0.0.2")()
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("acquire() of the same subnet did not wait")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("acquire() of the same subnet blocked after release")
+	}
+
+	var disabled *subnetLimiter
+	disabled.acquire("10.0.0.1")()
+}
@@ -0,0 +1,453 @@
+package scan
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/rs/zerolog"
+)
+
+// Scan modes of the targets. Connect scans open a connection to each port,
+// while SYN scans only send the first packet of the handshake through a raw
+// socket, and read the state of the port from the reply.
+const (
+	modeConnect = "connect"
+	modeSYN     = "syn"
+)
+
+// TCP flags read and written by the SYN probes.
+const (
+	tcpSYN = 0x02
+	tcpRST = 0x04
+	tcpACK = 0x10
+)
+
+// synWindow is the TCP window advertised by the SYN probes.
+const synWindow = 1024
+
+// rawSocket sends TCP segments to IPv4 addresses, the system adding their IP
+// header, and receives the IPv4 packets carrying TCP segments. Closing it
+// makes recv fail.
+type rawSocket interface {
+	send(segment []byte, dst netip.Addr) error
+	recv(buf []byte) (int, error)
+	close() error
+}
+
+// synKey identifies a port of an address to which a SYN probe was sent.
+type synKey struct {
+	addr netip.Addr
+	port uint16
+}
+
+// synBatch holds the replies to the SYN probes sent to the ports of an
+// address.
+type synBatch struct {
+	addr  netip.Addr
+	ports []int
+
+	mu sync.Mutex
+	// open holds the TCP window advertised by the open ports, and closed
+	// the ports which reset the connection
+	open   map[int]uint32
+	closed map[int]bool
+	// waiting is the number of probes without reply. done is closed once
+	// all the probes got one
+	waiting int
+	done    chan struct{}
+}
+
+// reply records the reply of a port, unless it already got one.
+func (b *synBatch) reply(port int, open bool, window uint32) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.open[port]; ok || b.closed[port] {
+		return
+	}
+	if open {
+		b.open[port] = window
+	} else {
+		b.closed[port] = true
+	}
+	b.waiting--
+	if b.waiting == 0 {
+		close(b.done)
+	}
+}
+
+// state returns the state of a port: open, with the TCP window it advertised,
+// closed, or neither when it did not reply.
+func (b *synBatch) state(port int) (window uint32, open, closed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	window, open = b.open[port]
+	return window, open, b.closed[port]
+}
+
+// update replaces the state of a port with its state in another batch.
+func (b *synBatch) update(port int, from *synBatch) {
+	window, open, closed := from.state(port)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.open, port)
+	delete(b.closed, port)
+	if open {
+		b.open[port] = window
+	}
+	if closed {
+		b.closed[port] = true
+	}
+}
+
+// synEngine sends the SYN probes of all the targets through a single raw
+// socket, and matches the replies with the probes waiting for them.
+type synEngine struct {
+	sock   rawSocket
+	logger zerolog.Logger
+	// srcPort is the source port of the probes, reserved so that no
+	// connection of the host uses it, and seq the sequence number of the
+	// probes, acknowledged by the replies
+	srcPort uint16
+	seq     uint32
+
+	mu      sync.Mutex
+	pending map[synKey]*synBatch
+
+	// closed is set once the socket is closed on shutdown, so that the
+	// failure of the reads it causes is not reported
+	closed atomic.Bool
+}
+
+// newSYNEngine creates an engine sending its probes through sock from
+// srcPort, and starts reading the replies.
+func newSYNEngine(sock rawSocket, srcPort uint16, logger zerolog.Logger) *synEngine {
+	e := &synEngine{
+		sock:    sock,
+		logger:  logger,
+		srcPort: srcPort,
+		seq:     rand.Uint32(),
+		pending: make(map[synKey]*synBatch),
+	}
+	go e.receive()
+	return e
+}
+
+// synEngine returns the engine of the SYN scans, which is created when the
+// first target using them is read.
+func (s *Scanner) synEngine() (*synEngine, error) {
+	s.synMu.Lock()
+	defer s.synMu.Unlock()
+
+	if s.syn == nil {
+		e, err := openSYNEngine(s.Logger)
+		if err != nil {
+			return nil, err
+		}
+		s.syn = e
+	}
+	return s.syn, nil
+}
+
+// send sends a SYN probe to each port of ip, waiting for the delay returned by
+// delay between two probes. The ports are copied, so that the caller can reuse
+// them. The probes which could not be sent are left without reply, and the
+// first error is returned along with the batch.
+func (e *synEngine) send(ip string, ports []int, delay func() time.Duration) (*synBatch, error) {
+	dst, err := netip.ParseAddr(ip)
+	if err != nil || !dst.Is4() {
+		return nil, fmt.Errorf("SYN probes can only be sent to IPv4 addresses, not %s", ip)
+	}
+	src, err := localAddr(dst)
+	if err != nil {
+		return nil, fmt.Errorf("no route to %s: %w", ip, err)
+	}
+
+	b := &synBatch{
+		addr:    dst,
+		ports:   append([]int(nil), ports...),
+		open:    make(map[int]uint32),
+		closed:  make(map[int]bool),
+		waiting: len(ports),
+		done:    make(chan struct{}),
+	}
+	if len(ports) == 0 {
+		close(b.done)
+		return b, nil
+	}
+
+	e.mu.Lock()
+	for _, port := range b.ports {
+		e.pending[synKey{addr: dst, port: uint16(port)}] = b
+	}
+	e.mu.Unlock()
+
+	var sendErr error
+	segment := make([]byte, synSegmentLen)
+	for i, port := range b.ports {
+		if i > 0 {
+			time.Sleep(delay())
+		}
+		buildSYN(segment, src, dst, e.srcPort, uint16(port), e.seq)
+		if err := e.sock.send(segment, dst); err != nil && sendErr == nil {
+			sendErr = err
+		}
+	}
+	return b, sendErr
+}
+
+// wait waits until all the probes of the batch got a reply, or for timeout.
+// The ports which did not reply are no longer waited for.
+func (e *synEngine) wait(b *synBatch, timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-b.done:
+	case <-timer.C:
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, port := range b.ports {
+		key := synKey{addr: b.addr, port: uint16(port)}
+		if e.pending[key] == b {
+			delete(e.pending, key)
+		}
+	}
+}
+
+// receive reads the replies to the probes until the socket fails.
+func (e *synEngine) receive() {
+	buf := make([]byte, 65535)
+	for {
+		n, err := e.sock.recv(buf)
+		if err != nil {
+			if e.closed.Load() {
+				return
+			}
+			e.logger.Error().Err(err).Msg("cannot read replies to SYN probes, SYN scans stopped")
+			return
+		}
+		reply, ok := parseSYNReply(buf[:n], e.srcPort, e.seq)
+		if !ok {
+			continue
+		}
+
+		key := synKey{addr: reply.addr, port: reply.port}
+		e.mu.Lock()
+		b := e.pending[key]
+		delete(e.pending, key)
+		e.mu.Unlock()
+		if b != nil {
+			b.reply(int(reply.port), reply.open, reply.window)
+		}
+	}
+}
+
+// close closes the socket of the engine, which stops reading the replies, and
+// releases the source port of the probes.
+func (e *synEngine) close() error {
+	e.closed.Store(true)
+	return e.sock.close()
+}
+
+// closeSYN closes the engine of the SYN scans, if any target created it.
+func (s *Scanner) closeSYN() {
+	s.synMu.Lock()
+	defer s.synMu.Unlock()
+
+	if s.syn == nil {
+		return
+	}
+	if err := s.syn.close(); err != nil {
+		s.Logger.Warn().Err(err).Msg("cannot close the raw socket of the SYN probes")
+	}
+	s.syn = nil
+}
+
+// localAddr returns the address from which the packets sent to dst leave the
+// host, as chosen by the routing table.
+func localAddr(dst netip.Addr) (netip.Addr, error) {
+	// Connecting a UDP socket sends nothing, but selects the route
+	conn, err := net.Dial("udp4", netip.AddrPortFrom(dst, 9).String())
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap(), nil
+}
+
+// synSegmentLen is the length of the SYN probes: a TCP header with the MSS
+// option, so that they look like the ones of the system.
+const synSegmentLen = 24
+
+// buildSYN writes in segment, which is synSegmentLen bytes long, a SYN probe
+// sent from src to dst.
+func buildSYN(segment []byte, src, dst netip.Addr, srcPort, dstPort uint16, seq uint32) {
+	binary.BigEndian.PutUint16(segment[0:], srcPort)
+	binary.BigEndian.PutUint16(segment[2:], dstPort)
+	binary.BigEndian.PutUint32(segment[4:], seq)
+	binary.BigEndian.PutUint32(segment[8:], 0)
+	segment[12] = (synSegmentLen / 4) << 4
+	segment[13] = tcpSYN
+	binary.BigEndian.PutUint16(segment[14:], synWindow)
+	binary.BigEndian.PutUint16(segment[16:], 0)
+	binary.BigEndian.PutUint16(segment[18:], 0)
+	// MSS of 1460 bytes
+	copy(segment[20:], []byte{2, 4, 0x05, 0xb4})
+	binary.BigEndian.PutUint16(segment[16:], tcpChecksum(segment, src, dst))
+}
+
+// tcpChecksum computes the checksum of a TCP segment sent from src to dst,
+// whose checksum field is zero.
+func tcpChecksum(segment []byte, src, dst netip.Addr) uint16 {
+	s4, d4 := src.As4(), dst.As4()
+	var sum uint32
+	add := func(b []byte) {
+		for i := 0; i+1 < len(b); i += 2 {
+			sum += uint32(b[i])<<8 | uint32(b[i+1])
+		}
+		if len(b)%2 == 1 {
+			sum += uint32(b[len(b)-1]) << 8
+		}
+	}
+	// Pseudo header
+	add(s4[:])
+	add(d4[:])
+	sum += 6 + uint32(len(segment))
+	add(segment)
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// synReply is the reply of a port to a SYN probe.
+type synReply struct {
+	addr   netip.Addr
+	port   uint16
+	open   bool
+	window uint32
+}
+
+// parseSYNReply reads an IPv4 packet, and reports whether it is the reply to a
+// SYN probe sent from srcPort with the sequence number seq: a SYN-ACK from an
+// open port, or a RST from a closed one.
+func parseSYNReply(pkt []byte, srcPort uint16, seq uint32) (synReply, bool) {
+	if len(pkt) < 20 || pkt[0]>>4 != 4 || pkt[9] != 6 {
+		return synReply{}, false
+	}
+	ihl := int(pkt[0]&0x0f) * 4
+	if ihl < 20 || len(pkt) < ihl+20 {
+		return synReply{}, false
+	}
+	tcp := pkt[ihl:]
+	if binary.BigEndian.Uint16(tcp[2:]) != srcPort || binary.BigEndian.Uint32(tcp[8:]) != seq+1 {
+		return synReply{}, false
+	}
+
+	reply := synReply{
+		addr: netip.AddrFrom4([4]byte(pkt[12:16])),
+		port: binary.BigEndian.Uint16(tcp[0:]),
+	}
+	flags := tcp[13]
+	switch {
+	case flags&tcpRST != 0:
+	case flags&(tcpSYN|tcpACK) == tcpSYN|tcpACK:
+		reply.open = true
+		reply.window = uint32(binary.BigEndian.Uint16(tcp[14:]))
+	default:
+		return synReply{}, false
+	}
+	return reply, true
+}
+
+// collectSYN waits for the replies to the SYN probes of a batch of ports of t,
+// confirms the changes of state since the previous scan, whose open ports are
+// given by before, and sends their results through singleResult. The open
+// ports with a banner, a check, HTTP assertions or a certificate to inspect
+// are then probed with a connection, as in connect scans. It returns the
+// number of probes without reply.
+func (s *Scanner) collectSYN(ctx context.Context, t *target, b *synBatch, before *common.PortSet, dials *dialStats, singleResult chan portResult) int {
+	timeout := t.dialer.probeTimeout(s.Timeout)
+	t.syn.wait(b, timeout)
+	s.confirmSYN(ctx, t, b, before, timeout)
+
+	unanswered := 0
+	for _, port := range b.ports {
+		window, open, closed := b.state(port)
+
+		switch {
+		case open && (t.banners[port] != nil || t.checks[port] != nil || t.http.handles(port) || t.tls.handles(port)):
+			s.Lock.Acquire(context.TODO(), 1)
+			s.scanPort(ctx, t.ip, port, t.banners[port], t.checks[port], t.http, t.tls, t.dialer, dials, singleResult)
+			s.Lock.Release(1)
+		case open:
+			singleResult <- portResult{ip: t.ip, port: portString(port), open: true, window: window}
+		default:
+			if !closed {
+				unanswered++
+			}
+			singleResult <- portResult{ip: t.ip, port: portString(port)}
+		}
+	}
+	return unanswered
+}
+
+// confirmSYN probes again, like confirmPort, the ports of a batch which
+// changed state since the previous scan, up to the number of retries of the
+// target, until a probe finds them in their previous state. The states of the
+// batch are replaced by the ones of the last probes.
+func (s *Scanner) confirmSYN(ctx context.Context, t *target, b *synBatch, before *common.PortSet, timeout time.Duration) {
+	if t.retries == 0 || before == nil {
+		return
+	}
+
+	changed := func(b *synBatch, ports []int) []int {
+		var c []int
+		for _, port := range ports {
+			if _, open, _ := b.state(port); open != before.Has(port) {
+				c = append(c, port)
+			}
+		}
+		return c
+	}
+	ports := changed(b, b.ports)
+	for i := 0; i < t.retries && len(ports) > 0; i++ {
+		select {
+		case <-time.After(t.jittered(t.retryDelay)):
+		case <-ctx.Done():
+			return
+		}
+
+		retry, err := t.syn.send(t.ip, ports, func() time.Duration {
+			s.waitRate(ctx, t)
+			return 0
+		})
+		if err != nil {
+			s.Logger.Warn().Str("name", t.name).Str("ip", t.ip).Err(err).Msgf("cannot send SYN probes to %s (%s)", t.name, t.ip)
+		}
+		if retry == nil {
+			return
+		}
+		t.syn.wait(retry, timeout)
+		for _, port := range retry.ports {
+			b.update(port, retry)
+		}
+
+		confirmed := len(ports)
+		ports = changed(retry, retry.ports)
+		if confirmed -= len(ports); confirmed > 0 {
+			s.Logger.Debug().Str("name", t.name).Str("ip", t.ip).Int("ports", confirmed).Int("probes", i+2).Msgf("change of state of %d port(s) of %s (%s) not confirmed", confirmed, t.name, t.ip)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+//go:build linux
+
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"syscall"
+
+	"github.com/rs/zerolog"
+	"golang.org/x/sys/unix"
+)
+
+// linuxRawSocket is a raw IPv4 socket receiving the TCP packets of the host.
+// It is read through the runtime poller, so that closing it unblocks recv.
+type linuxRawSocket struct {
+	file *os.File
+	conn syscall.RawConn
+	// reserved is the socket bound to the source port of the probes
+	reserved int
+}
+
+func (s *linuxRawSocket) send(segment []byte, dst netip.Addr) error {
+	var err error
+	werr := s.conn.Write(func(fd uintptr) bool {
+		err = unix.Sendto(int(fd), segment, 0, &unix.SockaddrInet4{Addr: dst.As4()})
+		return !errors.Is(err, unix.EAGAIN)
+	})
+	if werr != nil {
+		return werr
+	}
+	return err
+}
+
+func (s *linuxRawSocket) recv(buf []byte) (int, error) {
+	var n int
+	var err error
+	rerr := s.conn.Read(func(fd uintptr) bool {
+		for {
+			n, _, err = unix.Recvfrom(int(fd), buf, 0)
+			if !errors.Is(err, unix.EINTR) {
+				return !errors.Is(err, unix.EAGAIN)
+			}
+		}
+	})
+	if rerr != nil {
+		return 0, rerr
+	}
+	return n, err
+}
+
+func (s *linuxRawSocket) close() error {
+	return errors.Join(s.file.Close(), unix.Close(s.reserved))
+}
+
+// openSYNEngine opens the raw socket of the SYN probes, which requires the
+// CAP_NET_RAW capability, and reserves their source port.
+func openSYNEngine(logger zerolog.Logger) (*synEngine, error) {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK, unix.IPPROTO_TCP)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open raw socket, CAP_NET_RAW is required: %w", err)
+	}
+	file := os.NewFile(uintptr(fd), "syn")
+	conn, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot open raw socket: %w", err)
+	}
+
+	// The port is bound without listening, so that the system resets the
+	// connections opened by the replies. It stays bound until the engine is
+	// closed
+	reserved, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, unix.IPPROTO_TCP)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("cannot reserve the source port of the SYN probes: %w", err)
+	}
+	if err := unix.Bind(reserved, &unix.SockaddrInet4{}); err != nil {
+		file.Close()
+		unix.Close(reserved)
+		return nil, fmt.Errorf("cannot reserve the source port of the SYN probes: %w", err)
+	}
+	sa, err := unix.Getsockname(reserved)
+	if err != nil {
+		file.Close()
+		unix.Close(reserved)
+		return nil, fmt.Errorf("cannot reserve the source port of the SYN probes: %w", err)
+	}
+
+	sock := &linuxRawSocket{file: file, conn: conn, reserved: reserved}
+	return newSYNEngine(sock, uint16(sa.(*unix.SockaddrInet4).Port), logger), nil
+}
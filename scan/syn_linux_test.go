@@ -0,0 +1,60 @@
+//go:build linux
+
+package scan
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func Test_openSYNEngine(t *testing.T) {
+	e, err := openSYNEngine(zerolog.Nop())
+	if err != nil {
+		t.Skipf("raw sockets unavailable: %s", err)
+	}
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	closed, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	open := ln.Addr().(*net.TCPAddr).Port
+
+	s := &Scanner{Timeout: time.Second}
+	tgt := &target{ip: "127.0.0.1", syn: e}
+	b, err := e.send(tgt.ip, []int{open, closedPort}, func() time.Duration { return 0 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan portResult, 2)
+	if unanswered := s.collectSYN(context.Background(), tgt, b, nil, &dialStats{}, results); unanswered != 0 {
+		t.Errorf("collectSYN() = %d unanswered probes, want 0", unanswered)
+	}
+	close(results)
+	for r := range results {
+		if want := r.port == portString(open); r.open != want {
+			t.Errorf("port %s open = %v, want %v", r.port, r.open, want)
+		}
+	}
+
+	// Closing the engine releases the source port of the probes
+	if err := e.close(); err != nil {
+		t.Fatal(err)
+	}
+	released, err := net.Listen("tcp4", fmt.Sprintf("127.0.0.1:%d", e.srcPort))
+	if err != nil {
+		t.Fatalf("source port %d still reserved after close: %v", e.srcPort, err)
+	}
+	released.Close()
+}
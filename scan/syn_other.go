@@ -0,0 +1,17 @@
+//go:build !linux
+
+package scan
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog"
+)
+
+// errSYNUnsupported is returned when SYN scans cannot be done on this system.
+var errSYNUnsupported = errors.New("SYN scans are only supported on Linux")
+
+// openSYNEngine fails on systems where SYN scans are not supported.
+func openSYNEngine(logger zerolog.Logger) (*synEngine, error) {
+	return nil, errSYNUnsupported
+}
@@ -0,0 +1,212 @@
+package scan
+
+import (
+	"context"
+	"encoding/binary"
+	"maps"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/rs/zerolog"
+)
+
+// replyPacket builds the IPv4 packet of the reply of port to a probe sent from
+// srcPort with the sequence number seq.
+func replyPacket(from netip.Addr, port, srcPort uint16, seq uint32, flags byte, window uint16) []byte {
+	pkt := make([]byte, 40)
+	pkt[0] = 0x45
+	pkt[9] = 6
+	a4 := from.As4()
+	copy(pkt[12:], a4[:])
+	tcp := pkt[20:]
+	binary.BigEndian.PutUint16(tcp[0:], port)
+	binary.BigEndian.PutUint16(tcp[2:], srcPort)
+	binary.BigEndian.PutUint32(tcp[8:], seq+1)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	binary.BigEndian.PutUint16(tcp[14:], window)
+	return pkt
+}
+
+func Test_buildSYN(t *testing.T) {
+	src, dst := netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("198.51.100.7")
+	segment := make([]byte, synSegmentLen)
+	buildSYN(segment, src, dst, 40000, 443, 1234)
+
+	if got := binary.BigEndian.Uint16(segment[2:]); got != 443 {
+		t.Errorf("buildSYN() destination port = %d, want 443", got)
+	}
+	if segment[13] != tcpSYN {
+		t.Errorf("buildSYN() flags = %#x, want SYN", segment[13])
+	}
+	// The checksum of a segment including its checksum is zero
+	if got := tcpChecksum(segment, src, dst); got != 0 {
+		t.Errorf("checksum of the SYN probe = %#x, want 0", got)
+	}
+}
+
+func Test_parseSYNReply(t *testing.T) {
+	from := netip.MustParseAddr("198.51.100.7")
+	tests := []struct {
+		name   string
+		pkt    []byte
+		want   synReply
+		wantOK bool
+	}{
+		{
+			name:   "SYN-ACK",
+			pkt:    replyPacket(from, 443, 40000, 1234, tcpSYN|tcpACK, 64240),
+			want:   synReply{addr: from, port: 443, open: true, window: 64240},
+			wantOK: true,
+		},
+		{
+			name:   "RST",
+			pkt:    replyPacket(from, 23, 40000, 1234, tcpRST|tcpACK, 0),
+			want:   synReply{addr: from, port: 23},
+			wantOK: true,
+		},
+		{name: "other port", pkt: replyPacket(from, 443, 40001, 1234, tcpSYN|tcpACK, 0)},
+		{name: "other sequence", pkt: replyPacket(from, 443, 40000, 99, tcpSYN|tcpACK, 0)},
+		{name: "ACK", pkt: replyPacket(from, 443, 40000, 1234, tcpACK, 0)},
+		{name: "truncated", pkt: replyPacket(from, 443, 40000, 1234, tcpSYN|tcpACK, 0)[:30]},
+		{name: "UDP", pkt: func() []byte { p := replyPacket(from, 443, 40000, 1234, tcpSYN|tcpACK, 0); p[9] = 17; return p }()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseSYNReply(tt.pkt, 40000, 1234)
+			if ok != tt.wantOK || got != tt.want {
+				t.Errorf("parseSYNReply() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+// fakeRawSocket answers the SYN probes as a host whose ports in open are
+// open, the ones in closed are closed, and the others are filtered. The first
+// probes of the ports in drop are not answered, and the probes of each port
+// are counted in probes.
+type fakeRawSocket struct {
+	open, closed map[uint16]bool
+	drop, probes map[uint16]int
+	replies      chan []byte
+}
+
+func (f *fakeRawSocket) send(segment []byte, dst netip.Addr) error {
+	srcPort := binary.BigEndian.Uint16(segment[0:])
+	port := binary.BigEndian.Uint16(segment[2:])
+	seq := binary.BigEndian.Uint32(segment[4:])
+	if f.probes != nil {
+		f.probes[port]++
+	}
+	switch {
+	case f.drop[port] > 0:
+		f.drop[port]--
+	case f.open[port]:
+		f.replies <- replyPacket(dst, port, srcPort, seq, tcpSYN|tcpACK, 29200)
+	case f.closed[port]:
+		f.replies <- replyPacket(dst, port, srcPort, seq, tcpRST|tcpACK, 0)
+	}
+	return nil
+}
+
+func (f *fakeRawSocket) recv(buf []byte) (int, error) {
+	pkt, ok := <-f.replies
+	if !ok {
+		return 0, net.ErrClosed
+	}
+	return copy(buf, pkt), nil
+}
+
+func (f *fakeRawSocket) close() error {
+	close(f.replies)
+	return nil
+}
+
+func TestScanner_collectSYN(t *testing.T) {
+	sock := &fakeRawSocket{
+		open:    map[uint16]bool{22: true, 443: true},
+		closed:  map[uint16]bool{80: true},
+		replies: make(chan []byte, 16),
+	}
+	s := &Scanner{Timeout: 100 * time.Millisecond}
+	tgt := &target{ip: "127.0.0.1", syn: newSYNEngine(sock, 40000, zerolog.Nop())}
+
+	ports := []int{22, 80, 443, 8080}
+	b, err := tgt.syn.send(tgt.ip, ports, func() time.Duration { return 0 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The ports can be reused once sent
+	ports[0] = 1
+
+	results := make(chan portResult, len(ports))
+	unanswered := s.collectSYN(context.Background(), tgt, b, nil, &dialStats{}, results)
+	if unanswered != 1 {
+		t.Errorf("collectSYN() = %d unanswered probes, want 1", unanswered)
+	}
+	close(results)
+
+	got := make(map[string]portResult)
+	for r := range results {
+		got[r.port] = r
+	}
+	want := map[string]bool{"22": true, "80": false, "443": true, "8080": false}
+	if len(got) != len(want) {
+		t.Fatalf("collectSYN() sent %d results, want %d", len(got), len(want))
+	}
+	for port, open := range want {
+		if got[port].open != open {
+			t.Errorf("port %s open = %v, want %v", port, got[port].open, open)
+		}
+	}
+	if got["22"].window != 29200 {
+		t.Errorf("port 22 window = %d, want 29200", got["22"].window)
+	}
+	if len(tgt.syn.pending) != 0 {
+		t.Errorf("%d probes still pending after the batch", len(tgt.syn.pending))
+	}
+}
+
+func TestScanner_collectSYN_confirm(t *testing.T) {
+	sock := &fakeRawSocket{
+		open:    map[uint16]bool{22: true, 443: true},
+		closed:  map[uint16]bool{80: true},
+		drop:    map[uint16]int{22: 1},
+		probes:  make(map[uint16]int),
+		replies: make(chan []byte, 16),
+	}
+	s := &Scanner{Timeout: 100 * time.Millisecond, Logger: zerolog.Nop()}
+	e := newSYNEngine(sock, 40000, zerolog.Nop())
+	defer e.close()
+	tgt := &target{ip: "127.0.0.1", syn: e, retries: 2, retryDelay: time.Millisecond}
+
+	// 22 was open and its first probe is dropped, 80 was open and is now
+	// closed, and 443 was closed and is now open
+	before := common.NewPortSet(22, 80)
+	b, err := tgt.syn.send(tgt.ip, []int{22, 80, 443, 8080}, func() time.Duration { return 0 })
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := make(chan portResult, 4)
+	if unanswered := s.collectSYN(context.Background(), tgt, b, before, &dialStats{}, results); unanswered != 1 {
+		t.Errorf("collectSYN() = %d unanswered probes, want 1", unanswered)
+	}
+	close(results)
+
+	got := make(map[string]bool)
+	for r := range results {
+		got[r.port] = r.open
+	}
+	want := map[string]bool{"22": true, "80": false, "443": true, "8080": false}
+	if !maps.Equal(got, want) {
+		t.Errorf("collectSYN() open ports = %v, want %v", got, want)
+	}
+	// Unconfirmed changes are probed again until the retries are exhausted
+	wantProbes := map[uint16]int{22: 2, 80: 3, 443: 3, 8080: 1}
+	if !maps.Equal(sock.probes, wantProbes) {
+		t.Errorf("probes sent = %v, want %v", sock.probes, wantProbes)
+	}
+}
@@ -0,0 +1,330 @@
+package scan
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/devops-works/scan-exporter/common"
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+)
+
+// newTarget configures a local target object from its configuration. The
+// global values are used when specific values are not set.
+func (s *Scanner) newTarget(t config.Target) (*target, error) {
+	target := &target{
+		ip:         t.IP,
+		paused:     t.Paused,
+		dependsOn:  t.DependsOn,
+		ipv6:       t.IPv6,
+		name:       t.Name,
+		tcpPeriod:  t.TCP.Period,
+		icmpPeriod: t.ICMP.Period,
+		ports:      t.TCP.Range,
+		qps:        t.QueriesPerSecond,
+		labels:     t.Labels,
+
+		changeThreshold: t.ChangeThreshold,
+		conf:            t,
+	}
+
+	// Read target's timing profile, or the global one
+	profileName := t.Profile
+	if profileName == "" {
+		profileName = s.conf.Profile
+	}
+	profile, err := readProfile(profileName)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile for %s: %w", target.name, err)
+	}
+
+	// Set to the values of the profile, or the global ones, if specific
+	// values are not set
+	if target.qps == 0 && profile != nil {
+		target.qps = profile.qps
+	}
+	if target.qps == 0 {
+		target.qps = s.conf.QueriesPerSecond
+	}
+	if target.tcpPeriod == "" {
+		target.tcpPeriod = s.conf.TcpPeriod
+	}
+	if target.icmpPeriod == "" {
+		target.icmpPeriod = s.conf.IcmpPeriod
+	}
+	if target.changeThreshold == 0 {
+		target.changeThreshold = s.conf.ChangeThreshold
+	}
+
+	// Truth table for icmpPeriod value
+	//
+	// | global | target | doPing | period |
+	// | ------ | ------ | ------ | :----: |
+	// | ""     | ""     | false  |   -    |
+	// | ""     | "0"    | false  |   -    |
+	// | ""     | "y"    | true   |   y    |
+	// | "0"    | ""     | false  |   -    |
+	// | "0"    | "0"    | false  |   -    |
+	// | "0"    | "y"    | true   |   y    |
+	// | "x"    | ""     | true   |   x    |
+	// | "x"    | "0"    | false  |   -    |
+	// | "x"    | "y"    | true   |   y    |
+	switch s.conf.IcmpPeriod {
+	case "", "0":
+		if target.icmpPeriod != "" && target.icmpPeriod != "0" {
+			target.doPing = true
+		}
+	default:
+		if target.icmpPeriod != "0" {
+			target.doPing = true
+			if target.icmpPeriod == "" {
+				target.icmpPeriod = s.conf.IcmpPeriod
+			}
+		}
+	}
+	// Inform that ping is disabled
+	if !target.doPing {
+		s.Logger.Warn().Msgf("ping explicitly disabled for %s (%s) in configuration",
+			target.name,
+			target.ip)
+	}
+
+	// The owner and the description are labels of the target, so that they
+	// follow it in the results, the findings and the metrics
+	if t.Owner != "" || t.Description != "" {
+		if owner, ok := t.Labels["owner"]; ok && t.Owner != "" && owner != t.Owner {
+			return nil, fmt.Errorf("owner of %s is set to %q, but its owner label is %q", target.name, t.Owner, owner)
+		}
+		target.labels = maps.Clone(t.Labels)
+		if target.labels == nil {
+			target.labels = make(map[string]string)
+		}
+		if t.Owner != "" {
+			target.labels["owner"] = t.Owner
+		}
+		if t.Description != "" {
+			target.labels["description"] = t.Description
+		}
+	}
+
+	// Read target's scanned and expected port ranges once, so that they are
+	// reported at startup rather than when the target is scanned
+	target.intervals, err = readPortIntervals(t.TCP.Range)
+	if err != nil {
+		return nil, fmt.Errorf("invalid range for %s: %w", target.name, err)
+	}
+	exp, err := readPortsRange(t.TCP.Expected)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expected ports for %s: %w", target.name, err)
+	}
+
+	// Append them to the target
+	for _, port := range exp {
+		target.expected = append(target.expected, strconv.Itoa(port))
+	}
+	target.expectedSet = common.NewPortSet(exp...)
+
+	// Read target's send/expect checks
+	target.checks, err = readChecks(t.TCP.Checks)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checks for %s: %w", target.name, err)
+	}
+
+	// Read target's expected banners
+	target.banners, err = readBanners(t.TCP.Banners)
+	if err != nil {
+		return nil, fmt.Errorf("invalid banners for %s: %w", target.name, err)
+	}
+
+	// Banners can only be verified on scanned ports, and are meant for
+	// expected ones
+	if len(target.banners) > 0 {
+		for port := range target.banners {
+			if !inIntervals(target.intervals, port) {
+				return nil, fmt.Errorf("banner of %s is set on port %d, which is not in the scanned range", target.name, port)
+			}
+			if !target.expectedSet.Has(port) {
+				s.Logger.Warn().Str("name", target.name).Str("ip", target.ip).Msgf("banner is set on port %d, which is not expected to be open", port)
+			}
+		}
+	}
+
+	// Read how the target not responding to pings is reported, or the
+	// global setting
+	hostDown := t.HostDown
+	if hostDown == nil {
+		hostDown = s.conf.HostDown
+	}
+	if hostDown != nil {
+		if hostDown.Severity != "" && !notify.ValidSeverity(hostDown.Severity) {
+			return nil, fmt.Errorf("unknown host down severity %q for %s", hostDown.Severity, target.name)
+		}
+		target.downSeverity, target.notifyDown = hostDown.Severity, hostDown.Notify
+	}
+
+	// Read target's ports severities
+	target.severities, err = readSeverities(s.conf.Severities, t.Severities)
+	if err != nil {
+		return nil, fmt.Errorf("invalid severities for %s: %w", target.name, err)
+	}
+
+	// Read target's ports annotations
+	target.annotations = make(map[string]string)
+	for port, annotation := range t.Annotations {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("annotated port %d of %s is out of the valid range (1-65535)", port, target.name)
+		}
+		target.annotations[strconv.Itoa(port)] = annotation
+	}
+
+	// Read target's backoff settings, which replace the global ones
+	backoff := t.Backoff
+	if backoff == nil {
+		backoff = s.conf.Backoff
+	}
+	target.backoff, err = readBackoff(backoff)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backoff for %s: %w", target.name, err)
+	}
+
+	target.flaps, err = readFlapping(s.conf.Flapping)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flap detection for %s: %w", target.name, err)
+	}
+
+	// Probes use the source ports of the target, or the global ones
+	pool := s.sourcePorts
+	if t.SourcePorts != "" {
+		if pool, err = newPortPool(t.SourcePorts); err != nil {
+			return nil, fmt.Errorf("invalid source ports for %s: %w", target.name, err)
+		}
+	}
+
+	// Probes are sent from the source addresses of the target, or the
+	// global ones, which are shared by all the targets using them
+	addrs := s.sourceAddrs
+	if len(t.SourceAddresses) > 0 {
+		if addrs, err = newAddrPool(t.SourceAddresses); err != nil {
+			return nil, fmt.Errorf("invalid source addresses for %s: %w", target.name, err)
+		}
+	}
+
+	// Read target's TTL, or the global one
+	ttl := t.TTL
+	if ttl == 0 {
+		ttl = s.conf.TTL
+	}
+	if ttl < 0 || ttl > 255 {
+		return nil, fmt.Errorf("invalid TTL for %s: %d is not between 0 and 255", target.name, ttl)
+	}
+	target.ttl = ttl
+
+	// The interface can be missing until a VPN is up, so it is only checked
+	// to catch typos
+	target.iface = t.Interface
+	if t.Interface != "" {
+		if _, err := net.InterfaceByName(t.Interface); err != nil {
+			s.Logger.Warn().Str("name", target.name).Err(err).Msgf("interface %s not found", t.Interface)
+		}
+	}
+
+	var timeout time.Duration
+	var retries int
+	if profile != nil {
+		timeout, retries = profile.timeout, profile.retries
+		target.jitter = profile.jitter
+	}
+
+	// The timeout of the target replaces the one of its profile, and the
+	// timeout of each protocol the one of the target
+	if timeout, err = readTimeout(t.Timeout, timeout); err != nil {
+		return nil, fmt.Errorf("invalid timeout for %s: %w", target.name, err)
+	}
+	if target.icmpTimeout, err = readTimeout(t.ICMP.Timeout, timeout); err != nil {
+		return nil, fmt.Errorf("invalid ICMP timeout for %s: %w", target.name, err)
+	}
+	if timeout, err = readTimeout(t.TCP.Timeout, timeout); err != nil {
+		return nil, fmt.Errorf("invalid TCP timeout for %s: %w", target.name, err)
+	}
+
+	if target.rate, err = newRateLimiter(t.Rate); err != nil {
+		return nil, fmt.Errorf("invalid rate for %s: %w", target.name, err)
+	}
+
+	// Changes of state of the ports are confirmed by the retries of the
+	// target, or the global ones
+	target.retries, target.retryDelay, err = readRetries(t.Retries, s.conf.Retries, t.RetryDelay, s.conf.RetryDelay)
+	if err != nil {
+		return nil, fmt.Errorf("invalid retries for %s: %w", target.name, err)
+	}
+
+	// The ports are probed from the vantage point of the proxy, if any
+	proxy, err := readProxy(t.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy for %s: %w", target.name, err)
+	}
+
+	if pool != nil || addrs != nil || ttl > 0 || target.iface != "" || timeout > 0 || retries > 0 || proxy != nil {
+		target.dialer = &dialer{
+			sourcePorts: pool,
+			sourceAddrs: addrs,
+			ttl:         ttl,
+			iface:       target.iface,
+			timeout:     timeout,
+			retries:     retries,
+			proxy:       proxy,
+		}
+	}
+
+	// SYN probes share a raw socket and its reserved source port, so the
+	// settings of the connections they do not open are rejected rather than
+	// ignored
+	switch t.Mode {
+	case "", modeConnect:
+	case modeSYN:
+		switch {
+		case target.ipv6 != "":
+			return nil, fmt.Errorf("SYN scans of %s cannot be dual-stack", target.name)
+		case proxy != nil:
+			return nil, fmt.Errorf("SYN scans of %s cannot go through a proxy", target.name)
+		case pool != nil:
+			return nil, fmt.Errorf("SYN scans of %s cannot use source ports", target.name)
+		case addrs != nil:
+			return nil, fmt.Errorf("SYN scans of %s cannot use source addresses", target.name)
+		case ttl > 0:
+			return nil, fmt.Errorf("SYN scans of %s cannot set a TTL", target.name)
+		case target.iface != "":
+			return nil, fmt.Errorf("SYN scans of %s cannot be bound to an interface", target.name)
+		case s.subnets != nil:
+			return nil, fmt.Errorf("SYN scans of %s cannot be limited per subnet", target.name)
+		}
+		if target.syn, err = s.synEngine(); err != nil {
+			return nil, fmt.Errorf("cannot do SYN scans of %s: %w", target.name, err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown scan mode %q for %s", t.Mode, target.name)
+	}
+
+	// Read target's HTTP assertions
+	target.http, err = readHTTPCheck(t.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTTP check for %s: %w", target.name, err)
+	}
+
+	// Read the ports whose certificate is inspected
+	target.tls, err = readTLSCheck(t.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS check for %s: %w", target.name, err)
+	}
+
+	// If TCP period or ports range has been provided, it means that we want
+	// to do TCP scan on the target
+	if target.tcpPeriod != "" || target.ports != "" || len(target.expected) != 0 {
+		target.doTCP = true
+	}
+
+	return target, nil
+}
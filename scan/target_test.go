@@ -0,0 +1,276 @@
+package scan
+
+import (
+	"cmp"
+	"maps"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+func TestScanner_newTarget_banners(t *testing.T) {
+	tests := []struct {
+		name    string
+		tcp     string
+		banners map[int]string
+		wantErr bool
+	}{
+		{name: "expected port", tcp: "reserved", banners: map[int]string{22: "^SSH"}, wantErr: false},
+		{name: "unexpected scanned port", tcp: "reserved", banners: map[int]string{25: "^220"}, wantErr: false},
+		{name: "port not scanned", tcp: "reserved", banners: map[int]string{2222: "^SSH"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{Logger: zerolog.Nop(), conf: &config.Conf{}}
+			conf := config.Target{Name: "app", IP: "127.0.0.1"}
+			conf.TCP.Range = tt.tcp
+			conf.TCP.Expected = "22"
+			conf.TCP.Banners = tt.banners
+
+			_, err := s.newTarget(conf)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("newTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScanner_newTarget_ranges(t *testing.T) {
+	tests := []struct {
+		name          string
+		tcp           string
+		expected      string
+		wantErr       bool
+		wantIntervals [][2]int
+		wantExpected  int
+	}{
+		{name: "valid ranges", tcp: "22,80-82,81", expected: "80,22", wantIntervals: [][2]int{{22, 22}, {80, 82}}, wantExpected: 2},
+		{name: "invalid range", tcp: "22-abc", expected: "22", wantErr: true},
+		{name: "invalid expected ports", tcp: "reserved", expected: "70000", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{Logger: zerolog.Nop(), conf: &config.Conf{}}
+			conf := config.Target{Name: "app", IP: "127.0.0.1"}
+			conf.TCP.Range = tt.tcp
+			conf.TCP.Expected = tt.expected
+
+			target, err := s.newTarget(conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(target.intervals, tt.wantIntervals) {
+				t.Errorf("newTarget() intervals = %v, want %v", target.intervals, tt.wantIntervals)
+			}
+			if got := target.expectedSet.Len(); got != tt.wantExpected {
+				t.Errorf("newTarget() expected %d ports, want %d", got, tt.wantExpected)
+			}
+		})
+	}
+}
+
+func TestScanner_newTarget_owner(t *testing.T) {
+	tests := []struct {
+		name        string
+		owner       string
+		description string
+		labels      map[string]string
+		want        map[string]string
+		wantErr     bool
+	}{
+		{name: "labels only", labels: map[string]string{"owner": "team-a"}, want: map[string]string{"owner": "team-a"}},
+		{name: "owner and description", owner: "team-a", description: "billing API", want: map[string]string{"owner": "team-a", "description": "billing API"}},
+		{name: "owner with labels", owner: "team-a", labels: map[string]string{"env": "prod"}, want: map[string]string{"owner": "team-a", "env": "prod"}},
+		{name: "same owner label", owner: "team-a", labels: map[string]string{"owner": "team-a"}, want: map[string]string{"owner": "team-a"}},
+		{name: "conflicting owner label", owner: "team-a", labels: map[string]string{"owner": "team-b"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{Logger: zerolog.Nop(), conf: &config.Conf{}}
+			conf := config.Target{Name: "app", IP: "127.0.0.1", Owner: tt.owner, Description: tt.description, Labels: tt.labels}
+			before := maps.Clone(tt.labels)
+
+			target, err := s.newTarget(conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(target.labels, tt.want) {
+				t.Errorf("newTarget() labels = %v, want %v", target.labels, tt.want)
+			}
+			if !maps.Equal(conf.Labels, before) {
+				t.Errorf("newTarget() modified the labels of the configuration: %v", conf.Labels)
+			}
+		})
+	}
+}
+
+func TestScanner_newTarget_ttl(t *testing.T) {
+	tests := []struct {
+		name      string
+		globalTTL int
+		ttl       int
+		want      int
+		wantErr   bool
+	}{
+		{name: "system TTL", want: 0},
+		{name: "global TTL", globalTTL: 8, want: 8},
+		{name: "target TTL", globalTTL: 8, ttl: 3, want: 3},
+		{name: "negative TTL", ttl: -1, wantErr: true},
+		{name: "TTL too high", globalTTL: 256, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{Logger: zerolog.Nop(), conf: &config.Conf{TTL: tt.globalTTL}}
+			conf := config.Target{Name: "app", IP: "127.0.0.1", TTL: tt.ttl}
+			conf.TCP.Range = "reserved"
+
+			got, err := s.newTarget(conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.ttl != tt.want {
+				t.Errorf("newTarget() ttl = %d, want %d", got.ttl, tt.want)
+			}
+			if (got.dialer != nil) != (tt.want > 0) {
+				t.Errorf("newTarget() dialer = %v, want one %v", got.dialer, tt.want > 0)
+			}
+		})
+	}
+}
+
+func TestScanner_newTarget_syn(t *testing.T) {
+	// The settings ignored by the SYN probes are rejected before the raw
+	// socket is opened
+	tests := []struct {
+		name    string
+		global  config.Conf
+		target  config.Target
+		subnets bool
+		wantErr string
+	}{
+		{name: "dual-stack", target: config.Target{IPv6: "::1"}, wantErr: "dual-stack"},
+		{name: "proxy", target: config.Target{Proxy: "socks5://127.0.0.1:1080"}, wantErr: "proxy"},
+		{name: "source ports", target: config.Target{SourcePorts: "40000-40009"}, wantErr: "source ports"},
+		{name: "global source ports", global: config.Conf{SourcePorts: "40000-40009"}, wantErr: "source ports"},
+		{name: "source addresses", target: config.Target{SourceAddresses: []string{"127.0.0.1"}}, wantErr: "source addresses"},
+		{name: "TTL", target: config.Target{TTL: 3}, wantErr: "TTL"},
+		{name: "global TTL", global: config.Conf{TTL: 3}, wantErr: "TTL"},
+		{name: "interface", target: config.Target{Interface: "lo"}, wantErr: "interface"},
+		{name: "subnet limit", subnets: true, wantErr: "subnet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{Logger: zerolog.Nop(), conf: &tt.global}
+			var err error
+			if s.sourcePorts, err = newPortPool(tt.global.SourcePorts); err != nil {
+				t.Fatal(err)
+			}
+			if tt.subnets {
+				s.subnets, _ = newSubnetLimiter(&config.SubnetLimit{Probes: 4})
+			}
+			conf := tt.target
+			conf.Name, conf.IP, conf.Mode = "app", "127.0.0.1", modeSYN
+			conf.TCP.Range = "reserved"
+
+			_, err = s.newTarget(conf)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newTarget() error = %v, want one about %s", err, tt.wantErr)
+			}
+			if s.syn != nil {
+				t.Error("newTarget() opened the raw socket of a rejected target")
+			}
+		})
+	}
+}
+
+func TestScanner_newTarget_hostDown(t *testing.T) {
+	tests := []struct {
+		name         string
+		global       *config.HostDown
+		local        *config.HostDown
+		wantSeverity string
+		wantNotify   bool
+		wantErr      bool
+	}{
+		{name: "unset"},
+		{name: "global", global: &config.HostDown{Severity: "critical", Notify: true}, wantSeverity: "critical", wantNotify: true},
+		{name: "target", global: &config.HostDown{Severity: "critical", Notify: true}, local: &config.HostDown{Severity: "info"}, wantSeverity: "info"},
+		{name: "unknown severity", local: &config.HostDown{Severity: "page"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{Logger: zerolog.Nop(), conf: &config.Conf{HostDown: tt.global}}
+			conf := config.Target{Name: "lab", IP: "127.0.0.1", HostDown: tt.local}
+			conf.TCP.Range = "reserved"
+
+			got, err := s.newTarget(conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.downSeverity != tt.wantSeverity || got.notifyDown != tt.wantNotify {
+				t.Errorf("newTarget() host down severity %q and notify %v, want %q and %v", got.downSeverity, got.notifyDown, tt.wantSeverity, tt.wantNotify)
+			}
+		})
+	}
+}
+
+func TestScanner_newTarget_timeout(t *testing.T) {
+	tests := []struct {
+		name            string
+		profile         string
+		timeout         string
+		tcpTimeout      string
+		icmpTimeout     string
+		wantTCPTimeout  time.Duration
+		wantICMPTimeout time.Duration
+		wantErr         bool
+	}{
+		{name: "global timeout", wantTCPTimeout: 2 * time.Second, wantICMPTimeout: 2 * time.Second},
+		{name: "profile timeout", profile: "polite", wantTCPTimeout: 3 * time.Second, wantICMPTimeout: 3 * time.Second},
+		{name: "target timeout", profile: "polite", timeout: "200ms", wantTCPTimeout: 200 * time.Millisecond, wantICMPTimeout: 200 * time.Millisecond},
+		{name: "protocol timeouts", timeout: "200ms", tcpTimeout: "5s", wantTCPTimeout: 5 * time.Second, wantICMPTimeout: 200 * time.Millisecond},
+		{name: "ICMP timeout", icmpTimeout: "1s", wantTCPTimeout: 2 * time.Second, wantICMPTimeout: time.Second},
+		{name: "timeout without unit", timeout: "2", wantErr: true},
+		{name: "negative TCP timeout", tcpTimeout: "-1s", wantErr: true},
+		{name: "invalid ICMP timeout", icmpTimeout: "fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Scanner{Logger: zerolog.Nop(), Timeout: 2 * time.Second, conf: &config.Conf{}}
+			conf := config.Target{Name: "app", IP: "127.0.0.1", Profile: tt.profile, Timeout: tt.timeout}
+			conf.TCP.Range = "reserved"
+			conf.TCP.Timeout = tt.tcpTimeout
+			conf.ICMP.Timeout = tt.icmpTimeout
+
+			got, err := s.newTarget(conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTarget() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if timeout := got.dialer.probeTimeout(s.Timeout); timeout != tt.wantTCPTimeout {
+				t.Errorf("newTarget() TCP timeout = %s, want %s", timeout, tt.wantTCPTimeout)
+			}
+			if timeout := cmp.Or(got.icmpTimeout, s.Timeout); timeout != tt.wantICMPTimeout {
+				t.Errorf("newTarget() ICMP timeout = %s, want %s", timeout, tt.wantICMPTimeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package scan
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/metrics"
+)
+
+// tlsCheck holds the inspection of the certificates presented by open TLS
+// ports.
+type tlsCheck struct {
+	ports map[int]bool
+	// serverName is sent with the handshake when not empty, so that servers
+	// hosting several names present the right certificate
+	serverName string
+}
+
+// readTLSCheck transforms the TLS check from configuration into a tlsCheck. It
+// returns nil if no check is configured.
+func readTLSCheck(c *config.TLSCheck) (*tlsCheck, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	tc := &tlsCheck{ports: make(map[int]bool), serverName: c.ServerName}
+	ports, err := readPortsRange(c.Ports)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS ports: %w", err)
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("no TLS ports provided")
+	}
+	for _, p := range ports {
+		tc.ports[p] = true
+	}
+	return tc, nil
+}
+
+// handles reports whether the certificate of the port has to be inspected.
+func (c *tlsCheck) handles(port int) bool {
+	return c != nil && c.ports[port]
+}
+
+// run realises a TLS handshake on conn, and returns the certificate presented
+// by the server. The certificate is not verified, so that the expiry of invalid
+// certificates is known too.
+func (c *tlsCheck) run(conn net.Conn, timeout time.Duration) (*metrics.TLSCert, error) {
+	client := tls.Client(conn, &tls.Config{
+		ServerName:         c.serverName,
+		InsecureSkipVerify: true,
+	})
+	client.SetDeadline(time.Now().Add(timeout))
+	if err := client.Handshake(); err != nil {
+		return nil, fmt.Errorf("TLS handshake failed: %w", err)
+	}
+
+	certs := client.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate presented")
+	}
+	return &metrics.TLSCert{
+		NotAfter: certs[0].NotAfter,
+		Subject:  certs[0].Subject.String(),
+		Issuer:   certs[0].Issuer.String(),
+	}, nil
+}
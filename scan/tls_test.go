@@ -0,0 +1,90 @@
+package scan
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/rs/zerolog"
+)
+
+func Test_readTLSCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.TLSCheck
+		port    int
+		want    bool
+		wantErr bool
+	}{
+		{name: "disabled", port: 443},
+		{name: "port", conf: &config.TLSCheck{Ports: "443,8443"}, port: 8443, want: true},
+		{name: "other port", conf: &config.TLSCheck{Ports: "443"}, port: 80},
+		{name: "no ports", conf: &config.TLSCheck{}, wantErr: true},
+		{name: "invalid ports", conf: &config.TLSCheck{Ports: "443-"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc, err := readTLSCheck(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readTLSCheck() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := tc.handles(tt.port); got != tt.want {
+				t.Errorf("handles(%d) = %v, want %v", tt.port, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanner_scanPort_tls(t *testing.T) {
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	plain := httptest.NewServer(http.NotFoundHandler())
+	defer plain.Close()
+
+	tests := []struct {
+		name     string
+		addr     string
+		banner   *tcpCheck
+		wantCert bool
+	}{
+		{name: "tls", addr: srv.Listener.Addr().String(), wantCert: true},
+		// The banner is read on the connection of the probe, so the
+		// certificate is inspected on a new one
+		{name: "banner", addr: srv.Listener.Addr().String(), banner: &tcpCheck{expect: regexp.MustCompile("^SSH")}, wantCert: true},
+		{name: "plain", addr: plain.Listener.Addr().String()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, p, _ := net.SplitHostPort(tt.addr)
+			port, _ := strconv.Atoi(p)
+			tc, err := readTLSCheck(&config.TLSCheck{Ports: p})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := &Scanner{Timeout: 200 * time.Millisecond, Logger: zerolog.Nop()}
+			results := make(chan portResult, 1)
+			s.scanPort(context.Background(), host, port, tt.banner, nil, nil, tc, nil, nil, results)
+			res := <-results
+			if !res.open {
+				t.Fatal("scanPort() reported the port as closed")
+			}
+			if (res.cert != nil) != tt.wantCert {
+				t.Fatalf("scanPort() certificate = %+v, want one %v", res.cert, tt.wantCert)
+			}
+			if !tt.wantCert {
+				return
+			}
+			leaf := srv.Certificate()
+			if !res.cert.NotAfter.Equal(leaf.NotAfter) || res.cert.Subject != leaf.Subject.String() || res.cert.Issuer != leaf.Issuer.String() {
+				t.Errorf("scanPort() certificate = %+v, want the one of the server", res.cert)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package scan
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// dialStats aggregates the dial latencies of a probe batch. A span per dial
+// would be too expensive on large ranges.
+type dialStats struct {
+	mu         sync.Mutex
+	count      int
+	total, max time.Duration
+}
+
+// add records the latency of a dial. It does nothing on a nil dialStats.
+func (d *dialStats) add(latency time.Duration) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.count++
+	d.total += latency
+	d.max = max(d.max, latency)
+}
+
+// attributes describes the dial latencies as span attributes.
+func (d *dialStats) attributes() []attribute.KeyValue {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var avg time.Duration
+	if d.count > 0 {
+		avg = d.total / time.Duration(d.count)
+	}
+	return []attribute.KeyValue{
+		attribute.Int("dial.count", d.count),
+		attribute.Float64("dial.total_ms", float64(d.total)/float64(time.Millisecond)),
+		attribute.Float64("dial.avg_ms", float64(avg)/float64(time.Millisecond)),
+		attribute.Float64("dial.max_ms", float64(d.max)/float64(time.Millisecond)),
+	}
+}
+
+// traceProbe runs a probe realised on an open port in its own span, and returns
+// its error.
+func traceProbe(ctx context.Context, name string, port int, probe func() error) error {
+	_, span := tracer.Start(ctx, name, trace.WithAttributes(attribute.Int("port", port)))
+	defer span.End()
+
+	err := probe()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+package scan
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func Test_dialStats(t *testing.T) {
+	d := &dialStats{}
+	d.add(10 * time.Millisecond)
+	d.add(30 * time.Millisecond)
+
+	want := map[attribute.Key]attribute.Value{
+		"dial.count":    attribute.IntValue(2),
+		"dial.total_ms": attribute.Float64Value(40),
+		"dial.avg_ms":   attribute.Float64Value(20),
+		"dial.max_ms":   attribute.Float64Value(30),
+	}
+	for _, kv := range d.attributes() {
+		if kv.Value != want[kv.Key] {
+			t.Errorf("attributes() %s = %v, want %v", kv.Key, kv.Value.Emit(), want[kv.Key].Emit())
+		}
+	}
+
+	// A nil dialStats is ignored
+	var nilStats *dialStats
+	nilStats.add(time.Second)
+}
@@ -0,0 +1,130 @@
+package scan
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// States of the UDP ports. Ports which do not answer are open|filtered, as the
+// service may ignore the probe, or a firewall drop it.
+const (
+	UDPOpen         = "open"
+	UDPClosed       = "closed"
+	UDPOpenFiltered = "open|filtered"
+)
+
+// udpPayloads holds the probes sent to the UDP ports of the well-known
+// services, which only answer to valid requests. Other ports are sent an
+// empty datagram.
+var udpPayloads = map[int][]byte{
+	// DNS query for the name servers of the root zone
+	53: dnsQuery("", 2),
+	// NTP version 3 client request
+	123: append([]byte{0x1b}, make([]byte, 47)...),
+	// NetBIOS node status request
+	137: nbstatQuery(),
+	// SNMPv1 get request of sysDescr.0, with the public community
+	161: {
+		0x30, 0x29, 0x02, 0x01, 0x00, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c',
+		0xa0, 0x1c, 0x02, 0x04, 0x00, 0x00, 0x00, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01, 0x00,
+		0x30, 0x0e, 0x30, 0x0c, 0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, 0x05, 0x00,
+	},
+	// SSDP search of all the devices and services
+	1900: []byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\nST: ssdp:all\r\n\r\n"),
+	// mDNS query of the advertised services
+	5353: dnsQuery("_services._dns-sd._udp.local", 12),
+	// memcached stats command, behind the frame header of the UDP protocol
+	11211: append([]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}, "stats\r\n"...),
+}
+
+// dnsQuery returns a recursive DNS query of the records of the given type of
+// name.
+func dnsQuery(name string, qtype uint16) []byte {
+	// Header: ID, flags with recursion desired, and a single question
+	q := []byte{0x13, 0x37, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	for _, label := range strings.Split(name, ".") {
+		if label != "" {
+			q = append(q, byte(len(label)))
+			q = append(q, label...)
+		}
+	}
+	q = append(q, 0x00)
+	q = binary.BigEndian.AppendUint16(q, qtype)
+	return binary.BigEndian.AppendUint16(q, 1)
+}
+
+// nbstatQuery returns a NetBIOS node status request of the wildcard name.
+func nbstatQuery() []byte {
+	q := []byte{0x13, 0x37, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20}
+	// The name "*" padded with zeroes, encoded in halves of bytes
+	q = append(q, 'C', 'K')
+	q = append(q, strings.Repeat("A", 30)...)
+	return append(q, 0x00, 0x00, 0x21, 0x00, 0x01)
+}
+
+// UDPResult is the result of probing a single UDP port.
+type UDPResult struct {
+	Port    int
+	State   string
+	Latency time.Duration
+}
+
+// ProbeUDP probes the UDP ports of ip with the given number of workers and
+// timeout. Each port is sent the request of its well-known service, and is
+// open if it answers, closed if an ICMP port unreachable is received, and
+// open|filtered otherwise. The results are in the order of the ports.
+func ProbeUDP(ip string, ports []int, workers int, timeout time.Duration) []UDPResult {
+	results := make([]UDPResult, len(ports))
+	lock := semaphore.NewWeighted(int64(workers))
+	wg := sync.WaitGroup{}
+	for i, port := range ports {
+		lock.Acquire(context.Background(), 1)
+		wg.Add(1)
+		go func() {
+			defer lock.Release(1)
+			defer wg.Done()
+			start := time.Now()
+			state := probeUDP(ip, port, udpPayloads[port], timeout)
+			results[i] = UDPResult{Port: port, State: state, Latency: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// probeUDP sends payload to the port, and returns the state of the port found
+// from the answer.
+func probeUDP(ip string, port int, payload []byte, timeout time.Duration) string {
+	// Connected sockets receive the ICMP errors caused by their datagrams
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(ip, portString(port)), timeout)
+	if err != nil {
+		return UDPOpenFiltered
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(payload); err != nil {
+		return udpState(err)
+	}
+	buf := make([]byte, 1500)
+	if _, err := conn.Read(buf); err != nil {
+		return udpState(err)
+	}
+	return UDPOpen
+}
+
+// udpState returns the state of a UDP port whose probe failed with err.
+func udpState(err error) string {
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return UDPClosed
+	}
+	return UDPOpenFiltered
+}
@@ -0,0 +1,93 @@
+package scan
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// udpServer listens on a local UDP port, and answers the datagrams matching
+// the request when reply is true. It returns the port.
+func udpServer(t *testing.T, request []byte, reply bool) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if reply && bytes.Equal(buf[:n], request) {
+				conn.WriteToUDP([]byte("pong"), addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestProbeUDP(t *testing.T) {
+	open := udpServer(t, nil, true)
+	silent := udpServer(t, nil, false)
+
+	got := ProbeUDP("127.0.0.1", []int{open, silent}, 2, 100*time.Millisecond)
+	want := []string{UDPOpen, UDPOpenFiltered}
+	for i, r := range got {
+		if r.State != want[i] {
+			t.Errorf("ProbeUDP() port %d state = %s, want %s", r.Port, r.State, want[i])
+		}
+	}
+}
+
+func Test_probeUDP_closed(t *testing.T) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	// The kernel answers with a port unreachable once the socket is closed
+	conn.Close()
+
+	if got := probeUDP("127.0.0.1", port, nil, time.Second); got != UDPClosed {
+		t.Errorf("probeUDP() = %s, want %s", got, UDPClosed)
+	}
+}
+
+func Test_udpPayloads(t *testing.T) {
+	// The services only answer to the requests of their protocol
+	port := udpServer(t, udpPayloads[53], true)
+	if got := probeUDP("127.0.0.1", port, udpPayloads[53], time.Second); got != UDPOpen {
+		t.Errorf("probeUDP() with a DNS query = %s, want %s", got, UDPOpen)
+	}
+	if got := probeUDP("127.0.0.1", port, nil, 100*time.Millisecond); got != UDPOpenFiltered {
+		t.Errorf("probeUDP() with an empty datagram = %s, want %s", got, UDPOpenFiltered)
+	}
+
+	tests := []struct {
+		name string
+		port int
+		size int
+	}{
+		{name: "dns", port: 53, size: 17},
+		{name: "ntp", port: 123, size: 48},
+		{name: "netbios", port: 137, size: 50},
+		{name: "snmp", port: 161, size: 43},
+		{name: "mdns", port: 5353, size: 46},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(udpPayloads[tt.port]); got != tt.size {
+				t.Errorf("payload of port %d is %d bytes, want %d", tt.port, got, tt.size)
+			}
+		})
+	}
+	// The length of the SNMP message is the one of its content
+	if snmp := udpPayloads[161]; int(snmp[1]) != len(snmp)-2 {
+		t.Errorf("SNMP message length = %d, want %d", snmp[1], len(snmp)-2)
+	}
+}
@@ -2,10 +2,15 @@ package scan
 
 import (
 	"fmt"
+	"iter"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/devops-works/scan-exporter/services"
 )
 
 // getDuration transforms a protocol's period into a time.Duration value.
@@ -29,10 +34,44 @@ func getDuration(period string) (time.Duration, error) {
 	return t, nil
 }
 
+// readTimeout parses the timeout of the probes of a target, written as a Go
+// duration such as 200ms. It returns def if timeout is empty.
+func readTimeout(timeout string, def time.Duration) (time.Duration, error) {
+	if timeout == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout %s is not positive", timeout)
+	}
+	return d, nil
+}
+
 // readPortsRange transforms a comma-separated string of ports into a unique,
 // sorted slice of integers.
 func readPortsRange(ranges string) ([]int, error) {
-	ports := []int{}
+	intervals, err := readPortIntervals(ranges)
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]int, 0, intervalsLen(intervals))
+	for _, iv := range intervals {
+		for port := iv[0]; port <= iv[1]; port++ {
+			ports = append(ports, port)
+		}
+	}
+	return ports, nil
+}
+
+// readPortIntervals transforms a comma-separated string of ports into sorted
+// intervals of consecutive ports, each holding its first and last port, without
+// listing the ports themselves. Ports can be given by the name of their TCP
+// service, such as ssh.
+func readPortIntervals(ranges string) ([][2]int, error) {
+	var intervals [][2]int
 
 	// Remove spaces
 	ranges = strings.ReplaceAll(ranges, " ", "")
@@ -45,16 +84,18 @@ func readPortsRange(ranges string) ([]int, error) {
 		}
 		switch spec {
 		case "all":
-			for port := 1; port <= 65535; port++ {
-				ports = append(ports, port)
-			}
+			intervals = append(intervals, [2]int{1, 65535})
 		case "reserved":
-			for port := 1; port < 1024; port++ {
-				ports = append(ports, port)
-			}
-		case "top1000":
-			ports = append(ports, top1000Ports...)
+			intervals = append(intervals, [2]int{1, 1023})
+		case "top10", "top20", "top100", "top1000":
+			intervals = append(intervals, portIntervals(slices.Sorted(slices.Values(topPorts[spec])))...)
 		default:
+			// Names of services may hold hyphens, so they are looked up
+			// before ranges
+			if port, ok := services.Port(services.TCP, spec); ok {
+				intervals = append(intervals, [2]int{port, port})
+				continue
+			}
 			if strings.Contains(spec, "-") {
 				decomposedRange := strings.Split(spec, "-")
 				if len(decomposedRange) != 2 || decomposedRange[0] == "" || decomposedRange[1] == "" {
@@ -78,9 +119,7 @@ func readPortsRange(ranges string) ([]int, error) {
 					return nil, fmt.Errorf("port range %q is out of the valid range (1-65535)", spec)
 				}
 
-				for i := min; i <= max; i++ {
-					ports = append(ports, i)
-				}
+				intervals = append(intervals, [2]int{min, max})
 			} else {
 				port, err := strconv.Atoi(spec)
 				if err != nil {
@@ -91,13 +130,160 @@ func readPortsRange(ranges string) ([]int, error) {
 					return nil, fmt.Errorf("port %d is out of the valid range (1-65535)", port)
 				}
 
-				ports = append(ports, port)
+				intervals = append(intervals, [2]int{port, port})
+			}
+		}
+	}
+
+	// Overlapping and adjacent intervals are merged
+	slices.SortFunc(intervals, func(a, b [2]int) int { return a[0] - b[0] })
+	var merged [][2]int
+	for _, iv := range intervals {
+		if n := len(merged); n > 0 && iv[0] <= merged[n-1][1]+1 {
+			merged[n-1][1] = max(merged[n-1][1], iv[1])
+			continue
+		}
+		merged = append(merged, iv)
+	}
+	return merged, nil
+}
+
+// intervalsLen returns the number of ports in intervals.
+func intervalsLen(intervals [][2]int) int {
+	n := 0
+	for _, iv := range intervals {
+		n += iv[1] - iv[0] + 1
+	}
+	return n
+}
+
+// inIntervals reports whether a port is in one of the sorted intervals.
+func inIntervals(intervals [][2]int, port int) bool {
+	_, found := slices.BinarySearchFunc(intervals, port, func(iv [2]int, port int) int {
+		if iv[1] < port {
+			return -1
+		}
+		if iv[0] > port {
+			return 1
+		}
+		return 0
+	})
+	return found
+}
+
+// portStrings returns the decimal representation of every port, indexed by
+// port. They are computed once, in a single string, so that the probes of large
+// scans do not allocate one per port.
+var portStrings = sync.OnceValue(func() []string {
+	var b []byte
+	offsets := make([]int, 65537)
+	for port := range 65536 {
+		offsets[port] = len(b)
+		b = strconv.AppendInt(b, int64(port), 10)
+	}
+	offsets[65536] = len(b)
+
+	all := string(b)
+	s := make([]string, 65536)
+	for port := range s {
+		s[port] = all[offsets[port]:offsets[port+1]]
+	}
+	return s
+})
+
+// portString returns the decimal representation of a port, without allocating
+// it when the port is valid.
+func portString(port int) string {
+	if port < 0 || port > 65535 {
+		return strconv.Itoa(port)
+	}
+	return portStrings()[port]
+}
+
+// portBatches yields the ports of intervals in batches of up to size ports.
+// The batches share the same buffer, so they are only valid until the next
+// one is yielded.
+func portBatches(intervals [][2]int, size int) iter.Seq[[]int] {
+	return func(yield func([]int) bool) {
+		batch := make([]int, 0, min(size, intervalsLen(intervals)))
+		for _, iv := range intervals {
+			for port := iv[0]; port <= iv[1]; port++ {
+				batch = append(batch, port)
+				if len(batch) < size {
+					continue
+				}
+				if !yield(batch) {
+					return
+				}
+				batch = batch[:0]
 			}
 		}
+		if len(batch) > 0 {
+			yield(batch)
+		}
 	}
+}
 
-	slices.Sort(ports)
-	uniquePorts := slices.Compact(ports)
+// severityOrder is the order in which overlapping severities are resolved: the
+// highest one wins.
+var severityOrder = []string{notify.SeverityCritical, notify.SeverityWarning, notify.SeverityInfo}
 
-	return uniquePorts, nil
+// sortedPorts returns a copy of the ports, sorted numerically.
+func sortedPorts(ports []string) []string {
+	sorted := slices.Clone(ports)
+	slices.SortFunc(sorted, func(a, b string) int {
+		pa, _ := strconv.Atoi(a)
+		pb, _ := strconv.Atoi(b)
+		return pa - pb
+	})
+	return sorted
+}
+
+// ParsePorts parses a range of ports written as in configuration, and returns
+// the sorted ports it holds.
+func ParsePorts(ranges string) ([]int, error) {
+	return readPortsRange(ranges)
+}
+
+// readSeverities transforms the port ranges indexed by severity into ordered
+// severities. The ranges given in local take precedence over the ones given in
+// global. Within the same configuration, the highest severity wins.
+func readSeverities(global, local map[string]string) (notify.Severities, error) {
+	var severities notify.Severities
+	for _, conf := range []map[string]string{local, global} {
+		for severity := range conf {
+			if !notify.ValidSeverity(severity) {
+				return nil, fmt.Errorf("unknown severity %q", severity)
+			}
+		}
+		for _, severity := range severityOrder {
+			ranges, ok := conf[severity]
+			if !ok {
+				continue
+			}
+			ports, err := readPortsRange(ranges)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ports for severity %s: %w", severity, err)
+			}
+			severities = append(severities, notify.SeverityRanges{
+				Severity: severity,
+				Ranges:   portIntervals(ports),
+			})
+		}
+	}
+	return severities, nil
+}
+
+// portIntervals compacts a sorted slice of ports into intervals of consecutive
+// ports.
+func portIntervals(ports []int) [][2]int {
+	var intervals [][2]int
+	for _, p := range ports {
+		if n := len(intervals); n > 0 && intervals[n-1][1] == p-1 {
+			intervals[n-1][1] = p
+			continue
+		}
+		intervals = append(intervals, [2]int{p, p})
+	}
+	return intervals
 }
@@ -2,6 +2,8 @@ package scan
 
 import (
 	"reflect"
+	"slices"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -59,7 +61,15 @@ func Test_readPortsRange(t *testing.T) {
 		// Tests for keywords
 		{name: "keyword all", ranges: "all", want: allPorts, wantErr: false},
 		{name: "keyword reserved", ranges: "reserved", want: reservedPorts, wantErr: false},
+		{name: "keyword top10", ranges: "top10", want: top10Ports, wantErr: false},
+		{name: "keyword top100", ranges: "top100", want: top100Ports, wantErr: false},
 		{name: "keyword top1000", ranges: "top1000", want: top1000Ports, wantErr: false},
+		{name: "top ports with others", ranges: "top20,8443", want: append(slices.Clone(top20Ports), 8443), wantErr: false},
+
+		// Tests for service names
+		{name: "services", ranges: "ssh,HTTPS,postgres", want: []int{22, 443, 5432}, wantErr: false},
+		{name: "service with hyphen", ranges: "http-alt,8081-8082", want: []int{8080, 8081, 8082}, wantErr: false},
+		{name: "unknown service", ranges: "ssh,sshd", wantErr: true},
 
 		// Tests for combinations and uniqueness
 		{name: "duplicates", ranges: "80,81,443,79-88", want: []int{79, 80, 81, 82, 83, 84, 85, 86, 87, 88, 443}, wantErr: false},
@@ -92,3 +102,186 @@ func Test_readPortsRange(t *testing.T) {
 		})
 	}
 }
+
+func Test_readSeverities(t *testing.T) {
+	tests := []struct {
+		name    string
+		global  map[string]string
+		local   map[string]string
+		want    map[int]string
+		wantErr bool
+	}{
+		{name: "empty", want: map[int]string{22: ""}, wantErr: false},
+		{name: "global only", global: map[string]string{"critical": "3306,5432"}, want: map[int]string{3306: "critical", 5432: "critical", 22: ""}, wantErr: false},
+		{name: "local overrides global", global: map[string]string{"critical": "3306,5432"}, local: map[string]string{"info": "5432"}, want: map[int]string{3306: "critical", 5432: "info"}, wantErr: false},
+		{name: "overlap, highest wins", global: map[string]string{"critical": "3306", "info": "1-65535", "warning": "3000-4000"}, want: map[int]string{3306: "critical", 3307: "warning", 22: "info"}, wantErr: false},
+		{name: "local overlap over global", global: map[string]string{"critical": "3306"}, local: map[string]string{"info": "1-65535"}, want: map[int]string{3306: "info", 22: "info"}, wantErr: false},
+		{name: "unknown severity", global: map[string]string{"urgent": "22"}, wantErr: true},
+		{name: "invalid range", local: map[string]string{"warning": "9000-8000"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readSeverities(tt.global, tt.local)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("readSeverities() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			for port, want := range tt.want {
+				if sev, _ := got.Of(port); sev != want {
+					t.Errorf("readSeverities() severity of %d = %q, want %q", port, sev, want)
+				}
+			}
+		})
+	}
+}
+
+func Test_topPorts(t *testing.T) {
+	var shorter []int
+	for _, n := range []int{10, 20, 100, 1000} {
+		ports := topPorts["top"+strconv.Itoa(n)]
+		if len(ports) != n || !slices.IsSorted(ports) || len(slices.Compact(slices.Clone(ports))) != n {
+			t.Errorf("top%d does not hold %d sorted unique ports", n, n)
+		}
+		for _, p := range shorter {
+			if !slices.Contains(ports, p) {
+				t.Errorf("top%d does not hold port %d of the shorter list", n, p)
+			}
+		}
+		shorter = ports
+	}
+}
+
+func Test_portIntervals(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []int
+		want  [][2]int
+	}{
+		{name: "empty", ports: nil, want: nil},
+		{name: "single", ports: []int{22}, want: [][2]int{{22, 22}}},
+		{name: "consecutive", ports: []int{1, 2, 3, 80, 443, 444}, want: [][2]int{{1, 3}, {80, 80}, {443, 444}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := portIntervals(tt.ports); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("portIntervals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_readPortIntervals(t *testing.T) {
+	tests := []struct {
+		name    string
+		ranges  string
+		want    [][2]int
+		wantErr bool
+	}{
+		{name: "all", ranges: "all", want: [][2]int{{1, 65535}}},
+		{name: "overlapping", ranges: "80-90,85-100,22", want: [][2]int{{22, 22}, {80, 100}}},
+		{name: "adjacent", ranges: "1-10,11,12-20", want: [][2]int{{1, 20}}},
+		{name: "included", ranges: "reserved,22,1000-1010", want: [][2]int{{1, 1023}}},
+		{name: "invalid", ranges: "80-", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readPortIntervals(tt.ranges)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readPortIntervals() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readPortIntervals() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_portBatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals [][2]int
+		size      int
+		want      [][]int
+	}{
+		{name: "empty", size: 3},
+		{name: "spanning intervals", intervals: [][2]int{{1, 2}, {10, 12}, {20, 20}}, size: 2, want: [][]int{{1, 2}, {10, 11}, {12, 20}}},
+		{name: "exact", intervals: [][2]int{{1, 4}}, size: 2, want: [][]int{{1, 2}, {3, 4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got [][]int
+			for batch := range portBatches(tt.intervals, tt.size) {
+				got = append(got, slices.Clone(batch))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("portBatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The ports of a full range are generated without being listed.
+func Test_portBatches_allocs(t *testing.T) {
+	intervals, err := readPortIntervals("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		for range portBatches(intervals, probeBatchSize) {
+		}
+	})
+	if allocs > 2 {
+		t.Errorf("portBatches() made %.0f allocations for a full range, want a single buffer", allocs)
+	}
+}
+
+func Test_inIntervals(t *testing.T) {
+	intervals := [][2]int{{22, 22}, {80, 90}, {443, 443}}
+	tests := []struct {
+		port int
+		want bool
+	}{
+		{port: 21, want: false},
+		{port: 22, want: true},
+		{port: 80, want: true},
+		{port: 85, want: true},
+		{port: 90, want: true},
+		{port: 91, want: false},
+		{port: 443, want: true},
+		{port: 444, want: false},
+	}
+	for _, tt := range tests {
+		if got := inIntervals(intervals, tt.port); got != tt.want {
+			t.Errorf("inIntervals(%d) = %v, want %v", tt.port, got, tt.want)
+		}
+	}
+}
+
+func Test_portString(t *testing.T) {
+	for _, port := range []int{-1, 0, 7, 80, 443, 9999, 10000, 65535, 65536} {
+		if got, want := portString(port), strconv.Itoa(port); got != want {
+			t.Errorf("portString(%d) = %q, want %q", port, got, want)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		for port := range 65536 {
+			portString(port)
+		}
+	})
+	if allocs > 0 {
+		t.Errorf("portString() made %.0f allocations for a full range, want none", allocs)
+	}
+}
+
+func Test_sortedPorts(t *testing.T) {
+	ports := []string{"443", "22", "8080", "80"}
+	got := sortedPorts(ports)
+	if want := []string{"22", "80", "443", "8080"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sortedPorts() = %v, want %v", got, want)
+	}
+	got[0] = "1"
+	if ports[1] != "22" {
+		t.Errorf("sortedPorts() shares its backing array with its input")
+	}
+}
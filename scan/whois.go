@@ -0,0 +1,240 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// defaultWhoisTTL is the time during which the owner of an address is
+	// cached when none is configured.
+	defaultWhoisTTL = "1d"
+	// whoisRetryDelay is the delay before looking up again the owner of an
+	// address after a failure.
+	whoisRetryDelay = 5 * time.Minute
+)
+
+// ownerEntry is the cached owner of an address.
+type ownerEntry struct {
+	Owner   notify.Owner `json:"owner"`
+	Expires time.Time    `json:"expires"`
+}
+
+// ownerLookup finds the autonomous system and the netblock of public
+// addresses, and the organization owning them, using the IP to ASN mapping of
+// Team Cymru over DNS. Owners are cached, and stored in a file if configured
+// so that they survive restarts. Lookups are made in the background, so the
+// owner of an address is only known after its first scans. It is nil when
+// disabled, and safe for concurrent use.
+type ownerLookup struct {
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+	timeout   time.Duration
+	ttl       time.Duration
+	path      string
+	logger    zerolog.Logger
+
+	mu    sync.Mutex
+	cache map[string]ownerEntry
+	// pending holds the addresses being looked up
+	pending map[string]bool
+}
+
+// newOwnerLookup creates an owner lookup from its configuration, querying the
+// DNS servers of dns. It returns nil if the lookup is disabled.
+func newOwnerLookup(c *config.Whois, dns *config.DNS, logger zerolog.Logger) (*ownerLookup, error) {
+	if c == nil {
+		return nil, nil
+	}
+	ttl := c.TTL
+	if ttl == "" {
+		ttl = defaultWhoisTTL
+	}
+	d, err := getDuration(ttl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TTL: %w", err)
+	}
+	r, err := newResolver(dns)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &ownerLookup{
+		lookupTXT: r.resolver.LookupTXT,
+		timeout:   r.timeout,
+		ttl:       d,
+		path:      c.CacheFile,
+		logger:    logger,
+		cache:     make(map[string]ownerEntry),
+		pending:   make(map[string]bool),
+	}
+	if o.path == "" {
+		return o, nil
+	}
+	b, err := os.ReadFile(o.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read cache: %w", err)
+	}
+	if err := json.Unmarshal(b, &o.cache); err != nil {
+		return nil, fmt.Errorf("cannot read cache %s: %w", o.path, err)
+	}
+	return o, nil
+}
+
+// owner returns the cached owner of a public address, or nil if it is unknown.
+// A missing or expired owner is looked up in the background.
+func (o *ownerLookup) owner(addr string) *notify.Owner {
+	ip := net.ParseIP(addr)
+	if o == nil || !isPublic(ip) {
+		return nil
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	e, ok := o.cache[addr]
+	if (!ok || time.Now().After(e.Expires)) && !o.pending[addr] {
+		o.pending[addr] = true
+		go o.refresh(addr, ip)
+	}
+	if !ok || e.Owner.ASN == 0 {
+		return nil
+	}
+	owner := e.Owner
+	return &owner
+}
+
+// refresh looks up the owner of an address and caches it. On failure, the
+// previous owner is kept until the next attempt.
+func (o *ownerLookup) refresh(addr string, ip net.IP) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*o.timeout)
+	defer cancel()
+	owner, err := o.lookup(ctx, ip)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.pending, addr)
+	if err != nil {
+		o.logger.Warn().Err(err).Str("ip", addr).Msg("cannot look up the owner of the address")
+		e := o.cache[addr]
+		e.Expires = time.Now().Add(whoisRetryDelay)
+		o.cache[addr] = e
+		return
+	}
+	o.cache[addr] = ownerEntry{Owner: owner, Expires: time.Now().Add(o.ttl)}
+	if err := o.save(); err != nil {
+		o.logger.Error().Err(err).Msgf("cannot write owners cache to %s", o.path)
+	}
+}
+
+// save writes the cache to its file, if any. It must be called with mu held.
+func (o *ownerLookup) save() error {
+	if o.path == "" {
+		return nil
+	}
+	b, err := json.Marshal(o.cache)
+	if err != nil {
+		return err
+	}
+	// The cache is replaced at once, so it is never read partially written
+	tmp, err := os.CreateTemp(filepath.Dir(o.path), filepath.Base(o.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), o.path)
+}
+
+// lookup queries the origin of an address, such as "15169 | 8.8.8.0/24 | US |
+// arin | 2023-12-28", then the name of its autonomous system, such as "15169 |
+// US | arin | 2000-03-30 | GOOGLE - Google LLC, US". Addresses which are not
+// announced have no owner.
+func (o *ownerLookup) lookup(ctx context.Context, ip net.IP) (notify.Owner, error) {
+	var owner notify.Owner
+	origins, err := o.lookupTXT(ctx, originName(ip))
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return owner, nil
+	}
+	if err != nil {
+		return owner, err
+	}
+
+	// Addresses announced in several prefixes belong to the most specific
+	// one, and prefixes announced by several autonomous systems are given
+	// to the first one
+	bits := -1
+	for _, origin := range origins {
+		fields := strings.Split(origin, "|")
+		if len(fields) < 2 {
+			continue
+		}
+		asns := strings.Fields(fields[0])
+		_, prefix, err := net.ParseCIDR(strings.TrimSpace(fields[1]))
+		if len(asns) == 0 || err != nil {
+			continue
+		}
+		asn, err := strconv.ParseUint(asns[0], 10, 32)
+		if err != nil {
+			continue
+		}
+		if ones, _ := prefix.Mask.Size(); ones > bits {
+			bits = ones
+			owner.ASN, owner.Netblock = uint(asn), prefix.String()
+		}
+	}
+	if owner.ASN == 0 {
+		return owner, fmt.Errorf("invalid origin %q", origins)
+	}
+
+	names, err := o.lookupTXT(ctx, fmt.Sprintf("AS%d.asn.cymru.com.", owner.ASN))
+	if err != nil {
+		return owner, err
+	}
+	for _, name := range names {
+		if fields := strings.Split(name, "|"); len(fields) >= 5 {
+			owner.Name = strings.TrimSpace(fields[4])
+			break
+		}
+	}
+	return owner, nil
+}
+
+// originName returns the name whose TXT record holds the origin of an
+// address, made of its reversed bytes for IPv4, or reversed nibbles for IPv6.
+func originName(ip net.IP) string {
+	var labels []string
+	if ip4 := ip.To4(); ip4 != nil {
+		for i := len(ip4) - 1; i >= 0; i-- {
+			labels = append(labels, strconv.Itoa(int(ip4[i])))
+		}
+		return strings.Join(labels, ".") + ".origin.asn.cymru.com."
+	}
+	ip16 := ip.To16()
+	for i := len(ip16) - 1; i >= 0; i-- {
+		labels = append(labels, strconv.FormatUint(uint64(ip16[i]&0xf), 16), strconv.FormatUint(uint64(ip16[i]>>4), 16))
+	}
+	return strings.Join(labels, ".") + ".origin6.asn.cymru.com."
+}
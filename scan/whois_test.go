@@ -0,0 +1,149 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/notify"
+	"github.com/rs/zerolog"
+)
+
+// cymruRecords are TXT records of the IP to ASN mapping of Team Cymru.
+var cymruRecords = map[string][]string{
+	"8.8.8.8.origin.asn.cymru.com.": {"15169 | 8.8.8.0/24 | US | arin | 2023-12-28", "15169 | 8.0.0.0/9 | US | arin | 1992-12-01"},
+	"AS15169.asn.cymru.com.":        {"15169 | US | arin | 2000-03-30 | GOOGLE - Google LLC, US"},
+}
+
+// lookupCymru returns the TXT records of cymruRecords, counting the queries.
+func lookupCymru(queries *atomic.Int32) func(ctx context.Context, name string) ([]string, error) {
+	return func(ctx context.Context, name string) ([]string, error) {
+		queries.Add(1)
+		if txt, ok := cymruRecords[name]; ok {
+			return txt, nil
+		}
+		if name == "9.9.9.9.origin.asn.cymru.com." {
+			return nil, errors.New("server failure")
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+}
+
+func Test_originName(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{ip: "8.8.4.4", want: "4.4.8.8.origin.asn.cymru.com."},
+		{ip: "2001:db8::1", want: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.origin6.asn.cymru.com."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			if got := originName(net.ParseIP(tt.ip)); got != tt.want {
+				t.Errorf("originName(%s) = %s, want %s", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_newOwnerLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    *config.Whois
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "unset", wantNil: true},
+		{name: "default", conf: &config.Whois{}},
+		{name: "cached", conf: &config.Whois{CacheFile: filepath.Join(t.TempDir(), "owners.json"), TTL: "12h"}},
+		{name: "invalid TTL", conf: &config.Whois{TTL: "soon"}, wantNil: true, wantErr: true},
+		{name: "invalid cache", conf: &config.Whois{CacheFile: t.TempDir()}, wantNil: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newOwnerLookup(tt.conf, nil, zerolog.Nop())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newOwnerLookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("newOwnerLookup() = %v, want nil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func Test_ownerLookup_lookup(t *testing.T) {
+	var queries atomic.Int32
+	o := &ownerLookup{lookupTXT: lookupCymru(&queries)}
+	tests := []struct {
+		ip      string
+		want    notify.Owner
+		wantErr bool
+	}{
+		{ip: "8.8.8.8", want: notify.Owner{ASN: 15169, Netblock: "8.8.8.0/24", Name: "GOOGLE - Google LLC, US"}},
+		{ip: "198.51.100.1"},
+		{ip: "9.9.9.9", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			got, err := o.lookup(context.Background(), net.ParseIP(tt.ip))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("lookup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ownerLookup_owner(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "owners.json")
+	o, err := newOwnerLookup(&config.Whois{CacheFile: path}, nil, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var queries atomic.Int32
+	o.lookupTXT = lookupCymru(&queries)
+
+	if got := o.owner("10.0.0.1"); got != nil || queries.Load() != 0 {
+		t.Errorf("owner() of a private address = %v after %d queries, want nil without query", got, queries.Load())
+	}
+
+	// The owner is looked up in the background
+	if got := o.owner("8.8.8.8"); got != nil {
+		t.Errorf("owner() = %v before the lookup, want nil", got)
+	}
+	want := &notify.Owner{ASN: 15169, Netblock: "8.8.8.0/24", Name: "GOOGLE - Google LLC, US"}
+	deadline := time.Now().Add(time.Second)
+	var got *notify.Owner
+	for got == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+		got = o.owner("8.8.8.8")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("owner() = %v, want %v", got, want)
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("owner() made %d queries, want 2", n)
+	}
+
+	// The cache survives restarts
+	restarted, err := newOwnerLookup(&config.Whois{CacheFile: path}, nil, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.lookupTXT = lookupCymru(&queries)
+	if got := restarted.owner("8.8.8.8"); !reflect.DeepEqual(got, want) {
+		t.Errorf("owner() after a restart = %v, want %v", got, want)
+	}
+	if n := queries.Load(); n != 2 {
+		t.Errorf("owner() made %d queries after a restart, want the cached owner", n)
+	}
+}
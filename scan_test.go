@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func Test_runScan(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	open := ln.Addr().(*net.TCPAddr).Port
+	closed, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ports := fmt.Sprintf("%d,%d", open, closed)
+
+	tests := []struct {
+		name     string
+		args     []string
+		want     []string
+		wantCode int
+	}{
+		{
+			name: "compliant",
+			args: []string{"-target", "127.0.0.1", "-ports", ports, "-expected", fmt.Sprint(open)},
+			want: []string{fmt.Sprintf(`(?m)^%d/tcp +open`, open), `0 unexpected open, 0 unexpected closed ports`},
+		},
+		{
+			name:     "unexpected open",
+			args:     []string{"--target", "127.0.0.1", "--ports", ports, "--proto", "tcp"},
+			want:     []string{fmt.Sprintf(`(?m)^%d/tcp +unexpected`, open), `1 unexpected open, 0 unexpected closed ports`},
+			wantCode: scanDeviated,
+		},
+		{
+			name:     "unexpected closed",
+			args:     []string{"-target", "127.0.0.1", "-ports", ports, "-expected", ports},
+			want:     []string{fmt.Sprintf(`(?m)^%d/tcp +closed`, closed), `0 unexpected open, 1 unexpected closed ports`},
+			wantCode: scanDeviated,
+		},
+		{name: "no target", args: []string{"-ports", "22"}, wantCode: scanFailed},
+		{name: "invalid target", args: []string{"-target", "localhost", "-ports", "22"}, wantCode: scanFailed},
+		{name: "no ports", args: []string{"-target", "127.0.0.1"}, wantCode: scanFailed},
+		{name: "unsupported protocol", args: []string{"-target", "127.0.0.1", "-ports", "53", "-proto", "sctp"}, wantCode: scanFailed},
+		{name: "invalid expected ports", args: []string{"-target", "127.0.0.1", "-ports", "22", "-expected", "70000"}, wantCode: scanFailed},
+		{name: "invalid format", args: []string{"-target", "127.0.0.1", "-ports", "22", "-format", "xml"}, wantCode: scanFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := runScan(tt.args, &out)
+			code := scanCompliant
+			var exit *exitError
+			if errors.As(err, &exit) {
+				code = exit.code
+			} else if err != nil {
+				t.Fatalf("runScan() error = %v, want an exit error", err)
+			}
+			if code != tt.wantCode {
+				t.Fatalf("runScan() exit code = %d, want %d (error: %v)", code, tt.wantCode, err)
+			}
+			for _, want := range tt.want {
+				if !regexp.MustCompile(want).MatchString(out.String()) {
+					t.Errorf("runScan() output does not match %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+func Test_runScan_json(t *testing.T) {
+	closed, err := freePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = runScan([]string{"-target", "127.0.0.1", "-ports", fmt.Sprint(closed), "-expected", fmt.Sprint(closed), "-format", "json"}, &out)
+	var exit *exitError
+	if !errors.As(err, &exit) || exit.code != scanDeviated {
+		t.Fatalf("runScan() error = %v, want exit code %d", err, scanDeviated)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+		t.Fatalf("runScan() printed invalid JSON: %v\n%s", err, out.String())
+	}
+	want := map[string]any{
+		"ip":                "127.0.0.1",
+		"proto":             "tcp",
+		"open":              []any{},
+		"expected":          []any{fmt.Sprint(closed)},
+		"unexpected_open":   []any{},
+		"unexpected_closed": []any{fmt.Sprint(closed)},
+	}
+	for k, v := range want {
+		if !reflect.DeepEqual(got[k], v) {
+			t.Errorf("runScan() printed %s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func Test_runScan_udp(t *testing.T) {
+	// The open port answers, the silent one does not, and the closed one is
+	// refused by the kernel
+	open, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			_, addr, err := open.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			open.WriteToUDP([]byte("pong"), addr)
+		}
+	}()
+	silent, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	closed, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	openPort := open.LocalAddr().(*net.UDPAddr).Port
+	silentPort := silent.LocalAddr().(*net.UDPAddr).Port
+	closedPort := closed.LocalAddr().(*net.UDPAddr).Port
+	ports := fmt.Sprintf("%d,%d,%d", openPort, silentPort, closedPort)
+
+	var out bytes.Buffer
+	err = runScan([]string{"-target", "127.0.0.1", "-ports", ports, "-proto", "udp", "-expected", ports, "-timeout", "200ms"}, &out)
+	var exit *exitError
+	if !errors.As(err, &exit) || exit.code != scanDeviated {
+		t.Fatalf("runScan() error = %v, want exit code %d", err, scanDeviated)
+	}
+	// Expected ports which may be filtered are not reported as closed
+	for _, want := range []string{
+		fmt.Sprintf(`(?m)^%d/udp +open`, openPort),
+		fmt.Sprintf(`(?m)^%d/udp +open\|filtered`, silentPort),
+		fmt.Sprintf(`(?m)^%d/udp +closed`, closedPort),
+		`1 open, 0 unexpected open, 1 unexpected closed ports`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out.String()) {
+			t.Errorf("runScan() output does not match %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/devops-works/scan-exporter/config"
+	"github.com/devops-works/scan-exporter/logger"
+	"github.com/devops-works/scan-exporter/metrics"
+	"github.com/devops-works/scan-exporter/results"
+	"github.com/devops-works/scan-exporter/scan"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// selftestTarget is the name of the target scanned by the self-test.
+const selftestTarget = "selftest"
+
+// selftestCheck is a metric value expected at the end of the self-test. The
+// values of all the series of the metric are summed, and a metric without
+// series is worth zero.
+type selftestCheck struct {
+	metric string
+	want   float64
+}
+
+// runSelftest opens local TCP listeners, scans them through the scanner and
+// the metrics server, and verifies the exposed metrics. One of the listeners is
+// not expected, and one expected port is left closed, so that unexpected open
+// and closed ports are verified too.
+// Usage: scan-exporter selftest [-listeners <n>] [-timeout <duration>]
+func runSelftest(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	var listeners int
+	var timeout time.Duration
+	fs.IntVar(&listeners, "listeners", 3, "number of TCP listeners to scan, including an unexpected one")
+	fs.DurationVar(&timeout, "timeout", 30*time.Second, "maximum duration of the self-test")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if listeners < 2 {
+		return errors.New("at least two listeners are required")
+	}
+
+	// Open the listeners, which accept and close connections
+	var ports []string
+	for i := 0; i < listeners; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return fmt.Errorf("cannot open listener: %w", err)
+		}
+		defer ln.Close()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+		ports = append(ports, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port))
+	}
+
+	closed, err := freePort()
+	if err != nil {
+		return err
+	}
+	metricsPort, err := freePort()
+	if err != nil {
+		return err
+	}
+	metricsAddr := net.JoinHostPort("127.0.0.1", strconv.Itoa(metricsPort))
+
+	t := config.Target{Name: selftestTarget, IP: "127.0.0.1"}
+	t.TCP.Period = "1h"
+	expected := append(slices.Clone(ports[:listeners-1]), strconv.Itoa(closed))
+	t.TCP.Range = strings.Join(append(slices.Clone(ports), strconv.Itoa(closed)), ",")
+	t.TCP.Expected = strings.Join(expected, ",")
+	t.ICMP.Period = "0"
+	c := &config.Conf{Timeout: 1, Limit: 64, Targets: []config.Target{t}}
+
+	scanner := scan.Scanner{
+		Logger:  logger.New("error"),
+		Results: results.New(),
+		Version: Version,
+	}
+	scanner.MetricsServ = *metrics.Init(metricsAddr)
+	scanner.MetricsServ.Results = scanner.Results
+	scanner.MetricsServ.Version = Version
+
+	failed := make(chan error, 2)
+	go func() { failed <- scanner.MetricsServ.Start() }()
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go func() { failed <- scanner.Start(ctx, c) }()
+
+	checks := []selftestCheck{
+		{metric: "scanexporter_open_ports_total", want: float64(listeners)},
+		{metric: "scanexporter_unexpected_open_port", want: 1},
+		{metric: "scanexporter_unexpected_closed_ports_total", want: 1},
+	}
+
+	fmt.Fprintf(stdout, "scanning 127.0.0.1: ports %s expected, port %s unexpected, port %d expected but closed\n",
+		strings.Join(ports[:listeners-1], ","), ports[listeners-1], closed)
+
+	deadline := time.Now().Add(timeout)
+	var got map[string]float64
+	for {
+		select {
+		case err := <-failed:
+			return fmt.Errorf("self-test pipeline failed: %w", err)
+		default:
+		}
+
+		got, err = selftestMetrics("http://" + metricsAddr + "/metrics")
+		if err == nil && selftestPassed(checks, got) {
+			break
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	passed := selftestPassed(checks, got)
+	for _, check := range checks {
+		status := "ok"
+		if got[check.metric] != check.want {
+			status = "FAIL"
+		}
+		fmt.Fprintf(stdout, "%-4s %s = %v (want %v)\n", status, check.metric, got[check.metric], check.want)
+	}
+
+	if !passed {
+		if err != nil {
+			return fmt.Errorf("self-test failed: %w", err)
+		}
+		return errors.New("self-test failed")
+	}
+	fmt.Fprintln(stdout, "self-test passed")
+	return nil
+}
+
+// selftestPassed checks if all the metrics have their expected value.
+func selftestPassed(checks []selftestCheck, got map[string]float64) bool {
+	for _, check := range checks {
+		if got[check.metric] != check.want {
+			return false
+		}
+	}
+	return true
+}
+
+// selftestMetrics fetches the metrics of the self-test target from the metrics
+// server.
+func selftestMetrics(url string) (map[string]float64, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]float64)
+	for name, family := range families {
+		for _, m := range family.GetMetric() {
+			if selftestLabel(m, "name") == selftestTarget && m.GetGauge() != nil {
+				values[name] += m.GetGauge().GetValue()
+			}
+		}
+	}
+	return values, nil
+}
+
+// selftestLabel returns the value of a label of a metric.
+func selftestLabel(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// freePort returns a local TCP port that nothing listens on.
+func freePort() (int, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// The metrics are registered globally by metrics.Init, so the self-test can
+// only run once per test binary.
+func Test_runSelftest(t *testing.T) {
+	var out bytes.Buffer
+	if err := runSelftest([]string{"-listeners", "4", "-timeout", "20s"}, &out); err != nil {
+		t.Fatalf("runSelftest() error = %v, output:\n%s", err, out.String())
+	}
+	for _, want := range []string{
+		"ok   scanexporter_open_ports_total = 4 (want 4)",
+		"ok   scanexporter_unexpected_open_port = 1 (want 1)",
+		"ok   scanexporter_unexpected_closed_ports_total = 1 (want 1)",
+		"self-test passed",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("runSelftest() output does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func Test_runSelftest_listeners(t *testing.T) {
+	if err := runSelftest([]string{"-listeners", "1"}, &bytes.Buffer{}); err == nil {
+		t.Error("runSelftest() with a single listener should fail")
+	}
+}
@@ -0,0 +1,186 @@
+// Package services names the well-known services running on ports, using the
+// service names of the IANA registry.
+package services
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Protocols of the ports.
+const (
+	TCP = "tcp"
+	UDP = "udp"
+)
+
+// tcp holds the names of the well-known TCP services, indexed by port.
+var tcp = map[int]string{
+	20:    "ftp-data",
+	21:    "ftp",
+	22:    "ssh",
+	23:    "telnet",
+	25:    "smtp",
+	53:    "domain",
+	80:    "http",
+	88:    "kerberos",
+	110:   "pop3",
+	111:   "sunrpc",
+	119:   "nntp",
+	135:   "epmap",
+	139:   "netbios-ssn",
+	143:   "imap",
+	161:   "snmp",
+	179:   "bgp",
+	389:   "ldap",
+	443:   "https",
+	445:   "microsoft-ds",
+	465:   "submissions",
+	514:   "shell",
+	515:   "printer",
+	587:   "submission",
+	631:   "ipp",
+	636:   "ldaps",
+	873:   "rsync",
+	993:   "imaps",
+	995:   "pop3s",
+	1080:  "socks",
+	1194:  "openvpn",
+	1433:  "ms-sql-s",
+	1723:  "pptp",
+	1812:  "radius",
+	1883:  "mqtt",
+	2049:  "nfs",
+	2375:  "docker",
+	2376:  "docker-s",
+	2379:  "etcd-client",
+	2380:  "etcd-server",
+	3268:  "msft-gc",
+	3306:  "mysql",
+	3389:  "ms-wbt-server",
+	4369:  "epmd",
+	5060:  "sip",
+	5222:  "xmpp-client",
+	5432:  "postgresql",
+	5672:  "amqp",
+	5900:  "rfb",
+	5984:  "couchdb",
+	6379:  "redis",
+	8080:  "http-alt",
+	8883:  "secure-mqtt",
+	9418:  "git",
+	11211: "memcache",
+	27017: "mongodb",
+}
+
+// udp holds the names of the well-known UDP services, indexed by port.
+var udp = map[int]string{
+	53:   "domain",
+	67:   "bootps",
+	68:   "bootpc",
+	69:   "tftp",
+	88:   "kerberos",
+	111:  "sunrpc",
+	123:  "ntp",
+	137:  "netbios-ns",
+	138:  "netbios-dgm",
+	161:  "snmp",
+	162:  "snmptrap",
+	443:  "https",
+	500:  "isakmp",
+	514:  "syslog",
+	1194: "openvpn",
+	1812: "radius",
+	1813: "radius-acct",
+	2049: "nfs",
+	4500: "ipsec-nat-t",
+	5060: "sip",
+	5353: "mdns",
+}
+
+// aliases holds the other names under which the well-known services are
+// commonly known, as the aliases of /etc/services, indexed by protocol.
+var aliases = map[string]map[string]int{
+	TCP: {
+		"dns":       53,
+		"www":       80,
+		"mssql":     1433,
+		"postgres":  5432,
+		"rdp":       3389,
+		"vnc":       5900,
+		"memcached": 11211,
+	},
+	UDP: {
+		"dns": 53,
+	},
+}
+
+// ports holds the ports of the well-known services, indexed by protocol and
+// name, including their aliases.
+var ports = map[string]map[string]int{
+	TCP: byName(tcp, aliases[TCP]),
+	UDP: byName(udp, aliases[UDP]),
+}
+
+// byName indexes the ports of services by name. Names are unique in the
+// tables of the services.
+func byName(services map[int]string, aliases map[string]int) map[string]int {
+	names := make(map[string]int, len(services)+len(aliases))
+	for port, name := range services {
+		names[name] = port
+	}
+	for name, port := range aliases {
+		names[name] = port
+	}
+	return names
+}
+
+// Port returns the port of the well-known service with the given name, or one
+// of its aliases, for the given protocol. Names are case-insensitive. It
+// reports whether the service is known.
+func Port(proto, name string) (int, bool) {
+	port, ok := ports[proto][strings.ToLower(name)]
+	return port, ok
+}
+
+// Name returns the name of the well-known service running on a port of the
+// given protocol, or an empty string if it is unknown.
+func Name(proto, port string) string {
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return ""
+	}
+	switch proto {
+	case TCP:
+		return tcp[p]
+	case UDP:
+		return udp[p]
+	}
+	return ""
+}
+
+// Describe returns the port followed by the name of its well-known service,
+// such as "6379 (redis)", or the port alone if the service is unknown.
+func Describe(proto, port string) string {
+	if name := Name(proto, port); name != "" {
+		return port + " (" + name + ")"
+	}
+	return port
+}
+
+// Names returns the names of the well-known services running on the given
+// ports, indexed by port. Ports whose service is unknown are omitted, and nil
+// is returned if none is known.
+func Names(proto string, ports []string) map[string]string {
+	var names map[string]string
+	for _, port := range ports {
+		name := Name(proto, port)
+		if name == "" {
+			continue
+		}
+		if names == nil {
+			names = make(map[string]string)
+		}
+		names[port] = name
+	}
+	return names
+}
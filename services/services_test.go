@@ -0,0 +1,79 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		proto string
+		port  string
+		want  string
+	}{
+		{proto: TCP, port: "6379", want: "6379 (redis)"},
+		{proto: UDP, port: "123", want: "123 (ntp)"},
+		{proto: TCP, port: "123", want: "123"},
+		{proto: TCP, port: "65000", want: "65000"},
+		{proto: TCP, port: "http", want: "http"},
+		{proto: "sctp", port: "22", want: "22"},
+	}
+	for _, tt := range tests {
+		if got := Describe(tt.proto, tt.port); got != tt.want {
+			t.Errorf("Describe(%s, %s) = %q, want %q", tt.proto, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []string
+		want  map[string]string
+	}{
+		{name: "known", ports: []string{"22", "443", "65000"}, want: map[string]string{"22": "ssh", "443": "https"}},
+		{name: "unknown", ports: []string{"65000"}, want: nil},
+		{name: "none", ports: nil, want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Names(TCP, tt.ports); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Names() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPort(t *testing.T) {
+	tests := []struct {
+		proto  string
+		name   string
+		want   int
+		wantOk bool
+	}{
+		{proto: TCP, name: "ssh", want: 22, wantOk: true},
+		{proto: TCP, name: "HTTPS", want: 443, wantOk: true},
+		{proto: TCP, name: "postgres", want: 5432, wantOk: true},
+		{proto: TCP, name: "postgresql", want: 5432, wantOk: true},
+		{proto: TCP, name: "ms-wbt-server", want: 3389, wantOk: true},
+		{proto: UDP, name: "ntp", want: 123, wantOk: true},
+		{proto: TCP, name: "ntp"},
+		{proto: TCP, name: "22"},
+		{proto: "sctp", name: "ssh"},
+	}
+	for _, tt := range tests {
+		got, ok := Port(tt.proto, tt.name)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("Port(%s, %s) = %d, %v, want %d, %v", tt.proto, tt.name, got, ok, tt.want, tt.wantOk)
+		}
+	}
+
+	// Every service is found by its name
+	for proto, services := range map[string]map[int]string{TCP: tcp, UDP: udp} {
+		for port, name := range services {
+			if got, _ := Port(proto, name); got != port {
+				t.Errorf("Port(%s, %s) = %d, want %d", proto, name, got, port)
+			}
+		}
+	}
+}